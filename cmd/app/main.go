@@ -3,8 +3,13 @@ package main
 import (
 	"context"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/Agmer17/golang_yapping/configs"
+	"github.com/Agmer17/golang_yapping/internal/service"
+	"github.com/Agmer17/golang_yapping/internal/ws"
 	"github.com/Agmer17/golang_yapping/pkg"
 	"github.com/joho/godotenv"
 )
@@ -19,7 +24,17 @@ func main() {
 	redisUrl := os.Getenv("REDIS_URL")
 	jwtSecret := os.Getenv("JWT_SECRET")
 
-	pkg.JwtInit(jwtSecret)
+	// kalo JWT_KEYS_DIR di isi, token ditanda tangan pake key asimetris (RS256 / EdDSA)
+	// dan public key nya bisa diambil di /.well-known/jwks.json
+	jwtKeysDir := os.Getenv("JWT_KEYS_DIR")
+
+	if jwtKeysDir != "" {
+		if err := pkg.JwtInitKeys(jwtKeysDir, os.Getenv("JWT_ACTIVE_KID")); err != nil {
+			panic("gagal baca jwt key : " + err.Error())
+		}
+	} else {
+		pkg.JwtInit(jwtSecret)
+	}
 
 	// email
 	emailConfig := os.Getenv("EMAIL_CONFIG")
@@ -29,9 +44,123 @@ func main() {
 	redCtx := context.Background()
 	eventContext := context.Background()
 
-	app := configs.NewApp(ctx, dbUrl, redCtx, redisUrl, eventContext, emailConfig, emailPassword)
+	// lama waktu pesan masih bisa di edit, format nya time.ParseDuration (misal "15m")
+	// kalo kosong pake default dari service
+	var chatEditWindow time.Duration
+	if raw := os.Getenv("CHAT_EDIT_WINDOW"); raw != "" {
+		chatEditWindow, err = time.ParseDuration(raw)
+		if err != nil {
+			panic("CHAT_EDIT_WINDOW tidak valid : " + err.Error())
+		}
+	}
+
+	// url buat link aktivasi / reset password di email, token nya ditambahin di belakang
+	// (misal "https://yapping.app/reset-password" atau "https://api.yapping.app/api/auth/activate-account").
+	// wajib diisi, link nya ga pernah dibikin dari header Host request
+	authLinks := service.AuthLinkConfig{
+		ActivationURL:    os.Getenv("ACTIVATION_URL"),
+		ResetPasswordURL: os.Getenv("RESET_PASSWORD_URL"),
+	}
+
+	if err := authLinks.Validate(); err != nil {
+		panic("ACTIVATION_URL / RESET_PASSWORD_URL belum diisi : " + err.Error())
+	}
+
+	// ip / CIDR reverse proxy di depan app dipisah koma (misal "10.0.0.0/8"), cuma dari situ
+	// X-Forwarded-For dipercaya. kosong kalo app nya ga di belakang proxy
+	var trustedProxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			trustedProxies = append(trustedProxies, proxy)
+		}
+	}
+
+	// key buat enkripsi secret TOTP di db, base64 dari 32 byte random (openssl rand -base64 32).
+	// jangan diganti kalo udah ada user yang aktifin 2FA, secret lama nya ga bakal bisa dibaca lagi
+	totpSecrets, err := pkg.NewSecretBox(os.Getenv("TOTP_ENCRYPTION_KEY"))
+	if err != nil {
+		panic("TOTP_ENCRYPTION_KEY tidak valid : " + err.Error())
+	}
+
+	app := configs.NewApp(ctx, dbUrl, redCtx, redisUrl, eventContext, emailConfig, emailPassword, loadOidcProviders(), chatEditWindow, loadWsConfig(), authLinks, trustedProxies, totpSecrets)
 
 	defer app.Shutdown()
 
 	app.Run()
 }
+
+// WS_BACKPLANE "redis" kalo app nya dijalanin lebih dari satu instance, payload websocket disebar lewat redis pub/sub.
+// WS_QUEUE_SIZE jumlah payload yang boleh ngantri per koneksi, WS_SLOW_CONSUMER_POLICY
+// isinya drop_oldest, coalesce atau disconnect. WS_ALLOWED_ORIGINS origin browser yang boleh konek
+// dipisah koma (misal "https://yapping.app"). semua nya boleh kosong
+func loadWsConfig() configs.WsConfig {
+
+	cfg := configs.WsConfig{
+		Backplane: os.Getenv("WS_BACKPLANE"),
+	}
+
+	if cfg.Backplane != "" && cfg.Backplane != configs.WsBackplaneRedis {
+		panic("WS_BACKPLANE tidak valid : " + cfg.Backplane)
+	}
+
+	if raw := os.Getenv("WS_QUEUE_SIZE"); raw != "" {
+		size, err := strconv.Atoi(raw)
+		if err != nil || size <= 0 {
+			panic("WS_QUEUE_SIZE tidak valid : " + raw)
+		}
+		cfg.QueueSize = size
+	}
+
+	if raw := os.Getenv("WS_SLOW_CONSUMER_POLICY"); raw != "" {
+		policy, err := ws.ParseSlowConsumerPolicy(raw)
+		if err != nil {
+			panic("WS_SLOW_CONSUMER_POLICY tidak valid : " + err.Error())
+		}
+		cfg.SlowConsumerPolicy = policy
+	}
+
+	for _, origin := range strings.Split(os.Getenv("WS_ALLOWED_ORIGINS"), ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			cfg.AllowedOrigins = append(cfg.AllowedOrigins, origin)
+		}
+	}
+
+	return cfg
+}
+
+// OIDC_PROVIDERS isinya nama provider dipisah koma, misal "google,gitlab".
+// tiap provider butuh OIDC_<NAMA>_ISSUER, OIDC_<NAMA>_CLIENT_ID, OIDC_<NAMA>_CLIENT_SECRET
+// dan OIDC_<NAMA>_REDIRECT_URL (.../api/auth/oidc/<nama>/callback)
+func loadOidcProviders() []pkg.OidcProviderConfig {
+
+	var providers []pkg.OidcProviderConfig
+
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.TrimSpace(strings.ToLower(name))
+		if name == "" {
+			continue
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+
+		cfg := pkg.OidcProviderConfig{
+			Name:         name,
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientId:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  os.Getenv(prefix + "REDIRECT_URL"),
+		}
+
+		if scopes := os.Getenv(prefix + "SCOPES"); scopes != "" {
+			cfg.Scopes = strings.Fields(scopes)
+		}
+
+		if cfg.Issuer == "" || cfg.ClientId == "" || cfg.RedirectURL == "" {
+			panic("konfigurasi OIDC provider " + name + " belum lengkap")
+		}
+
+		providers = append(providers, cfg)
+	}
+
+	return providers
+}
@@ -2,7 +2,10 @@ package configs
 
 import (
 	"context"
+	"time"
 
+	"github.com/Agmer17/golang_yapping/internal/service"
+	"github.com/Agmer17/golang_yapping/pkg"
 	"github.com/gin-gonic/gin"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/redis/go-redis/v9"
@@ -23,6 +26,12 @@ func NewApp(
 	EventContext context.Context,
 	EmailSmtp string,
 	EmailPassword string,
+	OidcProviders []pkg.OidcProviderConfig,
+	ChatEditWindow time.Duration,
+	Ws WsConfig,
+	AuthLinks service.AuthLinkConfig,
+	TrustedProxies []string,
+	TotpSecrets *pkg.SecretBox,
 ) *App {
 
 	pool, err := SetUpDatabase(ctx, dbUrl)
@@ -33,8 +42,8 @@ func NewApp(
 		panic(err)
 	}
 
-	svc := NewServiceConfigs(pool, rdb, EmailSmtp, EmailPassword, EventContext)
-	r := SetUpRouter(pool, rdb, svc)
+	svc := NewServiceConfigs(pool, rdb, EmailSmtp, EmailPassword, EventContext, OidcProviders, ChatEditWindow, Ws, AuthLinks, TotpSecrets)
+	r := SetUpRouter(pool, rdb, svc, TrustedProxies)
 
 	return &App{
 		DB:      pool,
@@ -9,33 +9,61 @@ import (
 	"github.com/redis/go-redis/v9"
 )
 
-func SetUpRouter(p *pgxpool.Pool, r *redis.Client, svc *serviceConfigs) *gin.Engine {
+// trustedProxies ip / CIDR reverse proxy di depan server, cuma dari situ X-Forwarded-For dipercaya.
+// kosong berarti server nya langsung diakses client, ClientIP nya selalu dari alamat koneksi
+func SetUpRouter(p *pgxpool.Pool, r *redis.Client, svc *serviceConfigs, trustedProxies []string) *gin.Engine {
 
-	authHandler := handlers.NewAuthHandler(svc.AuthService)
+	limiter := middleware.NewRateLimiter(middleware.NewRedisRateLimitStore(r))
+
+	authHandler := handlers.NewAuthHandler(svc.AuthService, limiter)
 	verificationRoute := handlers.NewVerificationHandler(svc.VerificationService)
+	jwksHandler := handlers.NewJwksHandler()
+	oidcHandler := handlers.NewOidcHandler(svc.OidcService, limiter)
 
 	// ------------------- PROTECTED --------------------
 	userHandler := handlers.NewUserHandler(svc.UserService)
-	wsHandler := handlers.NewWebsocketHandler(svc.Hub)
-	chatHandler := handlers.NewChatHandler(svc.ChatService)
+	wsHandler := handlers.NewWebsocketHandler(svc.Hub, svc.WsAuthService, svc.WsAllowedOrigins, limiter)
+	chatHandler := handlers.NewChatHandler(svc.ChatService, limiter)
+	groupHandler := handlers.NewGroupHandler(svc.GroupService, limiter)
+	presenceHandler := handlers.NewPresenceHandler(svc.PresenceService, limiter)
+	twoFactorHandler := handlers.NewTwoFactorHandler(svc.TwoFactorService, limiter)
 	// --------------------------------------------------
 
 	server := gin.Default()
+
+	// default nya gin percaya semua proxy, X-Forwarded-For palsu bisa dipake buat ngakalin
+	// rate limit sama lockout login per ip
+	if len(trustedProxies) == 0 {
+		trustedProxies = nil
+	}
+
+	if err := server.SetTrustedProxies(trustedProxies); err != nil {
+		panic("TRUSTED_PROXIES tidak valid : " + err.Error())
+	}
+
 	server.Use(cors.Default())
 
+	jwksHandler.RegisterRoutes(server.Group("/"))
+
 	api := server.Group("/api")
 	api.Static("/uploads", svc.FileService.Public)
 
 	authHandler.RegisterRoutes(api)
+	oidcHandler.RegisterRoutes(api)
 	verificationRoute.RegisterRoutes(api)
+	wsHandler.RegisterRoutes(api)
 
 	// ============= PROTECTED ========================
 	protected := api.Group("/")
 
-	protected.Use(middleware.AuthMiddleware())
+	protected.Use(middleware.AuthMiddleware(svc.TokenRevocation))
+	authHandler.RegisterProtectedRoutes(protected)
+	twoFactorHandler.RegisterRoutes(protected)
 	userHandler.RegisterRoutes(protected)
-	wsHandler.RegisterRoutes(protected)
+	wsHandler.RegisterProtectedRoutes(protected)
 	chatHandler.RegisterRoutes(protected)
+	groupHandler.RegisterRoutes(protected)
+	presenceHandler.RegisterRoutes(protected)
 
 	return server
 
@@ -2,6 +2,7 @@ package configs
 
 import (
 	"context"
+	"time"
 
 	"github.com/Agmer17/golang_yapping/internal/event"
 	"github.com/Agmer17/golang_yapping/internal/repository"
@@ -12,6 +13,20 @@ import (
 	"github.com/redis/go-redis/v9"
 )
 
+const WsBackplaneRedis = "redis"
+
+type WsConfig struct {
+	// WsBackplaneRedis kalo app nya jalan lebih dari satu instance, kosong berarti single node
+	Backplane string
+
+	// 0 / kosong pake default dari package ws
+	QueueSize          int
+	SlowConsumerPolicy ws.SlowConsumerPolicy
+
+	// origin browser yang boleh konek, kosong berarti cuma yang host nya sama kayak server
+	AllowedOrigins []string
+}
+
 type serviceConfigs struct {
 	AuthService         *service.AuthService
 	ChatService         *service.ChatService
@@ -19,6 +34,14 @@ type serviceConfigs struct {
 	FileService         *service.FileStorage
 	Hub                 *ws.Hub
 	VerificationService *service.VerificationService
+	TokenRevocation     *service.TokenRevocation
+	TwoFactorService    *service.TwoFactorService
+	OidcService         *service.OidcService
+	GroupService        *service.GroupService
+	PresenceService     *service.PresenceService
+	WsAuthService       *service.WsAuthService
+
+	WsAllowedOrigins []string
 
 	EmailService *pkg.MailSender
 
@@ -32,13 +55,37 @@ func NewServiceConfigs(
 	email string,
 	emailPw string,
 	eventContext context.Context,
+	oidcProviders []pkg.OidcProviderConfig,
+	chatEditWindow time.Duration,
+	wsConfig WsConfig,
+	authLinks service.AuthLinkConfig,
+	totpSecrets *pkg.SecretBox,
 ) *serviceConfigs {
-	hub := ws.NewHub()
+	var backplane ws.Backplane
+	var presence ws.PresenceStore
+	if wsConfig.Backplane == WsBackplaneRedis {
+		backplane = ws.NewRedisBackplane(eventContext, r)
+		presence = ws.NewRedisPresence(eventContext, r)
+	}
+
+	hub := ws.NewHub(backplane, ws.NewRedisEventLog(eventContext, r), presence)
+
+	if wsConfig.QueueSize > 0 {
+		hub.Queue.Size = wsConfig.QueueSize
+	}
+
+	if wsConfig.SlowConsumerPolicy != "" {
+		hub.Queue.Policy = wsConfig.SlowConsumerPolicy
+	}
 
 	userRepo := repository.NewUserRepo(pool)
 	chatRepo := repository.NewChatRepo(pool)
 	chatAttachmentRepo := repository.NewChatAttachmentRepo(pool)
 	VerifcationRepo := repository.NewVerificationRepo(pool)
+	twoFactorRepo := repository.NewTwoFactorRepo(pool)
+	linkedIdentityRepo := repository.NewLinkedIdentityRepo(pool)
+	conversationRepo := repository.NewConversationRepo(pool)
+	presenceRepo := repository.NewPresenceRepo(pool)
 
 	// email sender
 	emailService, err := pkg.NewMailSender(email, emailPw)
@@ -54,12 +101,18 @@ func NewServiceConfigs(
 	// setup event bus disini!
 	event.SetupEvent(eventBus)
 
-	authService := service.NewAuthService(userRepo, r, eventBus)
+	verificationService := service.NewVerificationService(VerifcationRepo, r)
+	tokenRevocation := service.NewTokenRevocation(r)
+	twoFactorService := service.NewTwoFactorService(twoFactorRepo, userRepo, r, totpSecrets)
+	authService := service.NewAuthService(userRepo, r, eventBus, verificationService, tokenRevocation, twoFactorService, authLinks)
+	oidcService := service.NewOidcService(oidcProviders, linkedIdentityRepo, userRepo, r, authService)
 	userService := service.NewUserService(userRepo)
 
 	fileService := service.NewFileService()
-	chatService := service.NewChatService(chatRepo, hub, userService, chatAttachmentRepo, fileService, r, eventBus)
-	verificationService := service.NewVerificationService(VerifcationRepo, r)
+	chatService := service.NewChatService(chatRepo, hub, userService, chatAttachmentRepo, fileService, r, eventBus, conversationRepo, chatEditWindow)
+	groupService := service.NewGroupService(conversationRepo, chatService, fileService, eventBus)
+	presenceService := service.NewPresenceService(presenceRepo, hub, eventBus, r, eventContext)
+	wsAuthService := service.NewWsAuthService(r, tokenRevocation, hub)
 
 	return &serviceConfigs{
 		AuthService:         authService,
@@ -70,6 +123,13 @@ func NewServiceConfigs(
 		EmailService:        emailService,
 		EventBus:            eventBus,
 		VerificationService: verificationService,
+		TokenRevocation:     tokenRevocation,
+		TwoFactorService:    twoFactorService,
+		OidcService:         oidcService,
+		GroupService:        groupService,
+		PresenceService:     presenceService,
+		WsAuthService:       wsAuthService,
+		WsAllowedOrigins:    wsConfig.AllowedOrigins,
 	}
 
 }
@@ -14,7 +14,12 @@ require (
 	golang.org/x/crypto v0.44.0
 )
 
-require github.com/wneessen/go-mail v0.7.2 // indirect
+require (
+	github.com/alicebob/miniredis/v2 v2.39.0
+	github.com/wneessen/go-mail v0.7.2
+)
+
+require github.com/yuin/gopher-lua v1.1.1 // indirect
 
 require (
 	github.com/bytedance/sonic v1.14.0 // indirect
@@ -47,7 +52,7 @@ require (
 	golang.org/x/arch v0.20.0 // indirect
 	golang.org/x/mod v0.29.0 // indirect
 	golang.org/x/net v0.46.0 // indirect
-	golang.org/x/sync v0.18.0 // indirect
+	golang.org/x/sync v0.18.0
 	golang.org/x/sys v0.38.0 // indirect
 	golang.org/x/text v0.31.0 // indirect
 	golang.org/x/tools v0.38.0 // indirect
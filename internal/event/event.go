@@ -1,9 +1,15 @@
 package event
 
 const NewUserCreated = "user.created"
+const VerificationResend = "user.verification.resend"
+const PasswordResetRequested = "user.password.reset"
+const AccountLocked = "user.account.locked"
 const WsEventSendPayload = "ws.send.payload"
 
 func SetupEvent(bus *EventBus) {
 	bus.Subscribe(NewUserCreated, SendVerificationEmail(bus.EmailService))
+	bus.Subscribe(VerificationResend, SendVerificationEmail(bus.EmailService))
+	bus.Subscribe(PasswordResetRequested, SendPasswordResetEmail(bus.EmailService))
+	bus.Subscribe(AccountLocked, SendAccountLockedEmail(bus.EmailService))
 	bus.Subscribe(WsEventSendPayload, sendPayload(bus.Hub))
 }
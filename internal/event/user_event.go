@@ -14,6 +14,19 @@ type NewUserEvent struct {
 	ActivationLink string
 }
 
+type PasswordResetEvent struct {
+	Email     string
+	Username  string
+	ResetLink string
+}
+
+type AccountLockedEvent struct {
+	Email     string
+	Username  string
+	Ip        string
+	LockedFor time.Duration
+}
+
 func SendVerificationEmail(
 	emailSender *pkg.MailSender,
 ) EventHandler {
@@ -32,3 +45,50 @@ func SendVerificationEmail(
 	}
 
 }
+
+func SendPasswordResetEmail(
+	emailSender *pkg.MailSender,
+) EventHandler {
+
+	return func(rootCtx context.Context, payload interface{}) {
+		eventData := payload.(PasswordResetEvent)
+		eventCtx, eventCancel := context.WithTimeout(rootCtx, 15*time.Second)
+
+		defer eventCancel()
+
+		err := emailSender.SendEmail(eventCtx, eventData.Email, "Reset password akun yapping", eventData.ResetLink)
+
+		if err != nil {
+			fmt.Println("ERROR :" + err.Error())
+		}
+	}
+
+}
+
+func SendAccountLockedEmail(
+	emailSender *pkg.MailSender,
+) EventHandler {
+
+	return func(rootCtx context.Context, payload interface{}) {
+		eventData := payload.(AccountLockedEvent)
+		eventCtx, eventCancel := context.WithTimeout(rootCtx, 15*time.Second)
+
+		defer eventCancel()
+
+		body := fmt.Sprintf(
+			"Halo %s, kami mendeteksi beberapa percobaan login gagal ke akun kamu dari IP %s. "+
+				"Demi keamanan, login ke akun kamu dikunci sementara dan akan terbuka otomatis dalam %s. "+
+				"Kalau ini bukan kamu, segera ganti password lewat fitur lupa password.",
+			eventData.Username,
+			eventData.Ip,
+			eventData.LockedFor.Round(time.Second),
+		)
+
+		err := emailSender.SendEmail(eventCtx, eventData.Email, "Akun yapping dikunci sementara", body)
+
+		if err != nil {
+			fmt.Println("ERROR :" + err.Error())
+		}
+	}
+
+}
@@ -2,7 +2,6 @@ package event
 
 import (
 	"context"
-	"encoding/json"
 
 	"github.com/Agmer17/golang_yapping/internal/ws"
 )
@@ -14,9 +13,8 @@ func sendPayload(
 	return func(rootCtx context.Context, payload interface{}) {
 
 		data := payload.(ws.WebsocketEvent)
-		wsEventByte, _ := json.Marshal(data)
 
-		hub.SendPayloadTo(data.Receiver, wsEventByte)
+		hub.SendEvent(data)
 
 	}
 
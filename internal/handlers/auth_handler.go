@@ -5,10 +5,12 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/Agmer17/golang_yapping/internal/middleware"
 	"github.com/Agmer17/golang_yapping/internal/service"
 	"github.com/Agmer17/golang_yapping/pkg"
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
 )
 
 type loginRequest struct {
@@ -16,6 +18,11 @@ type loginRequest struct {
 	Password string `json:"password" binding:"required"`
 }
 
+type loginTwoFactorRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Code           string `json:"code" binding:"required"`
+}
+
 type SignUpRequest struct {
 	Username string `json:"username" binding:"required,min=4,max=150"`
 	Email    string `json:"email" binding:"required,email"`
@@ -23,13 +30,38 @@ type SignUpRequest struct {
 	Password string `json:"password" binding:"required,min=5,max=150"`
 }
 
+type resendActivationRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type forgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type resetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,min=5,max=150"`
+}
+
+// route publik ke limit per ip, yang lewat AuthMiddleware per user
+var (
+	loginRateLimit         = middleware.RateLimitPolicy{Name: "auth-login", Limit: 10, Window: time.Minute}
+	signUpRateLimit        = middleware.RateLimitPolicy{Name: "auth-sign-up", Limit: 5, Window: time.Hour}
+	refreshRateLimit       = middleware.RateLimitPolicy{Name: "auth-refresh", Limit: 30, Window: time.Minute}
+	verificationRateLimit  = middleware.RateLimitPolicy{Name: "auth-verification", Limit: 5, Window: time.Hour}
+	resetPasswordRateLimit = middleware.RateLimitPolicy{Name: "auth-reset-password", Limit: 10, Window: time.Hour}
+	sessionManageRateLimit = middleware.RateLimitPolicy{Name: "auth-sessions", Limit: 30, Window: time.Minute}
+)
+
 type AuthHandler struct {
 	Service service.AuthServiceInterface
+	limiter *middleware.RateLimiter
 }
 
-func NewAuthHandler(svc *service.AuthService) *AuthHandler {
+func NewAuthHandler(svc *service.AuthService, limiter *middleware.RateLimiter) *AuthHandler {
 	return &AuthHandler{
 		Service: svc,
+		limiter: limiter,
 	}
 }
 
@@ -38,10 +70,29 @@ func (h *AuthHandler) RegisterRoutes(rg *gin.RouterGroup) {
 	auth := rg.Group("/auth")
 
 	{
-		auth.POST("/login", h.handleLogin)
-		auth.POST("/sign-up", h.handleSignUp)
-		auth.GET("/refresh-session", h.refreshSession)
-		auth.GET("/activate-account/:token", h.handleActivateAccount)
+		auth.POST("/login", h.limiter.Limit(loginRateLimit), h.handleLogin)
+		auth.POST("/login/2fa", h.limiter.Limit(loginRateLimit), h.handleLoginTwoFactor)
+		auth.POST("/sign-up", h.limiter.Limit(signUpRateLimit), h.handleSignUp)
+		auth.GET("/refresh-session", h.limiter.Limit(refreshRateLimit), h.refreshSession)
+		auth.GET("/activate-account/:token", h.limiter.Limit(resetPasswordRateLimit), h.handleActivateAccount)
+		auth.POST("/resend-activation", h.limiter.Limit(verificationRateLimit), h.handleResendActivation)
+		auth.POST("/forgot-password", h.limiter.Limit(verificationRateLimit), h.handleForgotPassword)
+		auth.GET("/reset-password/:token", h.limiter.Limit(resetPasswordRateLimit), h.handleCheckResetToken)
+		auth.POST("/reset-password", h.limiter.Limit(resetPasswordRateLimit), h.handleResetPassword)
+		auth.POST("/logout", h.handleLogout)
+	}
+
+}
+
+// route auth yang butuh access token, dipasang di group yang udah pake AuthMiddleware
+func (h *AuthHandler) RegisterProtectedRoutes(rg *gin.RouterGroup) {
+
+	auth := rg.Group("/auth")
+
+	{
+		auth.POST("/logout-all", h.limiter.Limit(sessionManageRateLimit), h.handleLogoutAll)
+		auth.GET("/sessions", h.limiter.Limit(sessionManageRateLimit), h.handleGetSessions)
+		auth.DELETE("/sessions/:id", h.limiter.Limit(sessionManageRateLimit), h.handleRevokeSession)
 	}
 
 }
@@ -57,13 +108,61 @@ func (h *AuthHandler) handleLogin(c *gin.Context) {
 		return
 	}
 
-	resp, serviceErr := h.Service.LoginService(rBind.Username, rBind.Password, c.Request.Context())
+	meta := service.SessionMeta{
+		UserAgent: c.Request.UserAgent(),
+		Ip:        c.ClientIP(),
+	}
+
+	resp, serviceErr := h.Service.LoginService(rBind.Username, rBind.Password, meta, c.Request.Context())
 	if serviceErr != nil {
-		c.JSON(serviceErr.Code, gin.H{"error": serviceErr.Message})
+		writeServiceError(c, serviceErr)
 		c.Abort()
 		return
 	}
 
+	writeLoginOrChallenge(c, resp)
+}
+
+// kalo user pake 2FA yang dikirim challenge token nya dulu, bukan access token
+func writeLoginOrChallenge(c *gin.Context, resp service.ResponseSchema) {
+
+	if required, _ := resp["twoFactorRequired"].(bool); required {
+		c.JSON(http.StatusOK, gin.H{
+			"message":             resp["message"],
+			"two_factor_required": true,
+			"challenge_token":     resp["challengeToken"],
+		})
+		return
+	}
+
+	writeLoginResponse(c, resp)
+}
+
+func (h *AuthHandler) handleLoginTwoFactor(c *gin.Context) {
+
+	var rBind loginTwoFactorRequest
+
+	if err := c.ShouldBindJSON(&rBind); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "bad request! isi data degan benar"})
+		return
+	}
+
+	meta := service.SessionMeta{
+		UserAgent: c.Request.UserAgent(),
+		Ip:        c.ClientIP(),
+	}
+
+	resp, serviceErr := h.Service.CompleteTwoFactorLogin(rBind.ChallengeToken, rBind.Code, meta, c.Request.Context())
+	if serviceErr != nil {
+		writeServiceError(c, serviceErr)
+		return
+	}
+
+	writeLoginResponse(c, resp)
+}
+
+func writeLoginResponse(c *gin.Context, resp service.ResponseSchema) {
+
 	sevenDays := time.Hour * 24 * 7
 
 	c.SetCookie("refreshToken",
@@ -99,7 +198,7 @@ func (h *AuthHandler) handleSignUp(c *gin.Context) {
 
 	}
 
-	resp, customErr := h.Service.SignUp(sBind.Username, sBind.Email, sBind.Fullname, sBind.Password, c.Request.Host, c.Request.Context())
+	resp, customErr := h.Service.SignUp(sBind.Username, sBind.Email, sBind.Fullname, sBind.Password, c.Request.Context())
 	if customErr != nil {
 		c.JSON(customErr.Code, gin.H{"error": customErr.Message})
 		c.Abort()
@@ -121,9 +220,13 @@ func (h *AuthHandler) refreshSession(c *gin.Context) {
 		return
 	}
 
-	accessToken, serviceErr := h.Service.RefreshSession(refreshToken, c.Request.Context())
+	resp, serviceErr := h.Service.RefreshSession(refreshToken, c.Request.Context())
 
 	if serviceErr != nil {
+		if serviceErr.Code == http.StatusUnauthorized {
+			c.SetCookie("refreshToken", "", -1, "/", "", true, true)
+		}
+
 		c.JSON(serviceErr.Code, gin.H{
 			"error": serviceErr.Message,
 		})
@@ -131,7 +234,19 @@ func (h *AuthHandler) refreshSession(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, accessToken)
+	sevenDays := time.Hour * 24 * 7
+
+	c.SetCookie("refreshToken",
+		resp["refreshToken"].(string),
+		int(sevenDays), "/",
+		"",
+		true,
+		true)
+
+	c.JSON(http.StatusOK, gin.H{
+		"accessToken": resp["accessToken"],
+		"id":          resp["id"],
+	})
 }
 
 func (h *AuthHandler) handleActivateAccount(c *gin.Context) {
@@ -146,6 +261,186 @@ func (h *AuthHandler) handleActivateAccount(c *gin.Context) {
 
 	}
 
-	// todo : impl ngecek tokennya mas
+	svcErr := h.Service.ActivateAccount(token, c.Request.Context())
+	if svcErr != nil {
+		c.JSON(svcErr.Code, gin.H{"error": svcErr.Message})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "akun berhasil diaktifkan, silahkan login",
+	})
+
+}
+
+func (h *AuthHandler) handleResendActivation(c *gin.Context) {
+
+	var rBind resendActivationRequest
+
+	if err := c.ShouldBindJSON(&rBind); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "bad request! isi data degan benar"})
+		return
+	}
+
+	svcErr := h.Service.ResendActivation(rBind.Email, c.Request.Context())
+	if svcErr != nil {
+		writeServiceError(c, svcErr)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "jika email terdaftar dan belum aktif, link aktivasi baru sudah dikirim ke email kamu",
+	})
+}
+
+func (h *AuthHandler) handleForgotPassword(c *gin.Context) {
 
+	var rBind forgotPasswordRequest
+
+	if err := c.ShouldBindJSON(&rBind); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "bad request! isi data degan benar"})
+		return
+	}
+
+	svcErr := h.Service.ForgotPassword(rBind.Email, c.Request.Context())
+	if svcErr != nil {
+		writeServiceError(c, svcErr)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "jika email terdaftar, link reset password sudah dikirim ke email kamu",
+	})
+}
+
+// link di email reset password, cuma ngecek token nya. password baru nya dikirim lewat POST /reset-password
+func (h *AuthHandler) handleCheckResetToken(c *gin.Context) {
+
+	svcErr := h.Service.CheckResetToken(c.Param("token"), c.Request.Context())
+	if svcErr != nil {
+		writeServiceError(c, svcErr)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "token valid, silahkan kirim password baru",
+	})
+}
+
+func (h *AuthHandler) handleResetPassword(c *gin.Context) {
+
+	var rBind resetPasswordRequest
+
+	if err := c.ShouldBindJSON(&rBind); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "bad request! isi data degan benar"})
+		return
+	}
+
+	svcErr := h.Service.ResetPassword(rBind.Token, rBind.Password, c.Request.Context())
+	if svcErr != nil {
+		c.JSON(svcErr.Code, gin.H{"error": svcErr.Message})
+		return
+	}
+
+	c.SetCookie("refreshToken", "", -1, "/", "", true, true)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "password berhasil diganti, silahkan login ulang",
+	})
+}
+
+func (h *AuthHandler) handleLogout(c *gin.Context) {
+
+	refreshToken, _ := c.Cookie("refreshToken")
+	accessToken, _ := pkg.GetAccessToken(c.GetHeader("Authorization"))
+
+	svcErr := h.Service.Logout(refreshToken, accessToken, c.Request.Context())
+	if svcErr != nil {
+		c.JSON(svcErr.Code, gin.H{"error": svcErr.Message})
+		return
+	}
+
+	c.SetCookie("refreshToken", "", -1, "/", "", true, true)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "berhasil logout",
+	})
+}
+
+func (h *AuthHandler) handleLogoutAll(c *gin.Context) {
+
+	val, ok := c.Get("userId")
+	if !ok {
+		c.JSON(401, gin.H{
+			"error": "harap login sebelum mengakses ini!",
+		})
+		return
+	}
+
+	userId := val.(uuid.UUID)
+
+	svcErr := h.Service.LogoutAll(userId, c.Request.Context())
+	if svcErr != nil {
+		c.JSON(svcErr.Code, gin.H{"error": svcErr.Message})
+		return
+	}
+
+	c.SetCookie("refreshToken", "", -1, "/", "", true, true)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "berhasil logout dari semua perangkat",
+	})
+}
+
+func (h *AuthHandler) handleGetSessions(c *gin.Context) {
+
+	val, ok := c.Get("userId")
+	if !ok {
+		c.JSON(401, gin.H{
+			"error": "harap login sebelum mengakses ini!",
+		})
+		return
+	}
+
+	userId := val.(uuid.UUID)
+	currentSession := c.GetString("sessionId")
+
+	data, svcErr := h.Service.GetSessions(userId, currentSession, c.Request.Context())
+	if svcErr != nil {
+		c.JSON(svcErr.Code, gin.H{"error": svcErr.Message})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "berhasil mengambil data!",
+		"data":    data,
+	})
+}
+
+func (h *AuthHandler) handleRevokeSession(c *gin.Context) {
+
+	val, ok := c.Get("userId")
+	if !ok {
+		c.JSON(401, gin.H{
+			"error": "harap login sebelum mengakses ini!",
+		})
+		return
+	}
+
+	userId := val.(uuid.UUID)
+	sessionId := c.Param("id")
+
+	svcErr := h.Service.RevokeSession(userId, sessionId, c.Request.Context())
+	if svcErr != nil {
+		c.JSON(svcErr.Code, gin.H{"error": svcErr.Message})
+		return
+	}
+
+	if sessionId == c.GetString("sessionId") {
+		c.SetCookie("refreshToken", "", -1, "/", "", true, true)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "sesi berhasil dihapus",
+	})
 }
@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"mime/multipart"
 	"net/http"
+	"time"
 
+	"github.com/Agmer17/golang_yapping/internal/middleware"
 	"github.com/Agmer17/golang_yapping/internal/service"
 	"github.com/gin-gonic/gin"
 	"github.com/gin-gonic/gin/binding"
@@ -13,8 +15,18 @@ import (
 
 const MaxFileSizes = 5 << 20
 
+// route chat udah lewat AuthMiddleware jadi limit nya per user
+var (
+	postChatRateLimit = middleware.RateLimitPolicy{Name: "chat-post", Limit: 30, Window: time.Minute}
+	readChatRateLimit = middleware.RateLimitPolicy{Name: "chat-read", Limit: 120, Window: time.Minute}
+
+	// query search lebih berat dari baca chat biasa
+	searchChatRateLimit = middleware.RateLimitPolicy{Name: "chat-search", Limit: 30, Window: time.Minute}
+)
+
 type ChatHandler struct {
-	svc service.ChatServiceInterface
+	svc     service.ChatServiceInterface
+	limiter *middleware.RateLimiter
 }
 
 type PostChatRequest struct {
@@ -25,9 +37,41 @@ type PostChatRequest struct {
 	MediaFiles []*multipart.FileHeader `form:"chat_media"`
 }
 
-func NewChatHandler(svc *service.ChatService) *ChatHandler {
+// before / after isinya cursor dari paging response sebelumnya, around isinya chat id
+type chatPageRequest struct {
+	Before string `form:"before"`
+	After  string `form:"after"`
+	Around string `form:"around" binding:"omitempty,uuid"`
+	Limit  int    `form:"limit" binding:"omitempty,min=1,max=100"`
+}
+
+// from / to format nya YYYY-MM-DD, to ikut dihitung sampe akhir hari
+type searchChatRequest struct {
+	Query         string     `form:"q" binding:"required"`
+	Partner       string     `form:"partner" binding:"omitempty,uuid"`
+	From          *time.Time `form:"from" time_format:"2006-01-02" time_utc:"1"`
+	To            *time.Time `form:"to" time_format:"2006-01-02" time_utc:"1"`
+	HasAttachment *bool      `form:"has_attachment"`
+	Before        string     `form:"before"`
+	Limit         int        `form:"limit" binding:"omitempty,min=1,max=100"`
+}
+
+type editChatRequest struct {
+	ChatText string `json:"chat_text" binding:"required"`
+}
+
+type reactionRequest struct {
+	Emoji string `json:"emoji" binding:"required"`
+}
+
+type markAsReadRequest struct {
+	UpTo string `json:"up_to" binding:"required,uuid"`
+}
+
+func NewChatHandler(svc *service.ChatService, limiter *middleware.RateLimiter) *ChatHandler {
 	return &ChatHandler{
-		svc: svc,
+		svc:     svc,
+		limiter: limiter,
 	}
 }
 
@@ -36,11 +80,19 @@ func (chat *ChatHandler) RegisterRoutes(rg *gin.RouterGroup) {
 	chatEndpoint := rg.Group("/chat")
 
 	{
-		chatEndpoint.POST("/post-message", chat.PostChat)
-		chatEndpoint.GET("/beetween/:receiver", chat.GetChatBeetween)
-		chatEndpoint.GET("/attachment/:token", chat.GetChatAttachment)
-		chatEndpoint.GET("/latest", chat.GetLatestChat)
-		chatEndpoint.DELETE("/delete/:chatId", chat.DeleteChat)
+		chatEndpoint.POST("/post-message", chat.limiter.Limit(postChatRateLimit), chat.PostChat)
+		chatEndpoint.GET("/beetween/:receiver", chat.limiter.Limit(readChatRateLimit), chat.GetChatBeetween)
+		chatEndpoint.GET("/attachment/:token", chat.limiter.Limit(readChatRateLimit), chat.GetChatAttachment)
+		chatEndpoint.GET("/latest", chat.limiter.Limit(readChatRateLimit), chat.GetLatestChat)
+		chatEndpoint.DELETE("/delete/:chatId", chat.limiter.Limit(postChatRateLimit), chat.DeleteChat)
+		chatEndpoint.POST("/read/:partner", chat.limiter.Limit(readChatRateLimit), chat.MarkAsRead)
+		chatEndpoint.GET("/unread", chat.limiter.Limit(readChatRateLimit), chat.GetUnreadSummary)
+		chatEndpoint.GET("/search", chat.limiter.Limit(searchChatRateLimit), chat.SearchChats)
+		chatEndpoint.PATCH("/:chatId", chat.limiter.Limit(postChatRateLimit), chat.EditChat)
+		chatEndpoint.GET("/:chatId/edits", chat.limiter.Limit(readChatRateLimit), chat.GetChatEdits)
+		chatEndpoint.GET("/:chatId/reactions", chat.limiter.Limit(readChatRateLimit), chat.GetReactions)
+		chatEndpoint.POST("/:chatId/reactions", chat.limiter.Limit(postChatRateLimit), chat.AddReaction)
+		chatEndpoint.DELETE("/:chatId/reactions/:emoji", chat.limiter.Limit(postChatRateLimit), chat.RemoveReaction)
 	}
 
 }
@@ -116,12 +168,32 @@ func (chat *ChatHandler) GetChatBeetween(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error": "parameter tidak valid! harap masukan parameter dengan benar",
 		})
+		return
 	}
 
-	data, svcErr := chat.svc.GetChatBeetween(c.Request.Context(), receiverId, senderId)
+	var q chatPageRequest
+	if err := c.ShouldBindQuery(&q); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "parameter tidak valid! harap masukan parameter dengan benar",
+		})
+		return
+	}
+
+	pageInput := service.ChatPageInput{
+		Before: q.Before,
+		After:  q.After,
+		Limit:  q.Limit,
+	}
+
+	if q.Around != "" {
+		around, _ := uuid.Parse(q.Around)
+		pageInput.Around = &around
+	}
+
+	data, svcErr := chat.svc.GetChatBeetween(c.Request.Context(), receiverId, senderId, pageInput)
 	if svcErr != nil {
-		c.JSON(http.StatusNotFound, gin.H{
-			"error": "chat atau user tidak ditemukan! " + svcErr.Message,
+		c.JSON(svcErr.Code, gin.H{
+			"error": svcErr.Message,
 		})
 		return
 	}
@@ -183,8 +255,14 @@ func (chat *ChatHandler) GetLatestChat(c *gin.Context) {
 		return
 	}
 
+	totalUnread := 0
+	for _, v := range data {
+		totalUnread += v.UnreadCount
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"data": data,
+		"data":         data,
+		"total_unread": totalUnread,
 	})
 
 }
@@ -202,11 +280,18 @@ func (chat *ChatHandler) DeleteChat(c *gin.Context) {
 
 	chatIdStr := c.Param("chatId")
 
-	ChatId, _ := uuid.Parse(chatIdStr)
+	ChatId, parseErr := uuid.Parse(chatIdStr)
+	if parseErr != nil {
+		c.JSON(400, gin.H{
+			"error": "id chat tidak valid",
+		})
+		return
+	}
 
-	fmt.Println("ini chatId" + ChatId.String())
+	// ?mode=me (default) cuma ngilangin dari chat kita, ?mode=everyone buat narik pesan
+	mode := c.DefaultQuery("mode", service.DeleteModeForMe)
 
-	err := chat.svc.DeleteChat(c.Request.Context(), userId, ChatId)
+	err := chat.svc.DeleteChat(c.Request.Context(), userId, ChatId, mode)
 
 	if err != nil {
 		c.JSON(err.Code, gin.H{
@@ -220,3 +305,298 @@ func (chat *ChatHandler) DeleteChat(c *gin.Context) {
 	})
 
 }
+
+func (chat *ChatHandler) MarkAsRead(c *gin.Context) {
+
+	val, ok := c.Get("userId")
+	if !ok {
+		c.JSON(401, gin.H{
+			"error": "harap login sebelum mengakses ini!",
+		})
+		return
+	}
+	userId := val.(uuid.UUID)
+
+	partnerId, err := uuid.Parse(c.Param("partner"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "parameter tidak valid! harap masukan parameter dengan benar",
+		})
+		return
+	}
+
+	var req markAsReadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Harap isi data dengan benar!",
+		})
+		return
+	}
+
+	upTo, _ := uuid.Parse(req.UpTo)
+
+	svcErr := chat.svc.MarkConversationAsRead(c.Request.Context(), userId, partnerId, upTo)
+	if svcErr != nil {
+		c.JSON(svcErr.Code, gin.H{
+			"error": svcErr.Message,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "pesan ditandai sudah dibaca",
+	})
+}
+
+func (chat *ChatHandler) GetUnreadSummary(c *gin.Context) {
+
+	val, ok := c.Get("userId")
+	if !ok {
+		c.JSON(401, gin.H{
+			"error": "harap login sebelum mengakses ini!",
+		})
+		return
+	}
+
+	data, svcErr := chat.svc.GetUnreadSummary(c.Request.Context(), val.(uuid.UUID))
+	if svcErr != nil {
+		c.JSON(svcErr.Code, gin.H{
+			"error": svcErr.Message,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "berhasil mengambil data!",
+		"data":    data,
+	})
+}
+
+func (chat *ChatHandler) EditChat(c *gin.Context) {
+
+	val, ok := c.Get("userId")
+	if !ok {
+		c.JSON(401, gin.H{
+			"error": "harap login sebelum mengakses ini!",
+		})
+		return
+	}
+	userId := val.(uuid.UUID)
+
+	chatId, err := uuid.Parse(c.Param("chatId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "parameter tidak valid! harap masukan parameter dengan benar",
+		})
+		return
+	}
+
+	var req editChatRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Harap isi data dengan benar!",
+		})
+		return
+	}
+
+	data, svcErr := chat.svc.EditChat(c.Request.Context(), userId, chatId, req.ChatText)
+	if svcErr != nil {
+		c.JSON(svcErr.Code, gin.H{
+			"error": svcErr.Message,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "pesan berhasil diedit",
+		"data":    data,
+	})
+}
+
+func (chat *ChatHandler) GetChatEdits(c *gin.Context) {
+
+	val, ok := c.Get("userId")
+	if !ok {
+		c.JSON(401, gin.H{
+			"error": "harap login sebelum mengakses ini!",
+		})
+		return
+	}
+	userId := val.(uuid.UUID)
+
+	chatId, err := uuid.Parse(c.Param("chatId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "parameter tidak valid! harap masukan parameter dengan benar",
+		})
+		return
+	}
+
+	data, svcErr := chat.svc.GetChatEdits(c.Request.Context(), userId, chatId)
+	if svcErr != nil {
+		c.JSON(svcErr.Code, gin.H{
+			"error": svcErr.Message,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "berhasil mengambil data!",
+		"data":    data,
+	})
+}
+
+func (chat *ChatHandler) AddReaction(c *gin.Context) {
+
+	val, ok := c.Get("userId")
+	if !ok {
+		c.JSON(401, gin.H{
+			"error": "harap login sebelum mengakses ini!",
+		})
+		return
+	}
+	userId := val.(uuid.UUID)
+
+	chatId, err := uuid.Parse(c.Param("chatId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "parameter tidak valid! harap masukan parameter dengan benar",
+		})
+		return
+	}
+
+	var req reactionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Harap isi data dengan benar!",
+		})
+		return
+	}
+
+	if svcErr := chat.svc.AddReaction(c.Request.Context(), userId, chatId, req.Emoji); svcErr != nil {
+		c.JSON(svcErr.Code, gin.H{
+			"error": svcErr.Message,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "reaksi berhasil ditambahkan",
+	})
+}
+
+// emoji nya dikirim di path dalam bentuk url encoded
+func (chat *ChatHandler) RemoveReaction(c *gin.Context) {
+
+	val, ok := c.Get("userId")
+	if !ok {
+		c.JSON(401, gin.H{
+			"error": "harap login sebelum mengakses ini!",
+		})
+		return
+	}
+	userId := val.(uuid.UUID)
+
+	chatId, err := uuid.Parse(c.Param("chatId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "parameter tidak valid! harap masukan parameter dengan benar",
+		})
+		return
+	}
+
+	if svcErr := chat.svc.RemoveReaction(c.Request.Context(), userId, chatId, c.Param("emoji")); svcErr != nil {
+		c.JSON(svcErr.Code, gin.H{
+			"error": svcErr.Message,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "reaksi berhasil dihapus",
+	})
+}
+
+func (chat *ChatHandler) GetReactions(c *gin.Context) {
+
+	val, ok := c.Get("userId")
+	if !ok {
+		c.JSON(401, gin.H{
+			"error": "harap login sebelum mengakses ini!",
+		})
+		return
+	}
+	userId := val.(uuid.UUID)
+
+	chatId, err := uuid.Parse(c.Param("chatId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "parameter tidak valid! harap masukan parameter dengan benar",
+		})
+		return
+	}
+
+	data, svcErr := chat.svc.GetReactions(c.Request.Context(), userId, chatId)
+	if svcErr != nil {
+		c.JSON(svcErr.Code, gin.H{
+			"error": svcErr.Message,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "berhasil mengambil data!",
+		"data":    data,
+	})
+}
+
+func (chat *ChatHandler) SearchChats(c *gin.Context) {
+
+	val, ok := c.Get("userId")
+	if !ok {
+		c.JSON(401, gin.H{
+			"error": "harap login sebelum mengakses ini!",
+		})
+		return
+	}
+	userId := val.(uuid.UUID)
+
+	var q searchChatRequest
+	if err := c.ShouldBindQuery(&q); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "parameter tidak valid! harap masukan parameter dengan benar",
+		})
+		return
+	}
+
+	in := service.ChatSearchInput{
+		Query:         q.Query,
+		From:          q.From,
+		HasAttachment: q.HasAttachment,
+		Before:        q.Before,
+		Limit:         q.Limit,
+	}
+
+	if q.Partner != "" {
+		partner, _ := uuid.Parse(q.Partner)
+		in.PartnerId = &partner
+	}
+
+	if q.To != nil {
+		endOfDay := q.To.AddDate(0, 0, 1)
+		in.To = &endOfDay
+	}
+
+	data, svcErr := chat.svc.SearchChats(c.Request.Context(), userId, in)
+	if svcErr != nil {
+		c.JSON(svcErr.Code, gin.H{
+			"error": svcErr.Message,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "berhasil mengambil data!",
+		"data":    data,
+	})
+}
@@ -0,0 +1,413 @@
+package handlers
+
+import (
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"time"
+
+	"github.com/Agmer17/golang_yapping/internal/middleware"
+	"github.com/Agmer17/golang_yapping/internal/service"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/google/uuid"
+)
+
+var manageGroupRateLimit = middleware.RateLimitPolicy{Name: "group-manage", Limit: 30, Window: time.Minute}
+
+type GroupHandler struct {
+	svc     service.GroupServiceInterface
+	limiter *middleware.RateLimiter
+}
+
+type createGroupRequest struct {
+	Name      string                `form:"name" binding:"required"`
+	MemberIds []string              `form:"member_ids" binding:"dive,uuid"`
+	Avatar    *multipart.FileHeader `form:"avatar"`
+}
+
+type updateGroupRequest struct {
+	Name   *string               `form:"name"`
+	Avatar *multipart.FileHeader `form:"avatar"`
+}
+
+type inviteMembersRequest struct {
+	UserIds []string `json:"user_ids" binding:"required,min=1,dive,uuid"`
+}
+
+type changeRoleRequest struct {
+	Role string `json:"role" binding:"required,oneof=admin member"`
+}
+
+type postGroupMessageRequest struct {
+	ReplyTo    *string                 `form:"reply_to" binding:"omitempty,uuid"`
+	ChatText   *string                 `form:"chat_text"`
+	PostId     *string                 `form:"posts_id" binding:"omitempty,uuid"`
+	MediaFiles []*multipart.FileHeader `form:"chat_media"`
+}
+
+type groupMessagesRequest struct {
+	Before string `form:"before"`
+	Limit  int    `form:"limit" binding:"omitempty,min=1,max=100"`
+}
+
+func NewGroupHandler(svc *service.GroupService, limiter *middleware.RateLimiter) *GroupHandler {
+	return &GroupHandler{
+		svc:     svc,
+		limiter: limiter,
+	}
+}
+
+func (g *GroupHandler) RegisterRoutes(rg *gin.RouterGroup) {
+
+	groupEndpoint := rg.Group("/groups")
+
+	{
+		groupEndpoint.POST("", g.limiter.Limit(manageGroupRateLimit), g.CreateGroup)
+		groupEndpoint.GET("", g.limiter.Limit(readChatRateLimit), g.GetMyGroups)
+		groupEndpoint.GET("/:groupId", g.limiter.Limit(readChatRateLimit), g.GetGroup)
+		groupEndpoint.PATCH("/:groupId", g.limiter.Limit(manageGroupRateLimit), g.UpdateGroup)
+		groupEndpoint.POST("/:groupId/members", g.limiter.Limit(manageGroupRateLimit), g.InviteMembers)
+		groupEndpoint.DELETE("/:groupId/members/:userId", g.limiter.Limit(manageGroupRateLimit), g.KickMember)
+		groupEndpoint.PATCH("/:groupId/members/:userId", g.limiter.Limit(manageGroupRateLimit), g.ChangeRole)
+		groupEndpoint.POST("/:groupId/leave", g.limiter.Limit(manageGroupRateLimit), g.LeaveGroup)
+		groupEndpoint.POST("/:groupId/messages", g.limiter.Limit(postChatRateLimit), g.PostMessage)
+		groupEndpoint.GET("/:groupId/messages", g.limiter.Limit(readChatRateLimit), g.GetMessages)
+	}
+}
+
+// ambil user yang login + group id dari path, false kalo response error nya udah dikirim
+func groupRequestIds(c *gin.Context) (uuid.UUID, uuid.UUID, bool) {
+
+	val, ok := c.Get("userId")
+	if !ok {
+		c.JSON(401, gin.H{
+			"error": "harap login sebelum mengakses ini!",
+		})
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	groupId, err := uuid.Parse(c.Param("groupId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "parameter tidak valid! harap masukan parameter dengan benar",
+		})
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	return val.(uuid.UUID), groupId, true
+}
+
+func parseUuidList(list []string) []uuid.UUID {
+	ids := make([]uuid.UUID, 0, len(list))
+
+	for _, s := range list {
+		// udah divalidasi binding, yang gagal di parse ga mungkin ada
+		id, _ := uuid.Parse(s)
+		ids = append(ids, id)
+	}
+
+	return ids
+}
+
+func avatarTooLarge(c *gin.Context, fh *multipart.FileHeader) bool {
+	if fh != nil && fh.Size > MaxFileSizes {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "avatar terlalu besar, maksimal 5MB",
+		})
+		return true
+	}
+
+	return false
+}
+
+func (g *GroupHandler) CreateGroup(c *gin.Context) {
+
+	val, ok := c.Get("userId")
+	if !ok {
+		c.JSON(401, gin.H{
+			"error": "harap login sebelum mengakses ini!",
+		})
+		return
+	}
+	userId := val.(uuid.UUID)
+
+	var req createGroupRequest
+	if err := c.ShouldBindWith(&req, binding.FormMultipart); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Harap isi data dengan benar!",
+		})
+		return
+	}
+
+	if avatarTooLarge(c, req.Avatar) {
+		return
+	}
+
+	data, svcErr := g.svc.CreateGroup(c.Request.Context(), service.CreateGroupInput{
+		OwnerId:   userId,
+		Name:      req.Name,
+		MemberIds: parseUuidList(req.MemberIds),
+		Avatar:    req.Avatar,
+	})
+
+	if svcErr != nil {
+		writeServiceError(c, svcErr)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "grup berhasil dibuat",
+		"data":    data,
+	})
+}
+
+func (g *GroupHandler) GetMyGroups(c *gin.Context) {
+
+	val, ok := c.Get("userId")
+	if !ok {
+		c.JSON(401, gin.H{
+			"error": "harap login sebelum mengakses ini!",
+		})
+		return
+	}
+	userId := val.(uuid.UUID)
+
+	data, svcErr := g.svc.GetMyGroups(c.Request.Context(), userId)
+	if svcErr != nil {
+		writeServiceError(c, svcErr)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "berhasil mengambil data!",
+		"data":    data,
+	})
+}
+
+func (g *GroupHandler) GetGroup(c *gin.Context) {
+
+	userId, groupId, ok := groupRequestIds(c)
+	if !ok {
+		return
+	}
+
+	data, svcErr := g.svc.GetGroup(c.Request.Context(), userId, groupId)
+	if svcErr != nil {
+		writeServiceError(c, svcErr)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "berhasil mengambil data!",
+		"data":    data,
+	})
+}
+
+func (g *GroupHandler) UpdateGroup(c *gin.Context) {
+
+	userId, groupId, ok := groupRequestIds(c)
+	if !ok {
+		return
+	}
+
+	var req updateGroupRequest
+	if err := c.ShouldBindWith(&req, binding.FormMultipart); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Harap isi data dengan benar!",
+		})
+		return
+	}
+
+	if avatarTooLarge(c, req.Avatar) {
+		return
+	}
+
+	data, svcErr := g.svc.UpdateGroup(c.Request.Context(), userId, groupId, service.UpdateGroupInput{
+		Name:   req.Name,
+		Avatar: req.Avatar,
+	})
+
+	if svcErr != nil {
+		writeServiceError(c, svcErr)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "grup berhasil diubah",
+		"data":    data,
+	})
+}
+
+func (g *GroupHandler) InviteMembers(c *gin.Context) {
+
+	userId, groupId, ok := groupRequestIds(c)
+	if !ok {
+		return
+	}
+
+	var req inviteMembersRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Harap isi data dengan benar!",
+		})
+		return
+	}
+
+	added, svcErr := g.svc.InviteMembers(c.Request.Context(), userId, groupId, parseUuidList(req.UserIds))
+	if svcErr != nil {
+		writeServiceError(c, svcErr)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": fmt.Sprintf("%d member berhasil ditambahkan", len(added)),
+		"data":    added,
+	})
+}
+
+func (g *GroupHandler) KickMember(c *gin.Context) {
+
+	userId, groupId, ok := groupRequestIds(c)
+	if !ok {
+		return
+	}
+
+	target, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "parameter tidak valid! harap masukan parameter dengan benar",
+		})
+		return
+	}
+
+	if svcErr := g.svc.KickMember(c.Request.Context(), userId, groupId, target); svcErr != nil {
+		writeServiceError(c, svcErr)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "member berhasil dikeluarkan",
+	})
+}
+
+func (g *GroupHandler) ChangeRole(c *gin.Context) {
+
+	userId, groupId, ok := groupRequestIds(c)
+	if !ok {
+		return
+	}
+
+	target, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "parameter tidak valid! harap masukan parameter dengan benar",
+		})
+		return
+	}
+
+	var req changeRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Harap isi data dengan benar!",
+		})
+		return
+	}
+
+	if svcErr := g.svc.ChangeRole(c.Request.Context(), userId, groupId, target, req.Role); svcErr != nil {
+		writeServiceError(c, svcErr)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "role member berhasil diubah",
+	})
+}
+
+func (g *GroupHandler) LeaveGroup(c *gin.Context) {
+
+	userId, groupId, ok := groupRequestIds(c)
+	if !ok {
+		return
+	}
+
+	if svcErr := g.svc.LeaveGroup(c.Request.Context(), userId, groupId); svcErr != nil {
+		writeServiceError(c, svcErr)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "berhasil keluar dari grup",
+	})
+}
+
+func (g *GroupHandler) PostMessage(c *gin.Context) {
+
+	userId, groupId, ok := groupRequestIds(c)
+	if !ok {
+		return
+	}
+
+	var req postGroupMessageRequest
+	if err := c.ShouldBindWith(&req, binding.FormMultipart); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Harap isi data dengan benar!",
+		})
+		return
+	}
+
+	for _, file := range req.MediaFiles {
+		if file.Size > MaxFileSizes {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("File %s terlalu besar, maksimal 5MB", file.Filename),
+			})
+			return
+		}
+	}
+
+	data, svcErr := g.svc.SendMessage(c.Request.Context(), service.GroupMessageInput{
+		SenderId:       userId,
+		ConversationId: groupId,
+		ReplyTo:        req.ReplyTo,
+		ChatText:       req.ChatText,
+		PostId:         req.PostId,
+		MediaFiles:     req.MediaFiles,
+	})
+
+	if svcErr != nil {
+		writeServiceError(c, svcErr)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "ok",
+		"data":    data,
+	})
+}
+
+func (g *GroupHandler) GetMessages(c *gin.Context) {
+
+	userId, groupId, ok := groupRequestIds(c)
+	if !ok {
+		return
+	}
+
+	var q groupMessagesRequest
+	if err := c.ShouldBindQuery(&q); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "parameter tidak valid! harap masukan parameter dengan benar",
+		})
+		return
+	}
+
+	data, svcErr := g.svc.GetMessages(c.Request.Context(), userId, groupId, q.Before, q.Limit)
+	if svcErr != nil {
+		writeServiceError(c, svcErr)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "berhasil mengambil data!",
+		"data":    data,
+	})
+}
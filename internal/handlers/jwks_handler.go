@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/Agmer17/golang_yapping/pkg"
+	"github.com/gin-gonic/gin"
+)
+
+type JwksHandler struct{}
+
+func NewJwksHandler() *JwksHandler {
+	return &JwksHandler{}
+}
+
+func (h *JwksHandler) RegisterRoutes(rg *gin.RouterGroup) {
+
+	rg.GET("/.well-known/jwks.json", h.GetJwks)
+
+}
+
+func (h *JwksHandler) GetJwks(c *gin.Context) {
+
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, pkg.PublicJWKS())
+
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/Agmer17/golang_yapping/internal/middleware"
+	"github.com/Agmer17/golang_yapping/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+// nyimpen state login di browser yang mulai login, dicocokin lagi pas callback
+const (
+	oidcStateCookie     = "oidc_state"
+	oidcStateCookiePath = "/api/auth/oidc"
+)
+
+type OidcHandler struct {
+	svc     service.OidcServiceInterface
+	limiter *middleware.RateLimiter
+}
+
+func NewOidcHandler(svc *service.OidcService, limiter *middleware.RateLimiter) *OidcHandler {
+	return &OidcHandler{
+		svc:     svc,
+		limiter: limiter,
+	}
+}
+
+func (h *OidcHandler) RegisterRoutes(rg *gin.RouterGroup) {
+
+	oidc := rg.Group("/auth/oidc/:provider")
+	oidc.Use(h.limiter.Limit(loginRateLimit))
+
+	{
+		oidc.GET("/login", h.handleLogin)
+		oidc.GET("/callback", h.handleCallback)
+	}
+
+}
+
+// redirect user ke halaman login provider
+func (h *OidcHandler) handleLogin(c *gin.Context) {
+
+	start, svcErr := h.svc.BeginLogin(c.Request.Context(), c.Param("provider"))
+	if svcErr != nil {
+		c.JSON(svcErr.Code, gin.H{"error": svcErr.Message})
+		return
+	}
+
+	setOidcStateCookie(c, start.State, int(service.OidcStateTTL.Seconds()))
+	c.Redirect(http.StatusFound, start.AuthURL)
+}
+
+// SameSite Lax tetep kekirim pas redirect GET dari provider, tapi ga pas request dari situs lain.
+// maxAge negatif buat ngehapus cookie nya
+func setOidcStateCookie(c *gin.Context, state string, maxAge int) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     oidcStateCookiePath,
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https",
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func (h *OidcHandler) handleCallback(c *gin.Context) {
+
+	// state cuma bisa dipake sekali, cookie nya langsung dihapus apa pun hasil nya
+	browserState, _ := c.Cookie(oidcStateCookie)
+	setOidcStateCookie(c, "", -1)
+
+	if providerErr := c.Query("error"); providerErr != "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "login dibatalkan oleh provider : " + providerErr,
+		})
+		return
+	}
+
+	state := c.Query("state")
+	code := c.Query("code")
+
+	if state == "" || code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "parameter state dan code wajib di isi"})
+		return
+	}
+
+	meta := service.SessionMeta{
+		UserAgent: c.Request.UserAgent(),
+		Ip:        c.ClientIP(),
+	}
+
+	resp, svcErr := h.svc.CompleteLogin(c.Request.Context(), c.Param("provider"), state, browserState, code, meta)
+	if svcErr != nil {
+		c.JSON(svcErr.Code, gin.H{"error": svcErr.Message})
+		return
+	}
+
+	writeLoginOrChallenge(c, resp)
+}
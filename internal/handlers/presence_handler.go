@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/Agmer17/golang_yapping/internal/middleware"
+	"github.com/Agmer17/golang_yapping/internal/service"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type PresenceHandler struct {
+	svc     service.PresenceServiceInterface
+	limiter *middleware.RateLimiter
+}
+
+type presencePrivacyRequest struct {
+	HideLastSeen *bool `json:"hide_last_seen" binding:"required"`
+}
+
+func NewPresenceHandler(svc *service.PresenceService, limiter *middleware.RateLimiter) *PresenceHandler {
+	return &PresenceHandler{
+		svc:     svc,
+		limiter: limiter,
+	}
+}
+
+func (p *PresenceHandler) RegisterRoutes(rg *gin.RouterGroup) {
+
+	presence := rg.Group("/presence")
+
+	{
+		presence.GET("", p.limiter.Limit(readChatRateLimit), p.GetPresence)
+		presence.PUT("/privacy", p.limiter.Limit(postChatRateLimit), p.SetPrivacy)
+	}
+}
+
+// ?user_ids=<uuid>,<uuid>,...
+func (p *PresenceHandler) GetPresence(c *gin.Context) {
+
+	val, ok := c.Get("userId")
+	if !ok {
+		c.JSON(401, gin.H{
+			"error": "harap login sebelum mengakses ini!",
+		})
+		return
+	}
+	userId := val.(uuid.UUID)
+
+	raw := strings.Split(c.Query("user_ids"), ",")
+	userIds := make([]uuid.UUID, 0, len(raw))
+
+	for _, s := range raw {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+
+		id, err := uuid.Parse(s)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "parameter tidak valid! harap masukan parameter dengan benar",
+			})
+			return
+		}
+
+		userIds = append(userIds, id)
+	}
+
+	data, svcErr := p.svc.GetPresence(c.Request.Context(), userId, userIds)
+	if svcErr != nil {
+		writeServiceError(c, svcErr)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "berhasil mengambil data!",
+		"data":    data,
+	})
+}
+
+func (p *PresenceHandler) SetPrivacy(c *gin.Context) {
+
+	val, ok := c.Get("userId")
+	if !ok {
+		c.JSON(401, gin.H{
+			"error": "harap login sebelum mengakses ini!",
+		})
+		return
+	}
+	userId := val.(uuid.UUID)
+
+	var req presencePrivacyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Harap isi data dengan benar!",
+		})
+		return
+	}
+
+	if svcErr := p.svc.SetHideLastSeen(c.Request.Context(), userId, *req.HideLastSeen); svcErr != nil {
+		writeServiceError(c, svcErr)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "pengaturan privasi berhasil disimpan",
+	})
+}
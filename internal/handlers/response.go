@@ -0,0 +1,19 @@
+package handlers
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/Agmer17/golang_yapping/pkg/customerrors"
+	"github.com/gin-gonic/gin"
+)
+
+// sama kayak c.JSON(svcErr.Code, ...) biasa, tapi ikut ngirim header Retry-After kalo ada
+func writeServiceError(c *gin.Context, svcErr *customerrors.ServiceErrors) {
+
+	if svcErr.RetryAfter > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(svcErr.RetryAfter.Seconds()))))
+	}
+
+	c.JSON(svcErr.Code, gin.H{"error": svcErr.Message})
+}
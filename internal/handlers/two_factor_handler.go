@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/Agmer17/golang_yapping/internal/middleware"
+	"github.com/Agmer17/golang_yapping/internal/service"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type twoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+var twoFactorRateLimit = middleware.RateLimitPolicy{Name: "auth-2fa", Limit: 10, Window: time.Minute}
+
+type TwoFactorHandler struct {
+	svc     service.TwoFactorServiceInterface
+	limiter *middleware.RateLimiter
+}
+
+func NewTwoFactorHandler(svc *service.TwoFactorService, limiter *middleware.RateLimiter) *TwoFactorHandler {
+	return &TwoFactorHandler{
+		svc:     svc,
+		limiter: limiter,
+	}
+}
+
+func (h *TwoFactorHandler) RegisterRoutes(rg *gin.RouterGroup) {
+
+	tf := rg.Group("/auth/2fa")
+	tf.Use(h.limiter.Limit(twoFactorRateLimit))
+
+	{
+		tf.POST("/setup", h.handleSetup)
+		tf.POST("/confirm", h.handleConfirm)
+		tf.POST("/disable", h.handleDisable)
+		tf.POST("/recovery-codes", h.handleRegenerateRecoveryCodes)
+	}
+
+}
+
+func (h *TwoFactorHandler) handleSetup(c *gin.Context) {
+
+	val, ok := c.Get("userId")
+	if !ok {
+		c.JSON(401, gin.H{
+			"error": "harap login sebelum mengakses ini!",
+		})
+		return
+	}
+
+	userId := val.(uuid.UUID)
+
+	data, svcErr := h.svc.BeginEnrollment(c.Request.Context(), userId)
+	if svcErr != nil {
+		c.JSON(svcErr.Code, gin.H{"error": svcErr.Message})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "scan QR / masukan secret di aplikasi authenticator, lalu konfirmasi dengan kode yang muncul",
+		"data":    data,
+	})
+}
+
+func (h *TwoFactorHandler) handleConfirm(c *gin.Context) {
+
+	val, ok := c.Get("userId")
+	if !ok {
+		c.JSON(401, gin.H{
+			"error": "harap login sebelum mengakses ini!",
+		})
+		return
+	}
+
+	userId := val.(uuid.UUID)
+
+	var rBind twoFactorCodeRequest
+	if err := c.ShouldBindJSON(&rBind); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "bad request! isi data degan benar"})
+		return
+	}
+
+	codes, svcErr := h.svc.ConfirmEnrollment(c.Request.Context(), userId, rBind.Code)
+	if svcErr != nil {
+		c.JSON(svcErr.Code, gin.H{"error": svcErr.Message})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "2FA berhasil diaktifkan, simpan recovery code ini di tempat yang aman",
+		"recovery_codes": codes,
+	})
+}
+
+func (h *TwoFactorHandler) handleDisable(c *gin.Context) {
+
+	val, ok := c.Get("userId")
+	if !ok {
+		c.JSON(401, gin.H{
+			"error": "harap login sebelum mengakses ini!",
+		})
+		return
+	}
+
+	userId := val.(uuid.UUID)
+
+	var rBind twoFactorCodeRequest
+	if err := c.ShouldBindJSON(&rBind); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "bad request! isi data degan benar"})
+		return
+	}
+
+	if svcErr := h.svc.Disable(c.Request.Context(), userId, rBind.Code); svcErr != nil {
+		c.JSON(svcErr.Code, gin.H{"error": svcErr.Message})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "2FA berhasil dinonaktifkan",
+	})
+}
+
+func (h *TwoFactorHandler) handleRegenerateRecoveryCodes(c *gin.Context) {
+
+	val, ok := c.Get("userId")
+	if !ok {
+		c.JSON(401, gin.H{
+			"error": "harap login sebelum mengakses ini!",
+		})
+		return
+	}
+
+	userId := val.(uuid.UUID)
+
+	var rBind twoFactorCodeRequest
+	if err := c.ShouldBindJSON(&rBind); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "bad request! isi data degan benar"})
+		return
+	}
+
+	codes, svcErr := h.svc.RegenerateRecoveryCodes(c.Request.Context(), userId, rBind.Code)
+	if svcErr != nil {
+		c.JSON(svcErr.Code, gin.H{"error": svcErr.Message})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "recovery code lama sudah tidak berlaku, simpan recovery code baru ini",
+		"recovery_codes": codes,
+	})
+}
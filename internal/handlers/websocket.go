@@ -2,32 +2,48 @@ package handlers
 
 import (
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
 
+	"github.com/Agmer17/golang_yapping/internal/middleware"
+	"github.com/Agmer17/golang_yapping/internal/service"
 	"github.com/Agmer17/golang_yapping/internal/ws"
+	"github.com/Agmer17/golang_yapping/pkg"
+	"github.com/Agmer17/golang_yapping/pkg/customerrors"
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 )
 
-var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool { return true },
-}
+// browser ga bisa ngeset header Authorization pas upgrade websocket, jadi token nya bisa
+// dikirim lewat Sec-WebSocket-Protocol : ["access_token", "<jwt>"]
+const wsTokenSubprotocol = "access_token"
+
+var wsTicketRateLimit = middleware.RateLimitPolicy{Name: "ws-ticket", Limit: 30, Window: time.Minute}
 
 type WebSocketHandler struct {
 	Hub      *ws.Hub
+	Auth     service.WsAuthServiceInterface
 	Upgrader websocket.Upgrader
+	limiter  *middleware.RateLimiter
 }
 
-func NewWebsocketHandler(h *ws.Hub) *WebSocketHandler {
+// allowedOrigins kosong berarti cuma origin yang host nya sama kayak server yang boleh
+func NewWebsocketHandler(h *ws.Hub, auth *service.WsAuthService, allowedOrigins []string, limiter *middleware.RateLimiter) *WebSocketHandler {
 
 	return &WebSocketHandler{
-		Hub: h,
+		Hub:  h,
+		Auth: auth,
 		Upgrader: websocket.Upgrader{
-			CheckOrigin: func(r *http.Request) bool { return true },
+			CheckOrigin:  originChecker(allowedOrigins),
+			Subprotocols: []string{wsTokenSubprotocol},
 		},
+		limiter: limiter,
 	}
 
 }
+
+// /ws/connect ngecek token nya sendiri, ga lewat AuthMiddleware
 func (w *WebSocketHandler) RegisterRoutes(r *gin.RouterGroup) {
 
 	we := r.Group("/ws")
@@ -38,10 +54,94 @@ func (w *WebSocketHandler) RegisterRoutes(r *gin.RouterGroup) {
 
 }
 
+func (w *WebSocketHandler) RegisterProtectedRoutes(r *gin.RouterGroup) {
+
+	we := r.Group("/ws")
+
+	{
+		we.POST("/ticket", w.limiter.Limit(wsTicketRateLimit), w.IssueTicket)
+		we.GET("/metrics", w.Metrics)
+	}
+
+}
+
+// request tanpa header Origin bukan dari browser, jadi ga dicek
+func originChecker(allowedOrigins []string) func(r *http.Request) bool {
+
+	allowed := make(map[string]bool, len(allowedOrigins))
+	for _, origin := range allowedOrigins {
+		origin = strings.ToLower(strings.TrimRight(strings.TrimSpace(origin), "/"))
+		if origin != "" {
+			allowed[origin] = true
+		}
+	}
+
+	return func(r *http.Request) bool {
+
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			return true
+		}
+
+		if len(allowed) == 0 {
+			u, err := url.Parse(origin)
+			return err == nil && strings.EqualFold(u.Host, r.Host)
+		}
+
+		return allowed[strings.ToLower(origin)]
+	}
+}
+
+// urutan nya : ?ticket= , Sec-WebSocket-Protocol, terus header Authorization
+func (w *WebSocketHandler) authenticate(c *gin.Context) (*pkg.Claims, *customerrors.ServiceErrors) {
+
+	ctx := c.Request.Context()
+
+	if ticket := c.Query("ticket"); ticket != "" {
+		return w.Auth.RedeemTicket(ctx, ticket)
+	}
+
+	protocols := websocket.Subprotocols(c.Request)
+	for i, p := range protocols {
+		if p == wsTokenSubprotocol && i+1 < len(protocols) {
+			return w.Auth.Authenticate(ctx, protocols[i+1])
+		}
+	}
+
+	token, err := pkg.GetAccessToken(c.GetHeader("Authorization"))
+	if err != nil {
+		return nil, customerrors.New(http.StatusUnauthorized, err.Error())
+	}
+
+	return w.Auth.Authenticate(ctx, token)
+}
+
 func (w *WebSocketHandler) ServeWS(c *gin.Context) {
 
-	val, ok := c.Get("userId")
+	claims, svcErr := w.authenticate(c)
+	if svcErr != nil {
+		writeServiceError(c, svcErr)
+		return
+	}
+
+	userId := claims.UserID
 
+	conn, err := w.Upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		return
+	}
+	client := ws.NewClient(conn, w.Hub, userId)
+	w.Hub.Join(ws.UserRoom(userId), client)
+	w.Auth.Watch(client, claims)
+
+	go client.WritePump()
+	client.ReadPump()
+}
+
+// ticket sekali pakai buat /ws/connect?ticket=..., dipake client yang ga bisa ngirim header Authorization
+func (w *WebSocketHandler) IssueTicket(c *gin.Context) {
+
+	val, ok := c.Get("claims")
 	if !ok {
 		c.JSON(401, gin.H{
 			"error": "harap login sebelum mengakses ini!",
@@ -49,17 +149,39 @@ func (w *WebSocketHandler) ServeWS(c *gin.Context) {
 		return
 	}
 
-	userId := val.(uuid.UUID)
+	data, svcErr := w.Auth.IssueTicket(c.Request.Context(), val.(*pkg.Claims))
+	if svcErr != nil {
+		writeServiceError(c, svcErr)
+		return
+	}
 
-	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
-	if err != nil {
+	c.JSON(http.StatusOK, gin.H{
+		"message": "ok",
+		"data":    data,
+	})
+}
+
+// antrian kirim websocket di instance ini, buat mantau client yang kelambatan
+func (w *WebSocketHandler) Metrics(c *gin.Context) {
+
+	val, ok := c.Get("claims")
+	if !ok {
+		c.JSON(401, gin.H{
+			"error": "harap login sebelum mengakses ini!",
+		})
 		return
 	}
-	room := w.Hub.GetOrCreate("user:" + userId.String())
-	client := ws.NewClient(conn, room, userId)
 
-	room.Register <- client
+	// isi nya kondisi internal server, cuma buat moderator
+	if val.(*pkg.Claims).Role != "MODERATOR" {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "kamu tidak punya akses ke fitur ini",
+		})
+		return
+	}
 
-	go client.WritePump()
-	client.ReadPump()
+	c.JSON(http.StatusOK, gin.H{
+		"message": "berhasil mengambil data!",
+		"data":    w.Hub.Metrics.Snapshot(),
+	})
 }
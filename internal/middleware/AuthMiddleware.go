@@ -1,11 +1,12 @@
 package middleware
 
 import (
+	"github.com/Agmer17/golang_yapping/internal/service"
 	"github.com/Agmer17/golang_yapping/pkg"
 	"github.com/gin-gonic/gin"
 )
 
-func AuthMiddleware() gin.HandlerFunc {
+func AuthMiddleware(revocation service.TokenRevocationInterface) gin.HandlerFunc {
 
 	return func(ctx *gin.Context) {
 
@@ -30,7 +31,26 @@ func AuthMiddleware() gin.HandlerFunc {
 		}
 
 		if accesClaims != nil {
+			revoked, err := revocation.IsRevoked(ctx.Request.Context(), accesClaims)
+			if err != nil {
+				ctx.JSON(500, gin.H{
+					"error": "terjadi kesalahan di server " + err.Error(),
+				})
+				ctx.Abort()
+				return
+			}
+
+			if revoked {
+				ctx.JSON(401, gin.H{
+					"error": "sesi kamu sudah tidak berlaku, silahkan login ulang",
+				})
+				ctx.Abort()
+				return
+			}
+
 			ctx.Set("userId", accesClaims.UserID)
+			ctx.Set("sessionId", accesClaims.SessionId)
+			ctx.Set("claims", accesClaims)
 			ctx.Next()
 			return
 
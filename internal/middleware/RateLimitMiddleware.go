@@ -0,0 +1,122 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// policy dideklarasiin di tiap handler, Name dipake buat bedain counter antar route
+type RateLimitPolicy struct {
+	Name   string
+	Limit  int
+	Window time.Duration
+}
+
+type RateLimitResult struct {
+	Allowed   bool
+	Remaining int
+
+	// sisa waktu sampe window sekarang selesai
+	Reset time.Duration
+}
+
+// backend penyimpanan counter, ada versi redis buat production dan versi memory buat testing
+type RateLimitStore interface {
+	Allow(ctx context.Context, key string, limit int, window time.Duration, now time.Time) (RateLimitResult, error)
+}
+
+type RateLimiter struct {
+	Store RateLimitStore
+
+	// diganti pas testing biar waktunya bisa diatur
+	Now func() time.Time
+}
+
+func NewRateLimiter(store RateLimitStore) *RateLimiter {
+	return &RateLimiter{
+		Store: store,
+		Now:   time.Now,
+	}
+}
+
+// kalo route nya udah lewat AuthMiddleware counter nya per user, kalo belum per ip
+func (l *RateLimiter) Limit(policy RateLimitPolicy) gin.HandlerFunc {
+
+	return func(ctx *gin.Context) {
+
+		// limiter nil artinya rate limit ga dipasang
+		if l == nil {
+			ctx.Next()
+			return
+		}
+
+		key := "ratelimit:" + policy.Name + ":" + rateLimitIdentity(ctx)
+
+		res, err := l.Store.Allow(ctx.Request.Context(), key, policy.Limit, policy.Window, l.Now())
+
+		// redis error jangan sampe bikin semua request gagal, dilepas aja
+		if err != nil {
+			log.Printf("rate limit %s gagal, request dilepas : %v", policy.Name, err)
+			ctx.Next()
+			return
+		}
+
+		resetSeconds := strconv.Itoa(int(math.Ceil(res.Reset.Seconds())))
+
+		ctx.Header("RateLimit-Limit", strconv.Itoa(policy.Limit))
+		ctx.Header("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		ctx.Header("RateLimit-Reset", resetSeconds)
+		ctx.Header("RateLimit-Policy", fmt.Sprintf("%d;w=%d", policy.Limit, int(policy.Window.Seconds())))
+
+		if !res.Allowed {
+			ctx.Header("Retry-After", resetSeconds)
+			ctx.JSON(429, gin.H{
+				"error": "terlalu banyak request, coba lagi dalam " + resetSeconds + " detik",
+			})
+			ctx.Abort()
+			return
+		}
+
+		ctx.Next()
+	}
+}
+
+func rateLimitIdentity(ctx *gin.Context) string {
+
+	if val, ok := ctx.Get("userId"); ok {
+		if userId, ok := val.(uuid.UUID); ok {
+			return "user:" + userId.String()
+		}
+	}
+
+	return "ip:" + ctx.ClientIP()
+}
+
+// sliding window counter : jumlah request di window sebelumnya dihitung sesuai
+// sisa porsi nya di window sekarang, jadi ga ada lonjakan 2x limit di batas window
+func slidingWindowCount(previous int64, current int64, window time.Duration, elapsed time.Duration) int64 {
+	weight := float64(window-elapsed) / float64(window)
+	return int64(math.Floor(float64(previous)*weight)) + current
+}
+
+func windowIndex(now time.Time, window time.Duration) (int64, time.Duration) {
+	ms := now.UnixMilli()
+	windowMs := window.Milliseconds()
+
+	return ms / windowMs, time.Duration(ms%windowMs) * time.Millisecond
+}
+
+func rateLimitResult(count int64, limit int, allowed bool, window time.Duration, elapsed time.Duration) RateLimitResult {
+	return RateLimitResult{
+		Allowed:   allowed,
+		Remaining: max(limit-int(count), 0),
+		Reset:     window - elapsed,
+	}
+}
@@ -0,0 +1,209 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// awal window 1 menit, biar gampang ngitung elapsed nya
+var windowStart = time.UnixMilli(1_700_000_040_000)
+
+func rateLimitStores(t *testing.T) map[string]RateLimitStore {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+
+	return map[string]RateLimitStore{
+		"memory": NewMemoryRateLimitStore(),
+		"redis":  NewRedisRateLimitStore(rdb),
+	}
+}
+
+func allowN(t *testing.T, store RateLimitStore, key string, n int, now time.Time) (allowed int) {
+	t.Helper()
+
+	for i := 0; i < n; i++ {
+		res, err := store.Allow(context.Background(), key, 3, time.Minute, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if res.Allowed {
+			allowed++
+		}
+	}
+
+	return allowed
+}
+
+func TestSlidingWindow(t *testing.T) {
+
+	for name, store := range rateLimitStores(t) {
+		t.Run(name, func(t *testing.T) {
+
+			if got := allowN(t, store, "k", 4, windowStart.Add(10*time.Second)); got != 3 {
+				t.Fatalf("window pertama : %d request lolos, harusnya 3", got)
+			}
+
+			// pas di batas window, request window sebelumnya masih diitung penuh
+			if got := allowN(t, store, "k", 1, windowStart.Add(time.Minute)); got != 0 {
+				t.Fatalf("batas window : %d request lolos, harusnya 0", got)
+			}
+
+			// setengah window, sisa porsi window sebelumnya floor(3 * 0.5) = 1
+			if got := allowN(t, store, "k", 3, windowStart.Add(90*time.Second)); got != 2 {
+				t.Fatalf("setengah window : %d request lolos, harusnya 2", got)
+			}
+
+			// udah lewat satu window penuh tanpa request, counter nya mulai dari 0 lagi
+			if got := allowN(t, store, "k", 4, windowStart.Add(3*time.Minute)); got != 3 {
+				t.Fatalf("setelah window habis : %d request lolos, harusnya 3", got)
+			}
+
+			// key lain punya counter sendiri
+			if got := allowN(t, store, "lain", 1, windowStart.Add(3*time.Minute)); got != 1 {
+				t.Fatalf("key lain : %d request lolos, harusnya 1", got)
+			}
+		})
+	}
+}
+
+func newRateLimitedRouter(store RateLimitStore, now time.Time) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	limiter := NewRateLimiter(store)
+	limiter.Now = func() time.Time { return now }
+
+	r := gin.New()
+	r.GET("/", limiter.Limit(RateLimitPolicy{Name: "test", Limit: 2, Window: time.Minute}), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	return r
+}
+
+func doRequest(r *gin.Engine) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	return w
+}
+
+func TestRateLimitHeaders(t *testing.T) {
+
+	r := newRateLimitedRouter(NewMemoryRateLimitStore(), windowStart.Add(15*time.Second))
+
+	want := []struct {
+		code      int
+		remaining string
+	}{
+		{http.StatusOK, "1"},
+		{http.StatusOK, "0"},
+		{http.StatusTooManyRequests, "0"},
+	}
+
+	for i, expected := range want {
+		w := doRequest(r)
+
+		if w.Code != expected.code {
+			t.Fatalf("request %d : status %d, harusnya %d", i+1, w.Code, expected.code)
+		}
+
+		h := w.Header()
+		if h.Get("RateLimit-Limit") != "2" || h.Get("RateLimit-Remaining") != expected.remaining ||
+			h.Get("RateLimit-Reset") != "45" || h.Get("RateLimit-Policy") != "2;w=60" {
+			t.Fatalf("request %d : header salah %v", i+1, h)
+		}
+
+		retryAfter := h.Get("Retry-After")
+		if expected.code == http.StatusTooManyRequests && retryAfter != "45" {
+			t.Fatalf("Retry-After %q, harusnya 45", retryAfter)
+		}
+
+		if expected.code == http.StatusOK && retryAfter != "" {
+			t.Fatalf("request yang lolos ga boleh ada Retry-After")
+		}
+	}
+}
+
+type failingStore struct{}
+
+func (failingStore) Allow(ctx context.Context, key string, limit int, window time.Duration, now time.Time) (RateLimitResult, error) {
+	return RateLimitResult{}, errors.New("redis mati")
+}
+
+func TestRateLimitFailOpen(t *testing.T) {
+
+	w := doRequest(newRateLimitedRouter(failingStore{}, windowStart))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("store error harusnya request nya dilepas, dapet %d", w.Code)
+	}
+
+	if w.Header().Get("RateLimit-Limit") != "" {
+		t.Fatal("store error ga boleh ngirim header rate limit")
+	}
+}
+
+func TestRateLimitIdentityIgnoresForgedForwardedFor(t *testing.T) {
+
+	gin.SetMode(gin.TestMode)
+
+	cases := []struct {
+		name       string
+		proxies    []string
+		remoteAddr string
+		forwarded  []string
+		want       string
+	}{
+		// ga di belakang proxy, header nya ga dipercaya sama sekali
+		{"tanpa proxy", nil, "203.0.113.9:5000", []string{"1.1.1.1", "2.2.2.2"}, "ip:203.0.113.9"},
+
+		// proxy nya nambahin ip asli di paling kanan, isian client di kiri nya diabaikan
+		{"lewat proxy", []string{"10.0.0.0/8"}, "10.0.0.5:5000", []string{"1.1.1.1, 203.0.113.9", "2.2.2.2, 203.0.113.9"}, "ip:203.0.113.9"},
+
+		// request langsung ke server walaupun ada proxy yang dipercaya
+		{"bukan dari proxy", []string{"10.0.0.0/8"}, "203.0.113.9:5000", []string{"10.0.0.7", "1.1.1.1"}, "ip:203.0.113.9"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+
+			r := gin.New()
+			if err := r.SetTrustedProxies(tc.proxies); err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			r.GET("/", func(c *gin.Context) {
+				got = append(got, rateLimitIdentity(c))
+			})
+
+			for _, forwarded := range tc.forwarded {
+				req := httptest.NewRequest(http.MethodGet, "/", nil)
+				req.RemoteAddr = tc.remoteAddr
+				req.Header.Set("X-Forwarded-For", forwarded)
+				r.ServeHTTP(httptest.NewRecorder(), req)
+			}
+
+			if len(got) != len(tc.forwarded) {
+				t.Fatalf("handler kepanggil %d kali, harusnya %d", len(got), len(tc.forwarded))
+			}
+
+			for i, identity := range got {
+				if identity != tc.want {
+					t.Errorf("request %d : identity %q, harusnya %q", i+1, identity, tc.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package middleware
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// KEYS[1] = counter window sekarang, KEYS[2] = counter window sebelumnya
+// ARGV[1] = limit, ARGV[2] = panjang window (ms), ARGV[3] = waktu yang udah lewat di window sekarang (ms)
+var slidingWindowScript = redis.NewScript(`
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local elapsed = tonumber(ARGV[3])
+
+local current = tonumber(redis.call('GET', KEYS[1]) or '0')
+local previous = tonumber(redis.call('GET', KEYS[2]) or '0')
+
+local count = math.floor(previous * (window - elapsed) / window) + current
+if count >= limit then
+	return {0, count}
+end
+
+redis.call('INCR', KEYS[1])
+redis.call('PEXPIRE', KEYS[1], window * 2)
+
+return {1, count + 1}
+`)
+
+type RedisRateLimitStore struct {
+	RedisClient *redis.Client
+}
+
+func NewRedisRateLimitStore(r *redis.Client) *RedisRateLimitStore {
+	return &RedisRateLimitStore{
+		RedisClient: r,
+	}
+}
+
+func (s *RedisRateLimitStore) Allow(ctx context.Context, key string, limit int, window time.Duration, now time.Time) (RateLimitResult, error) {
+
+	idx, elapsed := windowIndex(now, window)
+
+	keys := []string{
+		key + ":" + strconv.FormatInt(idx, 10),
+		key + ":" + strconv.FormatInt(idx-1, 10),
+	}
+
+	res, err := slidingWindowScript.Run(ctx, s.RedisClient, keys, limit, window.Milliseconds(), elapsed.Milliseconds()).Int64Slice()
+	if err != nil {
+		return RateLimitResult{}, err
+	}
+
+	return rateLimitResult(res[1], limit, res[0] == 1, window, elapsed), nil
+}
+
+type memoryCounter struct {
+	count     int64
+	expiresAt time.Time
+}
+
+// cuma buat testing / jalan tanpa redis, counter nya ga dibagi antar instance
+type MemoryRateLimitStore struct {
+	mu        sync.Mutex
+	counters  map[string]*memoryCounter
+	lastSweep time.Time
+}
+
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{
+		counters: make(map[string]*memoryCounter),
+	}
+}
+
+func (s *MemoryRateLimitStore) Allow(ctx context.Context, key string, limit int, window time.Duration, now time.Time) (RateLimitResult, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep(now)
+
+	idx, elapsed := windowIndex(now, window)
+	currentKey := key + ":" + strconv.FormatInt(idx, 10)
+	previousKey := key + ":" + strconv.FormatInt(idx-1, 10)
+
+	count := slidingWindowCount(s.get(previousKey, now), s.get(currentKey, now), window, elapsed)
+	if count >= int64(limit) {
+		return rateLimitResult(count, limit, false, window, elapsed), nil
+	}
+
+	c, ok := s.counters[currentKey]
+	if !ok || !now.Before(c.expiresAt) {
+		c = &memoryCounter{}
+		s.counters[currentKey] = c
+	}
+
+	c.count++
+	c.expiresAt = now.Add(window * 2)
+
+	return rateLimitResult(count+1, limit, true, window, elapsed), nil
+}
+
+func (s *MemoryRateLimitStore) get(key string, now time.Time) int64 {
+	c, ok := s.counters[key]
+	if !ok || !now.Before(c.expiresAt) {
+		return 0
+	}
+
+	return c.count
+}
+
+// counter yang udah expired dibuang maksimal semenit sekali biar map nya ga numpuk
+func (s *MemoryRateLimitStore) sweep(now time.Time) {
+
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+
+	for k, c := range s.counters {
+		if !now.Before(c.expiresAt) {
+			delete(s.counters, k)
+		}
+	}
+
+	s.lastSweep = now
+}
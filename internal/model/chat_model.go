@@ -24,8 +24,36 @@ type ChatModel struct {
 	PostId     *uuid.UUID
 	IsRead     bool
 	CreatedAt  time.Time
-	IsOwn      bool
-	Attachment []ChatAttachment
+	EditedAt   *time.Time
+
+	// cuma di isi pesan yang dikirim lewat websocket, dipake buat nolak retry
+	ClientMsgId *string
+	DeletedAt   *time.Time
+	IsOwn       bool
+	Attachment  []ChatAttachment
+	Reactions   []ReactionCount
+}
+
+type ChatReaction struct {
+	ChatId    uuid.UUID
+	UserId    uuid.UUID
+	Emoji     string
+	CreatedAt time.Time
+}
+
+// jumlah reaksi per emoji di satu pesan, ReactedByMe dari sudut pandang user yang ngambil
+type ReactionCount struct {
+	Emoji       string
+	Count       int
+	ReactedByMe bool
+}
+
+// isi pesan sebelum di edit
+type ChatEdit struct {
+	Id           uuid.UUID
+	ChatId       uuid.UUID
+	PreviousText *string
+	EditedAt     time.Time
 }
 
 type ChatAttachment struct {
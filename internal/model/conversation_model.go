@@ -0,0 +1,49 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	RoleOwner  = "owner"
+	RoleAdmin  = "admin"
+	RoleMember = "member"
+)
+
+type Conversation struct {
+	Id        uuid.UUID
+	Name      string
+	Avatar    *string
+	CreatedBy *uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	// role user yang lagi ngambil data, cuma di isi di list grup
+	MyRole      string
+	MemberCount int
+}
+
+type ConversationMember struct {
+	ConversationId uuid.UUID
+	UserId         uuid.UUID
+	Role           string
+	JoinedAt       time.Time
+
+	Username       string
+	FullName       string
+	ProfilePicture *string
+}
+
+type GroupMessage struct {
+	Id             uuid.UUID
+	ConversationId uuid.UUID
+	SenderId       uuid.UUID
+	ReplyTo        *uuid.UUID
+	ChatText       *string
+	PostId         *uuid.UUID
+	CreatedAt      time.Time
+	IsOwn          bool
+	Attachment     []ChatAttachment
+}
@@ -0,0 +1,16 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type LinkedIdentity struct {
+	Id        uuid.UUID
+	UserId    uuid.UUID
+	Provider  string
+	Subject   string
+	Email     *string
+	CreatedAt time.Time
+}
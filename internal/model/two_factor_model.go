@@ -0,0 +1,11 @@
+package model
+
+import (
+	"github.com/google/uuid"
+)
+
+type TwoFactor struct {
+	UserId  uuid.UUID
+	Secret  *string
+	Enabled bool
+}
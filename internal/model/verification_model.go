@@ -16,6 +16,7 @@ type VerificationModel struct {
 	UserId    uuid.UUID
 	Token     string
 	Type      string
-	UsedAt    time.Time
+	UsedAt    *time.Time
+	ExpiresAt time.Time
 	CreatedAt time.Time
 }
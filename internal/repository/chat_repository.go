@@ -3,6 +3,7 @@ package repository
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"time"
 
 	"github.com/Agmer17/golang_yapping/internal/model"
@@ -14,6 +15,12 @@ import (
 type LatestChatQuery struct {
 	ChatData    model.ChatModel
 	PartnerData model.User
+	UnreadCount int
+}
+
+type UnreadCount struct {
+	PartnerId   uuid.UUID
+	UnreadCount int
 }
 type Attachment struct {
 	Filename  string    `json:"file_name"`
@@ -22,17 +29,31 @@ type Attachment struct {
 	CreatedAt time.Time `json:"created_at"`
 }
 
+// client_msg_id nya udah pernah dipake sender yang sama, pesan nya ga disimpen lagi
+var ErrDuplicateClientMsgId = errors.New("client_msg_id sudah pernah dipakai")
+
 type ChatWithSender struct {
 	ChatData model.ChatModel
 	Sender   model.User
 }
 type ChatRepositoryInterface interface {
 	Save(d model.ChatModel, ctx context.Context) (ChatWithSender, error)
-	GetChatBeetween(ctx context.Context, r uuid.UUID, s uuid.UUID) ([]model.ChatModel, error)
+	GetChatBeetween(ctx context.Context, r uuid.UUID, s uuid.UUID, q ChatPageQuery) (ChatPage, error)
+	GetChatAround(ctx context.Context, r uuid.UUID, s uuid.UUID, chatId uuid.UUID, limit int) (ChatPage, error)
 	GetLastChat(ctx context.Context, userId uuid.UUID) ([]LatestChatQuery, error)
-	MarkConversationAsRead(sender uuid.UUID, receiver uuid.UUID) error
+	GetUnreadCounts(ctx context.Context, userId uuid.UUID) ([]UnreadCount, error)
+	MarkConversationAsRead(ctx context.Context, reader uuid.UUID, partner uuid.UUID, upTo uuid.UUID) (ReadReceipt, error)
 	GetChatById(ctx context.Context, chatId uuid.UUID) (model.ChatModel, error)
+	GetChatByClientMsgId(ctx context.Context, senderId uuid.UUID, clientMsgId string) (model.ChatModel, error)
+	EditChatText(ctx context.Context, chatId uuid.UUID, text string) (model.ChatModel, error)
+	GetChatEdits(ctx context.Context, chatId uuid.UUID) ([]model.ChatEdit, error)
+	AddReaction(ctx context.Context, chatId uuid.UUID, userId uuid.UUID, emoji string) (bool, int, error)
+	RemoveReaction(ctx context.Context, chatId uuid.UUID, userId uuid.UUID, emoji string) (bool, int, error)
+	GetReactions(ctx context.Context, chatId uuid.UUID) ([]model.ChatReaction, error)
+	SearchChats(ctx context.Context, q ChatSearchQuery) ([]ChatSearchHit, bool, error)
 	Delete(ctx context.Context, id uuid.UUID) ([]string, error)
+	HideForUser(ctx context.Context, chatId uuid.UUID, userId uuid.UUID) ([]string, error)
+	DeleteForEveryone(ctx context.Context, chatId uuid.UUID) ([]string, error)
 }
 
 type ChatRepository struct {
@@ -53,9 +74,11 @@ func (r *ChatRepository) Save(
 	query := `
 	WITH inserted_message AS (
 		INSERT INTO private_messages
-			(sender_id, receiver_id, reply_to, chat_text, post_id)
+			(sender_id, receiver_id, reply_to, chat_text, post_id, client_msg_id)
 		VALUES
-			($1, $2, $3, $4, $5)
+			($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (sender_id, client_msg_id) WHERE client_msg_id IS NOT NULL
+		DO NOTHING
 		RETURNING
 			id,
 			sender_id,
@@ -65,6 +88,12 @@ func (r *ChatRepository) Save(
 			post_id,
 			is_read,
 			created_at
+	),
+	unread_bump AS (
+		INSERT INTO conversation_state (user_id, partner_id, unread_count)
+		SELECT receiver_id, sender_id, 1 FROM inserted_message
+		ON CONFLICT (user_id, partner_id)
+		DO UPDATE SET unread_count = conversation_state.unread_count + 1, updated_at = now()
 	)
 	SELECT
 		im.id,
@@ -95,6 +124,7 @@ func (r *ChatRepository) Save(
 			d.ReplyTo,
 			d.ChatText,
 			d.PostId,
+			d.ClientMsgId,
 		).Scan(
 			// chat
 			&result.ChatData.Id,
@@ -114,17 +144,36 @@ func (r *ChatRepository) Save(
 		)
 	})
 
+	// insert nya ke skip sama ON CONFLICT, unread_bump nya juga ga jalan
+	if errors.Is(err, pgx.ErrNoRows) && d.ClientMsgId != nil {
+		return ChatWithSender{}, ErrDuplicateClientMsgId
+	}
+
 	return result, err
 }
 
-func (r *ChatRepository) GetChatBeetween(
-	ctx context.Context,
-	re uuid.UUID,
-	se uuid.UUID,
-) ([]model.ChatModel, error) {
+// posisi pesan di percakapan, urutan nya (created_at, id) biar pesan yang created_at nya sama tetep konsisten
+type ChatCursor struct {
+	CreatedAt time.Time
+	Id        uuid.UUID
+}
 
-	query := `
-		SELECT
+// Before sama After ga boleh di isi barengan, kalo dua duanya kosong yang diambil pesan paling baru
+type ChatPageQuery struct {
+	Before *ChatCursor
+	After  *ChatCursor
+	Limit  int
+}
+
+// Chats selalu urut dari yang paling lama
+type ChatPage struct {
+	Chats    []model.ChatModel
+	HasOlder bool
+	HasNewer bool
+}
+
+// kolom yang sama dipake di semua query halaman chat
+const chatPageColumns = `
 		pm.id,
 		pm.sender_id,
 		pm.receiver_id,
@@ -132,46 +181,204 @@ func (r *ChatRepository) GetChatBeetween(
 		pm.reply_to,
 		pm.chat_text,
 		pm.created_at,
+		pm.edited_at,
+		pm.deleted_at,
 		pm.is_read,
+		(pm.sender_id = $2) AS is_own
+`
 
-		(pm.sender_id = $3) AS is_own,
-
-		COALESCE(
-			(
-				SELECT json_agg(
-					json_build_object(
-						'id', pma.id,
-						'chat_id', pma.chat_id,
-						'file_name', pma.file_name,
-						'media_type', pma.media_type,
-						'size', pma.size,
-						'created_at', pma.created_at AT TIME ZONE 'UTC'
-					)
-				)
-				FROM private_messages_attachment pma
-				WHERE pma.chat_id = pm.id
-			),
-			'[]'
-		) AS attachments
-	FROM private_messages pm
-	WHERE
-		(pm.sender_id = $1 AND pm.receiver_id = $2)
-		OR
-		(pm.sender_id = $2 AND pm.receiver_id = $1)
-	ORDER BY pm.created_at;
+// filter percakapan pake least / greatest biar kena index private_messages_conversation_idx
+const chatConversationFilter = `
+		least(pm.sender_id, pm.receiver_id) = least($1::uuid, $2::uuid)
+		AND greatest(pm.sender_id, pm.receiver_id) = greatest($1::uuid, $2::uuid)
+`
+
+// pesan yang udah di "hapus untuk saya" sama user $2 ga ikut diambil
+const chatNotHiddenFilter = `
+		NOT EXISTS (
+			SELECT 1 FROM private_message_hidden h
+			WHERE h.chat_id = pm.id AND h.user_id = $2
+		)
+`
+
+func (r *ChatRepository) GetChatBeetween(
+	ctx context.Context,
+	re uuid.UUID,
+	se uuid.UUID,
+	q ChatPageQuery,
+) (ChatPage, error) {
+
+	var page ChatPage
+	var err error
+
+	if q.After != nil {
+		page.Chats, page.HasNewer, err = r.chatsAfter(ctx, re, se, *q.After, q.Limit, false)
+		page.HasOlder = true
+	} else {
+		page.Chats, page.HasOlder, err = r.chatsBefore(ctx, re, se, q.Before, q.Limit)
+		page.HasNewer = q.Before != nil
+	}
+
+	if err != nil {
+		return ChatPage{}, err
+	}
+
+	if err := r.attachAttachments(ctx, page.Chats); err != nil {
+		return ChatPage{}, err
+	}
+
+	if err := r.attachReactions(ctx, page.Chats, se); err != nil {
+		return ChatPage{}, err
+	}
+
+	return page, nil
+}
+
+// ambil pesan di sekitar chatId, setengah limit sebelum dan sisanya mulai dari chatId itu sendiri
+func (r *ChatRepository) GetChatAround(
+	ctx context.Context,
+	re uuid.UUID,
+	se uuid.UUID,
+	chatId uuid.UUID,
+	limit int,
+) (ChatPage, error) {
+
+	var target ChatCursor
+
+	err := r.Pool.QueryRow(ctx, `
+		SELECT pm.created_at, pm.id
+		FROM private_messages pm
+		WHERE pm.id = $3 AND `+chatConversationFilter,
+		re, se, chatId,
+	).Scan(&target.CreatedAt, &target.Id)
+
+	if err != nil {
+		return ChatPage{}, err
+	}
+
+	older, hasOlder, err := r.chatsBefore(ctx, re, se, &target, limit/2)
+	if err != nil {
+		return ChatPage{}, err
+	}
+
+	newer, hasNewer, err := r.chatsAfter(ctx, re, se, target, limit-limit/2, true)
+	if err != nil {
+		return ChatPage{}, err
+	}
+
+	page := ChatPage{
+		Chats:    append(older, newer...),
+		HasOlder: hasOlder,
+		HasNewer: hasNewer,
+	}
+
+	if err := r.attachAttachments(ctx, page.Chats); err != nil {
+		return ChatPage{}, err
+	}
+
+	if err := r.attachReactions(ctx, page.Chats, se); err != nil {
+		return ChatPage{}, err
+	}
+
+	return page, nil
+}
+
+// cursor nil artinya mulai dari pesan paling baru
+func (r *ChatRepository) chatsBefore(
+	ctx context.Context,
+	re uuid.UUID,
+	se uuid.UUID,
+	cursor *ChatCursor,
+	limit int,
+) ([]model.ChatModel, bool, error) {
+
+	if limit <= 0 {
+		return []model.ChatModel{}, true, nil
+	}
+
+	query := `SELECT ` + chatPageColumns + `
+		FROM private_messages pm
+		WHERE ` + chatConversationFilter + `
+		AND ` + chatNotHiddenFilter + `
+		AND ($3::timestamptz IS NULL OR (pm.created_at, pm.id) < ($3::timestamptz, $4::uuid))
+		ORDER BY pm.created_at DESC, pm.id DESC
+		LIMIT $5
 	`
 
-	rows, err := r.Pool.Query(ctx, query, re, se, se)
+	var cursorTime *time.Time
+	var cursorId *uuid.UUID
+	if cursor != nil {
+		cursorTime = &cursor.CreatedAt
+		cursorId = &cursor.Id
+	}
+
+	// ambil 1 lebih buat tau masih ada pesan lagi atau ngga
+	chats, err := r.scanChatPage(ctx, query, re, se, cursorTime, cursorId, limit+1)
+	if err != nil {
+		return nil, false, err
+	}
+
+	hasMore := len(chats) > limit
+	if hasMore {
+		chats = chats[:limit]
+	}
+
+	// query nya DESC, dibalik biar urut dari yang paling lama
+	for i, j := 0, len(chats)-1; i < j; i, j = i+1, j-1 {
+		chats[i], chats[j] = chats[j], chats[i]
+	}
+
+	return chats, hasMore, nil
+}
+
+func (r *ChatRepository) chatsAfter(
+	ctx context.Context,
+	re uuid.UUID,
+	se uuid.UUID,
+	cursor ChatCursor,
+	limit int,
+	inclusive bool,
+) ([]model.ChatModel, bool, error) {
+
+	op := ">"
+	if inclusive {
+		op = ">="
+	}
+
+	query := `SELECT ` + chatPageColumns + `
+		FROM private_messages pm
+		WHERE ` + chatConversationFilter + `
+		AND ` + chatNotHiddenFilter + `
+		AND (pm.created_at, pm.id) ` + op + ` ($3::timestamptz, $4::uuid)
+		ORDER BY pm.created_at ASC, pm.id ASC
+		LIMIT $5
+	`
+
+	chats, err := r.scanChatPage(ctx, query, re, se, cursor.CreatedAt, cursor.Id, limit+1)
+	if err != nil {
+		return nil, false, err
+	}
+
+	hasMore := len(chats) > limit
+	if hasMore {
+		chats = chats[:limit]
+	}
+
+	return chats, hasMore, nil
+}
+
+func (r *ChatRepository) scanChatPage(ctx context.Context, query string, args ...any) ([]model.ChatModel, error) {
+
+	rows, err := r.Pool.Query(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var chats []model.ChatModel
+	chats := make([]model.ChatModel, 0)
 
 	for rows.Next() {
 		var chat model.ChatModel
-		var rawAttachments json.RawMessage
 
 		if err := rows.Scan(
 			&chat.Id,
@@ -181,19 +388,14 @@ func (r *ChatRepository) GetChatBeetween(
 			&chat.ReplyTo,
 			&chat.ChatText,
 			&chat.CreatedAt,
+			&chat.EditedAt,
+			&chat.DeletedAt,
 			&chat.IsRead,
 			&chat.IsOwn,
-			&rawAttachments,
 		); err != nil {
 			return nil, err
 		}
 
-		var attachments []model.ChatAttachment
-		if err := json.Unmarshal(rawAttachments, &attachments); err != nil {
-			return nil, err
-		}
-
-		chat.Attachment = attachments
 		chats = append(chats, chat)
 	}
 
@@ -204,6 +406,99 @@ func (r *ChatRepository) GetChatBeetween(
 	return chats, nil
 }
 
+// attachment satu halaman diambil sekali query, bukan subquery per pesan
+func (r *ChatRepository) attachAttachments(ctx context.Context, chats []model.ChatModel) error {
+
+	if len(chats) == 0 {
+		return nil
+	}
+
+	ids := make([]uuid.UUID, 0, len(chats))
+	index := make(map[uuid.UUID]int, len(chats))
+
+	for i, c := range chats {
+		ids = append(ids, c.Id)
+		index[c.Id] = i
+		chats[i].Attachment = []model.ChatAttachment{}
+	}
+
+	rows, err := r.Pool.Query(ctx, `
+		SELECT id, chat_id, file_name, media_type, size, created_at
+		FROM private_messages_attachment
+		WHERE chat_id = ANY($1)
+		ORDER BY created_at, id
+	`, ids)
+
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var att model.ChatAttachment
+
+		if err := rows.Scan(
+			&att.Id,
+			&att.ChatId,
+			&att.FileName,
+			&att.MediaType,
+			&att.Size,
+			&att.CreatedAt,
+		); err != nil {
+			return err
+		}
+
+		i := index[att.ChatId]
+		chats[i].Attachment = append(chats[i].Attachment, att)
+	}
+
+	return rows.Err()
+}
+
+// reaksi satu halaman langsung di aggregate per emoji, viewer dipake buat ngisi ReactedByMe
+func (r *ChatRepository) attachReactions(ctx context.Context, chats []model.ChatModel, viewer uuid.UUID) error {
+
+	if len(chats) == 0 {
+		return nil
+	}
+
+	ids := make([]uuid.UUID, 0, len(chats))
+	index := make(map[uuid.UUID]int, len(chats))
+
+	for i, c := range chats {
+		ids = append(ids, c.Id)
+		index[c.Id] = i
+		chats[i].Reactions = []model.ReactionCount{}
+	}
+
+	rows, err := r.Pool.Query(ctx, `
+		SELECT chat_id, emoji, count(*), bool_or(user_id = $2)
+		FROM message_reactions
+		WHERE chat_id = ANY($1)
+		GROUP BY chat_id, emoji
+		ORDER BY chat_id, min(created_at), emoji
+	`, ids, viewer)
+
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var chatId uuid.UUID
+		var reaction model.ReactionCount
+
+		if err := rows.Scan(&chatId, &reaction.Emoji, &reaction.Count, &reaction.ReactedByMe); err != nil {
+			return err
+		}
+
+		i := index[chatId]
+		chats[i].Reactions = append(chats[i].Reactions, reaction)
+	}
+
+	return rows.Err()
+}
+
 func (r *ChatRepository) GetLastChat(ctx context.Context, userID uuid.UUID) ([]LatestChatQuery, error) {
 	query := `
 		SELECT DISTINCT ON (chat_partner_id)
@@ -215,6 +510,8 @@ func (r *ChatRepository) GetLastChat(ctx context.Context, userID uuid.UUID) ([]L
 			pm.post_id,
 			pm.is_read,
 			pm.created_at AT TIME ZONE 'UTC' AS created_at,
+			pm.edited_at,
+			pm.deleted_at,
 
 			(pm.sender_id = $1)            AS is_own,
 
@@ -223,6 +520,7 @@ func (r *ChatRepository) GetLastChat(ctx context.Context, userID uuid.UUID) ([]L
 			u.full_name                    AS partner_fullname,
 			u.username                     AS partner_username,
 			u.profile_picture              AS partner_profile_picture,
+			COALESCE(cst.unread_count, 0)  AS unread_count,
 
 			-- attachments as JSON
 			COALESCE(
@@ -252,10 +550,14 @@ func (r *ChatRepository) GetLastChat(ctx context.Context, userID uuid.UUID) ([]L
 				END AS chat_partner_id
 			FROM private_messages pm
 			WHERE
-				pm.sender_id = $1
-				OR pm.receiver_id = $1
+				(pm.sender_id = $1 OR pm.receiver_id = $1)
+				AND NOT EXISTS (
+					SELECT 1 FROM private_message_hidden h
+					WHERE h.chat_id = pm.id AND h.user_id = $1
+				)
 		) pm
 		JOIN users u ON u.id = pm.chat_partner_id
+		LEFT JOIN conversation_state cst ON cst.user_id = $1 AND cst.partner_id = pm.chat_partner_id
 		ORDER BY chat_partner_id, pm.created_at DESC;
 	`
 
@@ -274,6 +576,7 @@ func (r *ChatRepository) GetLastChat(ctx context.Context, userID uuid.UUID) ([]L
 		var chatData model.ChatModel
 		var partnerData model.User
 		var rawAttachments json.RawMessage
+		var unread int
 
 		err := rows.Scan(
 			&chatData.Id,
@@ -284,12 +587,15 @@ func (r *ChatRepository) GetLastChat(ctx context.Context, userID uuid.UUID) ([]L
 			&chatData.PostId,
 			&chatData.IsRead,
 			&chatData.CreatedAt,
+			&chatData.EditedAt,
+			&chatData.DeletedAt,
 			&chatData.IsOwn,
 
 			&partnerData.Id,
 			&partnerData.FullName,
 			&partnerData.Username,
 			&partnerData.ProfilePicture,
+			&unread,
 
 			&rawAttachments,
 		)
@@ -306,6 +612,7 @@ func (r *ChatRepository) GetLastChat(ctx context.Context, userID uuid.UUID) ([]L
 		queryData = append(queryData, LatestChatQuery{
 			ChatData:    chatData,
 			PartnerData: partnerData,
+			UnreadCount: unread,
 		})
 	}
 
@@ -313,9 +620,86 @@ func (r *ChatRepository) GetLastChat(ctx context.Context, userID uuid.UUID) ([]L
 
 }
 
-func (r *ChatRepository) MarkConversationAsRead(sender uuid.UUID, receiver uuid.UUID) error {
-	// TODO: implement mark chats as read
-	return nil
+// hasil tandain pesan udah dibaca, Count 0 artinya semua nya udah kebaca sebelumnya
+type ReadReceipt struct {
+	UpTo   ChatCursor
+	Count  int64
+	ReadAt time.Time
+}
+
+// semua pesan dari partner ke reader sampe pesan upTo (termasuk) ditandain udah dibaca.
+// upTo harus ada di percakapan mereka berdua, kalo ngga balikin pgx.ErrNoRows
+func (r *ChatRepository) MarkConversationAsRead(ctx context.Context, reader uuid.UUID, partner uuid.UUID, upTo uuid.UUID) (ReadReceipt, error) {
+
+	query := `
+	WITH target AS (
+		SELECT pm.created_at, pm.id
+		FROM private_messages pm
+		WHERE pm.id = $3 AND ` + chatConversationFilter + `
+	),
+	updated AS (
+		UPDATE private_messages pm
+		SET is_read = true, read_at = now()
+		FROM target t
+		WHERE pm.sender_id = $2
+			AND pm.receiver_id = $1
+			AND pm.is_read = false
+			AND (pm.created_at, pm.id) <= (t.created_at, t.id)
+		RETURNING pm.id
+	),
+	unread_drop AS (
+		UPDATE conversation_state
+		SET unread_count = greatest(unread_count - (SELECT count(*) FROM updated), 0), updated_at = now()
+		WHERE user_id = $1 AND partner_id = $2
+	)
+	SELECT t.created_at, t.id, (SELECT count(*) FROM updated), now()
+	FROM target t
+	`
+
+	var receipt ReadReceipt
+
+	err := r.Pool.QueryRow(ctx, query, reader, partner, upTo).Scan(
+		&receipt.UpTo.CreatedAt,
+		&receipt.UpTo.Id,
+		&receipt.Count,
+		&receipt.ReadAt,
+	)
+
+	if err != nil {
+		return ReadReceipt{}, err
+	}
+
+	return receipt, nil
+}
+
+// cuma percakapan yang masih ada pesan belum dibaca
+func (r *ChatRepository) GetUnreadCounts(ctx context.Context, userId uuid.UUID) ([]UnreadCount, error) {
+
+	query := `
+		SELECT partner_id, unread_count
+		FROM conversation_state
+		WHERE user_id = $1 AND unread_count > 0
+		ORDER BY updated_at DESC
+	`
+
+	rows, err := r.Pool.Query(ctx, query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make([]UnreadCount, 0)
+
+	for rows.Next() {
+		var c UnreadCount
+		if err := rows.Scan(&c.PartnerId, &c.UnreadCount); err != nil {
+			return nil, err
+		}
+
+		counts = append(counts, c)
+	}
+
+	return counts, rows.Err()
 }
 
 func (r *ChatRepository) GetChatById(ctx context.Context, chatId uuid.UUID) (model.ChatModel, error) {
@@ -329,7 +713,9 @@ func (r *ChatRepository) GetChatById(ctx context.Context, chatId uuid.UUID) (mod
 		pm.chat_text,
 		pm.post_id,
 		pm.is_read,
-		pm.created_at 
+		pm.created_at,
+		pm.edited_at,
+		pm.deleted_at
 	from private_messages pm
 	where pm.id = $1; 
 	`
@@ -346,6 +732,8 @@ func (r *ChatRepository) GetChatById(ctx context.Context, chatId uuid.UUID) (mod
 		&tmpData.PostId,
 		&tmpData.IsRead,
 		&tmpData.CreatedAt,
+		&tmpData.EditedAt,
+		&tmpData.DeletedAt,
 	)
 
 	if err != nil {
@@ -356,8 +744,219 @@ func (r *ChatRepository) GetChatById(ctx context.Context, chatId uuid.UUID) (mod
 
 }
 
+// cuma id sama created_at yang di isi, cukup buat bales ACK pesan yang duplikat
+func (r *ChatRepository) GetChatByClientMsgId(ctx context.Context, senderId uuid.UUID, clientMsgId string) (model.ChatModel, error) {
+
+	query := `
+	select
+		pm.id,
+		pm.created_at
+	from private_messages pm
+	where pm.sender_id = $1 and pm.client_msg_id = $2;
+	`
+
+	chat := model.ChatModel{SenderId: senderId, ClientMsgId: &clientMsgId}
+
+	err := r.Pool.QueryRow(ctx, query, senderId, clientMsgId).Scan(&chat.Id, &chat.CreatedAt)
+	if err != nil {
+		return model.ChatModel{}, err
+	}
+
+	return chat, nil
+}
+
+// isi lama nya dicatat dulu ke private_message_edits, baru chat_text nya diganti
+func (r *ChatRepository) EditChatText(ctx context.Context, chatId uuid.UUID, text string) (model.ChatModel, error) {
+
+	var chat model.ChatModel
+
+	err := pgx.BeginFunc(ctx, r.Pool, func(tx pgx.Tx) error {
+
+		var previous *string
+
+		err := tx.QueryRow(ctx, `
+			SELECT chat_text FROM private_messages WHERE id = $1 FOR UPDATE
+		`, chatId).Scan(&previous)
+
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, `
+			INSERT INTO private_message_edits (chat_id, previous_text)
+			VALUES ($1, $2)
+		`, chatId, previous)
+
+		if err != nil {
+			return err
+		}
+
+		return tx.QueryRow(ctx, `
+			UPDATE private_messages
+			SET chat_text = $2, edited_at = now()
+			WHERE id = $1
+			RETURNING id, sender_id, receiver_id, reply_to, chat_text, post_id, is_read, created_at, edited_at
+		`, chatId, text).Scan(
+			&chat.Id,
+			&chat.SenderId,
+			&chat.ReceiverId,
+			&chat.ReplyTo,
+			&chat.ChatText,
+			&chat.PostId,
+			&chat.IsRead,
+			&chat.CreatedAt,
+			&chat.EditedAt,
+		)
+	})
+
+	if err != nil {
+		return model.ChatModel{}, err
+	}
+
+	return chat, nil
+}
+
+// urut dari edit paling lama
+func (r *ChatRepository) GetChatEdits(ctx context.Context, chatId uuid.UUID) ([]model.ChatEdit, error) {
+
+	rows, err := r.Pool.Query(ctx, `
+		SELECT id, chat_id, previous_text, edited_at
+		FROM private_message_edits
+		WHERE chat_id = $1
+		ORDER BY edited_at, id
+	`, chatId)
+
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	edits := make([]model.ChatEdit, 0)
+
+	for rows.Next() {
+		var e model.ChatEdit
+		if err := rows.Scan(&e.Id, &e.ChatId, &e.PreviousText, &e.EditedAt); err != nil {
+			return nil, err
+		}
+
+		edits = append(edits, e)
+	}
+
+	return edits, rows.Err()
+}
+
+// added false kalo user udah pernah kasih emoji yang sama, count itu jumlah emoji tsb setelah di insert
+func (r *ChatRepository) AddReaction(ctx context.Context, chatId uuid.UUID, userId uuid.UUID, emoji string) (bool, int, error) {
+
+	var added bool
+	var count int
+
+	err := pgx.BeginFunc(ctx, r.Pool, func(tx pgx.Tx) error {
+
+		tag, err := tx.Exec(ctx, `
+			INSERT INTO message_reactions (chat_id, user_id, emoji)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (chat_id, user_id, emoji) DO NOTHING
+		`, chatId, userId, emoji)
+
+		if err != nil {
+			return err
+		}
+
+		added = tag.RowsAffected() > 0
+
+		return tx.QueryRow(ctx, `
+			SELECT count(*) FROM message_reactions WHERE chat_id = $1 AND emoji = $2
+		`, chatId, emoji).Scan(&count)
+	})
+
+	if err != nil {
+		return false, 0, err
+	}
+
+	return added, count, nil
+}
+
+// removed false kalo reaksi nya emang ga ada
+func (r *ChatRepository) RemoveReaction(ctx context.Context, chatId uuid.UUID, userId uuid.UUID, emoji string) (bool, int, error) {
+
+	var removed bool
+	var count int
+
+	err := pgx.BeginFunc(ctx, r.Pool, func(tx pgx.Tx) error {
+
+		tag, err := tx.Exec(ctx, `
+			DELETE FROM message_reactions
+			WHERE chat_id = $1 AND user_id = $2 AND emoji = $3
+		`, chatId, userId, emoji)
+
+		if err != nil {
+			return err
+		}
+
+		removed = tag.RowsAffected() > 0
+
+		return tx.QueryRow(ctx, `
+			SELECT count(*) FROM message_reactions WHERE chat_id = $1 AND emoji = $2
+		`, chatId, emoji).Scan(&count)
+	})
+
+	if err != nil {
+		return false, 0, err
+	}
+
+	return removed, count, nil
+}
+
+// urut dari reaksi paling lama
+func (r *ChatRepository) GetReactions(ctx context.Context, chatId uuid.UUID) ([]model.ChatReaction, error) {
+
+	rows, err := r.Pool.Query(ctx, `
+		SELECT chat_id, user_id, emoji, created_at
+		FROM message_reactions
+		WHERE chat_id = $1
+		ORDER BY created_at, user_id
+	`, chatId)
+
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reactions := make([]model.ChatReaction, 0)
+
+	for rows.Next() {
+		var re model.ChatReaction
+		if err := rows.Scan(&re.ChatId, &re.UserId, &re.Emoji, &re.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		reactions = append(reactions, re)
+	}
+
+	return reactions, rows.Err()
+}
+
 func (r *ChatRepository) Delete(ctx context.Context, id uuid.UUID) ([]string, error) {
-	// TODO: implement delete chat by ID
+
+	var filesToDelete []string
+
+	err := pgx.BeginFunc(ctx, r.Pool, func(tx pgx.Tx) error {
+		var err error
+		filesToDelete, err = hardDeleteChat(ctx, tx, id)
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return filesToDelete, nil
+}
+
+// balikin nama file attachment yang harus dihapus dari storage
+func hardDeleteChat(ctx context.Context, tx pgx.Tx, id uuid.UUID) ([]string, error) {
+
 	query := `
 	WITH deleted_files AS (
 		DELETE FROM private_messages_attachment
@@ -367,35 +966,148 @@ func (r *ChatRepository) Delete(ctx context.Context, id uuid.UUID) ([]string, er
 	delete_chat AS (
 		DELETE FROM private_messages
 		WHERE id = $1
+		RETURNING sender_id, receiver_id, is_read
+	),
+	unread_drop AS (
+		UPDATE conversation_state cs
+		SET unread_count = greatest(cs.unread_count - 1, 0), updated_at = now()
+		FROM delete_chat d
+		WHERE d.is_read = false AND cs.user_id = d.receiver_id AND cs.partner_id = d.sender_id
 	)
 	SELECT file_name FROM deleted_files;
 	`
 
-	var filesToDelete []string = make([]string, 0)
+	rows, err := tx.Query(ctx, query, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, pgx.RowTo[string])
+}
+
+// pesan disembunyiin buat userId aja. kalo dua dua nya udah nyembunyiin,
+// ga ada lagi yang bisa liat pesan nya jadi row + attachment nya dihapus
+func (r *ChatRepository) HideForUser(ctx context.Context, chatId uuid.UUID, userId uuid.UUID) ([]string, error) {
+
+	filesToDelete := make([]string, 0)
 
 	err := pgx.BeginFunc(ctx, r.Pool, func(tx pgx.Tx) error {
 
-		rows, err := r.Pool.Query(ctx, query, id)
+		_, err := tx.Exec(ctx, `
+			INSERT INTO private_message_hidden (chat_id, user_id)
+			VALUES ($1, $2)
+			ON CONFLICT (chat_id, user_id) DO NOTHING
+		`, chatId, userId)
 
 		if err != nil {
 			return err
 		}
 
-		defer rows.Close()
+		// pesan belum dibaca yang disembunyiin penerima nya dianggap udah dibaca biar badge nya ga nyangkut
+		_, err = tx.Exec(ctx, `
+			WITH marked AS (
+				UPDATE private_messages
+				SET is_read = true, read_at = now()
+				WHERE id = $1 AND receiver_id = $2 AND is_read = false
+				RETURNING sender_id, receiver_id
+			)
+			UPDATE conversation_state cs
+			SET unread_count = greatest(cs.unread_count - 1, 0), updated_at = now()
+			FROM marked m
+			WHERE cs.user_id = m.receiver_id AND cs.partner_id = m.sender_id
+		`, chatId, userId)
 
-		for rows.Next() {
-			var fname string
-			if err := rows.Scan(&fname); err != nil {
-				return err
-			}
+		if err != nil {
+			return err
+		}
+
+		var stillVisible bool
+
+		err = tx.QueryRow(ctx, `
+			SELECT EXISTS (
+				SELECT 1
+				FROM private_messages pm
+				CROSS JOIN LATERAL (VALUES (pm.sender_id), (pm.receiver_id)) AS participant(user_id)
+				WHERE pm.id = $1
+				AND NOT EXISTS (
+					SELECT 1 FROM private_message_hidden h
+					WHERE h.chat_id = pm.id AND h.user_id = participant.user_id
+				)
+			)
+		`, chatId).Scan(&stillVisible)
+
+		if err != nil || stillVisible {
+			return err
+		}
+
+		filesToDelete, err = hardDeleteChat(ctx, tx, chatId)
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return filesToDelete, nil
+}
+
+// pesan jadi tombstone : isi, riwayat edit, reaksi dan attachment nya dihapus, row nya tetep ada.
+// kalo pesan nya udah dihapus sebelumnya balikin pgx.ErrNoRows
+func (r *ChatRepository) DeleteForEveryone(ctx context.Context, chatId uuid.UUID) ([]string, error) {
 
-			filesToDelete = append(filesToDelete, fname)
+	var filesToDelete []string
+
+	err := pgx.BeginFunc(ctx, r.Pool, func(tx pgx.Tx) error {
+
+		var id uuid.UUID
+
+		err := tx.QueryRow(ctx, `
+			WITH old AS (
+				SELECT id, sender_id, receiver_id, is_read
+				FROM private_messages
+				WHERE id = $1 AND deleted_at IS NULL
+				FOR UPDATE
+			),
+			tombstone AS (
+				UPDATE private_messages pm
+				SET deleted_at = now(), chat_text = NULL, post_id = NULL, is_read = true
+				FROM old
+				WHERE pm.id = old.id
+				RETURNING pm.id
+			),
+			unread_drop AS (
+				UPDATE conversation_state cs
+				SET unread_count = greatest(cs.unread_count - 1, 0), updated_at = now()
+				FROM old
+				WHERE old.is_read = false AND cs.user_id = old.receiver_id AND cs.partner_id = old.sender_id
+			)
+			SELECT id FROM tombstone
+		`, chatId).Scan(&id)
+
+		if err != nil {
+			return err
 		}
 
-		if err = rows.Err(); err != nil {
+		if _, err := tx.Exec(ctx, `DELETE FROM private_message_edits WHERE chat_id = $1`, chatId); err != nil {
 			return err
 		}
-		return nil
+
+		if _, err := tx.Exec(ctx, `DELETE FROM message_reactions WHERE chat_id = $1`, chatId); err != nil {
+			return err
+		}
+
+		rows, err := tx.Query(ctx, `
+			DELETE FROM private_messages_attachment
+			WHERE chat_id = $1
+			RETURNING file_name
+		`, chatId)
+
+		if err != nil {
+			return err
+		}
+
+		filesToDelete, err = pgx.CollectRows(rows, pgx.RowTo[string])
+		return err
 	})
 
 	if err != nil {
@@ -404,3 +1116,216 @@ func (r *ChatRepository) Delete(ctx context.Context, id uuid.UUID) ([]string, er
 
 	return filesToDelete, nil
 }
+
+// filter yang nil ga dipake. To itu batas atas eksklusif
+type ChatSearchQuery struct {
+	UserId        uuid.UUID
+	Text          string
+	PartnerId     *uuid.UUID
+	From          *time.Time
+	To            *time.Time
+	HasAttachment *bool
+	Before        *ChatCursor
+	Limit         int
+}
+
+type ChatSearchHit struct {
+	Chat model.ChatModel
+
+	// lawan chat, kalo pesan grup isinya pengirim pesan
+	Partner model.User
+
+	// nil kalo pesan nya dari chat private
+	Group *model.Conversation
+
+	Snippet       string
+	HasAttachment bool
+}
+
+// hasil urut dari pesan paling baru, dari chat private sama grup yang user nya masih jadi member.
+// Snippet nya potongan chat_text yang udah di escape html, kata yang cocok dibungkus <mark></mark>
+func (r *ChatRepository) SearchChats(ctx context.Context, q ChatSearchQuery) ([]ChatSearchHit, bool, error) {
+
+	// tiap cabang udah di limit sendiri biar ts_headline cuma jalan di hasil akhir.
+	// filter partner cuma berlaku buat chat private, jadi pesan grup ga ikut kalo diisi
+	query := `
+	WITH search AS (
+		SELECT websearch_to_tsquery('simple', $2) AS tsq
+	),
+	hits AS (
+		(
+			SELECT
+				pm.id,
+				pm.sender_id,
+				pm.receiver_id,
+				NULL::uuid AS conversation_id,
+				pm.reply_to,
+				pm.created_at,
+				pm.edited_at,
+				pm.chat_text,
+				att.has_attachment,
+				CASE WHEN pm.sender_id = $1 THEN pm.receiver_id ELSE pm.sender_id END AS partner_id
+			FROM private_messages pm
+			CROSS JOIN search
+			CROSS JOIN LATERAL (
+				SELECT EXISTS (SELECT 1 FROM private_messages_attachment a WHERE a.chat_id = pm.id) AS has_attachment
+			) att
+			WHERE (pm.sender_id = $1 OR pm.receiver_id = $1)
+				AND pm.chat_text_tsv @@ search.tsq
+				AND pm.deleted_at IS NULL
+				AND NOT EXISTS (
+					SELECT 1 FROM private_message_hidden h
+					WHERE h.chat_id = pm.id AND h.user_id = $1
+				)
+				AND ($3::uuid IS NULL OR least(pm.sender_id, pm.receiver_id) = least($1::uuid, $3::uuid)
+					AND greatest(pm.sender_id, pm.receiver_id) = greatest($1::uuid, $3::uuid))
+				AND ($4::timestamptz IS NULL OR pm.created_at >= $4)
+				AND ($5::timestamptz IS NULL OR pm.created_at < $5)
+				AND ($6::boolean IS NULL OR att.has_attachment = $6)
+				AND ($7::timestamptz IS NULL OR (pm.created_at, pm.id) < ($7::timestamptz, $8::uuid))
+			ORDER BY pm.created_at DESC, pm.id DESC
+			LIMIT $9
+		)
+		UNION ALL
+		(
+			SELECT
+				gm.id,
+				gm.sender_id,
+				NULL::uuid,
+				gm.conversation_id,
+				gm.reply_to,
+				gm.created_at,
+				NULL::timestamptz,
+				gm.chat_text,
+				att.has_attachment,
+				gm.sender_id
+			FROM group_messages gm
+			JOIN conversation_members cm ON cm.conversation_id = gm.conversation_id AND cm.user_id = $1
+			CROSS JOIN search
+			CROSS JOIN LATERAL (
+				SELECT EXISTS (SELECT 1 FROM group_messages_attachment a WHERE a.message_id = gm.id) AS has_attachment
+			) att
+			WHERE $3::uuid IS NULL
+				AND gm.chat_text_tsv @@ search.tsq
+				AND ($4::timestamptz IS NULL OR gm.created_at >= $4)
+				AND ($5::timestamptz IS NULL OR gm.created_at < $5)
+				AND ($6::boolean IS NULL OR att.has_attachment = $6)
+				AND ($7::timestamptz IS NULL OR (gm.created_at, gm.id) < ($7::timestamptz, $8::uuid))
+			ORDER BY gm.created_at DESC, gm.id DESC
+			LIMIT $9
+		)
+	)
+	SELECT
+		h.id,
+		h.sender_id,
+		h.receiver_id,
+		h.conversation_id,
+		h.reply_to,
+		h.created_at,
+		h.edited_at,
+		(h.sender_id = $1) AS is_own,
+		-- isi pesan di escape dulu biar html dari user ga ikut kerender bareng <mark>
+		ts_headline('simple',
+			replace(replace(replace(coalesce(h.chat_text, ''), '&', '&amp;'), '<', '&lt;'), '>', '&gt;'),
+			search.tsq,
+			'StartSel=<mark>, StopSel=</mark>, MaxFragments=2, MaxWords=20, MinWords=5, FragmentDelimiter=" ... "'),
+		h.has_attachment,
+
+		u.id,
+		u.username,
+		u.full_name,
+		u.profile_picture,
+
+		c.name,
+		c.avatar
+	FROM hits h
+	CROSS JOIN search
+	JOIN users u ON u.id = h.partner_id
+	LEFT JOIN conversations c ON c.id = h.conversation_id
+	ORDER BY h.created_at DESC, h.id DESC
+	LIMIT $9
+	`
+
+	var cursorTime *time.Time
+	var cursorId *uuid.UUID
+	if q.Before != nil {
+		cursorTime = &q.Before.CreatedAt
+		cursorId = &q.Before.Id
+	}
+
+	rows, err := r.Pool.Query(ctx, query,
+		q.UserId,
+		q.Text,
+		q.PartnerId,
+		q.From,
+		q.To,
+		q.HasAttachment,
+		cursorTime,
+		cursorId,
+		q.Limit+1,
+	)
+
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	hits := make([]ChatSearchHit, 0)
+
+	for rows.Next() {
+		var hit ChatSearchHit
+		var receiverId, groupId *uuid.UUID
+		var groupName, groupAvatar *string
+
+		if err := rows.Scan(
+			&hit.Chat.Id,
+			&hit.Chat.SenderId,
+			&receiverId,
+			&groupId,
+			&hit.Chat.ReplyTo,
+			&hit.Chat.CreatedAt,
+			&hit.Chat.EditedAt,
+			&hit.Chat.IsOwn,
+			&hit.Snippet,
+			&hit.HasAttachment,
+
+			&hit.Partner.Id,
+			&hit.Partner.Username,
+			&hit.Partner.FullName,
+			&hit.Partner.ProfilePicture,
+
+			&groupName,
+			&groupAvatar,
+		); err != nil {
+			return nil, false, err
+		}
+
+		if receiverId != nil {
+			hit.Chat.ReceiverId = *receiverId
+		}
+
+		if groupId != nil {
+			hit.Group = &model.Conversation{
+				Id:     *groupId,
+				Avatar: groupAvatar,
+			}
+
+			if groupName != nil {
+				hit.Group.Name = *groupName
+			}
+		}
+
+		hits = append(hits, hit)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, false, err
+	}
+
+	hasMore := len(hits) > q.Limit
+	if hasMore {
+		hits = hits[:q.Limit]
+	}
+
+	return hits, hasMore, nil
+}
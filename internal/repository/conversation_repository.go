@@ -0,0 +1,690 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Agmer17/golang_yapping/internal/model"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type GroupMessageWithSender struct {
+	Message model.GroupMessage
+	Sender  model.User
+}
+
+// hasil keluar dari grup. kalo yang keluar owner, NewOwner di isi member yang naik jadi owner.
+// kalo ga ada member tersisa grup nya dibubarin, Files sama Avatar harus dihapus dari storage
+type LeaveResult struct {
+	NewOwner  *uuid.UUID
+	Disbanded bool
+	Files     []string
+	Avatar    *string
+}
+
+type ConversationRepositoryInterface interface {
+	Create(ctx context.Context, c model.Conversation, ownerId uuid.UUID, memberIds []uuid.UUID) (model.Conversation, error)
+	GetById(ctx context.Context, id uuid.UUID) (model.Conversation, error)
+	ListForUser(ctx context.Context, userId uuid.UUID) ([]model.Conversation, error)
+	UpdateInfo(ctx context.Context, id uuid.UUID, name *string, avatar *string) (model.Conversation, *string, error)
+	GetMember(ctx context.Context, conversationId uuid.UUID, userId uuid.UUID) (model.ConversationMember, error)
+	GetMembers(ctx context.Context, conversationId uuid.UUID) ([]model.ConversationMember, error)
+	GetMemberIds(ctx context.Context, conversationId uuid.UUID) ([]uuid.UUID, error)
+	IsMember(ctx context.Context, conversationId uuid.UUID, userId uuid.UUID) (bool, error)
+	AddMembers(ctx context.Context, conversationId uuid.UUID, userIds []uuid.UUID) ([]uuid.UUID, error)
+	RemoveMember(ctx context.Context, conversationId uuid.UUID, userId uuid.UUID) (bool, error)
+	UpdateRole(ctx context.Context, conversationId uuid.UUID, userId uuid.UUID, role string) error
+	Leave(ctx context.Context, conversationId uuid.UUID, userId uuid.UUID) (LeaveResult, error)
+	SaveMessage(ctx context.Context, m model.GroupMessage) (GroupMessageWithSender, error)
+	SaveAttachments(ctx context.Context, list []model.ChatAttachment) error
+	GetMessages(ctx context.Context, conversationId uuid.UUID, viewer uuid.UUID, before *ChatCursor, limit int) ([]model.GroupMessage, bool, error)
+}
+
+type ConversationRepository struct {
+	Pool *pgxpool.Pool
+}
+
+func NewConversationRepo(pool *pgxpool.Pool) *ConversationRepository {
+	return &ConversationRepository{
+		Pool: pool,
+	}
+}
+
+const conversationColumns = `
+		c.id,
+		c.name,
+		c.avatar,
+		c.created_by,
+		c.created_at,
+		c.updated_at,
+		(SELECT count(*) FROM conversation_members m WHERE m.conversation_id = c.id) AS member_count
+`
+
+func scanConversation(row pgx.Row, c *model.Conversation, extra ...any) error {
+	dest := []any{
+		&c.Id,
+		&c.Name,
+		&c.Avatar,
+		&c.CreatedBy,
+		&c.CreatedAt,
+		&c.UpdatedAt,
+		&c.MemberCount,
+	}
+
+	return row.Scan(append(dest, extra...)...)
+}
+
+// user yang ga ada di tabel users di skip aja, owner selalu ikut masuk
+func (r *ConversationRepository) Create(ctx context.Context, c model.Conversation, ownerId uuid.UUID, memberIds []uuid.UUID) (model.Conversation, error) {
+
+	var created model.Conversation
+
+	err := pgx.BeginFunc(ctx, r.Pool, func(tx pgx.Tx) error {
+
+		var id uuid.UUID
+
+		err := tx.QueryRow(ctx, `
+			INSERT INTO conversations (name, avatar, created_by)
+			VALUES ($1, $2, $3)
+			RETURNING id
+		`, c.Name, c.Avatar, ownerId).Scan(&id)
+
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, `
+			INSERT INTO conversation_members (conversation_id, user_id, role)
+			VALUES ($1, $2, 'owner')
+		`, id, ownerId)
+
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, `
+			INSERT INTO conversation_members (conversation_id, user_id, role)
+			SELECT $1::uuid, u.id, 'member'
+			FROM users u
+			WHERE u.id = ANY($2)
+			ON CONFLICT (conversation_id, user_id) DO NOTHING
+		`, id, memberIds)
+
+		if err != nil {
+			return err
+		}
+
+		return scanConversation(tx.QueryRow(ctx, `
+			SELECT `+conversationColumns+`
+			FROM conversations c
+			WHERE c.id = $1
+		`, id), &created)
+	})
+
+	if err != nil {
+		return model.Conversation{}, err
+	}
+
+	created.MyRole = model.RoleOwner
+
+	return created, nil
+}
+
+func (r *ConversationRepository) GetById(ctx context.Context, id uuid.UUID) (model.Conversation, error) {
+
+	var c model.Conversation
+
+	err := scanConversation(r.Pool.QueryRow(ctx, `
+		SELECT `+conversationColumns+`
+		FROM conversations c
+		WHERE c.id = $1
+	`, id), &c)
+
+	if err != nil {
+		return model.Conversation{}, err
+	}
+
+	return c, nil
+}
+
+// urut dari grup yang paling baru ada aktivitas
+func (r *ConversationRepository) ListForUser(ctx context.Context, userId uuid.UUID) ([]model.Conversation, error) {
+
+	rows, err := r.Pool.Query(ctx, `
+		SELECT `+conversationColumns+`, me.role
+		FROM conversations c
+		JOIN conversation_members me ON me.conversation_id = c.id AND me.user_id = $1
+		ORDER BY greatest(
+			c.updated_at,
+			coalesce((SELECT max(gm.created_at) FROM group_messages gm WHERE gm.conversation_id = c.id), c.updated_at)
+		) DESC, c.id
+	`, userId)
+
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := make([]model.Conversation, 0)
+
+	for rows.Next() {
+		var c model.Conversation
+		if err := scanConversation(rows, &c, &c.MyRole); err != nil {
+			return nil, err
+		}
+
+		list = append(list, c)
+	}
+
+	return list, rows.Err()
+}
+
+// field yang nil ga diubah. balikin avatar lama kalo avatar nya diganti biar file nya bisa dihapus
+func (r *ConversationRepository) UpdateInfo(ctx context.Context, id uuid.UUID, name *string, avatar *string) (model.Conversation, *string, error) {
+
+	var updated model.Conversation
+	var oldAvatar *string
+
+	err := pgx.BeginFunc(ctx, r.Pool, func(tx pgx.Tx) error {
+
+		err := tx.QueryRow(ctx, `
+			SELECT avatar FROM conversations WHERE id = $1 FOR UPDATE
+		`, id).Scan(&oldAvatar)
+
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, `
+			UPDATE conversations
+			SET name = coalesce($2, name), avatar = coalesce($3, avatar), updated_at = now()
+			WHERE id = $1
+		`, id, name, avatar)
+
+		if err != nil {
+			return err
+		}
+
+		return scanConversation(tx.QueryRow(ctx, `
+			SELECT `+conversationColumns+`
+			FROM conversations c
+			WHERE c.id = $1
+		`, id), &updated)
+	})
+
+	if err != nil {
+		return model.Conversation{}, nil, err
+	}
+
+	if avatar == nil {
+		oldAvatar = nil
+	}
+
+	return updated, oldAvatar, nil
+}
+
+func (r *ConversationRepository) GetMember(ctx context.Context, conversationId uuid.UUID, userId uuid.UUID) (model.ConversationMember, error) {
+
+	var m model.ConversationMember
+
+	err := r.Pool.QueryRow(ctx, `
+		SELECT cm.conversation_id, cm.user_id, cm.role, cm.joined_at, u.username, u.full_name, u.profile_picture
+		FROM conversation_members cm
+		JOIN users u ON u.id = cm.user_id
+		WHERE cm.conversation_id = $1 AND cm.user_id = $2
+	`, conversationId, userId).Scan(
+		&m.ConversationId,
+		&m.UserId,
+		&m.Role,
+		&m.JoinedAt,
+		&m.Username,
+		&m.FullName,
+		&m.ProfilePicture,
+	)
+
+	if err != nil {
+		return model.ConversationMember{}, err
+	}
+
+	return m, nil
+}
+
+// urut owner, admin, terus member berdasarkan waktu join
+func (r *ConversationRepository) GetMembers(ctx context.Context, conversationId uuid.UUID) ([]model.ConversationMember, error) {
+
+	rows, err := r.Pool.Query(ctx, `
+		SELECT cm.conversation_id, cm.user_id, cm.role, cm.joined_at, u.username, u.full_name, u.profile_picture
+		FROM conversation_members cm
+		JOIN users u ON u.id = cm.user_id
+		WHERE cm.conversation_id = $1
+		ORDER BY array_position(ARRAY['owner', 'admin', 'member'], cm.role), cm.joined_at, cm.user_id
+	`, conversationId)
+
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := make([]model.ConversationMember, 0)
+
+	for rows.Next() {
+		var m model.ConversationMember
+
+		if err := rows.Scan(
+			&m.ConversationId,
+			&m.UserId,
+			&m.Role,
+			&m.JoinedAt,
+			&m.Username,
+			&m.FullName,
+			&m.ProfilePicture,
+		); err != nil {
+			return nil, err
+		}
+
+		members = append(members, m)
+	}
+
+	return members, rows.Err()
+}
+
+// dipake buat fan-out pesan ke room user:<id> tiap member
+func (r *ConversationRepository) GetMemberIds(ctx context.Context, conversationId uuid.UUID) ([]uuid.UUID, error) {
+
+	rows, err := r.Pool.Query(ctx, `
+		SELECT user_id FROM conversation_members WHERE conversation_id = $1
+	`, conversationId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+}
+
+func (r *ConversationRepository) IsMember(ctx context.Context, conversationId uuid.UUID, userId uuid.UUID) (bool, error) {
+
+	var exist bool
+
+	err := r.Pool.QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM conversation_members WHERE conversation_id = $1 AND user_id = $2
+		)
+	`, conversationId, userId).Scan(&exist)
+
+	return exist, err
+}
+
+// balikin user yang beneran baru masuk (yang udah jadi member atau ga ada di tabel users di skip)
+func (r *ConversationRepository) AddMembers(ctx context.Context, conversationId uuid.UUID, userIds []uuid.UUID) ([]uuid.UUID, error) {
+
+	var added []uuid.UUID
+
+	err := pgx.BeginFunc(ctx, r.Pool, func(tx pgx.Tx) error {
+
+		rows, err := tx.Query(ctx, `
+			INSERT INTO conversation_members (conversation_id, user_id, role)
+			SELECT $1::uuid, u.id, 'member'
+			FROM users u
+			WHERE u.id = ANY($2)
+			ON CONFLICT (conversation_id, user_id) DO NOTHING
+			RETURNING user_id
+		`, conversationId, userIds)
+
+		if err != nil {
+			return err
+		}
+
+		added, err = pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+		if err != nil {
+			return err
+		}
+
+		if len(added) == 0 {
+			return nil
+		}
+
+		_, err = tx.Exec(ctx, `UPDATE conversations SET updated_at = now() WHERE id = $1`, conversationId)
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return added, nil
+}
+
+// owner ga bisa di kick, owner harus keluar lewat Leave
+func (r *ConversationRepository) RemoveMember(ctx context.Context, conversationId uuid.UUID, userId uuid.UUID) (bool, error) {
+
+	tag, err := r.Pool.Exec(ctx, `
+		DELETE FROM conversation_members
+		WHERE conversation_id = $1 AND user_id = $2 AND role <> 'owner'
+	`, conversationId, userId)
+
+	if err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+// cuma buat admin <-> member, owner ga bisa diubah lewat sini
+func (r *ConversationRepository) UpdateRole(ctx context.Context, conversationId uuid.UUID, userId uuid.UUID, role string) error {
+
+	tag, err := r.Pool.Exec(ctx, `
+		UPDATE conversation_members
+		SET role = $3
+		WHERE conversation_id = $1 AND user_id = $2 AND role <> 'owner'
+	`, conversationId, userId, role)
+
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+
+	return nil
+}
+
+func (r *ConversationRepository) Leave(ctx context.Context, conversationId uuid.UUID, userId uuid.UUID) (LeaveResult, error) {
+
+	var result LeaveResult
+
+	err := pgx.BeginFunc(ctx, r.Pool, func(tx pgx.Tx) error {
+
+		// lock grup nya biar dua owner keluar barengan ga bikin grup tanpa owner
+		var avatar *string
+
+		err := tx.QueryRow(ctx, `
+			SELECT avatar FROM conversations WHERE id = $1 FOR UPDATE
+		`, conversationId).Scan(&avatar)
+
+		if err != nil {
+			return err
+		}
+
+		var role string
+
+		err = tx.QueryRow(ctx, `
+			DELETE FROM conversation_members
+			WHERE conversation_id = $1 AND user_id = $2
+			RETURNING role
+		`, conversationId, userId).Scan(&role)
+
+		if err != nil {
+			return err
+		}
+
+		var next uuid.UUID
+
+		// admin paling lama naik jadi owner, kalo ga ada admin member paling lama
+		err = tx.QueryRow(ctx, `
+			SELECT user_id
+			FROM conversation_members
+			WHERE conversation_id = $1
+			ORDER BY array_position(ARRAY['owner', 'admin', 'member'], role), joined_at, user_id
+			LIMIT 1
+		`, conversationId).Scan(&next)
+
+		if errors.Is(err, pgx.ErrNoRows) {
+			return disbandConversation(ctx, tx, conversationId, avatar, &result)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if role == model.RoleOwner {
+			_, err = tx.Exec(ctx, `
+				UPDATE conversation_members SET role = 'owner'
+				WHERE conversation_id = $1 AND user_id = $2
+			`, conversationId, next)
+
+			if err != nil {
+				return err
+			}
+
+			result.NewOwner = &next
+		}
+
+		_, err = tx.Exec(ctx, `UPDATE conversations SET updated_at = now() WHERE id = $1`, conversationId)
+		return err
+	})
+
+	if err != nil {
+		return LeaveResult{}, err
+	}
+
+	return result, nil
+}
+
+func disbandConversation(ctx context.Context, tx pgx.Tx, conversationId uuid.UUID, avatar *string, result *LeaveResult) error {
+
+	rows, err := tx.Query(ctx, `
+		SELECT a.file_name
+		FROM group_messages_attachment a
+		JOIN group_messages gm ON gm.id = a.message_id
+		WHERE gm.conversation_id = $1
+	`, conversationId)
+
+	if err != nil {
+		return err
+	}
+
+	files, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return err
+	}
+
+	// pesan, member sama attachment nya ikut kehapus lewat ON DELETE CASCADE
+	if _, err := tx.Exec(ctx, `DELETE FROM conversations WHERE id = $1`, conversationId); err != nil {
+		return err
+	}
+
+	result.Disbanded = true
+	result.Files = files
+	result.Avatar = avatar
+
+	return nil
+}
+
+// reply_to harus pesan di grup yang sama, kalo ngga balikin pgx.ErrNoRows
+func (r *ConversationRepository) SaveMessage(ctx context.Context, m model.GroupMessage) (GroupMessageWithSender, error) {
+
+	query := `
+	WITH inserted_message AS (
+		INSERT INTO group_messages (conversation_id, sender_id, reply_to, chat_text, post_id)
+		SELECT $1::uuid, $2::uuid, $3::uuid, $4::text, $5::uuid
+		WHERE $3::uuid IS NULL OR EXISTS (
+			SELECT 1 FROM group_messages WHERE id = $3 AND conversation_id = $1
+		)
+		RETURNING id, conversation_id, sender_id, reply_to, chat_text, post_id, created_at
+	)
+	SELECT
+		im.id,
+		im.conversation_id,
+		im.sender_id,
+		im.reply_to,
+		im.chat_text,
+		im.post_id,
+		im.created_at,
+
+		u.id,
+		u.username,
+		u.full_name,
+		u.profile_picture
+	FROM inserted_message im
+	JOIN users u ON u.id = im.sender_id
+	`
+
+	var result GroupMessageWithSender
+
+	err := r.Pool.QueryRow(ctx, query,
+		m.ConversationId,
+		m.SenderId,
+		m.ReplyTo,
+		m.ChatText,
+		m.PostId,
+	).Scan(
+		&result.Message.Id,
+		&result.Message.ConversationId,
+		&result.Message.SenderId,
+		&result.Message.ReplyTo,
+		&result.Message.ChatText,
+		&result.Message.PostId,
+		&result.Message.CreatedAt,
+
+		&result.Sender.Id,
+		&result.Sender.Username,
+		&result.Sender.FullName,
+		&result.Sender.ProfilePicture,
+	)
+
+	if err != nil {
+		return GroupMessageWithSender{}, err
+	}
+
+	result.Message.IsOwn = true
+
+	return result, nil
+}
+
+// ChatId di attachment nya diisi id pesan grup
+func (r *ConversationRepository) SaveAttachments(ctx context.Context, list []model.ChatAttachment) error {
+
+	return pgx.BeginFunc(ctx, r.Pool, func(tx pgx.Tx) error {
+		for _, m := range list {
+			_, err := tx.Exec(ctx, `
+				INSERT INTO group_messages_attachment (message_id, file_name, media_type, size)
+				VALUES ($1, $2, $3, $4)
+			`, m.ChatId, m.FileName, m.MediaType, m.Size)
+
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// sama kayak ChatRepository.chatsBefore, hasilnya urut dari pesan paling lama
+func (r *ConversationRepository) GetMessages(ctx context.Context, conversationId uuid.UUID, viewer uuid.UUID, before *ChatCursor, limit int) ([]model.GroupMessage, bool, error) {
+
+	var cursorTime *time.Time
+	var cursorId *uuid.UUID
+	if before != nil {
+		cursorTime = &before.CreatedAt
+		cursorId = &before.Id
+	}
+
+	rows, err := r.Pool.Query(ctx, `
+		SELECT gm.id, gm.conversation_id, gm.sender_id, gm.reply_to, gm.chat_text, gm.post_id, gm.created_at,
+			(gm.sender_id = $2) AS is_own
+		FROM group_messages gm
+		WHERE gm.conversation_id = $1
+		AND ($3::timestamptz IS NULL OR (gm.created_at, gm.id) < ($3::timestamptz, $4::uuid))
+		ORDER BY gm.created_at DESC, gm.id DESC
+		LIMIT $5
+	`, conversationId, viewer, cursorTime, cursorId, limit+1)
+
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	messages := make([]model.GroupMessage, 0)
+
+	for rows.Next() {
+		var m model.GroupMessage
+
+		if err := rows.Scan(
+			&m.Id,
+			&m.ConversationId,
+			&m.SenderId,
+			&m.ReplyTo,
+			&m.ChatText,
+			&m.PostId,
+			&m.CreatedAt,
+			&m.IsOwn,
+		); err != nil {
+			return nil, false, err
+		}
+
+		messages = append(messages, m)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, false, err
+	}
+
+	hasMore := len(messages) > limit
+	if hasMore {
+		messages = messages[:limit]
+	}
+
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+
+	if err := r.attachGroupAttachments(ctx, messages); err != nil {
+		return nil, false, err
+	}
+
+	return messages, hasMore, nil
+}
+
+func (r *ConversationRepository) attachGroupAttachments(ctx context.Context, messages []model.GroupMessage) error {
+
+	if len(messages) == 0 {
+		return nil
+	}
+
+	ids := make([]uuid.UUID, 0, len(messages))
+	index := make(map[uuid.UUID]int, len(messages))
+
+	for i, m := range messages {
+		ids = append(ids, m.Id)
+		index[m.Id] = i
+		messages[i].Attachment = []model.ChatAttachment{}
+	}
+
+	rows, err := r.Pool.Query(ctx, `
+		SELECT id, message_id, file_name, media_type, size, created_at
+		FROM group_messages_attachment
+		WHERE message_id = ANY($1)
+		ORDER BY created_at, id
+	`, ids)
+
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var att model.ChatAttachment
+
+		if err := rows.Scan(
+			&att.Id,
+			&att.ChatId,
+			&att.FileName,
+			&att.MediaType,
+			&att.Size,
+			&att.CreatedAt,
+		); err != nil {
+			return err
+		}
+
+		i := index[att.ChatId]
+		messages[i].Attachment = append(messages[i].Attachment, att)
+	}
+
+	return rows.Err()
+}
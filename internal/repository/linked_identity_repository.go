@@ -0,0 +1,112 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/Agmer17/golang_yapping/internal/model"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type LinkedIdentityRepoInterface interface {
+	FindByProviderSubject(ctx context.Context, provider string, subject string) (model.LinkedIdentity, error)
+	Link(ctx context.Context, identity model.LinkedIdentity) error
+	CreateUserWithIdentity(ctx context.Context, user model.User, identity model.LinkedIdentity) (model.User, error)
+}
+
+type LinkedIdentityRepo struct {
+	Pool *pgxpool.Pool
+}
+
+func NewLinkedIdentityRepo(pool *pgxpool.Pool) *LinkedIdentityRepo {
+	return &LinkedIdentityRepo{
+		Pool: pool,
+	}
+}
+
+func (r *LinkedIdentityRepo) FindByProviderSubject(ctx context.Context, provider string, subject string) (model.LinkedIdentity, error) {
+
+	query := `
+		select id, user_id, provider, subject, email, created_at
+		from linked_identities
+		where provider = $1 and subject = $2
+		limit 1
+	`
+
+	var li model.LinkedIdentity
+
+	err := r.Pool.QueryRow(ctx, query, provider, subject).Scan(
+		&li.Id,
+		&li.UserId,
+		&li.Provider,
+		&li.Subject,
+		&li.Email,
+		&li.CreatedAt,
+	)
+
+	if err != nil {
+		return model.LinkedIdentity{}, err
+	}
+
+	return li, nil
+}
+
+// kalo (provider, subject) udah ke link ga error, biar request callback yang dobel tetep aman
+func (r *LinkedIdentityRepo) Link(ctx context.Context, identity model.LinkedIdentity) error {
+
+	query := `
+		insert into linked_identities (user_id, provider, subject, email)
+		values ($1, $2, $3, $4)
+		on conflict (provider, subject) do nothing
+	`
+
+	_, err := r.Pool.Exec(ctx, query, identity.UserId, identity.Provider, identity.Subject, identity.Email)
+
+	return err
+}
+
+// user dari OIDC langsung aktif karena email nya udah diverifikasi sama provider
+func (r *LinkedIdentityRepo) CreateUserWithIdentity(ctx context.Context, user model.User, identity model.LinkedIdentity) (model.User, error) {
+
+	var nu model.User
+
+	err := pgx.BeginFunc(ctx, r.Pool, func(tx pgx.Tx) error {
+
+		err := tx.QueryRow(ctx, `
+			insert into users (username, full_name, email, password, is_activated)
+			values ($1, $2, $3, $4, true)
+			returning id, username, full_name, email, password, role, created_at, is_activated
+		`,
+			user.Username,
+			user.FullName,
+			user.Email,
+			user.Password,
+		).Scan(
+			&nu.Id,
+			&nu.Username,
+			&nu.FullName,
+			&nu.Email,
+			&nu.Password,
+			&nu.Role,
+			&nu.CreatedAt,
+			&nu.IsActivate,
+		)
+
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, `
+			insert into linked_identities (user_id, provider, subject, email)
+			values ($1, $2, $3, $4)
+		`, nu.Id, identity.Provider, identity.Subject, identity.Email)
+
+		return err
+	})
+
+	if err != nil {
+		return model.User{}, err
+	}
+
+	return nu, nil
+}
@@ -0,0 +1,137 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type UserPresence struct {
+	UserId       uuid.UUID
+	LastSeen     *time.Time
+	HideLastSeen bool
+}
+
+type PresenceRepositoryInterface interface {
+	UpdateLastSeen(ctx context.Context, userId uuid.UUID, at time.Time) error
+	GetPresence(ctx context.Context, viewer uuid.UUID, userIds []uuid.UUID) ([]UserPresence, error)
+	SharesConversation(ctx context.Context, userId uuid.UUID, otherId uuid.UUID) (bool, error)
+	SetHideLastSeen(ctx context.Context, userId uuid.UUID, hide bool) error
+	GetChatPartnerIds(ctx context.Context, userId uuid.UUID) ([]uuid.UUID, error)
+}
+
+type PresenceRepository struct {
+	Pool *pgxpool.Pool
+}
+
+func NewPresenceRepo(pool *pgxpool.Pool) *PresenceRepository {
+	return &PresenceRepository{
+		Pool: pool,
+	}
+}
+
+func (r *PresenceRepository) UpdateLastSeen(ctx context.Context, userId uuid.UUID, at time.Time) error {
+
+	_, err := r.Pool.Exec(ctx, `
+		UPDATE users SET last_seen_at = $2 WHERE id = $1
+	`, userId, at)
+
+	return err
+}
+
+// cuma user yang satu percakapan sama viewer (pernah chat pribadi atau satu grup) atau viewer
+// nya sendiri yang dibalikin, user yang ga ada / ga nyambung sama sekali ga ikut
+func (r *PresenceRepository) GetPresence(ctx context.Context, viewer uuid.UUID, userIds []uuid.UUID) ([]UserPresence, error) {
+
+	rows, err := r.Pool.Query(ctx, `
+		SELECT u.id, u.last_seen_at, u.hide_last_seen
+		FROM users u
+		WHERE u.id = ANY($2)
+		AND (
+			u.id = $1
+			OR EXISTS (
+				SELECT 1 FROM conversation_state cs
+				WHERE (cs.user_id = $1 AND cs.partner_id = u.id) OR (cs.user_id = u.id AND cs.partner_id = $1)
+			)
+			OR EXISTS (
+				SELECT 1 FROM conversation_members a
+				JOIN conversation_members b ON b.conversation_id = a.conversation_id
+				WHERE a.user_id = $1 AND b.user_id = u.id
+			)
+		)
+	`, viewer, userIds)
+
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]UserPresence, 0, len(userIds))
+
+	for rows.Next() {
+		var p UserPresence
+		if err := rows.Scan(&p.UserId, &p.LastSeen, &p.HideLastSeen); err != nil {
+			return nil, err
+		}
+
+		result = append(result, p)
+	}
+
+	return result, rows.Err()
+}
+
+// sama kayak filter di GetPresence, dipake buat ngecek target TYPING_START
+func (r *PresenceRepository) SharesConversation(ctx context.Context, userId uuid.UUID, otherId uuid.UUID) (bool, error) {
+
+	var shared bool
+
+	err := r.Pool.QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM conversation_state cs
+			WHERE (cs.user_id = $1 AND cs.partner_id = $2) OR (cs.user_id = $2 AND cs.partner_id = $1)
+		)
+		OR EXISTS (
+			SELECT 1 FROM conversation_members a
+			JOIN conversation_members b ON b.conversation_id = a.conversation_id
+			WHERE a.user_id = $1 AND b.user_id = $2
+		)
+	`, userId, otherId).Scan(&shared)
+
+	return shared, err
+}
+
+func (r *PresenceRepository) SetHideLastSeen(ctx context.Context, userId uuid.UUID, hide bool) error {
+
+	tag, err := r.Pool.Exec(ctx, `
+		UPDATE users SET hide_last_seen = $2 WHERE id = $1
+	`, userId, hide)
+
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+
+	return nil
+}
+
+// semua user yang pernah chat pribadi sama userId, dipake buat ngabarin perubahan online / offline
+func (r *PresenceRepository) GetChatPartnerIds(ctx context.Context, userId uuid.UUID) ([]uuid.UUID, error) {
+
+	rows, err := r.Pool.Query(ctx, `
+		SELECT partner_id FROM conversation_state WHERE user_id = $1
+		UNION
+		SELECT user_id FROM conversation_state WHERE partner_id = $1
+	`, userId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+}
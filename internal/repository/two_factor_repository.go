@@ -0,0 +1,183 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Agmer17/golang_yapping/internal/model"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// recovery code ga ketemu atau udah pernah dipake
+var ErrRecoveryCodeInvalid = errors.New("recovery code tidak valid")
+
+type TwoFactorRepoInterface interface {
+	GetTwoFactor(ctx context.Context, userId uuid.UUID) (model.TwoFactor, error)
+	SetPendingSecret(ctx context.Context, userId uuid.UUID, secret string) error
+	Enable(ctx context.Context, userId uuid.UUID, recoveryHashes []string) error
+	Disable(ctx context.Context, userId uuid.UUID) error
+	ReplaceRecoveryCodes(ctx context.Context, userId uuid.UUID, recoveryHashes []string) error
+	UseRecoveryCode(ctx context.Context, userId uuid.UUID, codeHash string) error
+	ReplaceSecret(ctx context.Context, userId uuid.UUID, oldSecret string, newSecret string) error
+}
+
+type TwoFactorRepo struct {
+	Pool *pgxpool.Pool
+}
+
+func NewTwoFactorRepo(pool *pgxpool.Pool) *TwoFactorRepo {
+	return &TwoFactorRepo{
+		Pool: pool,
+	}
+}
+
+func (r *TwoFactorRepo) GetTwoFactor(ctx context.Context, userId uuid.UUID) (model.TwoFactor, error) {
+
+	query := `
+		select id, totp_secret, totp_enabled
+		from users
+		where id = $1
+		limit 1
+	`
+
+	var tf model.TwoFactor
+
+	err := r.Pool.QueryRow(ctx, query, userId).Scan(
+		&tf.UserId,
+		&tf.Secret,
+		&tf.Enabled,
+	)
+
+	if err != nil {
+		return model.TwoFactor{}, err
+	}
+
+	return tf, nil
+}
+
+// secret baru cuma boleh ditimpa kalo 2FA nya belum aktif
+func (r *TwoFactorRepo) SetPendingSecret(ctx context.Context, userId uuid.UUID, secret string) error {
+
+	query := `
+		update users
+		set totp_secret = $1
+		where id = $2 and totp_enabled = false
+	`
+
+	tag, err := r.Pool.Exec(ctx, query, secret, userId)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+
+	return nil
+}
+
+func (r *TwoFactorRepo) Enable(ctx context.Context, userId uuid.UUID, recoveryHashes []string) error {
+
+	return pgx.BeginFunc(ctx, r.Pool, func(tx pgx.Tx) error {
+
+		tag, err := tx.Exec(ctx, `
+			update users
+			set totp_enabled = true
+			where id = $1 and totp_secret is not null and totp_enabled = false
+		`, userId)
+
+		if err != nil {
+			return err
+		}
+
+		if tag.RowsAffected() == 0 {
+			return pgx.ErrNoRows
+		}
+
+		return replaceRecoveryCodes(ctx, tx, userId, recoveryHashes)
+	})
+}
+
+func (r *TwoFactorRepo) Disable(ctx context.Context, userId uuid.UUID) error {
+
+	return pgx.BeginFunc(ctx, r.Pool, func(tx pgx.Tx) error {
+
+		_, err := tx.Exec(ctx, `
+			update users
+			set totp_enabled = false, totp_secret = null
+			where id = $1
+		`, userId)
+
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, `delete from user_recovery_codes where user_id = $1`, userId)
+
+		return err
+	})
+}
+
+func (r *TwoFactorRepo) ReplaceRecoveryCodes(ctx context.Context, userId uuid.UUID, recoveryHashes []string) error {
+
+	return pgx.BeginFunc(ctx, r.Pool, func(tx pgx.Tx) error {
+		return replaceRecoveryCodes(ctx, tx, userId, recoveryHashes)
+	})
+}
+
+// cuma ditimpa kalo isi nya masih sama, biar ga nimpa secret baru dari enrollment yang jalan barengan
+func (r *TwoFactorRepo) ReplaceSecret(ctx context.Context, userId uuid.UUID, oldSecret string, newSecret string) error {
+
+	query := `
+		update users
+		set totp_secret = $1
+		where id = $2 and totp_secret = $3
+	`
+
+	_, err := r.Pool.Exec(ctx, query, newSecret, userId, oldSecret)
+
+	return err
+}
+
+func (r *TwoFactorRepo) UseRecoveryCode(ctx context.Context, userId uuid.UUID, codeHash string) error {
+
+	query := `
+		update user_recovery_codes
+		set used_at = now()
+		where user_id = $1 and code_hash = $2 and used_at is null
+	`
+
+	tag, err := r.Pool.Exec(ctx, query, userId, codeHash)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrRecoveryCodeInvalid
+	}
+
+	return nil
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx pgx.Tx, userId uuid.UUID, recoveryHashes []string) error {
+
+	if _, err := tx.Exec(ctx, `delete from user_recovery_codes where user_id = $1`, userId); err != nil {
+		return err
+	}
+
+	rows := make([][]any, 0, len(recoveryHashes))
+	for _, h := range recoveryHashes {
+		rows = append(rows, []any{userId, h})
+	}
+
+	_, err := tx.CopyFrom(
+		ctx,
+		pgx.Identifier{"user_recovery_codes"},
+		[]string{"user_id", "code_hash"},
+		pgx.CopyFromRows(rows),
+	)
+
+	return err
+}
@@ -13,6 +13,7 @@ import (
 type UserRepositoryInterface interface {
 	GetUserDataByUsername(string, context.Context) (*model.User, error)
 	GetUserDataById(uuid.UUID, context.Context) (*model.User, error)
+	GetUserDataByEmail(string, context.Context) (*model.User, error)
 	AddUser(model.User, context.Context) (model.User, error)
 	DeleteUser(uuid.UUID, context.Context) error
 	EditUser(model.User, context.Context) (model.User, error)
@@ -195,3 +196,48 @@ func (u *UserRepository) GetUserDataById(id uuid.UUID, ctx context.Context) (*mo
 	return &user, nil
 
 }
+
+func (u *UserRepository) GetUserDataByEmail(email string, ctx context.Context) (*model.User, error) {
+
+	q := `
+		select id, 
+			full_name, 
+			username, 
+			email, 
+			role,
+			password, 
+			birthday, 
+			bio, 
+			profile_picture, 
+			banner_picture, 
+			created_at,
+			is_activated
+		from users
+		where email = $1
+		limit 1
+		`
+
+	var user model.User
+
+	err := u.Pool.QueryRow(ctx, q, email).Scan(
+		&user.Id,
+		&user.FullName,
+		&user.Username,
+		&user.Email,
+		&user.Role,
+		&user.Password,
+		&user.Birthday,
+		&user.Bio,
+		&user.ProfilePicture,
+		&user.BannerPicture,
+		&user.CreatedAt,
+		&user.IsActivate,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+
+}
@@ -1,13 +1,23 @@
 package repository
 
 import (
+	"context"
+	"errors"
+
 	"github.com/Agmer17/golang_yapping/internal/model"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// dibalikin kalo token udah pernah dipake (used_at udah ke isi)
+var ErrVerificationCodeUsed = errors.New("token verifikasi sudah digunakan")
+
 type VerificationRepoInterface interface {
-	SetVerificationCode(payload model.VerificationModel) error
-	FindVerificationCode(token string, verifType string) (model.VerificationModel, error)
+	ReplaceVerificationCode(ctx context.Context, payload model.VerificationModel) error
+	FindVerificationCode(ctx context.Context, token string, verifType string) (model.VerificationModel, error)
+	ActivateAccount(ctx context.Context, codeId uuid.UUID, userId uuid.UUID) error
+	ResetPassword(ctx context.Context, codeId uuid.UUID, userId uuid.UUID, hashedPassword string) error
 }
 
 type VerificationRepo struct {
@@ -21,12 +31,113 @@ func NewVerificationRepo(pool *pgxpool.Pool) *VerificationRepo {
 	}
 }
 
-func (vr *VerificationRepo) SetVerificationCode(payload model.VerificationModel) error {
+// token lama user yang tipe nya sama ditandain used di transaksi yang sama, jadi cuma token terakhir yang valid.
+// kalo insert nya gagal token lama nya ga ikut ke-invalidate
+func (vr *VerificationRepo) ReplaceVerificationCode(ctx context.Context, payload model.VerificationModel) error {
 
-	return nil
+	return pgx.BeginFunc(ctx, vr.Pool, func(tx pgx.Tx) error {
+
+		_, err := tx.Exec(ctx, `
+			update verification_codes
+			set used_at = now()
+			where user_id = $1 and type = $2 and used_at is null
+		`, payload.UserId, payload.Type)
+
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, `
+			insert into verification_codes(user_id, token, type, expires_at)
+			values($1, $2, $3, $4)
+		`,
+			payload.UserId,
+			payload.Token,
+			payload.Type,
+			payload.ExpiresAt,
+		)
+
+		return err
+	})
+}
+
+func (vr *VerificationRepo) FindVerificationCode(ctx context.Context, token string, verifType string) (model.VerificationModel, error) {
+
+	query := `
+		select
+			id,
+			user_id,
+			token,
+			type,
+			used_at,
+			expires_at,
+			created_at
+		from verification_codes
+		where token = $1 and type = $2
+		limit 1
+	`
+
+	var code model.VerificationModel
+
+	err := vr.Pool.QueryRow(ctx, query, token, verifType).Scan(
+		&code.Id,
+		&code.UserId,
+		&code.Token,
+		&code.Type,
+		&code.UsedAt,
+		&code.ExpiresAt,
+		&code.CreatedAt,
+	)
+
+	if err != nil {
+		return model.VerificationModel{}, err
+	}
+
+	return code, nil
 }
 
-func (vr *VerificationRepo) FindVerificationCode(token string, verifType string) (model.VerificationModel, error) {
+func (vr *VerificationRepo) ActivateAccount(ctx context.Context, codeId uuid.UUID, userId uuid.UUID) error {
+
+	return pgx.BeginFunc(ctx, vr.Pool, func(tx pgx.Tx) error {
+		if err := consumeCode(ctx, tx, codeId); err != nil {
+			return err
+		}
 
-	return model.VerificationModel{}, nil
+		_, err := tx.Exec(ctx, `update users set is_activated = true where id = $1`, userId)
+
+		return err
+	})
+}
+
+func (vr *VerificationRepo) ResetPassword(ctx context.Context, codeId uuid.UUID, userId uuid.UUID, hashedPassword string) error {
+
+	return pgx.BeginFunc(ctx, vr.Pool, func(tx pgx.Tx) error {
+		if err := consumeCode(ctx, tx, codeId); err != nil {
+			return err
+		}
+
+		_, err := tx.Exec(ctx, `update users set password = $1 where id = $2`, hashedPassword, userId)
+
+		return err
+	})
+}
+
+// used_at is null di where biar kalo ada 2 request barengan cuma satu yang lolos
+func consumeCode(ctx context.Context, tx pgx.Tx, codeId uuid.UUID) error {
+
+	tag, err := tx.Exec(ctx, `
+		update verification_codes
+		set used_at = now()
+		where id = $1 and used_at is null
+	`, codeId)
+
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrVerificationCodeUsed
+	}
+
+	return nil
 }
@@ -3,7 +3,10 @@ package service
 import (
 	"context"
 	"errors"
+	"fmt"
+	"math"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/Agmer17/golang_yapping/internal/event"
@@ -19,80 +22,132 @@ import (
 
 type ResponseSchema map[string]any
 
+const (
+	loginChallengeTTL         = 5 * time.Minute
+	loginChallengeMaxAttempts = 5
+)
+
+// url depan link yang dikirim lewat email, token nya ditambahin di belakang.
+// dua duanya wajib diisi, link email ga boleh dibikin dari header Host request
+// soalnya header itu bisa diisi bebas sama client (password reset poisoning)
+type AuthLinkConfig struct {
+	ActivationURL    string
+	ResetPasswordURL string
+}
+
+func (l AuthLinkConfig) Validate() error {
+	if l.ActivationURL == "" || l.ResetPasswordURL == "" {
+		return errors.New("url link aktivasi dan reset password wajib diisi")
+	}
+
+	return nil
+}
+
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("yapping-dummy-password"), bcrypt.DefaultCost)
+
 type AuthServiceInterface interface {
-	LoginService(string, string, context.Context) (ResponseSchema, *customerrors.ServiceErrors)
-	SignUp(username, email, fullName, password, host string, c context.Context) (ResponseSchema, *customerrors.ServiceErrors)
+	LoginService(string, string, SessionMeta, context.Context) (ResponseSchema, *customerrors.ServiceErrors)
+	CompleteTwoFactorLogin(challengeToken string, code string, meta SessionMeta, c context.Context) (ResponseSchema, *customerrors.ServiceErrors)
+	SignUp(username, email, fullName, password string, c context.Context) (ResponseSchema, *customerrors.ServiceErrors)
 	RefreshSession(token string, c context.Context) (ResponseSchema, *customerrors.ServiceErrors)
+	ActivateAccount(token string, c context.Context) *customerrors.ServiceErrors
+	ResendActivation(email string, c context.Context) *customerrors.ServiceErrors
+	ForgotPassword(email string, c context.Context) *customerrors.ServiceErrors
+	CheckResetToken(token string, c context.Context) *customerrors.ServiceErrors
+	ResetPassword(token string, newPassword string, c context.Context) *customerrors.ServiceErrors
+	Logout(refreshToken string, accessToken string, c context.Context) *customerrors.ServiceErrors
+	LogoutAll(userId uuid.UUID, c context.Context) *customerrors.ServiceErrors
+	GetSessions(userId uuid.UUID, currentSession string, c context.Context) ([]SessionInfo, *customerrors.ServiceErrors)
+	RevokeSession(userId uuid.UUID, sessionId string, c context.Context) *customerrors.ServiceErrors
+	RevokeUserAccess(userId uuid.UUID, c context.Context) *customerrors.ServiceErrors
 }
 
 type AuthService struct {
 	UserRepo    repository.UserRepositoryInterface
 	RedisClient *redis.Client
 	bus         *event.EventBus
+	verifSvc    VerificationServiceInterface
+	Sessions    *SessionRegistry
+	Revocation  TokenRevocationInterface
+	twoFactor   TwoFactorServiceInterface
+	guard       *LoginGuard
+	links       AuthLinkConfig
 }
 
-func NewAuthService(repo *repository.UserRepository, redclient *redis.Client, bus *event.EventBus) *AuthService {
+func NewAuthService(
+	repo *repository.UserRepository,
+	redclient *redis.Client,
+	bus *event.EventBus,
+	verifSvc *VerificationService,
+	revocation *TokenRevocation,
+	twoFactor *TwoFactorService,
+	links AuthLinkConfig,
+) *AuthService {
 	return &AuthService{
 		UserRepo:    repo,
 		RedisClient: redclient,
 		bus:         bus,
+		verifSvc:    verifSvc,
+		Sessions:    NewSessionRegistry(redclient),
+		Revocation:  revocation,
+		twoFactor:   twoFactor,
+		guard:       NewLoginGuard(redclient),
+		links:       links,
 	}
 }
 
 func (a *AuthService) setRedisSession(
-	uId string,
+	uId uuid.UUID,
+	sessionId string,
 	refreshToken string,
+	meta SessionMeta,
 	ctx context.Context,
 ) error {
 
-	key := "session:" + refreshToken
-
 	refreshClaims, err := pkg.VerifyRefreshToken(refreshToken)
 
 	if err != nil {
 		return err
 	}
 
-	expiresAt := refreshClaims.ExpiresAt.Time
-	ttl := time.Until(expiresAt)
-
-	data := map[string]any{
-		"user_id":       uId,
-		"refresh_token": refreshToken,
-		"expires_at":    expiresAt.Format(time.RFC3339),
-		"created_at":    time.Now().Format(time.RFC3339),
-	}
+	return a.Sessions.Create(ctx, sessionId, uId, refreshToken, refreshClaims.ExpiresAt.Time, meta)
+}
 
-	// set hashmap
-	if err := a.RedisClient.HSet(ctx, key, data).Err(); err != nil {
-		return err
+func (a *AuthService) LoginService(username string, pw string, meta SessionMeta, ctx context.Context) (ResponseSchema, *customerrors.ServiceErrors) {
+	lockedFor, err := a.guard.LockedFor(ctx, username, meta.Ip)
+	if err != nil {
+		return nil, customerrors.New(http.StatusInternalServerError, "ada kesalahan di server error : "+err.Error())
 	}
 
-	// set TTL Redis SESUAI exp refresh token
-	if err := a.RedisClient.Expire(ctx, key, ttl).Err(); err != nil {
-		return err
+	if lockedFor > 0 {
+		return nil, tooManyLoginAttempts(lockedFor)
 	}
 
-	return nil
-}
-
-func (a *AuthService) LoginService(username string, pw string, ctx context.Context) (ResponseSchema, *customerrors.ServiceErrors) {
 	data, err := a.UserRepo.GetUserDataByUsername(username, ctx)
 
-	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			return nil, &customerrors.ServiceErrors{
-				Code:    http.StatusNotFound,
-				Message: "username tidak ditemukan",
-			}
-		}
-
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
 		return nil, &customerrors.ServiceErrors{
 			Code:    http.StatusInternalServerError,
 			Message: "ada kesalahan di server error : " + err.Error(),
 		}
 	}
 
+	// username ga ketemu tetep di bcrypt pake hash dummy biar waktu response nya sama
+	hashedPw := dummyPasswordHash
+	if data != nil {
+		hashedPw = []byte(data.Password)
+	}
+
+	pwErr := bcrypt.CompareHashAndPassword(hashedPw, []byte(pw))
+
+	if data == nil || pwErr != nil {
+		return nil, a.loginFailed(username, data, meta, ctx)
+	}
+
+	if err := a.guard.RegisterSuccess(ctx, username); err != nil {
+		return nil, customerrors.New(http.StatusInternalServerError, "ada kesalahan di server error : "+err.Error())
+	}
+
 	if !data.IsActivate {
 		return ResponseSchema{}, &customerrors.ServiceErrors{
 			Code:    401,
@@ -100,13 +155,192 @@ func (a *AuthService) LoginService(username string, pw string, ctx context.Conte
 		}
 	}
 
-	err = bcrypt.CompareHashAndPassword([]byte(data.Password), []byte(pw))
+	return a.finishLogin(data, meta, ctx)
+
+}
+
+// dipake login password dan login OIDC, kalo 2FA aktif token nya belum dikasih
+func (a *AuthService) finishLogin(data *model.User, meta SessionMeta, ctx context.Context) (ResponseSchema, *customerrors.ServiceErrors) {
+
+	twoFactorEnabled, svcErr := a.twoFactor.IsEnabled(ctx, data.Id)
+	if svcErr != nil {
+		return nil, svcErr
+	}
+
+	if twoFactorEnabled {
+		challengeToken, err := a.createLoginChallenge(data.Id, ctx)
+		if err != nil {
+			return nil, customerrors.New(http.StatusInternalServerError, "Terjadi kesalahan di server : "+err.Error())
+		}
+
+		return ResponseSchema{
+			"message":           "masukan kode 2FA untuk melanjutkan login",
+			"twoFactorRequired": true,
+			"challengeToken":    challengeToken,
+		}, nil
+	}
+
+	return a.issueSession(data, meta, ctx)
+
+}
+
+// error nya sengaja sama buat username ga ada dan password salah biar ga bisa dipake nebak username
+func (a *AuthService) loginFailed(username string, data *model.User, meta SessionMeta, ctx context.Context) *customerrors.ServiceErrors {
+
+	lockedFor, newlyLocked, err := a.guard.RegisterFailure(ctx, username, meta.Ip)
+	if err != nil {
+		return customerrors.New(http.StatusInternalServerError, "ada kesalahan di server error : "+err.Error())
+	}
+
+	if newlyLocked && data != nil {
+		a.bus.Publish(event.AccountLocked, event.AccountLockedEvent{
+			Email:     data.Email,
+			Username:  data.Username,
+			Ip:        meta.Ip,
+			LockedFor: lockedFor,
+		})
+	}
+
+	if lockedFor > 0 {
+		return tooManyLoginAttempts(lockedFor)
+	}
+
+	return customerrors.New(http.StatusUnauthorized, "username atau password salah")
+}
+
+func tooManyLoginAttempts(lockedFor time.Duration) *customerrors.ServiceErrors {
+	return customerrors.NewTooManyRequests(
+		fmt.Sprintf("Terlalu banyak percobaan login, coba lagi dalam %d detik", int(math.Ceil(lockedFor.Seconds()))),
+		lockedFor,
+	)
+}
+
+// token challenge disimpen di redis, cuma bisa dipake sekali dan dibatesin jumlah percobaan nya
+func (a *AuthService) createLoginChallenge(userId uuid.UUID, ctx context.Context) (string, error) {
+
+	token, err := pkg.GenerateRandomStringToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	key := loginChallengeKey(token)
+
+	pipe := a.RedisClient.TxPipeline()
+	pipe.HSet(ctx, key, "user_id", userId.String(), "attempts", 0)
+	pipe.Expire(ctx, key, loginChallengeTTL)
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+func (a *AuthService) CompleteTwoFactorLogin(challengeToken string, code string, meta SessionMeta, ctx context.Context) (ResponseSchema, *customerrors.ServiceErrors) {
+
+	key := loginChallengeKey(challengeToken)
+
+	val, err := a.RedisClient.HGet(ctx, key, "user_id").Result()
+	if err == redis.Nil {
+		return nil, customerrors.New(http.StatusUnauthorized, "Sesi login sudah habis, silahkan login ulang")
+	}
+
+	if err != nil {
+		return nil, customerrors.New(http.StatusInternalServerError, "Terjadi kesalahan di server : "+err.Error())
+	}
+
+	userId, err := uuid.Parse(val)
+	if err != nil {
+		return nil, customerrors.New(http.StatusInternalServerError, "Terjadi kesalahan di server : "+err.Error())
+	}
+
+	lockedFor, err := a.guard.TwoFactorLockedFor(ctx, userId)
+	if err != nil {
+		return nil, customerrors.New(http.StatusInternalServerError, "Terjadi kesalahan di server : "+err.Error())
+	}
+
+	if lockedFor > 0 {
+		return nil, tooManyLoginAttempts(lockedFor)
+	}
+
+	attempts, err := a.RedisClient.HIncrBy(ctx, key, "attempts", 1).Result()
+	if err != nil {
+		return nil, customerrors.New(http.StatusInternalServerError, "Terjadi kesalahan di server : "+err.Error())
+	}
+
+	if attempts > loginChallengeMaxAttempts {
+		a.RedisClient.Del(ctx, key)
+		return nil, customerrors.New(http.StatusUnauthorized, "Terlalu banyak percobaan, silahkan login ulang")
+	}
+
+	if svcErr := a.twoFactor.VerifyCode(ctx, userId, code); svcErr != nil {
+		if svcErr.Code == http.StatusUnauthorized {
+			return nil, a.twoFactorFailed(userId, svcErr, meta, ctx)
+		}
+
+		return nil, svcErr
+	}
+
+	if err := a.guard.RegisterTwoFactorSuccess(ctx, userId); err != nil {
+		return nil, customerrors.New(http.StatusInternalServerError, "Terjadi kesalahan di server : "+err.Error())
+	}
 
+	// kalo Del nya 0 berarti challenge udah keburu dipake request lain
+	deleted, err := a.RedisClient.Del(ctx, key).Result()
 	if err != nil {
-		return nil, customerrors.New(http.StatusUnauthorized, "usename atau password salah")
+		return nil, customerrors.New(http.StatusInternalServerError, "Terjadi kesalahan di server : "+err.Error())
 	}
 
-	accessToken, err := pkg.GenerateToken(data.Id, data.Role, 10)
+	if deleted == 0 {
+		return nil, customerrors.New(http.StatusUnauthorized, "Sesi login sudah habis, silahkan login ulang")
+	}
+
+	data, err := a.UserRepo.GetUserDataById(userId, ctx)
+	if err != nil {
+		return nil, customerrors.New(http.StatusInternalServerError, "Terjadi kesalahan di server : "+err.Error())
+	}
+
+	return a.issueSession(data, meta, ctx)
+}
+
+// kode 2FA salah diitung per user, ga ikut ke-reset sama challenge baru atau login password yang bener
+func (a *AuthService) twoFactorFailed(userId uuid.UUID, codeErr *customerrors.ServiceErrors, meta SessionMeta, ctx context.Context) *customerrors.ServiceErrors {
+
+	lockedFor, newlyLocked, err := a.guard.RegisterTwoFactorFailure(ctx, userId)
+	if err != nil {
+		return customerrors.New(http.StatusInternalServerError, "Terjadi kesalahan di server : "+err.Error())
+	}
+
+	// yang nyoba udah tau password nya, user nya harus dikabarin biar bisa ganti password
+	if newlyLocked {
+		data, err := a.UserRepo.GetUserDataById(userId, ctx)
+		if err != nil {
+			return customerrors.New(http.StatusInternalServerError, "Terjadi kesalahan di server : "+err.Error())
+		}
+
+		a.bus.Publish(event.AccountLocked, event.AccountLockedEvent{
+			Email:     data.Email,
+			Username:  data.Username,
+			Ip:        meta.Ip,
+			LockedFor: lockedFor,
+		})
+	}
+
+	if lockedFor > 0 {
+		return tooManyLoginAttempts(lockedFor)
+	}
+
+	return codeErr
+}
+
+func (a *AuthService) issueSession(data *model.User, meta SessionMeta, ctx context.Context) (ResponseSchema, *customerrors.ServiceErrors) {
+
+	sessionId, err := NewSessionId()
+	if err != nil {
+		return nil, customerrors.New(http.StatusInternalServerError, "Terjadi kesalahan di server : "+err.Error())
+	}
+
+	accessToken, err := pkg.GenerateToken(data.Id, data.Role, sessionId, 10)
 
 	if err != nil {
 		return nil, &customerrors.ServiceErrors{
@@ -115,9 +349,12 @@ func (a *AuthService) LoginService(username string, pw string, ctx context.Conte
 		}
 	}
 
-	refreshToken, err := pkg.GenerateTokenNoRole(data.Id, 10800)
+	refreshToken, err := pkg.GenerateTokenNoRole(data.Id, sessionId, 10800)
+	if err != nil {
+		return nil, customerrors.New(http.StatusInternalServerError, "Terjadi kesalahan di server : "+err.Error())
+	}
 
-	err = a.setRedisSession(data.Id.String(), refreshToken, ctx)
+	err = a.setRedisSession(data.Id, sessionId, refreshToken, meta, ctx)
 
 	if err != nil {
 		return nil, &customerrors.ServiceErrors{
@@ -127,10 +364,13 @@ func (a *AuthService) LoginService(username string, pw string, ctx context.Conte
 	}
 
 	return ResponseSchema{"message": "berhasil login", "accessToken": accessToken, "refreshToken": refreshToken, "id": data.Id}, nil
+}
 
+func loginChallengeKey(token string) string {
+	return "login_challenge:" + pkg.HashToken(token)
 }
 
-func (a *AuthService) SignUp(username string, email string, fullName string, password string, host string, c context.Context) (ResponseSchema, *customerrors.ServiceErrors) {
+func (a *AuthService) SignUp(username string, email string, fullName string, password string, c context.Context) (ResponseSchema, *customerrors.ServiceErrors) {
 
 	var newUser model.User
 
@@ -166,23 +406,16 @@ func (a *AuthService) SignUp(username string, email string, fullName string, pas
 		}
 	}
 
-	activationToken, err := pkg.GenerateRandomStringToken(24)
+	activationToken, svcErr := a.verifSvc.SaveVerificationCode(c, data.Id, model.TypeAccountVerification)
 
-	if err != nil {
-		return ResponseSchema{}, &customerrors.ServiceErrors{
-			Code:    500,
-			Message: "Terjadi kesalahan di server " + err.Error(),
-		}
+	if svcErr != nil {
+		return ResponseSchema{}, svcErr
 	}
 
-	activationLink := host + "/activate-account/" + activationToken
-
-	// todo impl save token ke db
-
 	a.bus.Publish(event.NewUserCreated, event.NewUserEvent{
 		Email:          data.Email,
 		Username:       data.Username,
-		ActivationLink: activationLink,
+		ActivationLink: a.activationLink(activationToken),
 	})
 
 	return ResponseSchema{
@@ -193,33 +426,38 @@ func (a *AuthService) SignUp(username string, email string, fullName string, pas
 
 func (a *AuthService) RefreshSession(token string, ctx context.Context) (ResponseSchema, *customerrors.ServiceErrors) {
 
-	redisKey := "session:" + token
-	val, err := a.RedisClient.HGet(ctx, redisKey, "user_id").Result()
+	claims, svcErr := a.resolveSession(token, ctx)
+	if svcErr != nil {
+		return nil, svcErr
+	}
 
-	if err == redis.Nil {
-		return nil, &customerrors.ServiceErrors{
-			Code:    401,
-			Message: "Sesi sudah habis, silahkan login ulang",
-		}
+	sessionId := claims.ID
+
+	newRefreshToken, err := pkg.GenerateTokenNoRole(claims.UserId, sessionId, 10800)
+	if err != nil {
+		return nil, customerrors.New(http.StatusInternalServerError, "Gagal membuat token! terjadi kesalahan di server "+err.Error())
 	}
 
+	newClaims, err := pkg.VerifyRefreshToken(newRefreshToken)
 	if err != nil {
-		return nil, &customerrors.ServiceErrors{
-			Code:    500,
-			Message: "error : " + err.Error(),
-		}
+		return nil, customerrors.New(http.StatusInternalServerError, "Gagal membuat token! terjadi kesalahan di server "+err.Error())
+	}
 
+	err = a.Sessions.Rotate(ctx, sessionId, token, claims, newRefreshToken, newClaims.ExpiresAt.Time)
+
+	if errors.Is(err, ErrRefreshTokenReused) {
+		return nil, a.revokeReusedFamily(claims, ctx)
+	}
+
+	if errors.Is(err, redis.TxFailedErr) {
+		return nil, customerrors.New(http.StatusConflict, "Sesi sedang diperbarui, silahkan coba lagi")
 	}
 
-	userId, err := uuid.Parse(val)
 	if err != nil {
-		return nil, &customerrors.ServiceErrors{
-			Code:    500,
-			Message: "Terjadi error di server! " + err.Error(),
-		}
+		return nil, customerrors.New(http.StatusInternalServerError, "error : "+err.Error())
 	}
 
-	userData, err := a.UserRepo.GetUserDataById(userId, ctx)
+	userData, err := a.UserRepo.GetUserDataById(claims.UserId, ctx)
 
 	if err != nil {
 		return nil, &customerrors.ServiceErrors{
@@ -228,7 +466,7 @@ func (a *AuthService) RefreshSession(token string, ctx context.Context) (Respons
 		}
 	}
 
-	accessToken, err := pkg.GenerateToken(userData.Id, userData.Role, 15)
+	accessToken, err := pkg.GenerateToken(userData.Id, userData.Role, sessionId, 15)
 
 	if err != nil {
 		return nil, &customerrors.ServiceErrors{
@@ -238,8 +476,249 @@ func (a *AuthService) RefreshSession(token string, ctx context.Context) (Respons
 	}
 
 	return ResponseSchema{
-		"accessToken": accessToken,
-		"id":          userData.Id,
+		"accessToken":  accessToken,
+		"refreshToken": newRefreshToken,
+		"id":           userData.Id,
 	}, nil
 
 }
+
+func (a *AuthService) ActivateAccount(token string, ctx context.Context) *customerrors.ServiceErrors {
+	return a.verifSvc.ActivateAccount(ctx, token)
+}
+
+// sama kayak ForgotPassword, email ga ada / udah aktif / masih cooldown tetep dianggap berhasil
+// biar endpoint ini ga bisa dipake buat nyari email yang terdaftar
+func (a *AuthService) ResendActivation(email string, ctx context.Context) *customerrors.ServiceErrors {
+
+	data, err := a.UserRepo.GetUserDataByEmail(email, ctx)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+
+		return customerrors.New(http.StatusInternalServerError, "Terjadi kesalahan di server : "+err.Error())
+	}
+
+	if data.IsActivate {
+		return nil
+	}
+
+	activationToken, svcErr := a.verifSvc.SaveVerificationCode(ctx, data.Id, model.TypeAccountVerification)
+
+	if svcErr != nil && svcErr.Code == http.StatusTooManyRequests {
+		return nil
+	}
+
+	if svcErr != nil {
+		return svcErr
+	}
+
+	a.bus.Publish(event.VerificationResend, event.NewUserEvent{
+		Email:          data.Email,
+		Username:       data.Username,
+		ActivationLink: a.activationLink(activationToken),
+	})
+
+	return nil
+}
+
+// kalo email nya ga ada tetep dianggap berhasil, biar endpoint ini ga bisa dipake buat nyari email yang terdaftar
+func (a *AuthService) ForgotPassword(email string, ctx context.Context) *customerrors.ServiceErrors {
+
+	data, err := a.UserRepo.GetUserDataByEmail(email, ctx)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+
+		return customerrors.New(http.StatusInternalServerError, "Terjadi kesalahan di server : "+err.Error())
+	}
+
+	resetToken, svcErr := a.verifSvc.SaveVerificationCode(ctx, data.Id, model.TypePasswordVerification)
+
+	// cooldown juga ga boleh keliatan, kalo ngga email yang terdaftar bisa ketauan dari 429 nya
+	if svcErr != nil && svcErr.Code == http.StatusTooManyRequests {
+		return nil
+	}
+
+	if svcErr != nil {
+		return svcErr
+	}
+
+	a.bus.Publish(event.PasswordResetRequested, event.PasswordResetEvent{
+		Email:     data.Email,
+		Username:  data.Username,
+		ResetLink: a.resetPasswordLink(resetToken),
+	})
+
+	return nil
+}
+
+// dipake halaman reset password buat ngecek link nya masih berlaku sebelum user ngisi password baru
+func (a *AuthService) CheckResetToken(token string, ctx context.Context) *customerrors.ServiceErrors {
+
+	_, svcErr := a.verifSvc.GetVerificationCode(ctx, token, model.TypePasswordVerification)
+	return svcErr
+}
+
+func (a *AuthService) ResetPassword(token string, newPassword string, ctx context.Context) *customerrors.ServiceErrors {
+
+	hashedPw, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return customerrors.New(http.StatusInternalServerError, "Terjadi kesalahan di server silahkan coba lagi nanti")
+	}
+
+	userId, svcErr := a.verifSvc.ResetPassword(ctx, token, string(hashedPw))
+	if svcErr != nil {
+		return svcErr
+	}
+
+	if svcErr := a.RevokeUserAccess(userId, ctx); svcErr != nil {
+		return customerrors.New(svcErr.Code, "Password berhasil diganti tapi gagal menghapus sesi lama : "+svcErr.Message)
+	}
+
+	return nil
+}
+
+// refresh token harus valid secara jwt dan hash nya sama kayak refresh token terakhir di session.
+// kalo yang dikirim token lama yang udah di rotate, satu family (session) nya langsung di revoke
+func (a *AuthService) resolveSession(refreshToken string, ctx context.Context) (*pkg.RefreshTokenClaims, *customerrors.ServiceErrors) {
+
+	sessionExpired := customerrors.New(http.StatusUnauthorized, "Sesi sudah habis, silahkan login ulang")
+
+	claims, err := pkg.VerifyRefreshToken(refreshToken)
+	if err != nil || claims.ID == "" {
+		return nil, sessionExpired
+	}
+
+	data, err := a.Sessions.Get(ctx, claims.ID)
+	if err == redis.Nil {
+		return nil, sessionExpired
+	}
+
+	if err != nil {
+		return nil, customerrors.New(http.StatusInternalServerError, "error : "+err.Error())
+	}
+
+	if data.UserId != claims.UserId.String() {
+		return nil, sessionExpired
+	}
+
+	if data.RefreshToken != pkg.HashToken(refreshToken) {
+		reused, err := a.Sessions.IsConsumed(ctx, refreshToken, claims)
+		if err != nil {
+			return nil, customerrors.New(http.StatusInternalServerError, "error : "+err.Error())
+		}
+
+		if reused {
+			return nil, a.revokeReusedFamily(claims, ctx)
+		}
+
+		return nil, sessionExpired
+	}
+
+	return claims, nil
+}
+
+func (a *AuthService) revokeReusedFamily(claims *pkg.RefreshTokenClaims, ctx context.Context) *customerrors.ServiceErrors {
+
+	if _, err := a.Sessions.Revoke(ctx, claims.UserId, claims.ID); err != nil {
+		return customerrors.New(http.StatusInternalServerError, "error : "+err.Error())
+	}
+
+	return customerrors.New(http.StatusUnauthorized, "Refresh token sudah pernah digunakan, demi keamanan semua sesi di perangkat ini dihentikan. silahkan login ulang")
+}
+
+func (a *AuthService) Logout(refreshToken string, accessToken string, ctx context.Context) *customerrors.ServiceErrors {
+
+	// access token nya dicabut juga kalo dikirim, biar ga nunggu sampe expire
+	if accessToken != "" {
+		if accessClaims, err := pkg.VerifyToken(accessToken); err == nil {
+			if err := a.Revocation.Revoke(ctx, accessClaims); err != nil {
+				return customerrors.New(http.StatusInternalServerError, "Gagal logout : "+err.Error())
+			}
+		}
+	}
+
+	if refreshToken == "" {
+		return nil
+	}
+
+	claims, svcErr := a.resolveSession(refreshToken, ctx)
+	if svcErr != nil {
+		// session nya udah ga ada, anggap aja udah logout
+		if svcErr.Code == http.StatusUnauthorized {
+			return nil
+		}
+		return svcErr
+	}
+
+	if _, err := a.Sessions.Revoke(ctx, claims.UserId, claims.ID); err != nil {
+		return customerrors.New(http.StatusInternalServerError, "Gagal logout : "+err.Error())
+	}
+
+	return nil
+}
+
+func (a *AuthService) LogoutAll(userId uuid.UUID, ctx context.Context) *customerrors.ServiceErrors {
+
+	if svcErr := a.RevokeUserAccess(userId, ctx); svcErr != nil {
+		return customerrors.New(svcErr.Code, "Gagal logout dari semua perangkat : "+svcErr.Message)
+	}
+
+	return nil
+}
+
+// cabut semua refresh session dan access token user yang udah keburu dibikin.
+// dipake buat reset password, logout semua perangkat, ganti role, atau ban
+func (a *AuthService) RevokeUserAccess(userId uuid.UUID, ctx context.Context) *customerrors.ServiceErrors {
+
+	if err := a.Sessions.RevokeAll(ctx, userId); err != nil {
+		return customerrors.New(http.StatusInternalServerError, err.Error())
+	}
+
+	if err := a.Revocation.RevokeAllBefore(ctx, userId, time.Now()); err != nil {
+		return customerrors.New(http.StatusInternalServerError, err.Error())
+	}
+
+	return nil
+}
+
+func (a *AuthService) GetSessions(userId uuid.UUID, currentSession string, ctx context.Context) ([]SessionInfo, *customerrors.ServiceErrors) {
+
+	sessions, err := a.Sessions.List(ctx, userId, currentSession)
+	if err != nil {
+		return nil, customerrors.New(http.StatusInternalServerError, "Gagal mengambil data sesi : "+err.Error())
+	}
+
+	return sessions, nil
+}
+
+func (a *AuthService) RevokeSession(userId uuid.UUID, sessionId string, ctx context.Context) *customerrors.ServiceErrors {
+
+	ok, err := a.Sessions.Revoke(ctx, userId, sessionId)
+	if err != nil {
+		return customerrors.New(http.StatusInternalServerError, "Gagal menghapus sesi : "+err.Error())
+	}
+
+	if !ok {
+		return customerrors.New(http.StatusNotFound, "sesi tidak ditemukan")
+	}
+
+	return nil
+}
+
+func (a *AuthService) activationLink(token string) string {
+	return buildLink(a.links.ActivationURL, token)
+}
+
+func (a *AuthService) resetPasswordLink(token string) string {
+	return buildLink(a.links.ResetPasswordURL, token)
+}
+
+func buildLink(base string, token string) string {
+	return strings.TrimRight(base, "/") + "/" + token
+}
@@ -0,0 +1,79 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Agmer17/golang_yapping/internal/event"
+	"github.com/Agmer17/golang_yapping/internal/model"
+	"github.com/Agmer17/golang_yapping/internal/repository"
+	"github.com/google/uuid"
+)
+
+// verification repo in-memory, cuma nyatet token yang dibikin
+type fakeVerificationRepo struct {
+	repository.VerificationRepoInterface
+
+	codes []model.VerificationModel
+}
+
+func (r *fakeVerificationRepo) ReplaceVerificationCode(ctx context.Context, payload model.VerificationModel) error {
+	r.codes = append(r.codes, payload)
+	return nil
+}
+
+func TestResendActivationDoesNotRevealEmail(t *testing.T) {
+
+	_, rdb := newTestRedis(t)
+
+	inactive := &model.User{Id: uuid.New(), Username: "baru", Email: "baru@mail.com"}
+	active := &model.User{Id: uuid.New(), Username: "lama", Email: "lama@mail.com", IsActivate: true}
+
+	sent := make(chan event.NewUserEvent, 4)
+	bus := event.NewEventBus(nil, context.Background(), nil)
+	bus.Subscribe(event.VerificationResend, func(ctx context.Context, payload interface{}) {
+		sent <- payload.(event.NewUserEvent)
+	})
+
+	verifRepo := &fakeVerificationRepo{}
+	auth := &AuthService{
+		UserRepo:    newFakeUserRepo(inactive, active),
+		RedisClient: rdb,
+		bus:         bus,
+		verifSvc:    &VerificationService{VerifRepo: verifRepo, RedisCli: rdb},
+		links:       AuthLinkConfig{ActivationURL: "https://yapping.app/activate", ResetPasswordURL: "https://yapping.app/reset"},
+	}
+
+	ctx := context.Background()
+
+	if svcErr := auth.ResendActivation(inactive.Email, ctx); svcErr != nil {
+		t.Fatalf("akun yang belum aktif harusnya dikirim link, dapet %s", svcErr.Message)
+	}
+
+	select {
+	case ev := <-sent:
+		if ev.Email != inactive.Email {
+			t.Errorf("link nya dikirim ke %s", ev.Email)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("link aktivasi nya ga dikirim")
+	}
+
+	// email ga terdaftar, akun udah aktif, sama masih cooldown harus keliatan sama persis kayak yang berhasil
+	for _, email := range []string{"ga-ada@mail.com", active.Email, inactive.Email} {
+		if svcErr := auth.ResendActivation(email, ctx); svcErr != nil {
+			t.Errorf("%s : harusnya tetep berhasil, dapet %d %s", email, svcErr.Code, svcErr.Message)
+		}
+	}
+
+	select {
+	case ev := <-sent:
+		t.Errorf("link ga boleh dikirim lagi, kekirim ke %s", ev.Email)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if len(verifRepo.codes) != 1 {
+		t.Errorf("token yang dibikin %d, harusnya 1", len(verifRepo.codes))
+	}
+}
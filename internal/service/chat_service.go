@@ -2,14 +2,17 @@ package service
 
 import (
 	"context"
-	"database/sql"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
 	"mime/multipart"
 	"net/http"
+	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/Agmer17/golang_yapping/internal/event"
 	"github.com/Agmer17/golang_yapping/internal/model"
@@ -17,7 +20,9 @@ import (
 	"github.com/Agmer17/golang_yapping/internal/ws"
 	"github.com/Agmer17/golang_yapping/pkg"
 	"github.com/Agmer17/golang_yapping/pkg/customerrors"
+	"github.com/gin-gonic/gin/binding"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/redis/go-redis/v9"
 )
 
@@ -29,44 +34,168 @@ type ChatPostInput struct {
 	ChatText   *string
 	PostId     *string
 	MediaFiles []*multipart.FileHeader
+
+	// cuma dari SEND_MESSAGE websocket
+	ClientMsgId *string
 }
 
 // key buat get ini di redis tuh media_access:private_chat:<token>
+// token attachment grup cuma punya conversation_id, aksesnya dicek dari membership grup
 type mediaAccessToken struct {
-	Filename   string    `redis:"filename"`
-	SenderId   uuid.UUID `redis:"sender_id"`
-	ReceiverId uuid.UUID `redis:"receiver_id"`
+	Filename       string    `redis:"filename"`
+	SenderId       uuid.UUID `redis:"sender_id"`
+	ReceiverId     uuid.UUID `redis:"receiver_id"`
+	ConversationId uuid.UUID `redis:"conversation_id"`
 }
 
 type ChatResponseData struct {
-	Id               uuid.UUID  `json:"chat_id"`
-	SenderId         uuid.UUID  `json:"sender_id"`
-	ReceiverId       uuid.UUID  `json:"receiver_id"`
-	ReplyTo          *uuid.UUID `json:"reply_to"`
-	ChatText         *string    `json:"chat_text"`
-	PostId           *uuid.UUID `json:"post_id"`
-	IsRead           bool       `json:"is_read"`
-	CreatedAt        time.Time  `json:"created_at"`
-	IsOwn            bool       `json:"is_own_message"`
-	AttachmentAccess []string   `json:"attachment_access"`
+	Id               uuid.UUID           `json:"chat_id"`
+	SenderId         uuid.UUID           `json:"sender_id"`
+	ReceiverId       uuid.UUID           `json:"receiver_id"`
+	ReplyTo          *uuid.UUID          `json:"reply_to"`
+	ChatText         *string             `json:"chat_text"`
+	PostId           *uuid.UUID          `json:"post_id"`
+	IsRead           bool                `json:"is_read"`
+	CreatedAt        time.Time           `json:"created_at"`
+	EditedAt         *time.Time          `json:"edited_at"`
+	IsDeleted        bool                `json:"is_deleted"`
+	IsOwn            bool                `json:"is_own_message"`
+	AttachmentAccess []string            `json:"attachment_access"`
+	Reactions        []ReactionCountData `json:"reactions"`
+}
+
+type ReactionCountData struct {
+	Emoji       string `json:"emoji"`
+	Count       int    `json:"count"`
+	ReactedByMe bool   `json:"reacted_by_me"`
+}
+
+type ReactionData struct {
+	UserId    uuid.UUID `json:"user_id"`
+	Emoji     string    `json:"emoji"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// cursor nya opaque buat client, isinya created_at + id pesan
+type ChatPagingData struct {
+	OlderCursor *string `json:"older_cursor"`
+	NewerCursor *string `json:"newer_cursor"`
+	HasOlder    bool    `json:"has_older"`
+	HasNewer    bool    `json:"has_newer"`
 }
 
+type ChatPageData struct {
+	Chats  []ChatResponseData `json:"chats"`
+	Paging ChatPagingData     `json:"paging"`
+}
+
+// Before, After sama Around cuma boleh di isi salah satu
+type ChatPageInput struct {
+	Before string
+	After  string
+	Around *uuid.UUID
+	Limit  int
+}
+
+const (
+	defaultChatPageLimit = 30
+	maxChatPageLimit     = 100
+)
+
 type LatestChatData struct {
 	ChatResponseData      `json:"chat_data"`
 	ChatPartnerId         uuid.UUID `json:"partner_id"`
 	ChatPartnerFullName   string    `json:"partner_fullname"`
 	ChatPartnerUsername   string    `json:"partner_username"`
 	ChatPartnerProfilePic *string   `json:"partner_profile_picture"`
+	UnreadCount           int       `json:"unread_count"`
+}
+
+type ConversationUnread struct {
+	PartnerId   uuid.UUID `json:"partner_id"`
+	UnreadCount int       `json:"unread_count"`
+}
+
+type ChatEditData struct {
+	PreviousText *string   `json:"previous_text"`
+	EditedAt     time.Time `json:"edited_at"`
+}
+
+// batas waktu edit kalo ga di set lewat konfigurasi
+const DefaultChatEditWindow = 15 * time.Minute
+
+const (
+	DeleteModeForMe       = "me"
+	DeleteModeForEveryone = "everyone"
+
+	deleteForEveryoneWindow = time.Hour
+
+	deletedChatPlaceholder = "pesan ini telah dihapus"
+)
+
+const maxChatTextLength = 4000
+
+// emoji gabungan (ZWJ, skin tone, bendera) bisa sampe beberapa code point
+const maxReactionRunes = 16
+
+// PartnerId, From, To sama HasAttachment opsional. To itu batas atas eksklusif
+type ChatSearchInput struct {
+	Query         string
+	PartnerId     *uuid.UUID
+	From          *time.Time
+	To            *time.Time
+	HasAttachment *bool
+	Before        string
+	Limit         int
+}
+
+// buat loncat ke pesan nya pake GET /chat/beetween/:partner_id?around=chat_id.
+// kalo group_id nya keisi berarti pesan grup, partner_* nya isinya pengirim pesan
+type ChatSearchResultData struct {
+	ChatId                uuid.UUID  `json:"chat_id"`
+	SenderId              uuid.UUID  `json:"sender_id"`
+	ChatPartnerId         uuid.UUID  `json:"partner_id"`
+	ChatPartnerFullName   string     `json:"partner_fullname"`
+	ChatPartnerUsername   string     `json:"partner_username"`
+	ChatPartnerProfilePic *string    `json:"partner_profile_picture"`
+	GroupId               *uuid.UUID `json:"group_id"`
+	GroupName             *string    `json:"group_name"`
+	GroupAvatar           *string    `json:"group_avatar"`
+	Snippet               string     `json:"snippet"`
+	HasAttachment         bool       `json:"has_attachment"`
+	IsOwn                 bool       `json:"is_own_message"`
+	CreatedAt             time.Time  `json:"created_at"`
+	EditedAt              *time.Time `json:"edited_at"`
+}
+
+type ChatSearchPageData struct {
+	Results []ChatSearchResultData `json:"results"`
+	Paging  ChatPagingData         `json:"paging"`
+}
+
+const maxSearchQueryLength = 200
+
+type UnreadSummaryData struct {
+	Total         int                  `json:"total_unread"`
+	Conversations []ConversationUnread `json:"conversations"`
 }
 
 // =======
 
 type ChatServiceInterface interface {
 	SaveChat(m *ChatPostInput, ctx context.Context) *customerrors.ServiceErrors
-	GetChatBeetween(ctx context.Context, r uuid.UUID, s uuid.UUID) ([]ChatResponseData, *customerrors.ServiceErrors)
+	GetChatBeetween(ctx context.Context, r uuid.UUID, s uuid.UUID, page ChatPageInput) (ChatPageData, *customerrors.ServiceErrors)
 	GetPrivateAttachmentFile(ctx context.Context, key string, userId uuid.UUID) (string, *customerrors.ServiceErrors)
 	GetLatestChat(ctx context.Context, userId uuid.UUID) ([]LatestChatData, *customerrors.ServiceErrors)
-	DeleteChat(ctx context.Context, userId uuid.UUID, chatId uuid.UUID) *customerrors.ServiceErrors
+	DeleteChat(ctx context.Context, userId uuid.UUID, chatId uuid.UUID, mode string) *customerrors.ServiceErrors
+	MarkConversationAsRead(ctx context.Context, reader uuid.UUID, partner uuid.UUID, upTo uuid.UUID) *customerrors.ServiceErrors
+	GetUnreadSummary(ctx context.Context, userId uuid.UUID) (UnreadSummaryData, *customerrors.ServiceErrors)
+	EditChat(ctx context.Context, userId uuid.UUID, chatId uuid.UUID, text string) (ChatResponseData, *customerrors.ServiceErrors)
+	GetChatEdits(ctx context.Context, userId uuid.UUID, chatId uuid.UUID) ([]ChatEditData, *customerrors.ServiceErrors)
+	AddReaction(ctx context.Context, userId uuid.UUID, chatId uuid.UUID, emoji string) *customerrors.ServiceErrors
+	RemoveReaction(ctx context.Context, userId uuid.UUID, chatId uuid.UUID, emoji string) *customerrors.ServiceErrors
+	GetReactions(ctx context.Context, userId uuid.UUID, chatId uuid.UUID) ([]ReactionData, *customerrors.ServiceErrors)
+	SearchChats(ctx context.Context, userId uuid.UUID, in ChatSearchInput) (ChatSearchPageData, *customerrors.ServiceErrors)
 }
 
 type ChatService struct {
@@ -77,6 +206,10 @@ type ChatService struct {
 	storage     *FileStorage
 	RedisClient *redis.Client
 	EventBus    *event.EventBus
+	Groups      repository.ConversationRepositoryInterface
+
+	// pesan cuma bisa di edit selama segini setelah dikirim
+	EditWindow time.Duration
 }
 
 func NewChatService(c *repository.ChatRepository,
@@ -85,8 +218,15 @@ func NewChatService(c *repository.ChatRepository,
 	ct *repository.ChatAttachmentRepository,
 	fileService *FileStorage,
 	redisCli *redis.Client,
-	eventBus *event.EventBus) *ChatService {
-	return &ChatService{
+	eventBus *event.EventBus,
+	groups *repository.ConversationRepository,
+	editWindow time.Duration) *ChatService {
+
+	if editWindow <= 0 {
+		editWindow = DefaultChatEditWindow
+	}
+
+	cs := &ChatService{
 		Pool:        c,
 		Hub:         h,
 		usv:         u,
@@ -94,14 +234,27 @@ func NewChatService(c *repository.ChatRepository,
 		storage:     fileService,
 		RedisClient: redisCli,
 		EventBus:    eventBus,
+		Groups:      groups,
+		EditWindow:  editWindow,
 	}
+
+	h.HandleAction(ws.ActionSendMessage, cs.handleSendMessage)
+
+	return cs
 }
 
 func (cs *ChatService) SaveChat(d *ChatPostInput, ctx context.Context) *customerrors.ServiceErrors {
 
+	_, svcErr := cs.saveChat(d, ctx)
+	return svcErr
+}
+
+// sama kayak SaveChat tapi balikin pesan yang kesimpen, dipake SEND_MESSAGE dari websocket
+func (cs *ChatService) saveChat(d *ChatPostInput, ctx context.Context) (model.ChatModel, *customerrors.ServiceErrors) {
+
 	isValid := isChatValid(d)
 	if !isValid {
-		return &customerrors.ServiceErrors{
+		return model.ChatModel{}, &customerrors.ServiceErrors{
 			Code:    400,
 			Message: "Input tidak valid!",
 		}
@@ -110,15 +263,19 @@ func (cs *ChatService) SaveChat(d *ChatPostInput, ctx context.Context) *customer
 
 	cm, err := parseToChatModel(d)
 	if err != nil {
-		return &customerrors.ServiceErrors{
+		return model.ChatModel{}, &customerrors.ServiceErrors{
 			Code:    500,
 			Message: "Ada kesalahan saat parsing data " + err.Error(),
 		}
 	}
 
 	savedChat, err := cs.Pool.Save(cm, ctx)
+	if errors.Is(err, repository.ErrDuplicateClientMsgId) {
+		return model.ChatModel{}, customerrors.New(http.StatusConflict, "pesan dengan client_msg_id ini sudah pernah dikirim")
+	}
+
 	if err != nil {
-		return &customerrors.ServiceErrors{
+		return model.ChatModel{}, &customerrors.ServiceErrors{
 			Code:    http.StatusInternalServerError,
 			Message: "Ada kesalahan saat menyimpan pesan  " + err.Error(),
 		}
@@ -127,13 +284,13 @@ func (cs *ChatService) SaveChat(d *ChatPostInput, ctx context.Context) *customer
 	if len(d.MediaFiles) != 0 {
 		listMetadata, svcErr := cs.processAttachment(d.MediaFiles, savedChat.ChatData.Id)
 		if svcErr != nil {
-			return svcErr
+			return model.ChatModel{}, svcErr
 		}
 
 		err := cs.chatAtt.SaveAll(listMetadata, ctx)
 		if err != nil {
 			cs.cleanUpAttachment(listMetadata)
-			return &customerrors.ServiceErrors{
+			return model.ChatModel{}, &customerrors.ServiceErrors{
 				Code:    http.StatusInternalServerError,
 				Message: "Gagal saat menyimpan media " + err.Error(),
 			}
@@ -144,39 +301,152 @@ func (cs *ChatService) SaveChat(d *ChatPostInput, ctx context.Context) *customer
 		tokenAcc, err := cs.setTokenToAccess(ctx, savedChat.ChatData.Attachment, savedChat.ChatData.SenderId, savedChat.ChatData.ReceiverId)
 
 		if err != nil {
-			return &customerrors.ServiceErrors{
+			return model.ChatModel{}, &customerrors.ServiceErrors{
 				Code:    500,
 				Message: "Terjadi kesalahan di server! " + err.Error(),
 			}
 		}
 
 		cs.sendChat(savedChat, tokenAcc)
-		return nil
+		return savedChat.ChatData, nil
 	}
 
 	cs.sendChat(savedChat, []string{})
-	return nil
+	return savedChat.ChatData, nil
 }
 
-func (cs *ChatService) GetChatBeetween(ctx context.Context, receiver uuid.UUID, sender uuid.UUID) ([]ChatResponseData, *customerrors.ServiceErrors) {
+func (cs *ChatService) GetChatBeetween(ctx context.Context, receiver uuid.UUID, sender uuid.UUID, in ChatPageInput) (ChatPageData, *customerrors.ServiceErrors) {
+
+	query, svcErr := parseChatPageInput(in)
+	if svcErr != nil {
+		return ChatPageData{}, svcErr
+	}
 
-	chatList, err := cs.Pool.GetChatBeetween(ctx, receiver, sender)
+	var page repository.ChatPage
+	var err error
+
+	if in.Around != nil {
+		page, err = cs.Pool.GetChatAround(ctx, receiver, sender, *in.Around, max(query.Limit, 2))
+	} else {
+		page, err = cs.Pool.GetChatBeetween(ctx, receiver, sender, query)
+	}
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ChatPageData{}, &customerrors.ServiceErrors{
+			Code:    404,
+			Message: "pesan tidak ditemukan di percakapan ini",
+		}
+	}
 
 	if err != nil {
 		log.Print("terjadi error saat mengambil data di datbase : " + err.Error() + "\n")
-		return nil, &customerrors.ServiceErrors{
+		return ChatPageData{}, &customerrors.ServiceErrors{
 			Code:    500,
 			Message: "error " + err.Error(),
 		}
 	}
 
-	// todo buat ini di redis!
-	data, err := cs.setToChatResponses(ctx, chatList, sender)
+	data, err := cs.setToChatResponses(ctx, page.Chats, sender)
+	if err != nil {
+		return ChatPageData{}, &customerrors.ServiceErrors{
+			Code:    500,
+			Message: "Terjadi kesalahan di server! " + err.Error(),
+		}
+	}
+
+	paging := ChatPagingData{
+		HasOlder: page.HasOlder,
+		HasNewer: page.HasNewer,
+	}
+
+	if len(page.Chats) > 0 {
+		first := page.Chats[0]
+		last := page.Chats[len(page.Chats)-1]
+
+		older := encodeChatCursor(repository.ChatCursor{CreatedAt: first.CreatedAt, Id: first.Id})
+		newer := encodeChatCursor(repository.ChatCursor{CreatedAt: last.CreatedAt, Id: last.Id})
+
+		paging.OlderCursor = &older
+		paging.NewerCursor = &newer
+	}
 
-	return data, nil
+	return ChatPageData{
+		Chats:  data,
+		Paging: paging,
+	}, nil
 
 }
 
+func parseChatPageInput(in ChatPageInput) (repository.ChatPageQuery, *customerrors.ServiceErrors) {
+
+	filled := 0
+	for _, set := range []bool{in.Before != "", in.After != "", in.Around != nil} {
+		if set {
+			filled++
+		}
+	}
+
+	if filled > 1 {
+		return repository.ChatPageQuery{}, customerrors.New(http.StatusBadRequest, "before, after dan around tidak bisa dipakai bersamaan")
+	}
+
+	query := repository.ChatPageQuery{Limit: in.Limit}
+
+	if query.Limit <= 0 {
+		query.Limit = defaultChatPageLimit
+	}
+
+	query.Limit = min(query.Limit, maxChatPageLimit)
+
+	if in.Before != "" {
+		cursor, err := decodeChatCursor(in.Before)
+		if err != nil {
+			return repository.ChatPageQuery{}, customerrors.New(http.StatusBadRequest, "cursor tidak valid")
+		}
+		query.Before = &cursor
+	}
+
+	if in.After != "" {
+		cursor, err := decodeChatCursor(in.After)
+		if err != nil {
+			return repository.ChatPageQuery{}, customerrors.New(http.StatusBadRequest, "cursor tidak valid")
+		}
+		query.After = &cursor
+	}
+
+	return query, nil
+}
+
+func encodeChatCursor(c repository.ChatCursor) string {
+	raw := c.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + c.Id.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeChatCursor(s string) (repository.ChatCursor, error) {
+
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return repository.ChatCursor{}, err
+	}
+
+	ts, id, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return repository.ChatCursor{}, errors.New("format cursor salah")
+	}
+
+	createdAt, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		return repository.ChatCursor{}, err
+	}
+
+	chatId, err := uuid.Parse(id)
+	if err != nil {
+		return repository.ChatCursor{}, err
+	}
+
+	return repository.ChatCursor{CreatedAt: createdAt, Id: chatId}, nil
+}
+
 func isChatValid(d *ChatPostInput) bool {
 	chatTextEmpty := pkg.IsPStrEmpty(d.ChatText)
 	chatMediaEmpty := len(d.MediaFiles) == 0
@@ -296,12 +566,13 @@ func parseToChatModel(cp *ChatPostInput) (model.ChatModel, error) {
 	}
 
 	return model.ChatModel{
-		SenderId:   cp.SenderId,
-		ReceiverId: receiverUuid,
-		ReplyTo:    replyTo,
-		ChatText:   cp.ChatText,
-		PostId:     postId,
-		IsRead:     false,
+		SenderId:    cp.SenderId,
+		ReceiverId:  receiverUuid,
+		ReplyTo:     replyTo,
+		ChatText:    cp.ChatText,
+		PostId:      postId,
+		IsRead:      false,
+		ClientMsgId: cp.ClientMsgId,
 	}, nil
 
 }
@@ -348,6 +619,54 @@ func (cs *ChatService) setTokenToAccess(
 ) ([]string, error) {
 
 	pipe := cs.RedisClient.Pipeline()
+
+	tokenList, err := cs.queueAccessTokens(ctx, pipe, att, sender, receiverId)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	return tokenList, nil
+}
+
+// cuma nambahin command ke pipe, yang manggil yang harus Exec
+func (cs *ChatService) queueAccessTokens(
+	ctx context.Context,
+	pipe redis.Pipeliner,
+	att []model.ChatAttachment,
+	sender uuid.UUID,
+	receiverId uuid.UUID,
+) ([]string, error) {
+
+	return cs.queueMediaTokens(ctx, pipe, att, map[string]string{
+		"sender_id":   sender.String(),
+		"receiver_id": receiverId.String(),
+	})
+}
+
+// sama kayak queueAccessTokens tapi yang boleh akses semua member grup
+func (cs *ChatService) queueGroupAccessTokens(
+	ctx context.Context,
+	pipe redis.Pipeliner,
+	att []model.ChatAttachment,
+	conversationId uuid.UUID,
+) ([]string, error) {
+
+	return cs.queueMediaTokens(ctx, pipe, att, map[string]string{
+		"conversation_id": conversationId.String(),
+	})
+}
+
+func (cs *ChatService) queueMediaTokens(
+	ctx context.Context,
+	pipe redis.Pipeliner,
+	att []model.ChatAttachment,
+	access map[string]string,
+) ([]string, error) {
+
 	tokenList := make([]string, 0, len(att))
 
 	for _, v := range att {
@@ -359,10 +678,12 @@ func (cs *ChatService) setTokenToAccess(
 		key := "media_access:private_chat:" + token
 
 		data := map[string]string{
-			"filename":    v.FileName,
-			"sender_id":   sender.String(),
-			"receiver_id": receiverId.String(),
-			"type":        v.MediaType,
+			"filename": v.FileName,
+			"type":     v.MediaType,
+		}
+
+		for k, val := range access {
+			data[k] = val
 		}
 
 		pipe.HSet(ctx, key, data)
@@ -373,35 +694,38 @@ func (cs *ChatService) setTokenToAccess(
 		tokenList = append(tokenList, token)
 	}
 
-	if _, err := pipe.Exec(ctx); err != nil {
-		return nil, err
-	}
-
 	return tokenList, nil
 }
 
+// token media satu halaman dikirim ke redis dalam satu pipeline
 func (cs *ChatService) setToChatResponses(ctx context.Context, data []model.ChatModel, userId uuid.UUID) ([]ChatResponseData, error) {
 
-	var ResponseList []ChatResponseData
+	ResponseList := make([]ChatResponseData, 0, len(data))
+	pipe := cs.RedisClient.Pipeline()
 
 	for _, val := range data {
 
 		tmpResp := ChatResponseData{
-			Id:         val.Id,
-			SenderId:   val.SenderId,
-			ReceiverId: val.ReceiverId,
-			ReplyTo:    val.ReplyTo,
-			ChatText:   val.ChatText,
-			PostId:     val.PostId,
-			IsRead:     val.IsRead,
-			CreatedAt:  val.CreatedAt,
-			IsOwn:      val.IsOwn,
-		}
-
-		if len(val.Attachment) == 0 {
-			tmpResp.AttachmentAccess = []string{}
-		} else {
-			tmpToken, err := cs.setTokenToAccess(ctx, val.Attachment, val.SenderId, val.ReceiverId)
+			Id:               val.Id,
+			SenderId:         val.SenderId,
+			ReceiverId:       val.ReceiverId,
+			ReplyTo:          val.ReplyTo,
+			ChatText:         val.ChatText,
+			PostId:           val.PostId,
+			IsRead:           val.IsRead,
+			CreatedAt:        val.CreatedAt,
+			EditedAt:         val.EditedAt,
+			IsOwn:            val.IsOwn,
+			AttachmentAccess: []string{},
+			Reactions:        toReactionCounts(val.Reactions),
+		}
+
+		if val.DeletedAt != nil {
+			setDeletedPlaceholder(&tmpResp)
+		}
+
+		if len(val.Attachment) != 0 {
+			tmpToken, err := cs.queueAccessTokens(ctx, pipe, val.Attachment, val.SenderId, val.ReceiverId)
 
 			if err != nil {
 				return nil, err
@@ -413,10 +737,38 @@ func (cs *ChatService) setToChatResponses(ctx context.Context, data []model.Chat
 		ResponseList = append(ResponseList, tmpResp)
 	}
 
+	if pipe.Len() > 0 {
+		if _, err := pipe.Exec(ctx); err != nil {
+			return nil, err
+		}
+	}
+
 	return ResponseList, nil
 
 }
 
+func toReactionCounts(list []model.ReactionCount) []ReactionCountData {
+	result := make([]ReactionCountData, 0, len(list))
+
+	for _, r := range list {
+		result = append(result, ReactionCountData{
+			Emoji:       r.Emoji,
+			Count:       r.Count,
+			ReactedByMe: r.ReactedByMe,
+		})
+	}
+
+	return result
+}
+
+func setDeletedPlaceholder(resp *ChatResponseData) {
+	placeholder := deletedChatPlaceholder
+
+	resp.IsDeleted = true
+	resp.ChatText = &placeholder
+	resp.PostId = nil
+}
+
 func (cs *ChatService) setOneToChatResponse(ctx context.Context, data model.ChatModel, userId uuid.UUID) (ChatResponseData, error) {
 
 	tmpResp := ChatResponseData{
@@ -428,7 +780,13 @@ func (cs *ChatService) setOneToChatResponse(ctx context.Context, data model.Chat
 		PostId:     data.PostId,
 		IsRead:     data.IsRead,
 		CreatedAt:  data.CreatedAt,
+		EditedAt:   data.EditedAt,
 		IsOwn:      data.IsOwn,
+		Reactions:  toReactionCounts(data.Reactions),
+	}
+
+	if data.DeletedAt != nil {
+		setDeletedPlaceholder(&tmpResp)
 	}
 
 	if len(data.Attachment) == 0 {
@@ -464,6 +822,25 @@ func (cs *ChatService) GetPrivateAttachmentFile(ctx context.Context, key string,
 
 	}
 
+	if mediaAccess.ConversationId != uuid.Nil {
+		isMember, err := cs.Groups.IsMember(ctx, mediaAccess.ConversationId, userId)
+		if err != nil {
+			return "", &customerrors.ServiceErrors{
+				Code:    500,
+				Message: "internal server error! " + err.Error(),
+			}
+		}
+
+		if !isMember {
+			return "", &customerrors.ServiceErrors{
+				Code:    401,
+				Message: "Unauthorized access! kamu tidak berhak mengkases file ini!",
+			}
+		}
+
+		return cs.storage.GetPathPrivateFile(mediaAccess.Filename, "chat_attachment"), nil
+	}
+
 	if mediaAccess.SenderId != userId && mediaAccess.ReceiverId != userId {
 		return "", &customerrors.ServiceErrors{
 			Code:    401,
@@ -503,6 +880,7 @@ func (cs *ChatService) GetLatestChat(ctx context.Context, userId uuid.UUID) ([]L
 			ChatPartnerFullName:   v.PartnerData.FullName,
 			ChatPartnerUsername:   v.PartnerData.Username,
 			ChatPartnerProfilePic: v.PartnerData.ProfilePicture,
+			UnreadCount:           v.UnreadCount,
 		}
 
 		LatestChats = append(LatestChats, tmpRespData)
@@ -512,13 +890,20 @@ func (cs *ChatService) GetLatestChat(ctx context.Context, userId uuid.UUID) ([]L
 	return LatestChats, nil
 }
 
-func (cs *ChatService) DeleteChat(ctx context.Context, userId uuid.UUID, chatId uuid.UUID) *customerrors.ServiceErrors {
+func (cs *ChatService) DeleteChat(ctx context.Context, userId uuid.UUID, chatId uuid.UUID, mode string) *customerrors.ServiceErrors {
+
+	if mode != DeleteModeForMe && mode != DeleteModeForEveryone {
+		return &customerrors.ServiceErrors{
+			Code:    400,
+			Message: "mode hapus tidak valid, pilih " + DeleteModeForMe + " atau " + DeleteModeForEveryone,
+		}
+	}
 
 	chatMetaData, err := cs.Pool.GetChatById(ctx, chatId)
 
 	if err != nil {
 
-		if err == sql.ErrNoRows {
+		if errors.Is(err, pgx.ErrNoRows) {
 
 			return &customerrors.ServiceErrors{
 				Code:    404,
@@ -533,14 +918,40 @@ func (cs *ChatService) DeleteChat(ctx context.Context, userId uuid.UUID, chatId
 
 	}
 
-	if chatMetaData.SenderId != userId {
+	if chatMetaData.SenderId != userId && chatMetaData.ReceiverId != userId {
 		return &customerrors.ServiceErrors{
-			Code:    401,
-			Message: "Kamu tidak bisa menghapus pesan ini!",
+			Code:    404,
+			Message: "Chat tidak ditemukan!",
 		}
 	}
 
-	filesToDelete, err := cs.Pool.Delete(ctx, chatId)
+	var filesToDelete []string
+
+	if mode == DeleteModeForEveryone {
+		if chatMetaData.SenderId != userId {
+			return &customerrors.ServiceErrors{
+				Code:    403,
+				Message: "Kamu tidak bisa menghapus pesan ini untuk semua orang!",
+			}
+		}
+
+		if time.Since(chatMetaData.CreatedAt) > deleteForEveryoneWindow {
+			return &customerrors.ServiceErrors{
+				Code:    403,
+				Message: fmt.Sprintf("Pesan cuma bisa dihapus untuk semua orang %d menit setelah dikirim", int(deleteForEveryoneWindow.Minutes())),
+			}
+		}
+
+		filesToDelete, err = cs.Pool.DeleteForEveryone(ctx, chatId)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return &customerrors.ServiceErrors{
+				Code:    409,
+				Message: "Pesan sudah dihapus sebelumnya",
+			}
+		}
+	} else {
+		filesToDelete, err = cs.Pool.HideForUser(ctx, chatId, userId)
+	}
 
 	if err != nil {
 		return &customerrors.ServiceErrors{
@@ -550,10 +961,37 @@ func (cs *ChatService) DeleteChat(ctx context.Context, userId uuid.UUID, chatId
 	}
 
 	cs.storage.DeleteAllPrivateFile(filesToDelete, "chat_attachment")
+	cs.sendChatDeleted(chatMetaData, userId, mode)
+
 	return nil
 
 }
 
+// hapus untuk saya cuma dikabarin ke device lain punya user itu sendiri
+func (cs *ChatService) sendChatDeleted(chat model.ChatModel, deletedBy uuid.UUID, mode string) {
+
+	data, _ := json.Marshal(ws.MessageDeletedData{
+		ChatId:    chat.Id,
+		DeletedBy: deletedBy,
+		Mode:      mode,
+	})
+
+	rooms := []uuid.UUID{deletedBy}
+	if mode == DeleteModeForEveryone {
+		rooms = []uuid.UUID{chat.ReceiverId, chat.SenderId}
+	}
+
+	for _, room := range rooms {
+		cs.EventBus.Publish(event.WsEventSendPayload, ws.WebsocketEvent{
+			Action:   ws.ActionMessageDeleted,
+			Detail:   "MESSAGE DELETED",
+			Type:     ws.TypeSystemOk,
+			Receiver: "user:" + room.String(),
+			Data:     data,
+		})
+	}
+}
+
 func (cs *ChatService) resolveMediaTTL(
 	mediaType string,
 	filename string,
@@ -578,3 +1016,549 @@ func (cs *ChatService) resolveMediaTTL(
 
 	return duration
 }
+
+// tandain chat dari partner udah dibaca sampe pesan upTo, terus kabarin partner lewat websocket
+func (cs *ChatService) MarkConversationAsRead(ctx context.Context, reader uuid.UUID, partner uuid.UUID, upTo uuid.UUID) *customerrors.ServiceErrors {
+
+	receipt, err := cs.Pool.MarkConversationAsRead(ctx, reader, partner, upTo)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return &customerrors.ServiceErrors{
+			Code:    404,
+			Message: "pesan tidak ditemukan di percakapan ini",
+		}
+	}
+
+	if err != nil {
+		return &customerrors.ServiceErrors{
+			Code:    500,
+			Message: "gagal menandai pesan sebagai dibaca " + err.Error(),
+		}
+	}
+
+	// ga ada yang berubah, ga usah kirim event lagi
+	if receipt.Count == 0 {
+		return nil
+	}
+
+	cs.sendReadReceipt(reader, partner, receipt)
+
+	return nil
+}
+
+func (cs *ChatService) sendReadReceipt(reader uuid.UUID, partner uuid.UUID, receipt repository.ReadReceipt) {
+
+	data, _ := json.Marshal(ws.ReadReceiptData{
+		ReaderId:   reader,
+		PartnerId:  partner,
+		UpToChatId: receipt.UpTo.Id,
+		ReadAt:     receipt.ReadAt,
+	})
+
+	// ke pengirim pesan buat nampilin centang, ke device lain punya reader biar ikut ke update
+	cs.EventBus.Publish(event.WsEventSendPayload, ws.WebsocketEvent{
+		Action:   ws.ActionReadReceipt,
+		Detail:   "MESSAGE HAS BEEN READ",
+		Type:     ws.TypeSystemOk,
+		Receiver: "user:" + partner.String(),
+		Data:     data,
+	})
+
+	cs.EventBus.Publish(event.WsEventSendPayload, ws.WebsocketEvent{
+		Action:   ws.ActionReadReceipt,
+		Detail:   "CONVERSATION MARKED AS READ",
+		Type:     ws.TypeSystemOk,
+		Receiver: "user:" + reader.String(),
+		Data:     data,
+	})
+}
+
+// buat badge di inbox, diambil dari conversation_state jadi ga perlu ngitung ulang dari history
+func (cs *ChatService) GetUnreadSummary(ctx context.Context, userId uuid.UUID) (UnreadSummaryData, *customerrors.ServiceErrors) {
+
+	counts, err := cs.Pool.GetUnreadCounts(ctx, userId)
+	if err != nil {
+		return UnreadSummaryData{}, &customerrors.ServiceErrors{
+			Code:    500,
+			Message: "Gagal saat mengambil data dari database " + err.Error(),
+		}
+	}
+
+	summary := UnreadSummaryData{
+		Conversations: make([]ConversationUnread, 0, len(counts)),
+	}
+
+	for _, c := range counts {
+		summary.Total += c.UnreadCount
+		summary.Conversations = append(summary.Conversations, ConversationUnread{
+			PartnerId:   c.PartnerId,
+			UnreadCount: c.UnreadCount,
+		})
+	}
+
+	return summary, nil
+}
+
+func (cs *ChatService) EditChat(ctx context.Context, userId uuid.UUID, chatId uuid.UUID, text string) (ChatResponseData, *customerrors.ServiceErrors) {
+
+	text = strings.TrimSpace(text)
+	if text == "" || len(text) > maxChatTextLength {
+		return ChatResponseData{}, &customerrors.ServiceErrors{
+			Code:    400,
+			Message: "Isi pesan tidak valid!",
+		}
+	}
+
+	chatMetaData, err := cs.Pool.GetChatById(ctx, chatId)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ChatResponseData{}, &customerrors.ServiceErrors{
+			Code:    404,
+			Message: "Chat tidak ditemukan!",
+		}
+	}
+
+	if err != nil {
+		return ChatResponseData{}, &customerrors.ServiceErrors{
+			Code:    500,
+			Message: "Gagal mengambil data di database " + err.Error(),
+		}
+	}
+
+	if chatMetaData.SenderId != userId {
+		return ChatResponseData{}, &customerrors.ServiceErrors{
+			Code:    403,
+			Message: "Kamu tidak bisa mengedit pesan ini!",
+		}
+	}
+
+	if chatMetaData.DeletedAt != nil {
+		return ChatResponseData{}, &customerrors.ServiceErrors{
+			Code:    409,
+			Message: "Pesan yang sudah dihapus tidak bisa diedit",
+		}
+	}
+
+	if time.Since(chatMetaData.CreatedAt) > cs.EditWindow {
+		return ChatResponseData{}, &customerrors.ServiceErrors{
+			Code:    403,
+			Message: fmt.Sprintf("Pesan cuma bisa diedit %d menit setelah dikirim", int(cs.EditWindow.Minutes())),
+		}
+	}
+
+	if chatMetaData.ChatText != nil && *chatMetaData.ChatText == text {
+		return ChatResponseData{}, &customerrors.ServiceErrors{
+			Code:    400,
+			Message: "Isi pesan tidak berubah",
+		}
+	}
+
+	edited, err := cs.Pool.EditChatText(ctx, chatId, text)
+	if err != nil {
+		return ChatResponseData{}, &customerrors.ServiceErrors{
+			Code:    500,
+			Message: "gagal mengedit pesan " + err.Error(),
+		}
+	}
+
+	cs.sendChatEdited(edited)
+
+	// token media ga dibikin ulang, client pake yang udah ada
+	return ChatResponseData{
+		Id:               edited.Id,
+		SenderId:         edited.SenderId,
+		ReceiverId:       edited.ReceiverId,
+		ReplyTo:          edited.ReplyTo,
+		ChatText:         edited.ChatText,
+		PostId:           edited.PostId,
+		IsRead:           edited.IsRead,
+		CreatedAt:        edited.CreatedAt,
+		EditedAt:         edited.EditedAt,
+		IsOwn:            true,
+		AttachmentAccess: []string{},
+	}, nil
+}
+
+// riwayat edit bisa dilihat pengirim dan penerima pesan
+func (cs *ChatService) GetChatEdits(ctx context.Context, userId uuid.UUID, chatId uuid.UUID) ([]ChatEditData, *customerrors.ServiceErrors) {
+
+	chatMetaData, err := cs.Pool.GetChatById(ctx, chatId)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, &customerrors.ServiceErrors{
+			Code:    404,
+			Message: "Chat tidak ditemukan!",
+		}
+	}
+
+	if err != nil {
+		return nil, &customerrors.ServiceErrors{
+			Code:    500,
+			Message: "Gagal mengambil data di database " + err.Error(),
+		}
+	}
+
+	if chatMetaData.SenderId != userId && chatMetaData.ReceiverId != userId {
+		// sengaja 404 biar ga ketauan chat nya ada
+		return nil, &customerrors.ServiceErrors{
+			Code:    404,
+			Message: "Chat tidak ditemukan!",
+		}
+	}
+
+	edits, err := cs.Pool.GetChatEdits(ctx, chatId)
+	if err != nil {
+		return nil, &customerrors.ServiceErrors{
+			Code:    500,
+			Message: "Gagal mengambil data di database " + err.Error(),
+		}
+	}
+
+	result := make([]ChatEditData, 0, len(edits))
+	for _, e := range edits {
+		result = append(result, ChatEditData{
+			PreviousText: e.PreviousText,
+			EditedAt:     e.EditedAt,
+		})
+	}
+
+	return result, nil
+}
+
+func (cs *ChatService) sendChatEdited(chat model.ChatModel) {
+
+	data, _ := json.Marshal(ws.MessageEditedData{
+		ChatId:     chat.Id,
+		SenderId:   chat.SenderId,
+		ReceiverId: chat.ReceiverId,
+		ChatText:   chat.ChatText,
+		EditedAt:   chat.EditedAt,
+	})
+
+	for _, room := range []uuid.UUID{chat.ReceiverId, chat.SenderId} {
+		cs.EventBus.Publish(event.WsEventSendPayload, ws.WebsocketEvent{
+			Action:   ws.ActionMessageEdited,
+			Detail:   "MESSAGE EDITED",
+			Type:     ws.TypeSystemOk,
+			Receiver: "user:" + room.String(),
+			Data:     data,
+		})
+	}
+}
+
+// cuma nerima emoji, bukan teks biasa. huruf, spasi sama karakter kontrol ditolak
+func isValidReaction(emoji string) bool {
+
+	if emoji == "" || !utf8.ValidString(emoji) || utf8.RuneCountInString(emoji) > maxReactionRunes {
+		return false
+	}
+
+	hasSymbol := false
+	for _, r := range emoji {
+		if unicode.IsLetter(r) || unicode.IsSpace(r) || unicode.IsControl(r) {
+			return false
+		}
+
+		if r > unicode.MaxASCII {
+			hasSymbol = true
+		}
+	}
+
+	return hasSymbol
+}
+
+// chat yang bisa dikasih reaksi cuma yang user nya ikut di percakapan itu
+func (cs *ChatService) getChatForParticipant(ctx context.Context, userId uuid.UUID, chatId uuid.UUID) (model.ChatModel, *customerrors.ServiceErrors) {
+
+	chatMetaData, err := cs.Pool.GetChatById(ctx, chatId)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return model.ChatModel{}, &customerrors.ServiceErrors{
+			Code:    404,
+			Message: "Chat tidak ditemukan!",
+		}
+	}
+
+	if err != nil {
+		return model.ChatModel{}, &customerrors.ServiceErrors{
+			Code:    500,
+			Message: "Gagal mengambil data di database " + err.Error(),
+		}
+	}
+
+	if chatMetaData.SenderId != userId && chatMetaData.ReceiverId != userId {
+		return model.ChatModel{}, &customerrors.ServiceErrors{
+			Code:    404,
+			Message: "Chat tidak ditemukan!",
+		}
+	}
+
+	return chatMetaData, nil
+}
+
+func (cs *ChatService) AddReaction(ctx context.Context, userId uuid.UUID, chatId uuid.UUID, emoji string) *customerrors.ServiceErrors {
+
+	emoji = strings.TrimSpace(emoji)
+	if !isValidReaction(emoji) {
+		return &customerrors.ServiceErrors{
+			Code:    400,
+			Message: "reaksi harus berupa emoji",
+		}
+	}
+
+	chatMetaData, svcErr := cs.getChatForParticipant(ctx, userId, chatId)
+	if svcErr != nil {
+		return svcErr
+	}
+
+	if chatMetaData.DeletedAt != nil {
+		return &customerrors.ServiceErrors{
+			Code:    409,
+			Message: "Pesan yang sudah dihapus tidak bisa diberi reaksi",
+		}
+	}
+
+	added, count, err := cs.Pool.AddReaction(ctx, chatId, userId, emoji)
+	if err != nil {
+		return &customerrors.ServiceErrors{
+			Code:    500,
+			Message: "Gagal menyimpan reaksi " + err.Error(),
+		}
+	}
+
+	// reaksi yang sama dikirim ulang ga perlu di broadcast lagi
+	if added {
+		cs.sendReaction(ws.ActionReactionAdded, chatMetaData, userId, emoji, count)
+	}
+
+	return nil
+}
+
+func (cs *ChatService) RemoveReaction(ctx context.Context, userId uuid.UUID, chatId uuid.UUID, emoji string) *customerrors.ServiceErrors {
+
+	emoji = strings.TrimSpace(emoji)
+
+	chatMetaData, svcErr := cs.getChatForParticipant(ctx, userId, chatId)
+	if svcErr != nil {
+		return svcErr
+	}
+
+	removed, count, err := cs.Pool.RemoveReaction(ctx, chatId, userId, emoji)
+	if err != nil {
+		return &customerrors.ServiceErrors{
+			Code:    500,
+			Message: "Gagal menghapus reaksi " + err.Error(),
+		}
+	}
+
+	if !removed {
+		return &customerrors.ServiceErrors{
+			Code:    404,
+			Message: "Reaksi tidak ditemukan!",
+		}
+	}
+
+	cs.sendReaction(ws.ActionReactionRemoved, chatMetaData, userId, emoji, count)
+
+	return nil
+}
+
+func (cs *ChatService) GetReactions(ctx context.Context, userId uuid.UUID, chatId uuid.UUID) ([]ReactionData, *customerrors.ServiceErrors) {
+
+	if _, svcErr := cs.getChatForParticipant(ctx, userId, chatId); svcErr != nil {
+		return nil, svcErr
+	}
+
+	reactions, err := cs.Pool.GetReactions(ctx, chatId)
+	if err != nil {
+		return nil, &customerrors.ServiceErrors{
+			Code:    500,
+			Message: "Gagal mengambil data di database " + err.Error(),
+		}
+	}
+
+	result := make([]ReactionData, 0, len(reactions))
+	for _, r := range reactions {
+		result = append(result, ReactionData{
+			UserId:    r.UserId,
+			Emoji:     r.Emoji,
+			CreatedAt: r.CreatedAt,
+		})
+	}
+
+	return result, nil
+}
+
+func (cs *ChatService) sendReaction(action string, chat model.ChatModel, userId uuid.UUID, emoji string, count int) {
+
+	data, _ := json.Marshal(ws.ReactionEventData{
+		ChatId: chat.Id,
+		UserId: userId,
+		Emoji:  emoji,
+		Count:  count,
+	})
+
+	for _, room := range []uuid.UUID{chat.ReceiverId, chat.SenderId} {
+		cs.EventBus.Publish(event.WsEventSendPayload, ws.WebsocketEvent{
+			Action:   action,
+			Detail:   strings.ReplaceAll(action, "_", " "),
+			Type:     ws.TypeSystemOk,
+			Receiver: "user:" + room.String(),
+			Data:     data,
+		})
+	}
+}
+
+// cuma nyari di chat private sama grup yang user nya ikut, pesan yang dihapus / disembunyiin ga ikut
+func (cs *ChatService) SearchChats(ctx context.Context, userId uuid.UUID, in ChatSearchInput) (ChatSearchPageData, *customerrors.ServiceErrors) {
+
+	text := strings.TrimSpace(in.Query)
+	if text == "" || utf8.RuneCountInString(text) > maxSearchQueryLength {
+		return ChatSearchPageData{}, customerrors.New(http.StatusBadRequest, "kata kunci wajib di isi dan maksimal 200 karakter")
+	}
+
+	if in.From != nil && in.To != nil && !in.From.Before(*in.To) {
+		return ChatSearchPageData{}, customerrors.New(http.StatusBadRequest, "rentang tanggal tidak valid")
+	}
+
+	page, svcErr := parseChatPageInput(ChatPageInput{Before: in.Before, Limit: in.Limit})
+	if svcErr != nil {
+		return ChatSearchPageData{}, svcErr
+	}
+
+	hits, hasMore, err := cs.Pool.SearchChats(ctx, repository.ChatSearchQuery{
+		UserId:        userId,
+		Text:          text,
+		PartnerId:     in.PartnerId,
+		From:          in.From,
+		To:            in.To,
+		HasAttachment: in.HasAttachment,
+		Before:        page.Before,
+		Limit:         page.Limit,
+	})
+
+	if err != nil {
+		return ChatSearchPageData{}, customerrors.New(http.StatusInternalServerError, "Gagal mencari pesan "+err.Error())
+	}
+
+	results := make([]ChatSearchResultData, 0, len(hits))
+	for _, h := range hits {
+		result := ChatSearchResultData{
+			ChatId:                h.Chat.Id,
+			SenderId:              h.Chat.SenderId,
+			ChatPartnerId:         h.Partner.Id,
+			ChatPartnerFullName:   h.Partner.FullName,
+			ChatPartnerUsername:   h.Partner.Username,
+			ChatPartnerProfilePic: h.Partner.ProfilePicture,
+			Snippet:               h.Snippet,
+			HasAttachment:         h.HasAttachment,
+			IsOwn:                 h.Chat.IsOwn,
+			CreatedAt:             h.Chat.CreatedAt,
+			EditedAt:              h.Chat.EditedAt,
+		}
+
+		if h.Group != nil {
+			result.GroupId = &h.Group.Id
+			result.GroupName = &h.Group.Name
+			result.GroupAvatar = h.Group.Avatar
+		}
+
+		results = append(results, result)
+	}
+
+	paging := ChatPagingData{
+		HasOlder: hasMore,
+		HasNewer: page.Before != nil,
+	}
+
+	if len(hits) > 0 {
+		last := hits[len(hits)-1].Chat
+		older := encodeChatCursor(repository.ChatCursor{CreatedAt: last.CreatedAt, Id: last.Id})
+		paging.OlderCursor = &older
+	}
+
+	return ChatSearchPageData{
+		Results: results,
+		Paging:  paging,
+	}, nil
+}
+
+const wsSendTimeout = 10 * time.Second
+
+// SEND_MESSAGE dari websocket, hasilnya selalu dibales ACK ke koneksi yang ngirim.
+// jalan di goroutine ReadPump jadi urutan pesan dari satu koneksi tetep kejaga.
+// client_msg_id nya disimpen bareng pesan nya, jadi retry yang dateng barengan pun cuma kesimpen sekali
+func (cs *ChatService) handleSendMessage(c *ws.Client, ev ws.WebsocketEvent) {
+
+	var req ws.SendMessageData
+	if err := json.Unmarshal(ev.Data, &req); err != nil {
+		c.SendError("Harap kirim payload dengan benar!")
+		return
+	}
+
+	if err := binding.Validator.ValidateStruct(req); err != nil {
+		cs.sendAck(c, ws.AckData{ClientMsgId: req.ClientMsgId, Error: "Harap kirim data payload dengan benar"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), wsSendTimeout)
+	defer cancel()
+
+	saved, svcErr := cs.saveChat(&ChatPostInput{
+		SenderId:    c.UserId,
+		ReceiverId:  req.ReceiverId,
+		ReplyTo:     req.ReplyTo,
+		ChatText:    req.ChatText,
+		PostId:      req.PostId,
+		ClientMsgId: &req.ClientMsgId,
+	}, ctx)
+
+	if svcErr != nil && svcErr.Code == http.StatusConflict {
+		cs.sendDuplicateAck(ctx, c, req.ClientMsgId)
+		return
+	}
+
+	if svcErr != nil {
+		// ga ada yang kesimpen, client boleh retry pake client_msg_id yang sama
+		cs.sendAck(c, ws.AckData{ClientMsgId: req.ClientMsgId, Error: svcErr.Message})
+		return
+	}
+
+	cs.sendAck(c, ws.AckData{
+		ClientMsgId: req.ClientMsgId,
+		ChatId:      &saved.Id,
+		CreatedAt:   &saved.CreatedAt,
+	})
+}
+
+func (cs *ChatService) sendDuplicateAck(ctx context.Context, c *ws.Client, clientMsgId string) {
+
+	saved, err := cs.Pool.GetChatByClientMsgId(ctx, c.UserId, clientMsgId)
+	if err != nil {
+		cs.sendAck(c, ws.AckData{ClientMsgId: clientMsgId, Error: "Terjadi kesalahan di server! " + err.Error()})
+		return
+	}
+
+	cs.sendAck(c, ws.AckData{
+		ClientMsgId: clientMsgId,
+		ChatId:      &saved.Id,
+		CreatedAt:   &saved.CreatedAt,
+		Duplicate:   true,
+	})
+}
+
+func (cs *ChatService) sendAck(c *ws.Client, ack ws.AckData) {
+
+	data, _ := json.Marshal(ack)
+
+	ev := ws.WebsocketEvent{
+		Action: ws.ActionAck,
+		Detail: "MESSAGE ACCEPTED",
+		Type:   ws.TypeSystemOk,
+		Data:   data,
+	}
+
+	if ack.Error != "" {
+		ev.Detail = "MESSAGE REJECTED"
+		ev.Type = ws.TypeSystemError
+	}
+
+	c.SendEvent(ev)
+}
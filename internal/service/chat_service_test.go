@@ -0,0 +1,1368 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Agmer17/golang_yapping/internal/event"
+	"github.com/Agmer17/golang_yapping/internal/model"
+	"github.com/Agmer17/golang_yapping/internal/repository"
+	"github.com/Agmer17/golang_yapping/internal/ws"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/jackc/pgx/v5"
+)
+
+// chat repo in-memory, method yang ga di override bakal panic kalo kepanggil
+type fakeChatRepo struct {
+	repository.ChatRepositoryInterface
+
+	mu    sync.Mutex
+	chats []model.ChatModel
+
+	edits     []model.ChatEdit
+	reactions []model.ChatReaction
+
+	// chat_id -> user yang udah nyembunyiin pesan nya
+	hidden map[uuid.UUID]map[uuid.UUID]bool
+
+	// query halaman terakhir yang diterima repo, buat ngecek hasil parse input nya
+	lastPage repository.ChatPageQuery
+
+	// hasil pencarian nya disiapin test, urut dari yang paling baru
+	searchHits []repository.ChatSearchHit
+	lastSearch repository.ChatSearchQuery
+}
+
+// masukin pesan langsung tanpa lewat Save, id sama created_at nya diisi kalo kosong
+func (r *fakeChatRepo) add(c model.ChatModel) model.ChatModel {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if c.Id == uuid.Nil {
+		c.Id = uuid.New()
+	}
+
+	if c.CreatedAt.IsZero() {
+		c.CreatedAt = time.Now()
+	}
+
+	r.chats = append(r.chats, c)
+
+	return c
+}
+
+// urutan (created_at, id) sama kayak index di postgres, uuid dibandingin per byte
+func chatBefore(c model.ChatModel, cursor repository.ChatCursor) bool {
+	if !c.CreatedAt.Equal(cursor.CreatedAt) {
+		return c.CreatedAt.Before(cursor.CreatedAt)
+	}
+	return bytes.Compare(c.Id[:], cursor.Id[:]) < 0
+}
+
+func chatAfter(c model.ChatModel, cursor repository.ChatCursor) bool {
+	if !c.CreatedAt.Equal(cursor.CreatedAt) {
+		return c.CreatedAt.After(cursor.CreatedAt)
+	}
+	return bytes.Compare(c.Id[:], cursor.Id[:]) > 0
+}
+
+func chatCursorOf(c model.ChatModel) repository.ChatCursor {
+	return repository.ChatCursor{CreatedAt: c.CreatedAt, Id: c.Id}
+}
+
+// pesan antara dua user, urut dari yang paling lama
+func (r *fakeChatRepo) conversation(a uuid.UUID, b uuid.UUID) []model.ChatModel {
+	var list []model.ChatModel
+	for _, c := range r.chats {
+		if (c.SenderId == a && c.ReceiverId == b) || (c.SenderId == b && c.ReceiverId == a) {
+			list = append(list, c)
+		}
+	}
+
+	sort.Slice(list, func(i, j int) bool { return chatBefore(list[i], chatCursorOf(list[j])) })
+
+	return list
+}
+
+func (r *fakeChatRepo) visibleTo(list []model.ChatModel, viewer uuid.UUID) []model.ChatModel {
+	visible := make([]model.ChatModel, 0, len(list))
+	for _, c := range list {
+		if !r.hidden[c.Id][viewer] {
+			visible = append(visible, c)
+		}
+	}
+	return visible
+}
+
+func (r *fakeChatRepo) GetChatBeetween(ctx context.Context, re uuid.UUID, se uuid.UUID, q repository.ChatPageQuery) (repository.ChatPage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.lastPage = q
+	all := r.visibleTo(r.conversation(re, se), se)
+
+	var page repository.ChatPage
+
+	if q.After != nil {
+		var newer []model.ChatModel
+		for _, c := range all {
+			if chatAfter(c, *q.After) {
+				newer = append(newer, c)
+			}
+		}
+
+		page.HasOlder = true
+		page.HasNewer = len(newer) > q.Limit
+		page.Chats = newer[:min(len(newer), q.Limit)]
+
+		return page, nil
+	}
+
+	var older []model.ChatModel
+	for _, c := range all {
+		if q.Before == nil || chatBefore(c, *q.Before) {
+			older = append(older, c)
+		}
+	}
+
+	page.HasNewer = q.Before != nil
+	page.HasOlder = len(older) > q.Limit
+	page.Chats = older[max(0, len(older)-q.Limit):]
+
+	return page, nil
+}
+
+func (r *fakeChatRepo) GetChatAround(ctx context.Context, re uuid.UUID, se uuid.UUID, chatId uuid.UUID, limit int) (repository.ChatPage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	all := r.visibleTo(r.conversation(re, se), se)
+	for i, c := range all {
+		if c.Id != chatId {
+			continue
+		}
+
+		from := max(0, i-limit/2)
+		to := min(len(all), i+limit-limit/2)
+
+		return repository.ChatPage{
+			Chats:    all[from:to],
+			HasOlder: from > 0,
+			HasNewer: to < len(all),
+		}, nil
+	}
+
+	return repository.ChatPage{}, pgx.ErrNoRows
+}
+
+func (r *fakeChatRepo) Save(d model.ChatModel, ctx context.Context) (repository.ChatWithSender, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// niru unique index (sender_id, client_msg_id)
+	if d.ClientMsgId != nil {
+		for _, c := range r.chats {
+			if c.SenderId == d.SenderId && c.ClientMsgId != nil && *c.ClientMsgId == *d.ClientMsgId {
+				return repository.ChatWithSender{}, repository.ErrDuplicateClientMsgId
+			}
+		}
+	}
+
+	d.Id = uuid.New()
+	d.CreatedAt = time.Now()
+	r.chats = append(r.chats, d)
+
+	return repository.ChatWithSender{ChatData: d, Sender: model.User{Id: d.SenderId}}, nil
+}
+
+func (r *fakeChatRepo) GetChatByClientMsgId(ctx context.Context, senderId uuid.UUID, clientMsgId string) (model.ChatModel, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, c := range r.chats {
+		if c.SenderId == senderId && c.ClientMsgId != nil && *c.ClientMsgId == clientMsgId {
+			return c, nil
+		}
+	}
+
+	return model.ChatModel{}, pgx.ErrNoRows
+}
+
+func (r *fakeChatRepo) MarkConversationAsRead(ctx context.Context, reader uuid.UUID, partner uuid.UUID, upTo uuid.UUID) (repository.ReadReceipt, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var target *model.ChatModel
+	for _, c := range r.conversation(reader, partner) {
+		if c.Id == upTo {
+			target = &c
+			break
+		}
+	}
+
+	if target == nil {
+		return repository.ReadReceipt{}, pgx.ErrNoRows
+	}
+
+	receipt := repository.ReadReceipt{UpTo: chatCursorOf(*target), ReadAt: time.Now()}
+
+	for i, c := range r.chats {
+		if c.SenderId == partner && c.ReceiverId == reader && !c.IsRead && !chatAfter(c, receipt.UpTo) {
+			r.chats[i].IsRead = true
+			receipt.Count++
+		}
+	}
+
+	return receipt, nil
+}
+
+// dihitung langsung dari pesan yang belum dibaca, hasilnya harus sama kayak conversation_state
+func (r *fakeChatRepo) GetUnreadCounts(ctx context.Context, userId uuid.UUID) ([]repository.UnreadCount, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	counts := make([]repository.UnreadCount, 0)
+	index := map[uuid.UUID]int{}
+
+	for _, c := range r.chats {
+		if c.ReceiverId != userId || c.IsRead || c.DeletedAt != nil {
+			continue
+		}
+
+		i, ok := index[c.SenderId]
+		if !ok {
+			i = len(counts)
+			index[c.SenderId] = i
+			counts = append(counts, repository.UnreadCount{PartnerId: c.SenderId})
+		}
+
+		counts[i].UnreadCount++
+	}
+
+	return counts, nil
+}
+
+func (r *fakeChatRepo) GetChatById(ctx context.Context, chatId uuid.UUID) (model.ChatModel, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, c := range r.chats {
+		if c.Id == chatId {
+			return c, nil
+		}
+	}
+
+	return model.ChatModel{}, pgx.ErrNoRows
+}
+
+func (r *fakeChatRepo) EditChatText(ctx context.Context, chatId uuid.UUID, text string) (model.ChatModel, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, c := range r.chats {
+		if c.Id != chatId {
+			continue
+		}
+
+		now := time.Now()
+		r.edits = append(r.edits, model.ChatEdit{Id: uuid.New(), ChatId: chatId, PreviousText: c.ChatText, EditedAt: now})
+
+		r.chats[i].ChatText = &text
+		r.chats[i].EditedAt = &now
+
+		return r.chats[i], nil
+	}
+
+	return model.ChatModel{}, pgx.ErrNoRows
+}
+
+func (r *fakeChatRepo) GetChatEdits(ctx context.Context, chatId uuid.UUID) ([]model.ChatEdit, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	edits := make([]model.ChatEdit, 0)
+	for _, e := range r.edits {
+		if e.ChatId == chatId {
+			edits = append(edits, e)
+		}
+	}
+
+	return edits, nil
+}
+
+func (r *fakeChatRepo) HideForUser(ctx context.Context, chatId uuid.UUID, userId uuid.UUID) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.hidden == nil {
+		r.hidden = make(map[uuid.UUID]map[uuid.UUID]bool)
+	}
+
+	if r.hidden[chatId] == nil {
+		r.hidden[chatId] = make(map[uuid.UUID]bool)
+	}
+
+	r.hidden[chatId][userId] = true
+
+	for i, c := range r.chats {
+		if c.Id != chatId {
+			continue
+		}
+
+		if c.ReceiverId == userId {
+			r.chats[i].IsRead = true
+		}
+
+		// dua dua nya udah nyembunyiin, row nya dihapus beneran
+		if r.hidden[chatId][c.SenderId] && r.hidden[chatId][c.ReceiverId] {
+			r.chats = append(r.chats[:i], r.chats[i+1:]...)
+			return attachmentNames(c), nil
+		}
+
+		break
+	}
+
+	return []string{}, nil
+}
+
+func (r *fakeChatRepo) DeleteForEveryone(ctx context.Context, chatId uuid.UUID) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, c := range r.chats {
+		if c.Id != chatId || c.DeletedAt != nil {
+			continue
+		}
+
+		now := time.Now()
+		r.chats[i].DeletedAt = &now
+		r.chats[i].ChatText = nil
+		r.chats[i].PostId = nil
+		r.chats[i].IsRead = true
+		r.chats[i].Attachment = nil
+		r.chats[i].Reactions = nil
+
+		edits := r.edits[:0]
+		for _, e := range r.edits {
+			if e.ChatId != chatId {
+				edits = append(edits, e)
+			}
+		}
+		r.edits = edits
+
+		return attachmentNames(c), nil
+	}
+
+	return nil, pgx.ErrNoRows
+}
+
+// count itu jumlah emoji yang sama di pesan itu setelah di tambah / dihapus
+func (r *fakeChatRepo) countReaction(chatId uuid.UUID, emoji string) int {
+	count := 0
+	for _, re := range r.reactions {
+		if re.ChatId == chatId && re.Emoji == emoji {
+			count++
+		}
+	}
+	return count
+}
+
+func (r *fakeChatRepo) AddReaction(ctx context.Context, chatId uuid.UUID, userId uuid.UUID, emoji string) (bool, int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, re := range r.reactions {
+		if re.ChatId == chatId && re.UserId == userId && re.Emoji == emoji {
+			return false, r.countReaction(chatId, emoji), nil
+		}
+	}
+
+	r.reactions = append(r.reactions, model.ChatReaction{ChatId: chatId, UserId: userId, Emoji: emoji, CreatedAt: time.Now()})
+
+	return true, r.countReaction(chatId, emoji), nil
+}
+
+func (r *fakeChatRepo) RemoveReaction(ctx context.Context, chatId uuid.UUID, userId uuid.UUID, emoji string) (bool, int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, re := range r.reactions {
+		if re.ChatId == chatId && re.UserId == userId && re.Emoji == emoji {
+			r.reactions = append(r.reactions[:i], r.reactions[i+1:]...)
+			return true, r.countReaction(chatId, emoji), nil
+		}
+	}
+
+	return false, r.countReaction(chatId, emoji), nil
+}
+
+func (r *fakeChatRepo) GetReactions(ctx context.Context, chatId uuid.UUID) ([]model.ChatReaction, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	list := make([]model.ChatReaction, 0)
+	for _, re := range r.reactions {
+		if re.ChatId == chatId {
+			list = append(list, re)
+		}
+	}
+
+	return list, nil
+}
+
+// full text search nya ada di postgres, disini cuma potong halaman dari hasil yang udah disiapin
+func (r *fakeChatRepo) SearchChats(ctx context.Context, q repository.ChatSearchQuery) ([]repository.ChatSearchHit, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.lastSearch = q
+
+	hits := make([]repository.ChatSearchHit, 0)
+	for _, h := range r.searchHits {
+		if q.Before == nil || chatBefore(h.Chat, *q.Before) {
+			hits = append(hits, h)
+		}
+	}
+
+	if len(hits) > q.Limit {
+		return hits[:q.Limit], true, nil
+	}
+
+	return hits, false, nil
+}
+
+func attachmentNames(c model.ChatModel) []string {
+	names := make([]string, 0, len(c.Attachment))
+	for _, a := range c.Attachment {
+		names = append(names, a.FileName)
+	}
+	return names
+}
+
+func (r *fakeChatRepo) saved() []model.ChatModel {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]model.ChatModel(nil), r.chats...)
+}
+
+func newTestChatService(t *testing.T, repo repository.ChatRepositoryInterface) *ChatService {
+	t.Helper()
+
+	hub := ws.NewHub(ws.NewMemoryBackplane(), nil, nil)
+	_, rdb := newTestRedis(t)
+
+	cs := &ChatService{
+		Pool:        repo,
+		Hub:         hub,
+		storage:     &FileStorage{Private: t.TempDir()},
+		RedisClient: rdb,
+		EventBus:    event.NewEventBus(hub, context.Background(), nil),
+		EditWindow:  DefaultChatEditWindow,
+	}
+
+	hub.HandleAction(ws.ActionSendMessage, cs.handleSendMessage)
+
+	return cs
+}
+
+// nampung event websocket yang di publish service ke event bus
+func captureWsEvents(cs *ChatService) <-chan ws.WebsocketEvent {
+	events := make(chan ws.WebsocketEvent, 32)
+
+	cs.EventBus.Subscribe(event.WsEventSendPayload, func(ctx context.Context, payload interface{}) {
+		events <- payload.(ws.WebsocketEvent)
+	})
+
+	return events
+}
+
+// ngumpulin n event, urutan nya ga dijamin karena bus nya jalan di goroutine
+func waitWsEvents(t *testing.T, events <-chan ws.WebsocketEvent, n int) []ws.WebsocketEvent {
+	t.Helper()
+
+	var got []ws.WebsocketEvent
+	deadline := time.After(2 * time.Second)
+
+	for len(got) < n {
+		select {
+		case ev := <-events:
+			got = append(got, ev)
+		case <-deadline:
+			t.Fatalf("event yang nyampe %d, harusnya %d", len(got), n)
+		}
+	}
+
+	return got
+}
+
+func expectNoWsEvent(t *testing.T, events <-chan ws.WebsocketEvent) {
+	t.Helper()
+
+	select {
+	case ev := <-events:
+		t.Fatalf("ga boleh ada event, dapet %s ke %s", ev.Action, ev.Receiver)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// koneksi websocket palsu, yang dikirim test dibaca ReadPump dan yang ditulis WritePump dikirim ke written
+type wsTestConn struct {
+	inbound chan []byte
+	written chan []byte
+
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newWsTestConn() *wsTestConn {
+	return &wsTestConn{
+		inbound: make(chan []byte, 8),
+		written: make(chan []byte, 32),
+		closed:  make(chan struct{}),
+	}
+}
+
+func (f *wsTestConn) ReadMessage() (int, []byte, error) {
+	select {
+	case msg := <-f.inbound:
+		return websocket.TextMessage, msg, nil
+	case <-f.closed:
+		return 0, nil, errors.New("koneksi ditutup")
+	}
+}
+
+func (f *wsTestConn) WriteMessage(messageType int, data []byte) error {
+	if messageType == websocket.TextMessage {
+		f.written <- data
+	}
+	return nil
+}
+
+func (f *wsTestConn) WriteControl(messageType int, data []byte, deadline time.Time) error {
+	return nil
+}
+
+func (f *wsTestConn) SetReadLimit(limit int64)                    {}
+func (f *wsTestConn) SetReadDeadline(t time.Time) error           { return nil }
+func (f *wsTestConn) SetWriteDeadline(t time.Time) error          { return nil }
+func (f *wsTestConn) SetPongHandler(h func(appData string) error) {}
+
+func (f *wsTestConn) Close() error {
+	f.closeOnce.Do(func() { close(f.closed) })
+	return nil
+}
+
+// client websocket yang udah jalan ReadPump + WritePump nya
+func connectTestClient(t *testing.T, hub *ws.Hub, userId uuid.UUID) *wsTestConn {
+	t.Helper()
+
+	conn := newWsTestConn()
+	c := ws.NewClient(conn, hub, userId)
+
+	go c.WritePump()
+	go c.ReadPump()
+
+	t.Cleanup(func() { conn.Close() })
+
+	return conn
+}
+
+func (f *wsTestConn) send(t *testing.T, action string, data any) {
+	t.Helper()
+
+	raw, err := json.Marshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload, _ := json.Marshal(ws.WebsocketEvent{Action: action, Data: raw})
+	f.inbound <- payload
+}
+
+// nunggu event dengan action tertentu, event lain nya dilewatin
+func (f *wsTestConn) waitEvent(t *testing.T, action string) ws.WebsocketEvent {
+	t.Helper()
+
+	deadline := time.After(2 * time.Second)
+	for {
+		select {
+		case raw := <-f.written:
+			var ev ws.WebsocketEvent
+			if err := json.Unmarshal(raw, &ev); err != nil {
+				t.Fatalf("payload bukan json : %s", raw)
+			}
+
+			if ev.Action == action {
+				return ev
+			}
+		case <-deadline:
+			t.Fatalf("event %s ga nyampe", action)
+			return ws.WebsocketEvent{}
+		}
+	}
+}
+
+func (f *wsTestConn) waitAck(t *testing.T) ws.AckData {
+	t.Helper()
+
+	var ack ws.AckData
+	if err := json.Unmarshal(f.waitEvent(t, ws.ActionAck).Data, &ack); err != nil {
+		t.Fatal(err)
+	}
+
+	return ack
+}
+
+func TestWsSendMessageRetryStoredOnce(t *testing.T) {
+
+	repo := &fakeChatRepo{}
+	cs := newTestChatService(t, repo)
+
+	sender := uuid.New()
+	conn := connectTestClient(t, cs.Hub, sender)
+
+	text := "halo"
+	msg := ws.SendMessageData{ClientMsgId: "msg-1", ReceiverId: uuid.NewString(), ChatText: &text}
+
+	conn.send(t, ws.ActionSendMessage, msg)
+	first := conn.waitAck(t)
+
+	if first.Error != "" || first.ChatId == nil || first.Duplicate {
+		t.Fatalf("pesan pertama harusnya diterima, ack nya %+v", first)
+	}
+
+	// retry pake client_msg_id yang sama dibales id pesan yang dulu
+	conn.send(t, ws.ActionSendMessage, msg)
+	retry := conn.waitAck(t)
+
+	if !retry.Duplicate || retry.ChatId == nil || *retry.ChatId != *first.ChatId {
+		t.Fatalf("retry harusnya ditandain duplikat dengan id yang sama, ack nya %+v", retry)
+	}
+
+	// client_msg_id yang sama dari user lain bukan duplikat
+	other := connectTestClient(t, cs.Hub, uuid.New())
+	other.send(t, ws.ActionSendMessage, msg)
+
+	if ack := other.waitAck(t); ack.Duplicate || ack.Error != "" {
+		t.Fatalf("client_msg_id user lain ga boleh dianggap duplikat, ack nya %+v", ack)
+	}
+
+	if n := len(repo.saved()); n != 2 {
+		t.Fatalf("pesan yang kesimpen %d, harusnya 2", n)
+	}
+}
+
+func TestChatPaginationWalksHistoryWithCursors(t *testing.T) {
+
+	repo := &fakeChatRepo{}
+	cs := newTestChatService(t, repo)
+	ctx := context.Background()
+
+	me, partner := uuid.New(), uuid.New()
+	base := time.Date(2026, 1, 2, 3, 4, 5, 123456789, time.UTC)
+
+	// 3 pesan di created_at yang sama, urutan nya cuma ditentuin id
+	var want []model.ChatModel
+	for i := range 7 {
+		at := base.Add(time.Duration(i) * time.Second)
+		if i >= 2 && i <= 4 {
+			at = base.Add(2 * time.Second)
+		}
+
+		sender, receiver := me, partner
+		if i%2 == 1 {
+			sender, receiver = partner, me
+		}
+
+		want = append(want, repo.add(model.ChatModel{SenderId: sender, ReceiverId: receiver, CreatedAt: at}))
+	}
+
+	repo.add(model.ChatModel{SenderId: me, ReceiverId: uuid.New(), CreatedAt: base})
+
+	sort.Slice(want, func(i, j int) bool { return chatBefore(want[i], chatCursorOf(want[j])) })
+
+	// mundur dari pesan paling baru sampe habis
+	var got []uuid.UUID
+	var oldest ChatPageData
+	in := ChatPageInput{Limit: 3}
+	for pages := 0; ; pages++ {
+		if pages > len(want) {
+			t.Fatal("pagination nya ga berhenti")
+		}
+
+		page, svcErr := cs.GetChatBeetween(ctx, partner, me, in)
+		if svcErr != nil {
+			t.Fatal(svcErr.Message)
+		}
+
+		ids := make([]uuid.UUID, 0, len(page.Chats))
+		for _, c := range page.Chats {
+			ids = append(ids, c.Id)
+		}
+		got = append(ids, got...)
+		oldest = page
+
+		if !page.Paging.HasOlder {
+			break
+		}
+
+		in = ChatPageInput{Before: *page.Paging.OlderCursor, Limit: 3}
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("dapet %d pesan, harusnya %d", len(got), len(want))
+	}
+
+	for i := range want {
+		if got[i] != want[i].Id {
+			t.Fatalf("urutan pesan ke %d beda, ada yang kelewat atau dobel", i)
+		}
+	}
+
+	// maju lagi dari pesan paling lama pake cursor after
+	page, svcErr := cs.GetChatBeetween(ctx, partner, me, ChatPageInput{After: *oldest.Paging.OlderCursor, Limit: 1})
+	if svcErr != nil {
+		t.Fatal(svcErr.Message)
+	}
+
+	if len(page.Chats) != 1 || page.Chats[0].Id != want[1].Id || !page.Paging.HasNewer {
+		t.Fatalf("after cursor nya harusnya balikin pesan setelah cursor, dapet %+v", page)
+	}
+
+	// presisi nanodetik nya ga ilang di cursor
+	if repo.lastPage.After == nil || !repo.lastPage.After.CreatedAt.Equal(want[0].CreatedAt) {
+		t.Fatalf("cursor nya berubah pas di decode : %+v", repo.lastPage.After)
+	}
+}
+
+func TestChatPaginationInput(t *testing.T) {
+
+	repo := &fakeChatRepo{}
+	cs := newTestChatService(t, repo)
+	ctx := context.Background()
+
+	me, partner := uuid.New(), uuid.New()
+	chat := repo.add(model.ChatModel{SenderId: me, ReceiverId: partner})
+	cursor := encodeChatCursor(chatCursorOf(chat))
+
+	for name, in := range map[string]ChatPageInput{
+		"before sama after":  {Before: cursor, After: cursor},
+		"before sama around": {Before: cursor, Around: &chat.Id},
+		"cursor rusak":       {Before: "bukan-cursor"},
+		"cursor kepotong":    {After: encodeChatCursor(repository.ChatCursor{CreatedAt: time.Now()})[:10]},
+	} {
+		if _, svcErr := cs.GetChatBeetween(ctx, partner, me, in); svcErr == nil || svcErr.Code != http.StatusBadRequest {
+			t.Errorf("%s : harusnya 400, dapet %v", name, svcErr)
+		}
+	}
+
+	for limit, want := range map[int]int{0: defaultChatPageLimit, -5: defaultChatPageLimit, 10: 10, 500: maxChatPageLimit} {
+		if _, svcErr := cs.GetChatBeetween(ctx, partner, me, ChatPageInput{Limit: limit}); svcErr != nil {
+			t.Fatal(svcErr.Message)
+		}
+
+		if repo.lastPage.Limit != want {
+			t.Errorf("limit %d jadi %d, harusnya %d", limit, repo.lastPage.Limit, want)
+		}
+	}
+
+	// around pesan yang ga ada di percakapan ini
+	stranger := repo.add(model.ChatModel{SenderId: uuid.New(), ReceiverId: uuid.New()})
+	if _, svcErr := cs.GetChatBeetween(ctx, partner, me, ChatPageInput{Around: &stranger.Id}); svcErr == nil || svcErr.Code != http.StatusNotFound {
+		t.Fatalf("around pesan percakapan lain harusnya 404, dapet %v", svcErr)
+	}
+
+	// limit 1 tetep dapet pesan target nya
+	page, svcErr := cs.GetChatBeetween(ctx, partner, me, ChatPageInput{Around: &chat.Id, Limit: 1})
+	if svcErr != nil || len(page.Chats) != 1 || page.Chats[0].Id != chat.Id {
+		t.Fatalf("around harusnya ikut balikin pesan target nya, dapet %+v %v", page, svcErr)
+	}
+}
+
+func TestMarkConversationAsReadSendsReceipt(t *testing.T) {
+
+	repo := &fakeChatRepo{}
+	cs := newTestChatService(t, repo)
+	events := captureWsEvents(cs)
+	ctx := context.Background()
+
+	me, partner := uuid.New(), uuid.New()
+	base := time.Now().Add(-time.Minute)
+
+	first := repo.add(model.ChatModel{SenderId: partner, ReceiverId: me, CreatedAt: base})
+	second := repo.add(model.ChatModel{SenderId: partner, ReceiverId: me, CreatedAt: base.Add(time.Second)})
+	mine := repo.add(model.ChatModel{SenderId: me, ReceiverId: partner, CreatedAt: base.Add(2 * time.Second)})
+	third := repo.add(model.ChatModel{SenderId: partner, ReceiverId: me, CreatedAt: base.Add(3 * time.Second)})
+
+	if svcErr := cs.MarkConversationAsRead(ctx, me, partner, mine.Id); svcErr != nil {
+		t.Fatal(svcErr.Message)
+	}
+
+	// ke partner buat centang biru, ke device lain punya reader buat sinkron
+	receivers := map[string]bool{}
+	for _, ev := range waitWsEvents(t, events, 2) {
+		var data ws.ReadReceiptData
+		if err := json.Unmarshal(ev.Data, &data); err != nil {
+			t.Fatal(err)
+		}
+
+		if ev.Action != ws.ActionReadReceipt || data.ReaderId != me || data.PartnerId != partner || data.UpToChatId != mine.Id {
+			t.Errorf("receipt nya %s %+v", ev.Action, data)
+		}
+
+		receivers[ev.Receiver] = true
+	}
+
+	if !receivers["user:"+partner.String()] || !receivers["user:"+me.String()] {
+		t.Fatalf("receipt harusnya ke partner sama reader, dapet %v", receivers)
+	}
+
+	for _, c := range repo.saved() {
+		wantRead := c.Id == first.Id || c.Id == second.Id
+		if c.Id != mine.Id && c.IsRead != wantRead {
+			t.Errorf("pesan %s is_read=%v, harusnya %v", c.Id, c.IsRead, wantRead)
+		}
+	}
+
+	// udah kebaca semua sampe situ, ga perlu kirim receipt lagi
+	if svcErr := cs.MarkConversationAsRead(ctx, me, partner, second.Id); svcErr != nil {
+		t.Fatal(svcErr.Message)
+	}
+	expectNoWsEvent(t, events)
+
+	// pesan dari percakapan lain ga bisa dipake buat nandain
+	other := repo.add(model.ChatModel{SenderId: uuid.New(), ReceiverId: me})
+	if svcErr := cs.MarkConversationAsRead(ctx, me, partner, other.Id); svcErr == nil || svcErr.Code != http.StatusNotFound {
+		t.Fatalf("pesan percakapan lain harusnya 404, dapet %v", svcErr)
+	}
+
+	if svcErr := cs.MarkConversationAsRead(ctx, me, partner, third.Id); svcErr != nil {
+		t.Fatal(svcErr.Message)
+	}
+	waitWsEvents(t, events, 2)
+}
+
+func TestUnreadSummaryFollowsReads(t *testing.T) {
+
+	repo := &fakeChatRepo{}
+	cs := newTestChatService(t, repo)
+	ctx := context.Background()
+
+	me, budi, sari := uuid.New(), uuid.New(), uuid.New()
+	base := time.Now().Add(-time.Minute)
+
+	var fromBudi []model.ChatModel
+	for i := range 3 {
+		fromBudi = append(fromBudi, repo.add(model.ChatModel{SenderId: budi, ReceiverId: me, CreatedAt: base.Add(time.Duration(i) * time.Second)}))
+	}
+
+	fromSari := repo.add(model.ChatModel{SenderId: sari, ReceiverId: me, CreatedAt: base})
+
+	// pesan yang dikirim sendiri ga diitung
+	repo.add(model.ChatModel{SenderId: me, ReceiverId: sari, CreatedAt: base})
+
+	unreadOf := func(summary UnreadSummaryData) map[uuid.UUID]int {
+		got := map[uuid.UUID]int{}
+		for _, c := range summary.Conversations {
+			got[c.PartnerId] = c.UnreadCount
+		}
+		return got
+	}
+
+	summary, svcErr := cs.GetUnreadSummary(ctx, me)
+	if svcErr != nil {
+		t.Fatal(svcErr.Message)
+	}
+
+	if got := unreadOf(summary); summary.Total != 4 || got[budi] != 3 || got[sari] != 1 {
+		t.Fatalf("total %d, per percakapan %v", summary.Total, got)
+	}
+
+	if svcErr := cs.MarkConversationAsRead(ctx, me, budi, fromBudi[1].Id); svcErr != nil {
+		t.Fatal(svcErr.Message)
+	}
+
+	summary, _ = cs.GetUnreadSummary(ctx, me)
+	if got := unreadOf(summary); summary.Total != 2 || got[budi] != 1 {
+		t.Fatalf("setelah dibaca sebagian total %d, per percakapan %v", summary.Total, got)
+	}
+
+	if svcErr := cs.MarkConversationAsRead(ctx, me, sari, fromSari.Id); svcErr != nil {
+		t.Fatal(svcErr.Message)
+	}
+
+	// percakapan yang udah kebaca semua ga muncul lagi
+	summary, _ = cs.GetUnreadSummary(ctx, me)
+	if got := unreadOf(summary); summary.Total != 1 || len(summary.Conversations) != 1 || got[budi] != 1 {
+		t.Fatalf("percakapan sari harusnya ilang, dapet total %d %v", summary.Total, got)
+	}
+
+	// user yang ga punya pesan masuk tetep dapet list kosong, bukan null
+	empty, svcErr := cs.GetUnreadSummary(ctx, uuid.New())
+	if svcErr != nil || empty.Total != 0 || empty.Conversations == nil {
+		t.Fatalf("summary kosong nya %+v %v", empty, svcErr)
+	}
+}
+
+func TestEditChatRulesAndHistory(t *testing.T) {
+
+	repo := &fakeChatRepo{}
+	cs := newTestChatService(t, repo)
+	events := captureWsEvents(cs)
+	ctx := context.Background()
+
+	me, partner := uuid.New(), uuid.New()
+	original := "halo"
+	chat := repo.add(model.ChatModel{SenderId: me, ReceiverId: partner, ChatText: &original})
+
+	edited, svcErr := cs.EditChat(ctx, me, chat.Id, "  halo semua  ")
+	if svcErr != nil {
+		t.Fatal(svcErr.Message)
+	}
+
+	if edited.ChatText == nil || *edited.ChatText != "halo semua" || edited.EditedAt == nil || !edited.IsOwn {
+		t.Fatalf("hasil edit nya %+v", edited)
+	}
+
+	// pengirim sama penerima dua duanya dikabarin
+	receivers := map[string]bool{}
+	for _, ev := range waitWsEvents(t, events, 2) {
+		var data ws.MessageEditedData
+		if err := json.Unmarshal(ev.Data, &data); err != nil {
+			t.Fatal(err)
+		}
+
+		if ev.Action != ws.ActionMessageEdited || data.ChatId != chat.Id || data.ChatText == nil || *data.ChatText != "halo semua" {
+			t.Errorf("event edit nya %s %+v", ev.Action, data)
+		}
+
+		receivers[ev.Receiver] = true
+	}
+
+	if !receivers["user:"+me.String()] || !receivers["user:"+partner.String()] {
+		t.Fatalf("event edit harusnya ke dua user, dapet %v", receivers)
+	}
+
+	// riwayat nya bisa diliat dua pihak, isinya teks sebelum di edit
+	for _, viewer := range []uuid.UUID{me, partner} {
+		history, svcErr := cs.GetChatEdits(ctx, viewer, chat.Id)
+		if svcErr != nil {
+			t.Fatal(svcErr.Message)
+		}
+
+		if len(history) != 1 || history[0].PreviousText == nil || *history[0].PreviousText != original {
+			t.Fatalf("riwayat edit nya %+v", history)
+		}
+	}
+
+	if _, svcErr := cs.GetChatEdits(ctx, uuid.New(), chat.Id); svcErr == nil || svcErr.Code != http.StatusNotFound {
+		t.Fatalf("riwayat edit percakapan orang lain harusnya 404, dapet %v", svcErr)
+	}
+
+	deletedAt := time.Now()
+	old := repo.add(model.ChatModel{SenderId: me, ReceiverId: partner, ChatText: &original, CreatedAt: time.Now().Add(-cs.EditWindow - time.Second)})
+	deleted := repo.add(model.ChatModel{SenderId: me, ReceiverId: partner, ChatText: &original, DeletedAt: &deletedAt})
+
+	cases := []struct {
+		name   string
+		userId uuid.UUID
+		chatId uuid.UUID
+		text   string
+		code   int
+	}{
+		{"teks kosong", me, chat.Id, "   ", http.StatusBadRequest},
+		{"teks kepanjangan", me, chat.Id, strings.Repeat("a", maxChatTextLength+1), http.StatusBadRequest},
+		{"teks ga berubah", me, chat.Id, "halo semua", http.StatusBadRequest},
+		{"bukan pengirim", partner, chat.Id, "diganti", http.StatusForbidden},
+		{"lewat batas waktu", me, old.Id, "diganti", http.StatusForbidden},
+		{"udah dihapus", me, deleted.Id, "diganti", http.StatusConflict},
+		{"chat ga ada", me, uuid.New(), "diganti", http.StatusNotFound},
+	}
+
+	for _, tc := range cases {
+		if _, svcErr := cs.EditChat(ctx, tc.userId, tc.chatId, tc.text); svcErr == nil || svcErr.Code != tc.code {
+			t.Errorf("%s : harusnya %d, dapet %v", tc.name, tc.code, svcErr)
+		}
+	}
+
+	expectNoWsEvent(t, events)
+
+	if history, _ := cs.GetChatEdits(ctx, me, chat.Id); len(history) != 1 {
+		t.Fatalf("edit yang ditolak ga boleh masuk riwayat, dapet %d", len(history))
+	}
+}
+
+// bikin file attachment palsu di storage private, balikin path nya
+func writeTestAttachment(t *testing.T, cs *ChatService, name string) string {
+	t.Helper()
+
+	dir := filepath.Join(cs.storage.Private, "chat_attachment")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte("isi"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestDeleteChatForMe(t *testing.T) {
+
+	repo := &fakeChatRepo{}
+	cs := newTestChatService(t, repo)
+	events := captureWsEvents(cs)
+	ctx := context.Background()
+
+	me, partner := uuid.New(), uuid.New()
+	text := "rahasia"
+	chat := repo.add(model.ChatModel{SenderId: partner, ReceiverId: me, ChatText: &text})
+
+	path := writeTestAttachment(t, cs, "foto.png")
+	withFile := repo.add(model.ChatModel{SenderId: me, ReceiverId: partner, Attachment: []model.ChatAttachment{{FileName: "foto.png", MediaType: model.TypeImage}}})
+
+	if svcErr := cs.DeleteChat(ctx, me, chat.Id, "semua"); svcErr == nil || svcErr.Code != http.StatusBadRequest {
+		t.Fatalf("mode ngaco harusnya 400, dapet %v", svcErr)
+	}
+
+	if svcErr := cs.DeleteChat(ctx, uuid.New(), chat.Id, DeleteModeForMe); svcErr == nil || svcErr.Code != http.StatusNotFound {
+		t.Fatalf("orang luar harusnya 404, dapet %v", svcErr)
+	}
+
+	if svcErr := cs.DeleteChat(ctx, me, chat.Id, DeleteModeForMe); svcErr != nil {
+		t.Fatal(svcErr.Message)
+	}
+
+	// cuma device punya yang ngehapus yang dikabarin
+	ev := waitWsEvents(t, events, 1)[0]
+	if ev.Action != ws.ActionMessageDeleted || ev.Receiver != "user:"+me.String() {
+		t.Fatalf("event hapus nya %s ke %s", ev.Action, ev.Receiver)
+	}
+	expectNoWsEvent(t, events)
+
+	mine, _ := cs.GetChatBeetween(ctx, partner, me, ChatPageInput{})
+	for _, c := range mine.Chats {
+		if c.Id == chat.Id {
+			t.Fatal("pesan yang dihapus buat saya masih keliatan")
+		}
+	}
+
+	theirs, _ := cs.GetChatBeetween(ctx, me, partner, ChatPageInput{})
+	if len(theirs.Chats) != 2 {
+		t.Fatalf("partner harusnya masih liat 2 pesan, dapet %d", len(theirs.Chats))
+	}
+
+	// pesan masuk yang belum dibaca ga nyangkut di badge
+	if summary, _ := cs.GetUnreadSummary(ctx, me); summary.Total != 0 {
+		t.Fatalf("unread nya masih %d", summary.Total)
+	}
+
+	// file nya baru dihapus kalo dua dua nya udah nyembunyiin
+	if svcErr := cs.DeleteChat(ctx, me, withFile.Id, DeleteModeForMe); svcErr != nil {
+		t.Fatal(svcErr.Message)
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		t.Fatal("attachment nya masih dipake partner, ga boleh dihapus")
+	}
+
+	if svcErr := cs.DeleteChat(ctx, partner, withFile.Id, DeleteModeForMe); svcErr != nil {
+		t.Fatal(svcErr.Message)
+	}
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatal("attachment nya harusnya ikut kehapus")
+	}
+}
+
+func TestDeleteChatForEveryone(t *testing.T) {
+
+	repo := &fakeChatRepo{}
+	cs := newTestChatService(t, repo)
+	events := captureWsEvents(cs)
+	ctx := context.Background()
+
+	me, partner := uuid.New(), uuid.New()
+	text := "salah kirim"
+	path := writeTestAttachment(t, cs, "video.mp4")
+	chat := repo.add(model.ChatModel{SenderId: me, ReceiverId: partner, ChatText: &text, Attachment: []model.ChatAttachment{{FileName: "video.mp4"}}})
+	old := repo.add(model.ChatModel{SenderId: me, ReceiverId: partner, ChatText: &text, CreatedAt: time.Now().Add(-deleteForEveryoneWindow - time.Minute)})
+
+	if svcErr := cs.DeleteChat(ctx, partner, chat.Id, DeleteModeForEveryone); svcErr == nil || svcErr.Code != http.StatusForbidden {
+		t.Fatalf("penerima ga boleh hapus buat semua orang, dapet %v", svcErr)
+	}
+
+	if svcErr := cs.DeleteChat(ctx, me, old.Id, DeleteModeForEveryone); svcErr == nil || svcErr.Code != http.StatusForbidden {
+		t.Fatalf("lewat batas waktu harusnya 403, dapet %v", svcErr)
+	}
+
+	if _, svcErr := cs.EditChat(ctx, me, chat.Id, "udah bener"); svcErr != nil {
+		t.Fatal(svcErr.Message)
+	}
+	waitWsEvents(t, events, 2)
+
+	if svcErr := cs.DeleteChat(ctx, me, chat.Id, DeleteModeForEveryone); svcErr != nil {
+		t.Fatal(svcErr.Message)
+	}
+
+	receivers := map[string]bool{}
+	for _, ev := range waitWsEvents(t, events, 2) {
+		var data ws.MessageDeletedData
+		if err := json.Unmarshal(ev.Data, &data); err != nil {
+			t.Fatal(err)
+		}
+
+		if ev.Action != ws.ActionMessageDeleted || data.ChatId != chat.Id || data.Mode != DeleteModeForEveryone {
+			t.Errorf("event hapus nya %s %+v", ev.Action, data)
+		}
+
+		receivers[ev.Receiver] = true
+	}
+
+	if !receivers["user:"+me.String()] || !receivers["user:"+partner.String()] {
+		t.Fatalf("hapus buat semua orang harusnya ke dua user, dapet %v", receivers)
+	}
+
+	// dua dua nya liat placeholder, isi sama riwayat edit nya udah ga ada
+	for viewer, other := range map[uuid.UUID]uuid.UUID{me: partner, partner: me} {
+		page, _ := cs.GetChatBeetween(ctx, other, viewer, ChatPageInput{After: encodeChatCursor(chatCursorOf(old))})
+		if len(page.Chats) != 1 || !page.Chats[0].IsDeleted || page.Chats[0].ChatText == nil || *page.Chats[0].ChatText != deletedChatPlaceholder {
+			t.Fatalf("tombstone nya %+v", page.Chats)
+		}
+	}
+
+	if history, _ := cs.GetChatEdits(ctx, me, chat.Id); len(history) != 0 {
+		t.Fatalf("riwayat edit harusnya ikut dihapus, sisa %d", len(history))
+	}
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatal("attachment nya harusnya ikut kehapus")
+	}
+
+	if svcErr := cs.DeleteChat(ctx, me, chat.Id, DeleteModeForEveryone); svcErr == nil || svcErr.Code != http.StatusConflict {
+		t.Fatalf("hapus ulang harusnya 409, dapet %v", svcErr)
+	}
+}
+
+func TestIsValidReaction(t *testing.T) {
+
+	for emoji, want := range map[string]bool{
+		"👍":     true,
+		"❤️":    true,
+		"👍🏽":    true,
+		"👨‍👩‍👧": true,
+		"🇮🇩":    true,
+		"":      false,
+		"a":     false,
+		"ok":    false,
+		"👍 ":    false,
+		"👍a":    false,
+		":)":    false,
+		"\x00👍": false,
+		"\xff":  false,
+		strings.Repeat("👍", maxReactionRunes+1): false,
+	} {
+		if got := isValidReaction(emoji); got != want {
+			t.Errorf("%q : %v, harusnya %v", emoji, got, want)
+		}
+	}
+}
+
+func TestChatReactions(t *testing.T) {
+
+	repo := &fakeChatRepo{}
+	cs := newTestChatService(t, repo)
+	events := captureWsEvents(cs)
+	ctx := context.Background()
+
+	me, partner := uuid.New(), uuid.New()
+	chat := repo.add(model.ChatModel{SenderId: me, ReceiverId: partner})
+
+	reactionEvent := func(action string, count int) {
+		t.Helper()
+
+		receivers := map[string]bool{}
+		for _, ev := range waitWsEvents(t, events, 2) {
+			var data ws.ReactionEventData
+			if err := json.Unmarshal(ev.Data, &data); err != nil {
+				t.Fatal(err)
+			}
+
+			if ev.Action != action || data.ChatId != chat.Id || data.Emoji != "👍" || data.Count != count {
+				t.Errorf("event reaksi nya %s %+v, harusnya %s count %d", ev.Action, data, action, count)
+			}
+
+			receivers[ev.Receiver] = true
+		}
+
+		if !receivers["user:"+me.String()] || !receivers["user:"+partner.String()] {
+			t.Fatalf("event reaksi harusnya ke dua user, dapet %v", receivers)
+		}
+	}
+
+	if svcErr := cs.AddReaction(ctx, partner, chat.Id, " 👍 "); svcErr != nil {
+		t.Fatal(svcErr.Message)
+	}
+	reactionEvent(ws.ActionReactionAdded, 1)
+
+	if svcErr := cs.AddReaction(ctx, me, chat.Id, "👍"); svcErr != nil {
+		t.Fatal(svcErr.Message)
+	}
+	reactionEvent(ws.ActionReactionAdded, 2)
+
+	// emoji yang sama dari user yang sama ga dihitung dua kali dan ga di broadcast lagi
+	if svcErr := cs.AddReaction(ctx, me, chat.Id, "👍"); svcErr != nil {
+		t.Fatal(svcErr.Message)
+	}
+	expectNoWsEvent(t, events)
+
+	reactions, svcErr := cs.GetReactions(ctx, partner, chat.Id)
+	if svcErr != nil || len(reactions) != 2 {
+		t.Fatalf("reaksi nya %+v %v", reactions, svcErr)
+	}
+
+	if svcErr := cs.RemoveReaction(ctx, me, chat.Id, "👍"); svcErr != nil {
+		t.Fatal(svcErr.Message)
+	}
+	reactionEvent(ws.ActionReactionRemoved, 1)
+
+	if svcErr := cs.RemoveReaction(ctx, me, chat.Id, "👍"); svcErr == nil || svcErr.Code != http.StatusNotFound {
+		t.Fatalf("hapus reaksi yang ga ada harusnya 404, dapet %v", svcErr)
+	}
+
+	deletedAt := time.Now()
+	deleted := repo.add(model.ChatModel{SenderId: me, ReceiverId: partner, DeletedAt: &deletedAt})
+	stranger := uuid.New()
+
+	cases := []struct {
+		name   string
+		userId uuid.UUID
+		chatId uuid.UUID
+		emoji  string
+		code   int
+	}{
+		{"bukan emoji", partner, chat.Id, "mantap", http.StatusBadRequest},
+		{"kosong", partner, chat.Id, "  ", http.StatusBadRequest},
+		{"bukan peserta", stranger, chat.Id, "👍", http.StatusNotFound},
+		{"chat ga ada", partner, uuid.New(), "👍", http.StatusNotFound},
+		{"udah dihapus", partner, deleted.Id, "👍", http.StatusConflict},
+	}
+
+	for _, tc := range cases {
+		if svcErr := cs.AddReaction(ctx, tc.userId, tc.chatId, tc.emoji); svcErr == nil || svcErr.Code != tc.code {
+			t.Errorf("%s : harusnya %d, dapet %v", tc.name, tc.code, svcErr)
+		}
+	}
+
+	if _, svcErr := cs.GetReactions(ctx, stranger, chat.Id); svcErr == nil || svcErr.Code != http.StatusNotFound {
+		t.Fatalf("orang luar ga boleh liat reaksi, dapet %v", svcErr)
+	}
+
+	expectNoWsEvent(t, events)
+}
+
+func TestSearchChatsInputAndPaging(t *testing.T) {
+
+	repo := &fakeChatRepo{}
+	cs := newTestChatService(t, repo)
+	ctx := context.Background()
+
+	me, partner := uuid.New(), uuid.New()
+	now := time.Now()
+	avatar := "grup.png"
+
+	repo.searchHits = []repository.ChatSearchHit{
+		{
+			Chat:    model.ChatModel{Id: uuid.New(), SenderId: me, ReceiverId: partner, CreatedAt: now, IsOwn: true},
+			Partner: model.User{Id: partner, Username: "sari", FullName: "Sari"},
+			Snippet: "ayo &lt;b&gt;<mark>makan</mark>&lt;/b&gt;",
+		},
+		{
+			Chat:          model.ChatModel{Id: uuid.New(), SenderId: partner, CreatedAt: now.Add(-time.Minute)},
+			Partner:       model.User{Id: partner, Username: "sari"},
+			Group:         &model.Conversation{Id: uuid.New(), Name: "Geng Kos", Avatar: &avatar},
+			Snippet:       "<mark>makan</mark> dimana",
+			HasAttachment: true,
+		},
+		{
+			Chat:    model.ChatModel{Id: uuid.New(), SenderId: partner, ReceiverId: me, CreatedAt: now.Add(-time.Hour)},
+			Partner: model.User{Id: partner, Username: "sari"},
+			Snippet: "udah <mark>makan</mark>",
+		},
+	}
+
+	from, to := now.Add(-time.Hour), now
+	cases := map[string]ChatSearchInput{
+		"kata kunci kosong":      {Query: "   "},
+		"kata kunci kepanjangan": {Query: strings.Repeat("a", maxSearchQueryLength+1)},
+		"tanggal kebalik":        {Query: "makan", From: &to, To: &from},
+		"tanggal sama":           {Query: "makan", From: &to, To: &to},
+		"cursor rusak":           {Query: "makan", Before: "bukan-cursor"},
+	}
+
+	for name, in := range cases {
+		if _, svcErr := cs.SearchChats(ctx, me, in); svcErr == nil || svcErr.Code != http.StatusBadRequest {
+			t.Errorf("%s : harusnya 400, dapet %v", name, svcErr)
+		}
+	}
+
+	hasAttachment := false
+	first, svcErr := cs.SearchChats(ctx, me, ChatSearchInput{Query: "  makan  ", PartnerId: &partner, From: &from, To: &to, HasAttachment: &hasAttachment, Limit: 2})
+	if svcErr != nil {
+		t.Fatal(svcErr.Message)
+	}
+
+	// filter nya diterusin apa adanya ke repo, user nya selalu yang lagi login
+	q := repo.lastSearch
+	if q.UserId != me || q.Text != "makan" || q.PartnerId != &partner || q.From != &from || q.To != &to || q.HasAttachment != &hasAttachment || q.Limit != 2 || q.Before != nil {
+		t.Fatalf("query ke repo nya %+v", q)
+	}
+
+	if len(first.Results) != 2 || !first.Paging.HasOlder || first.Paging.HasNewer || first.Paging.OlderCursor == nil {
+		t.Fatalf("halaman pertama nya %+v", first)
+	}
+
+	private, group := first.Results[0], first.Results[1]
+
+	if private.GroupId != nil || !private.IsOwn || private.ChatPartnerUsername != "sari" || private.Snippet != repo.searchHits[0].Snippet {
+		t.Errorf("hasil chat private nya %+v", private)
+	}
+
+	if group.GroupId == nil || *group.GroupId != repo.searchHits[1].Group.Id || group.GroupName == nil || *group.GroupName != "Geng Kos" ||
+		group.GroupAvatar != &avatar || !group.HasAttachment || group.SenderId != partner {
+		t.Errorf("hasil chat grup nya %+v", group)
+	}
+
+	second, svcErr := cs.SearchChats(ctx, me, ChatSearchInput{Query: "makan", Before: *first.Paging.OlderCursor, Limit: 2})
+	if svcErr != nil {
+		t.Fatal(svcErr.Message)
+	}
+
+	if len(second.Results) != 1 || second.Results[0].ChatId != repo.searchHits[2].Chat.Id || second.Paging.HasOlder || !second.Paging.HasNewer {
+		t.Fatalf("halaman kedua nya %+v", second)
+	}
+
+	// limit kosong pake default
+	if _, svcErr := cs.SearchChats(ctx, me, ChatSearchInput{Query: "makan"}); svcErr != nil || repo.lastSearch.Limit != defaultChatPageLimit {
+		t.Fatalf("limit default nya %d %v", repo.lastSearch.Limit, svcErr)
+	}
+
+	empty, svcErr := cs.SearchChats(ctx, me, ChatSearchInput{Query: "makan", Before: *second.Paging.OlderCursor})
+	if svcErr != nil || empty.Results == nil || len(empty.Results) != 0 || empty.Paging.OlderCursor != nil {
+		t.Fatalf("halaman kosong nya %+v %v", empty, svcErr)
+	}
+}
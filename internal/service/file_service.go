@@ -224,6 +224,22 @@ func (storage *FileStorage) DeletePrivateFile(fname string, place ...string) {
 
 }
 
+func (storage *FileStorage) DeletePublicFile(fname string, place ...string) {
+
+	parts := []string{storage.Public}
+	parts = append(parts, place...)
+	parts = append(parts, fname)
+
+	deletePath := filepath.Join(parts...)
+
+	if err := os.Remove(deletePath); err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("failed to remove file %s: %v", deletePath, err)
+		}
+	}
+
+}
+
 func (storage *FileStorage) GetPathPrivateFile(filename string, place ...string) string {
 
 	parts := []string{
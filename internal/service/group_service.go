@@ -0,0 +1,782 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Agmer17/golang_yapping/internal/event"
+	"github.com/Agmer17/golang_yapping/internal/model"
+	"github.com/Agmer17/golang_yapping/internal/repository"
+	"github.com/Agmer17/golang_yapping/internal/ws"
+	"github.com/Agmer17/golang_yapping/pkg"
+	"github.com/Agmer17/golang_yapping/pkg/customerrors"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	maxGroupMembers    = 256
+	maxGroupNameLength = 100
+
+	groupRoomAuthTimeout = 5 * time.Second
+)
+
+type CreateGroupInput struct {
+	OwnerId   uuid.UUID
+	Name      string
+	MemberIds []uuid.UUID
+	Avatar    *multipart.FileHeader
+}
+
+// field yang nil ga diubah
+type UpdateGroupInput struct {
+	Name   *string
+	Avatar *multipart.FileHeader
+}
+
+type GroupMessageInput struct {
+	SenderId       uuid.UUID
+	ConversationId uuid.UUID
+	ReplyTo        *string
+	ChatText       *string
+	PostId         *string
+	MediaFiles     []*multipart.FileHeader
+}
+
+type GroupData struct {
+	Id          uuid.UUID  `json:"group_id"`
+	Name        string     `json:"name"`
+	Avatar      *string    `json:"avatar"`
+	CreatedBy   *uuid.UUID `json:"created_by"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	MemberCount int        `json:"member_count"`
+	MyRole      string     `json:"my_role"`
+}
+
+type GroupMemberData struct {
+	UserId         uuid.UUID `json:"user_id"`
+	Username       string    `json:"username"`
+	FullName       string    `json:"full_name"`
+	ProfilePicture *string   `json:"profile_picture"`
+	Role           string    `json:"role"`
+	JoinedAt       time.Time `json:"joined_at"`
+}
+
+type GroupDetailData struct {
+	Group   GroupData         `json:"group"`
+	Members []GroupMemberData `json:"members"`
+}
+
+type GroupMessageData struct {
+	Id               uuid.UUID  `json:"chat_id"`
+	ConversationId   uuid.UUID  `json:"group_id"`
+	SenderId         uuid.UUID  `json:"sender_id"`
+	ReplyTo          *uuid.UUID `json:"reply_to"`
+	ChatText         *string    `json:"chat_text"`
+	PostId           *uuid.UUID `json:"post_id"`
+	CreatedAt        time.Time  `json:"created_at"`
+	IsOwn            bool       `json:"is_own_message"`
+	AttachmentAccess []string   `json:"attachment_access"`
+}
+
+type GroupMessagePageData struct {
+	Chats  []GroupMessageData `json:"chats"`
+	Paging ChatPagingData     `json:"paging"`
+}
+
+type GroupServiceInterface interface {
+	CreateGroup(ctx context.Context, in CreateGroupInput) (GroupData, *customerrors.ServiceErrors)
+	GetMyGroups(ctx context.Context, userId uuid.UUID) ([]GroupData, *customerrors.ServiceErrors)
+	GetGroup(ctx context.Context, userId uuid.UUID, groupId uuid.UUID) (GroupDetailData, *customerrors.ServiceErrors)
+	UpdateGroup(ctx context.Context, userId uuid.UUID, groupId uuid.UUID, in UpdateGroupInput) (GroupData, *customerrors.ServiceErrors)
+	InviteMembers(ctx context.Context, userId uuid.UUID, groupId uuid.UUID, memberIds []uuid.UUID) ([]uuid.UUID, *customerrors.ServiceErrors)
+	KickMember(ctx context.Context, userId uuid.UUID, groupId uuid.UUID, target uuid.UUID) *customerrors.ServiceErrors
+	ChangeRole(ctx context.Context, userId uuid.UUID, groupId uuid.UUID, target uuid.UUID, role string) *customerrors.ServiceErrors
+	LeaveGroup(ctx context.Context, userId uuid.UUID, groupId uuid.UUID) *customerrors.ServiceErrors
+	SendMessage(ctx context.Context, in GroupMessageInput) (GroupMessageData, *customerrors.ServiceErrors)
+	GetMessages(ctx context.Context, userId uuid.UUID, groupId uuid.UUID, before string, limit int) (GroupMessagePageData, *customerrors.ServiceErrors)
+}
+
+type GroupService struct {
+	Repo     repository.ConversationRepositoryInterface
+	EventBus *event.EventBus
+	storage  *FileStorage
+
+	// attachment grup disimpan + dikasih token lewat pipeline yang sama kayak chat pribadi
+	chat *ChatService
+}
+
+func NewGroupService(
+	repo *repository.ConversationRepository,
+	chat *ChatService,
+	storage *FileStorage,
+	eventBus *event.EventBus,
+) *GroupService {
+	gs := &GroupService{
+		Repo:     repo,
+		EventBus: eventBus,
+		storage:  storage,
+		chat:     chat,
+	}
+
+	chat.Hub.AuthorizeRoom(ws.RoomKindGroup, gs.authorizeGroupRoom)
+
+	return gs
+}
+
+// SUBSCRIBE ke room group:<id> cuma boleh buat member grup nya
+func (gs *GroupService) authorizeGroupRoom(userId uuid.UUID, id string) bool {
+
+	groupId, err := uuid.Parse(id)
+	if err != nil {
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), groupRoomAuthTimeout)
+	defer cancel()
+
+	ok, err := gs.Repo.IsMember(ctx, groupId, userId)
+	return err == nil && ok
+}
+
+var errGroupNotFound = customerrors.New(http.StatusNotFound, "grup tidak ditemukan")
+
+func canManageGroup(role string) bool {
+	return role == model.RoleOwner || role == model.RoleAdmin
+}
+
+func toGroupData(c model.Conversation) GroupData {
+	return GroupData{
+		Id:          c.Id,
+		Name:        c.Name,
+		Avatar:      c.Avatar,
+		CreatedBy:   c.CreatedBy,
+		CreatedAt:   c.CreatedAt,
+		UpdatedAt:   c.UpdatedAt,
+		MemberCount: c.MemberCount,
+		MyRole:      c.MyRole,
+	}
+}
+
+func validateGroupName(name string) (string, *customerrors.ServiceErrors) {
+	name = strings.TrimSpace(name)
+
+	if name == "" || utf8.RuneCountInString(name) > maxGroupNameLength {
+		return "", customerrors.New(http.StatusBadRequest, "nama grup wajib di isi dan maksimal 100 karakter")
+	}
+
+	return name, nil
+}
+
+// member yang bukan anggota grup dapet 404 biar ga ketauan grup nya ada
+func (gs *GroupService) requireMember(ctx context.Context, groupId uuid.UUID, userId uuid.UUID) (model.ConversationMember, *customerrors.ServiceErrors) {
+
+	member, err := gs.Repo.GetMember(ctx, groupId, userId)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return model.ConversationMember{}, errGroupNotFound
+	}
+
+	if err != nil {
+		return model.ConversationMember{}, customerrors.New(http.StatusInternalServerError, "Gagal mengambil data di database "+err.Error())
+	}
+
+	return member, nil
+}
+
+func (gs *GroupService) saveAvatar(fh *multipart.FileHeader) (string, *customerrors.ServiceErrors) {
+
+	mimeType, err := gs.storage.DetectFileType(fh)
+	if err != nil {
+		return "", customerrors.New(http.StatusInternalServerError, "Terjadi kesalahan saat menyimpan file "+err.Error())
+	}
+
+	ext, ok := gs.storage.IsTypeSupportted(mimeType)
+	if !ok || gs.storage.GetMediaType(mimeType) != model.TypeImage {
+		return "", customerrors.New(http.StatusBadRequest, "avatar grup harus berupa gambar")
+	}
+
+	fName, err := gs.storage.SavePublicFile(fh, ext, "group_avatar")
+	if err != nil {
+		return "", customerrors.New(http.StatusInternalServerError, "Gagal saat menyimpan file "+err.Error())
+	}
+
+	return fName, nil
+}
+
+func uniqueMemberIds(ids []uuid.UUID, exclude uuid.UUID) []uuid.UUID {
+
+	seen := make(map[uuid.UUID]bool, len(ids))
+	result := make([]uuid.UUID, 0, len(ids))
+
+	for _, id := range ids {
+		if id == exclude || seen[id] {
+			continue
+		}
+
+		seen[id] = true
+		result = append(result, id)
+	}
+
+	return result
+}
+
+func (gs *GroupService) CreateGroup(ctx context.Context, in CreateGroupInput) (GroupData, *customerrors.ServiceErrors) {
+
+	name, svcErr := validateGroupName(in.Name)
+	if svcErr != nil {
+		return GroupData{}, svcErr
+	}
+
+	memberIds := uniqueMemberIds(in.MemberIds, in.OwnerId)
+	if len(memberIds)+1 > maxGroupMembers {
+		return GroupData{}, customerrors.New(http.StatusBadRequest, "jumlah member grup melebihi batas")
+	}
+
+	conv := model.Conversation{Name: name}
+
+	if in.Avatar != nil {
+		fName, svcErr := gs.saveAvatar(in.Avatar)
+		if svcErr != nil {
+			return GroupData{}, svcErr
+		}
+
+		conv.Avatar = &fName
+	}
+
+	created, err := gs.Repo.Create(ctx, conv, in.OwnerId, memberIds)
+	if err != nil {
+		if conv.Avatar != nil {
+			gs.storage.DeletePublicFile(*conv.Avatar, "group_avatar")
+		}
+
+		return GroupData{}, customerrors.New(http.StatusInternalServerError, "Gagal membuat grup "+err.Error())
+	}
+
+	gs.notifyMembers(ctx, created.Id, nil, ws.GroupUpdatedData{
+		ConversationId: created.Id,
+		Change:         ws.GroupChangeCreated,
+		ActorId:        in.OwnerId,
+		Name:           created.Name,
+		Avatar:         created.Avatar,
+	})
+
+	return toGroupData(created), nil
+}
+
+func (gs *GroupService) GetMyGroups(ctx context.Context, userId uuid.UUID) ([]GroupData, *customerrors.ServiceErrors) {
+
+	list, err := gs.Repo.ListForUser(ctx, userId)
+	if err != nil {
+		return nil, customerrors.New(http.StatusInternalServerError, "Gagal mengambil data di database "+err.Error())
+	}
+
+	result := make([]GroupData, 0, len(list))
+	for _, c := range list {
+		result = append(result, toGroupData(c))
+	}
+
+	return result, nil
+}
+
+func (gs *GroupService) GetGroup(ctx context.Context, userId uuid.UUID, groupId uuid.UUID) (GroupDetailData, *customerrors.ServiceErrors) {
+
+	me, svcErr := gs.requireMember(ctx, groupId, userId)
+	if svcErr != nil {
+		return GroupDetailData{}, svcErr
+	}
+
+	conv, err := gs.Repo.GetById(ctx, groupId)
+	if err != nil {
+		return GroupDetailData{}, customerrors.New(http.StatusInternalServerError, "Gagal mengambil data di database "+err.Error())
+	}
+
+	conv.MyRole = me.Role
+
+	members, err := gs.Repo.GetMembers(ctx, groupId)
+	if err != nil {
+		return GroupDetailData{}, customerrors.New(http.StatusInternalServerError, "Gagal mengambil data di database "+err.Error())
+	}
+
+	memberData := make([]GroupMemberData, 0, len(members))
+	for _, m := range members {
+		memberData = append(memberData, GroupMemberData{
+			UserId:         m.UserId,
+			Username:       m.Username,
+			FullName:       m.FullName,
+			ProfilePicture: m.ProfilePicture,
+			Role:           m.Role,
+			JoinedAt:       m.JoinedAt,
+		})
+	}
+
+	return GroupDetailData{
+		Group:   toGroupData(conv),
+		Members: memberData,
+	}, nil
+}
+
+func (gs *GroupService) UpdateGroup(ctx context.Context, userId uuid.UUID, groupId uuid.UUID, in UpdateGroupInput) (GroupData, *customerrors.ServiceErrors) {
+
+	me, svcErr := gs.requireMember(ctx, groupId, userId)
+	if svcErr != nil {
+		return GroupData{}, svcErr
+	}
+
+	if !canManageGroup(me.Role) {
+		return GroupData{}, customerrors.New(http.StatusForbidden, "cuma owner atau admin yang bisa mengubah info grup")
+	}
+
+	if in.Name == nil && in.Avatar == nil {
+		return GroupData{}, customerrors.New(http.StatusBadRequest, "tidak ada data yang diubah")
+	}
+
+	var name *string
+	if in.Name != nil {
+		cleaned, svcErr := validateGroupName(*in.Name)
+		if svcErr != nil {
+			return GroupData{}, svcErr
+		}
+
+		name = &cleaned
+	}
+
+	var avatar *string
+	if in.Avatar != nil {
+		fName, svcErr := gs.saveAvatar(in.Avatar)
+		if svcErr != nil {
+			return GroupData{}, svcErr
+		}
+
+		avatar = &fName
+	}
+
+	updated, oldAvatar, err := gs.Repo.UpdateInfo(ctx, groupId, name, avatar)
+	if err != nil {
+		if avatar != nil {
+			gs.storage.DeletePublicFile(*avatar, "group_avatar")
+		}
+
+		return GroupData{}, customerrors.New(http.StatusInternalServerError, "Gagal mengubah grup "+err.Error())
+	}
+
+	if oldAvatar != nil {
+		gs.storage.DeletePublicFile(*oldAvatar, "group_avatar")
+	}
+
+	updated.MyRole = me.Role
+
+	gs.notifyMembers(ctx, groupId, nil, ws.GroupUpdatedData{
+		ConversationId: groupId,
+		Change:         ws.GroupChangeInfo,
+		ActorId:        userId,
+		Name:           updated.Name,
+		Avatar:         updated.Avatar,
+	})
+
+	return toGroupData(updated), nil
+}
+
+// balikin user yang beneran baru ditambahin
+func (gs *GroupService) InviteMembers(ctx context.Context, userId uuid.UUID, groupId uuid.UUID, memberIds []uuid.UUID) ([]uuid.UUID, *customerrors.ServiceErrors) {
+
+	me, svcErr := gs.requireMember(ctx, groupId, userId)
+	if svcErr != nil {
+		return nil, svcErr
+	}
+
+	if !canManageGroup(me.Role) {
+		return nil, customerrors.New(http.StatusForbidden, "cuma owner atau admin yang bisa menambahkan member")
+	}
+
+	memberIds = uniqueMemberIds(memberIds, userId)
+	if len(memberIds) == 0 {
+		return nil, customerrors.New(http.StatusBadRequest, "harap pilih user yang mau ditambahkan")
+	}
+
+	conv, err := gs.Repo.GetById(ctx, groupId)
+	if err != nil {
+		return nil, customerrors.New(http.StatusInternalServerError, "Gagal mengambil data di database "+err.Error())
+	}
+
+	if conv.MemberCount+len(memberIds) > maxGroupMembers {
+		return nil, customerrors.New(http.StatusBadRequest, "jumlah member grup melebihi batas")
+	}
+
+	added, err := gs.Repo.AddMembers(ctx, groupId, memberIds)
+	if err != nil {
+		return nil, customerrors.New(http.StatusInternalServerError, "Gagal menambahkan member "+err.Error())
+	}
+
+	if len(added) > 0 {
+		gs.notifyMembers(ctx, groupId, nil, ws.GroupUpdatedData{
+			ConversationId: groupId,
+			Change:         ws.GroupChangeMemberAdded,
+			ActorId:        userId,
+			Members:        added,
+		})
+	}
+
+	return added, nil
+}
+
+// owner bisa kick admin sama member, admin cuma bisa kick member
+func (gs *GroupService) KickMember(ctx context.Context, userId uuid.UUID, groupId uuid.UUID, target uuid.UUID) *customerrors.ServiceErrors {
+
+	if userId == target {
+		return customerrors.New(http.StatusBadRequest, "gunakan fitur keluar grup untuk keluar dari grup")
+	}
+
+	me, svcErr := gs.requireMember(ctx, groupId, userId)
+	if svcErr != nil {
+		return svcErr
+	}
+
+	targetMember, err := gs.Repo.GetMember(ctx, groupId, target)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return customerrors.New(http.StatusNotFound, "user bukan member grup ini")
+	}
+
+	if err != nil {
+		return customerrors.New(http.StatusInternalServerError, "Gagal mengambil data di database "+err.Error())
+	}
+
+	allowed := (me.Role == model.RoleOwner && targetMember.Role != model.RoleOwner) ||
+		(me.Role == model.RoleAdmin && targetMember.Role == model.RoleMember)
+
+	if !allowed {
+		return customerrors.New(http.StatusForbidden, "kamu tidak bisa mengeluarkan member ini")
+	}
+
+	removed, err := gs.Repo.RemoveMember(ctx, groupId, target)
+	if err != nil {
+		return customerrors.New(http.StatusInternalServerError, "Gagal mengeluarkan member "+err.Error())
+	}
+
+	if !removed {
+		return customerrors.New(http.StatusNotFound, "user bukan member grup ini")
+	}
+
+	gs.chat.Hub.EvictUser(ws.GroupRoom(groupId), target)
+
+	// yang di kick udah bukan member, jadi dikabarin terpisah
+	gs.notifyMembers(ctx, groupId, []uuid.UUID{target}, ws.GroupUpdatedData{
+		ConversationId: groupId,
+		Change:         ws.GroupChangeMemberKicked,
+		ActorId:        userId,
+		Members:        []uuid.UUID{target},
+	})
+
+	return nil
+}
+
+// cuma owner yang bisa naikin member jadi admin atau sebaliknya
+func (gs *GroupService) ChangeRole(ctx context.Context, userId uuid.UUID, groupId uuid.UUID, target uuid.UUID, role string) *customerrors.ServiceErrors {
+
+	if role != model.RoleAdmin && role != model.RoleMember {
+		return customerrors.New(http.StatusBadRequest, "role tidak valid, pilih admin atau member")
+	}
+
+	me, svcErr := gs.requireMember(ctx, groupId, userId)
+	if svcErr != nil {
+		return svcErr
+	}
+
+	if me.Role != model.RoleOwner {
+		return customerrors.New(http.StatusForbidden, "cuma owner yang bisa mengubah role member")
+	}
+
+	if userId == target {
+		return customerrors.New(http.StatusBadRequest, "owner tidak bisa mengubah role nya sendiri")
+	}
+
+	err := gs.Repo.UpdateRole(ctx, groupId, target, role)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return customerrors.New(http.StatusNotFound, "user bukan member grup ini")
+	}
+
+	if err != nil {
+		return customerrors.New(http.StatusInternalServerError, "Gagal mengubah role "+err.Error())
+	}
+
+	gs.notifyMembers(ctx, groupId, nil, ws.GroupUpdatedData{
+		ConversationId: groupId,
+		Change:         ws.GroupChangeRole,
+		ActorId:        userId,
+		Members:        []uuid.UUID{target},
+		Role:           role,
+	})
+
+	return nil
+}
+
+// kalo owner keluar, admin (atau member) paling lama otomatis jadi owner.
+// member terakhir keluar = grup dibubarin
+func (gs *GroupService) LeaveGroup(ctx context.Context, userId uuid.UUID, groupId uuid.UUID) *customerrors.ServiceErrors {
+
+	result, err := gs.Repo.Leave(ctx, groupId, userId)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return errGroupNotFound
+	}
+
+	if err != nil {
+		return customerrors.New(http.StatusInternalServerError, "Gagal keluar dari grup "+err.Error())
+	}
+
+	gs.chat.Hub.EvictUser(ws.GroupRoom(groupId), userId)
+
+	if result.Disbanded {
+		gs.storage.DeleteAllPrivateFile(result.Files, "chat_attachment")
+		if result.Avatar != nil {
+			gs.storage.DeletePublicFile(*result.Avatar, "group_avatar")
+		}
+
+		gs.publishGroupUpdate([]uuid.UUID{userId}, ws.GroupUpdatedData{
+			ConversationId: groupId,
+			Change:         ws.GroupChangeDisbanded,
+			ActorId:        userId,
+		})
+
+		return nil
+	}
+
+	gs.notifyMembers(ctx, groupId, []uuid.UUID{userId}, ws.GroupUpdatedData{
+		ConversationId: groupId,
+		Change:         ws.GroupChangeMemberLeft,
+		ActorId:        userId,
+		Members:        []uuid.UUID{userId},
+	})
+
+	if result.NewOwner != nil {
+		gs.notifyMembers(ctx, groupId, nil, ws.GroupUpdatedData{
+			ConversationId: groupId,
+			Change:         ws.GroupChangeRole,
+			ActorId:        userId,
+			Members:        []uuid.UUID{*result.NewOwner},
+			Role:           model.RoleOwner,
+		})
+	}
+
+	return nil
+}
+
+func (gs *GroupService) SendMessage(ctx context.Context, in GroupMessageInput) (GroupMessageData, *customerrors.ServiceErrors) {
+
+	if pkg.IsPStrEmpty(in.ChatText) && pkg.IsPStrEmpty(in.PostId) && len(in.MediaFiles) == 0 {
+		return GroupMessageData{}, customerrors.New(http.StatusBadRequest, "Input tidak valid!")
+	}
+
+	if in.ChatText != nil && utf8.RuneCountInString(*in.ChatText) > maxChatTextLength {
+		return GroupMessageData{}, customerrors.New(http.StatusBadRequest, "pesan terlalu panjang")
+	}
+
+	if _, svcErr := gs.requireMember(ctx, in.ConversationId, in.SenderId); svcErr != nil {
+		return GroupMessageData{}, svcErr
+	}
+
+	replyTo, err := pkg.StringToUuid(in.ReplyTo)
+	if err != nil {
+		return GroupMessageData{}, customerrors.New(http.StatusBadRequest, "Input tidak valid!")
+	}
+
+	postId, err := pkg.StringToUuid(in.PostId)
+	if err != nil {
+		return GroupMessageData{}, customerrors.New(http.StatusBadRequest, "Input tidak valid!")
+	}
+
+	saved, err := gs.Repo.SaveMessage(ctx, model.GroupMessage{
+		ConversationId: in.ConversationId,
+		SenderId:       in.SenderId,
+		ReplyTo:        replyTo,
+		ChatText:       in.ChatText,
+		PostId:         postId,
+	})
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return GroupMessageData{}, customerrors.New(http.StatusBadRequest, "pesan yang dibalas tidak ditemukan di grup ini")
+	}
+
+	if err != nil {
+		return GroupMessageData{}, customerrors.New(http.StatusInternalServerError, "Ada kesalahan saat menyimpan pesan "+err.Error())
+	}
+
+	saved.Message.Attachment = []model.ChatAttachment{}
+
+	if len(in.MediaFiles) != 0 {
+		listMetadata, svcErr := gs.chat.processAttachment(in.MediaFiles, saved.Message.Id)
+		if svcErr != nil {
+			return GroupMessageData{}, svcErr
+		}
+
+		if err := gs.Repo.SaveAttachments(ctx, listMetadata); err != nil {
+			gs.chat.cleanUpAttachment(listMetadata)
+			return GroupMessageData{}, customerrors.New(http.StatusInternalServerError, "Gagal saat menyimpan media "+err.Error())
+		}
+
+		saved.Message.Attachment = listMetadata
+	}
+
+	responses, err := gs.setToGroupMessageResponses(ctx, []model.GroupMessage{saved.Message})
+	if err != nil {
+		return GroupMessageData{}, customerrors.New(http.StatusInternalServerError, "Terjadi kesalahan di server! "+err.Error())
+	}
+
+	resp := responses[0]
+	gs.sendGroupMessage(ctx, saved, resp.AttachmentAccess)
+
+	return resp, nil
+}
+
+func (gs *GroupService) GetMessages(ctx context.Context, userId uuid.UUID, groupId uuid.UUID, before string, limit int) (GroupMessagePageData, *customerrors.ServiceErrors) {
+
+	if _, svcErr := gs.requireMember(ctx, groupId, userId); svcErr != nil {
+		return GroupMessagePageData{}, svcErr
+	}
+
+	query, svcErr := parseChatPageInput(ChatPageInput{Before: before, Limit: limit})
+	if svcErr != nil {
+		return GroupMessagePageData{}, svcErr
+	}
+
+	messages, hasOlder, err := gs.Repo.GetMessages(ctx, groupId, userId, query.Before, query.Limit)
+	if err != nil {
+		return GroupMessagePageData{}, customerrors.New(http.StatusInternalServerError, "Gagal mengambil data di database "+err.Error())
+	}
+
+	data, err := gs.setToGroupMessageResponses(ctx, messages)
+	if err != nil {
+		return GroupMessagePageData{}, customerrors.New(http.StatusInternalServerError, "Terjadi kesalahan di server! "+err.Error())
+	}
+
+	paging := ChatPagingData{
+		HasOlder: hasOlder,
+		HasNewer: query.Before != nil,
+	}
+
+	if len(messages) > 0 {
+		first := messages[0]
+		last := messages[len(messages)-1]
+
+		older := encodeChatCursor(repository.ChatCursor{CreatedAt: first.CreatedAt, Id: first.Id})
+		newer := encodeChatCursor(repository.ChatCursor{CreatedAt: last.CreatedAt, Id: last.Id})
+
+		paging.OlderCursor = &older
+		paging.NewerCursor = &newer
+	}
+
+	return GroupMessagePageData{
+		Chats:  data,
+		Paging: paging,
+	}, nil
+}
+
+// token attachment grup di cek dari membership, bukan sender/receiver
+func (gs *GroupService) setToGroupMessageResponses(ctx context.Context, messages []model.GroupMessage) ([]GroupMessageData, error) {
+
+	result := make([]GroupMessageData, 0, len(messages))
+	pipe := gs.chat.RedisClient.Pipeline()
+
+	for _, m := range messages {
+		resp := GroupMessageData{
+			Id:               m.Id,
+			ConversationId:   m.ConversationId,
+			SenderId:         m.SenderId,
+			ReplyTo:          m.ReplyTo,
+			ChatText:         m.ChatText,
+			PostId:           m.PostId,
+			CreatedAt:        m.CreatedAt,
+			IsOwn:            m.IsOwn,
+			AttachmentAccess: []string{},
+		}
+
+		if len(m.Attachment) != 0 {
+			tokens, err := gs.chat.queueGroupAccessTokens(ctx, pipe, m.Attachment, m.ConversationId)
+			if err != nil {
+				return nil, err
+			}
+
+			resp.AttachmentAccess = tokens
+		}
+
+		result = append(result, resp)
+	}
+
+	if pipe.Len() > 0 {
+		if _, err := pipe.Exec(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// pesan grup dikirim ke room user:<id> tiap member, termasuk pengirim buat device lain nya
+func (gs *GroupService) sendGroupMessage(ctx context.Context, saved repository.GroupMessageWithSender, attData []string) {
+
+	data, _ := json.Marshal(ws.GroupMessageData{
+		ConversationId: saved.Message.ConversationId,
+		ChatId:         saved.Message.Id,
+		ReplyTo:        saved.Message.ReplyTo,
+		Message:        saved.Message.ChatText,
+		PostId:         saved.Message.PostId,
+		MediaUrl:       attData,
+		CreatedAt:      saved.Message.CreatedAt,
+		From: ws.UserMetadata{
+			Id:             saved.Sender.Id,
+			Username:       saved.Sender.Username,
+			FullName:       saved.Sender.FullName,
+			ProfilePicture: saved.Sender.ProfilePicture,
+		},
+	})
+
+	memberIds, err := gs.Repo.GetMemberIds(ctx, saved.Message.ConversationId)
+	if err != nil {
+		return
+	}
+
+	for _, id := range memberIds {
+		gs.EventBus.Publish(event.WsEventSendPayload, ws.WebsocketEvent{
+			Action:   ws.ActionGroupMessage,
+			Detail:   "NEW GROUP MESSAGE",
+			Type:     ws.TypeSystemOk,
+			Receiver: "user:" + id.String(),
+			Data:     data,
+		})
+	}
+}
+
+// dikirim ke semua member grup yang sekarang + extra (misal user yang baru di kick)
+func (gs *GroupService) notifyMembers(ctx context.Context, groupId uuid.UUID, extra []uuid.UUID, d ws.GroupUpdatedData) {
+
+	memberIds, err := gs.Repo.GetMemberIds(ctx, groupId)
+	if err != nil {
+		memberIds = []uuid.UUID{}
+	}
+
+	gs.publishGroupUpdate(append(memberIds, extra...), d)
+}
+
+func (gs *GroupService) publishGroupUpdate(receivers []uuid.UUID, d ws.GroupUpdatedData) {
+
+	if d.Members == nil {
+		d.Members = []uuid.UUID{}
+	}
+
+	data, _ := json.Marshal(d)
+
+	for _, id := range receivers {
+		gs.EventBus.Publish(event.WsEventSendPayload, ws.WebsocketEvent{
+			Action:   ws.ActionGroupUpdated,
+			Detail:   "GROUP " + strings.ReplaceAll(d.Change, "_", " "),
+			Type:     ws.TypeSystemOk,
+			Receiver: "user:" + id.String(),
+			Data:     data,
+		})
+	}
+}
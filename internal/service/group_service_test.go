@@ -0,0 +1,507 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Agmer17/golang_yapping/internal/model"
+	"github.com/Agmer17/golang_yapping/internal/repository"
+	"github.com/Agmer17/golang_yapping/internal/ws"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// conversation repo in-memory, urutan member nya urutan join
+type fakeConversationRepo struct {
+	repository.ConversationRepositoryInterface
+
+	mu       sync.Mutex
+	groups   map[uuid.UUID]model.Conversation
+	members  map[uuid.UUID][]model.ConversationMember
+	messages []model.GroupMessage
+}
+
+func newFakeConversationRepo() *fakeConversationRepo {
+	return &fakeConversationRepo{
+		groups:  make(map[uuid.UUID]model.Conversation),
+		members: make(map[uuid.UUID][]model.ConversationMember),
+	}
+}
+
+func (r *fakeConversationRepo) join(groupId uuid.UUID, userId uuid.UUID, role string) {
+	r.members[groupId] = append(r.members[groupId], model.ConversationMember{
+		ConversationId: groupId,
+		UserId:         userId,
+		Role:           role,
+		JoinedAt:       time.Now(),
+	})
+}
+
+func (r *fakeConversationRepo) find(groupId uuid.UUID, userId uuid.UUID) int {
+	for i, m := range r.members[groupId] {
+		if m.UserId == userId {
+			return i
+		}
+	}
+	return -1
+}
+
+func (r *fakeConversationRepo) Create(ctx context.Context, c model.Conversation, ownerId uuid.UUID, memberIds []uuid.UUID) (model.Conversation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c.Id = uuid.New()
+	c.CreatedBy = &ownerId
+	c.CreatedAt = time.Now()
+	c.UpdatedAt = c.CreatedAt
+	r.groups[c.Id] = c
+
+	r.join(c.Id, ownerId, model.RoleOwner)
+	for _, id := range memberIds {
+		if r.find(c.Id, id) < 0 {
+			r.join(c.Id, id, model.RoleMember)
+		}
+	}
+
+	c.MemberCount = len(r.members[c.Id])
+	c.MyRole = model.RoleOwner
+
+	return c, nil
+}
+
+func (r *fakeConversationRepo) GetById(ctx context.Context, id uuid.UUID) (model.Conversation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, ok := r.groups[id]
+	if !ok {
+		return model.Conversation{}, pgx.ErrNoRows
+	}
+
+	c.MemberCount = len(r.members[id])
+
+	return c, nil
+}
+
+func (r *fakeConversationRepo) GetMember(ctx context.Context, conversationId uuid.UUID, userId uuid.UUID) (model.ConversationMember, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.find(conversationId, userId)
+	if i < 0 {
+		return model.ConversationMember{}, pgx.ErrNoRows
+	}
+
+	return r.members[conversationId][i], nil
+}
+
+func (r *fakeConversationRepo) GetMembers(ctx context.Context, conversationId uuid.UUID) ([]model.ConversationMember, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]model.ConversationMember{}, r.members[conversationId]...), nil
+}
+
+func (r *fakeConversationRepo) GetMemberIds(ctx context.Context, conversationId uuid.UUID) ([]uuid.UUID, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ids := make([]uuid.UUID, 0, len(r.members[conversationId]))
+	for _, m := range r.members[conversationId] {
+		ids = append(ids, m.UserId)
+	}
+
+	return ids, nil
+}
+
+func (r *fakeConversationRepo) IsMember(ctx context.Context, conversationId uuid.UUID, userId uuid.UUID) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.find(conversationId, userId) >= 0, nil
+}
+
+func (r *fakeConversationRepo) AddMembers(ctx context.Context, conversationId uuid.UUID, userIds []uuid.UUID) ([]uuid.UUID, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	added := []uuid.UUID{}
+	for _, id := range userIds {
+		if r.find(conversationId, id) < 0 {
+			r.join(conversationId, id, model.RoleMember)
+			added = append(added, id)
+		}
+	}
+
+	return added, nil
+}
+
+func (r *fakeConversationRepo) RemoveMember(ctx context.Context, conversationId uuid.UUID, userId uuid.UUID) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.find(conversationId, userId)
+	if i < 0 || r.members[conversationId][i].Role == model.RoleOwner {
+		return false, nil
+	}
+
+	r.members[conversationId] = append(r.members[conversationId][:i], r.members[conversationId][i+1:]...)
+
+	return true, nil
+}
+
+func (r *fakeConversationRepo) UpdateRole(ctx context.Context, conversationId uuid.UUID, userId uuid.UUID, role string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.find(conversationId, userId)
+	if i < 0 || r.members[conversationId][i].Role == model.RoleOwner {
+		return pgx.ErrNoRows
+	}
+
+	r.members[conversationId][i].Role = role
+
+	return nil
+}
+
+// admin paling lama naik jadi owner, kalo ga ada admin member paling lama
+func (r *fakeConversationRepo) Leave(ctx context.Context, conversationId uuid.UUID, userId uuid.UUID) (repository.LeaveResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.find(conversationId, userId)
+	if i < 0 {
+		return repository.LeaveResult{}, pgx.ErrNoRows
+	}
+
+	role := r.members[conversationId][i].Role
+	r.members[conversationId] = append(r.members[conversationId][:i], r.members[conversationId][i+1:]...)
+
+	rest := r.members[conversationId]
+	if len(rest) == 0 {
+		delete(r.groups, conversationId)
+		delete(r.members, conversationId)
+		return repository.LeaveResult{Disbanded: true}, nil
+	}
+
+	var result repository.LeaveResult
+	if role != model.RoleOwner {
+		return result, nil
+	}
+
+	next := 0
+	for j, m := range rest {
+		if m.Role == model.RoleAdmin {
+			next = j
+			break
+		}
+	}
+
+	rest[next].Role = model.RoleOwner
+	result.NewOwner = &rest[next].UserId
+
+	return result, nil
+}
+
+func (r *fakeConversationRepo) SaveMessage(ctx context.Context, m model.GroupMessage) (repository.GroupMessageWithSender, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if m.ReplyTo != nil {
+		found := false
+		for _, old := range r.messages {
+			found = found || (old.Id == *m.ReplyTo && old.ConversationId == m.ConversationId)
+		}
+
+		if !found {
+			return repository.GroupMessageWithSender{}, pgx.ErrNoRows
+		}
+	}
+
+	m.Id = uuid.New()
+	m.CreatedAt = time.Now()
+	m.IsOwn = true
+	r.messages = append(r.messages, m)
+
+	return repository.GroupMessageWithSender{Message: m, Sender: model.User{Id: m.SenderId}}, nil
+}
+
+func newTestGroupService(t *testing.T) (*GroupService, *fakeConversationRepo, <-chan ws.WebsocketEvent) {
+	t.Helper()
+
+	repo := newFakeConversationRepo()
+	cs := newTestChatService(t, &fakeChatRepo{})
+	events := captureWsEvents(cs)
+
+	return &GroupService{
+		Repo:     repo,
+		EventBus: cs.EventBus,
+		storage:  cs.storage,
+		chat:     cs,
+	}, repo, events
+}
+
+// event GROUP_UPDATED per penerima
+func groupUpdates(t *testing.T, events <-chan ws.WebsocketEvent, n int) map[string]ws.GroupUpdatedData {
+	t.Helper()
+
+	got := make(map[string]ws.GroupUpdatedData)
+	for _, ev := range waitWsEvents(t, events, n) {
+		if ev.Action != ws.ActionGroupUpdated {
+			t.Fatalf("event nya %s, harusnya %s", ev.Action, ws.ActionGroupUpdated)
+		}
+
+		var data ws.GroupUpdatedData
+		if err := json.Unmarshal(ev.Data, &data); err != nil {
+			t.Fatal(err)
+		}
+
+		got[ev.Receiver] = data
+	}
+
+	return got
+}
+
+func TestGroupRolesAndMembership(t *testing.T) {
+
+	gs, _, events := newTestGroupService(t)
+	ctx := context.Background()
+
+	owner, admin, member, outsider := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+
+	if _, svcErr := gs.CreateGroup(ctx, CreateGroupInput{OwnerId: owner, Name: "   "}); svcErr == nil || svcErr.Code != http.StatusBadRequest {
+		t.Fatalf("nama kosong harusnya 400, dapet %v", svcErr)
+	}
+
+	// owner sama id dobel di daftar member ga dihitung dua kali
+	group, svcErr := gs.CreateGroup(ctx, CreateGroupInput{OwnerId: owner, Name: " Geng Kos ", MemberIds: []uuid.UUID{admin, member, member, owner}})
+	if svcErr != nil {
+		t.Fatal(svcErr.Message)
+	}
+
+	if group.Name != "Geng Kos" || group.MemberCount != 3 || group.MyRole != model.RoleOwner {
+		t.Fatalf("grup nya %+v", group)
+	}
+
+	if created := groupUpdates(t, events, 3); len(created) != 3 || created["user:"+member.String()].Change != ws.GroupChangeCreated {
+		t.Fatalf("semua member harusnya dikabarin grup nya dibikin, dapet %v", created)
+	}
+
+	if _, svcErr := gs.GetGroup(ctx, outsider, group.Id); svcErr == nil || svcErr.Code != http.StatusNotFound {
+		t.Fatalf("orang luar harusnya 404, dapet %v", svcErr)
+	}
+
+	if _, svcErr := gs.InviteMembers(ctx, member, group.Id, []uuid.UUID{outsider}); svcErr == nil || svcErr.Code != http.StatusForbidden {
+		t.Fatalf("member biasa ga boleh invite, dapet %v", svcErr)
+	}
+
+	if svcErr := gs.ChangeRole(ctx, admin, group.Id, member, model.RoleAdmin); svcErr == nil || svcErr.Code != http.StatusForbidden {
+		t.Fatalf("cuma owner yang boleh ganti role, dapet %v", svcErr)
+	}
+
+	if svcErr := gs.ChangeRole(ctx, owner, group.Id, admin, model.RoleOwner); svcErr == nil || svcErr.Code != http.StatusBadRequest {
+		t.Fatalf("role owner ga bisa dikasih lewat ganti role, dapet %v", svcErr)
+	}
+
+	if svcErr := gs.ChangeRole(ctx, owner, group.Id, admin, model.RoleAdmin); svcErr != nil {
+		t.Fatal(svcErr.Message)
+	}
+	groupUpdates(t, events, 3)
+
+	// admin cuma bisa kick member, ga bisa kick owner
+	if svcErr := gs.KickMember(ctx, admin, group.Id, owner); svcErr == nil || svcErr.Code != http.StatusForbidden {
+		t.Fatalf("admin ga boleh kick owner, dapet %v", svcErr)
+	}
+
+	if svcErr := gs.KickMember(ctx, admin, group.Id, admin); svcErr == nil || svcErr.Code != http.StatusBadRequest {
+		t.Fatalf("kick diri sendiri harusnya 400, dapet %v", svcErr)
+	}
+
+	if svcErr := gs.KickMember(ctx, admin, group.Id, member); svcErr != nil {
+		t.Fatal(svcErr.Message)
+	}
+
+	// yang di kick tetep dikabarin walaupun udah bukan member
+	kicked := groupUpdates(t, events, 3)
+	if data, ok := kicked["user:"+member.String()]; !ok || data.Change != ws.GroupChangeMemberKicked {
+		t.Fatalf("member yang di kick harusnya dikabarin, dapet %v", kicked)
+	}
+
+	if _, svcErr := gs.GetGroup(ctx, member, group.Id); svcErr == nil || svcErr.Code != http.StatusNotFound {
+		t.Fatalf("member yang di kick harusnya udah ga bisa liat grup, dapet %v", svcErr)
+	}
+
+	if gs.authorizeGroupRoom(member, group.Id.String()) || !gs.authorizeGroupRoom(admin, group.Id.String()) {
+		t.Fatal("subscribe room grup harusnya ngikutin membership")
+	}
+
+	if gs.authorizeGroupRoom(admin, "bukan-uuid") {
+		t.Fatal("id room yang ngaco harusnya ditolak")
+	}
+
+	added, svcErr := gs.InviteMembers(ctx, admin, group.Id, []uuid.UUID{member, owner, admin})
+	if svcErr != nil || len(added) != 1 || added[0] != member {
+		t.Fatalf("yang ke invite harusnya cuma member yang baru, dapet %v %v", added, svcErr)
+	}
+	groupUpdates(t, events, 3)
+
+	// kalo ditambah jadi lewat batas, ga ada yang ditambahin
+	many := make([]uuid.UUID, maxGroupMembers)
+	for i := range many {
+		many[i] = uuid.New()
+	}
+
+	if _, svcErr := gs.InviteMembers(ctx, owner, group.Id, many); svcErr == nil || svcErr.Code != http.StatusBadRequest {
+		t.Fatalf("lewat batas member harusnya 400, dapet %v", svcErr)
+	}
+
+	if detail, _ := gs.GetGroup(ctx, owner, group.Id); len(detail.Members) != 3 {
+		t.Fatalf("member nya %d, harusnya tetep 3", len(detail.Members))
+	}
+
+	expectNoWsEvent(t, events)
+}
+
+func TestGroupLeaveTransfersOwnershipAndDisbands(t *testing.T) {
+
+	gs, repo, events := newTestGroupService(t)
+	ctx := context.Background()
+
+	owner, member, admin := uuid.New(), uuid.New(), uuid.New()
+
+	group, svcErr := gs.CreateGroup(ctx, CreateGroupInput{OwnerId: owner, Name: "Arisan", MemberIds: []uuid.UUID{member, admin}})
+	if svcErr != nil {
+		t.Fatal(svcErr.Message)
+	}
+	groupUpdates(t, events, 3)
+
+	if svcErr := gs.ChangeRole(ctx, owner, group.Id, admin, model.RoleAdmin); svcErr != nil {
+		t.Fatal(svcErr.Message)
+	}
+	groupUpdates(t, events, 3)
+
+	// admin naik jadi owner walaupun member nya join duluan
+	if svcErr := gs.LeaveGroup(ctx, owner, group.Id); svcErr != nil {
+		t.Fatal(svcErr.Message)
+	}
+
+	left := 0
+	for _, ev := range waitWsEvents(t, events, 5) {
+		var data ws.GroupUpdatedData
+		if err := json.Unmarshal(ev.Data, &data); err != nil {
+			t.Fatal(err)
+		}
+
+		switch data.Change {
+		case ws.GroupChangeMemberLeft:
+			left++
+		case ws.GroupChangeRole:
+			if data.Role != model.RoleOwner || len(data.Members) != 1 || data.Members[0] != admin {
+				t.Errorf("owner baru nya %+v", data)
+			}
+		default:
+			t.Errorf("event ga dikenal %s", data.Change)
+		}
+	}
+
+	if left != 3 {
+		t.Fatalf("event keluar grup nya ke %d user, harusnya 3 (termasuk yang keluar)", left)
+	}
+
+	if m, _ := repo.GetMember(ctx, group.Id, admin); m.Role != model.RoleOwner {
+		t.Fatalf("role admin sekarang %s, harusnya owner", m.Role)
+	}
+
+	if svcErr := gs.LeaveGroup(ctx, owner, group.Id); svcErr == nil || svcErr.Code != http.StatusNotFound {
+		t.Fatalf("keluar dua kali harusnya 404, dapet %v", svcErr)
+	}
+
+	if svcErr := gs.LeaveGroup(ctx, admin, group.Id); svcErr != nil {
+		t.Fatal(svcErr.Message)
+	}
+	waitWsEvents(t, events, 3)
+
+	// member terakhir keluar, grup nya bubar dan yang keluar dikabarin
+	if svcErr := gs.LeaveGroup(ctx, member, group.Id); svcErr != nil {
+		t.Fatal(svcErr.Message)
+	}
+
+	disbanded := groupUpdates(t, events, 1)
+	if data, ok := disbanded["user:"+member.String()]; !ok || data.Change != ws.GroupChangeDisbanded {
+		t.Fatalf("event bubar nya %v", disbanded)
+	}
+
+	if _, err := repo.GetById(ctx, group.Id); err == nil {
+		t.Fatal("grup nya harusnya udah ga ada")
+	}
+}
+
+func TestGroupMessagesOnlyForMembers(t *testing.T) {
+
+	gs, _, events := newTestGroupService(t)
+	ctx := context.Background()
+
+	owner, member, outsider := uuid.New(), uuid.New(), uuid.New()
+
+	group, svcErr := gs.CreateGroup(ctx, CreateGroupInput{OwnerId: owner, Name: "Kantor", MemberIds: []uuid.UUID{member}})
+	if svcErr != nil {
+		t.Fatal(svcErr.Message)
+	}
+	groupUpdates(t, events, 2)
+
+	text := "rapat jam 3"
+
+	if _, svcErr := gs.SendMessage(ctx, GroupMessageInput{SenderId: outsider, ConversationId: group.Id, ChatText: &text}); svcErr == nil || svcErr.Code != http.StatusNotFound {
+		t.Fatalf("orang luar ga boleh kirim pesan, dapet %v", svcErr)
+	}
+
+	empty := ""
+	if _, svcErr := gs.SendMessage(ctx, GroupMessageInput{SenderId: member, ConversationId: group.Id, ChatText: &empty}); svcErr == nil || svcErr.Code != http.StatusBadRequest {
+		t.Fatalf("pesan kosong harusnya 400, dapet %v", svcErr)
+	}
+
+	sent, svcErr := gs.SendMessage(ctx, GroupMessageInput{SenderId: member, ConversationId: group.Id, ChatText: &text})
+	if svcErr != nil {
+		t.Fatal(svcErr.Message)
+	}
+
+	// semua member dapet, termasuk pengirim buat device lain nya
+	receivers := map[string]bool{}
+	for _, ev := range waitWsEvents(t, events, 2) {
+		if ev.Action != ws.ActionGroupMessage {
+			t.Fatalf("event nya %s", ev.Action)
+		}
+		receivers[ev.Receiver] = true
+	}
+
+	if !receivers["user:"+owner.String()] || !receivers["user:"+member.String()] {
+		t.Fatalf("pesan grup harusnya ke semua member, dapet %v", receivers)
+	}
+
+	// reply ke pesan grup lain ditolak
+	other, _ := gs.CreateGroup(ctx, CreateGroupInput{OwnerId: owner, Name: "Lain"})
+	groupUpdates(t, events, 1)
+
+	foreign, svcErr := gs.SendMessage(ctx, GroupMessageInput{SenderId: owner, ConversationId: other.Id, ChatText: &text})
+	if svcErr != nil {
+		t.Fatal(svcErr.Message)
+	}
+	waitWsEvents(t, events, 1)
+
+	replyTo := foreign.Id.String()
+	if _, svcErr := gs.SendMessage(ctx, GroupMessageInput{SenderId: owner, ConversationId: group.Id, ChatText: &text, ReplyTo: &replyTo}); svcErr == nil || svcErr.Code != http.StatusBadRequest {
+		t.Fatalf("reply ke pesan grup lain harusnya 400, dapet %v", svcErr)
+	}
+
+	replyTo = sent.Id.String()
+	if _, svcErr := gs.SendMessage(ctx, GroupMessageInput{SenderId: owner, ConversationId: group.Id, ChatText: &text, ReplyTo: &replyTo}); svcErr != nil {
+		t.Fatalf("reply ke pesan grup yang sama harusnya bisa : %s", svcErr.Message)
+	}
+	waitWsEvents(t, events, 2)
+
+	expectNoWsEvent(t, events)
+}
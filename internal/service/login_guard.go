@@ -0,0 +1,150 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// counter gagal login di reset kalo ga ada percobaan gagal lagi selama ini
+	loginFailWindow = time.Hour
+
+	userLockThreshold = 5
+	ipLockThreshold   = 20
+
+	baseLockDuration = time.Minute
+	maxLockDuration  = time.Hour
+)
+
+// key di redis :
+//
+//	login_fail:user:<username> / login_fail:ip:<ip>   -> jumlah gagal login
+//	login_lock:user:<username> / login_lock:ip:<ip>   -> ada selama masih di lock
+//	twofa_fail:user:<userId> / twofa_lock:user:<userId> -> sama, buat kode 2FA yang salah
+//
+// lama lock nya naik 2x lipat tiap gagal lagi setelah lewat threshold
+type LoginGuard struct {
+	RedisClient *redis.Client
+}
+
+func NewLoginGuard(r *redis.Client) *LoginGuard {
+	return &LoginGuard{
+		RedisClient: r,
+	}
+}
+
+func userGuardKey(prefix string, username string) string {
+	return prefix + ":user:" + strings.ToLower(username)
+}
+
+func ipGuardKey(prefix string, ip string) string {
+	return prefix + ":ip:" + ip
+}
+
+// balikin sisa waktu lock paling lama antara username dan ip, 0 kalo ga di lock
+func (g *LoginGuard) LockedFor(ctx context.Context, username string, ip string) (time.Duration, error) {
+
+	pipe := g.RedisClient.Pipeline()
+	userTTL := pipe.PTTL(ctx, userGuardKey("login_lock", username))
+	ipTTL := pipe.PTTL(ctx, ipGuardKey("login_lock", ip))
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+
+	return max(userTTL.Val(), ipTTL.Val(), 0), nil
+}
+
+// newlyLocked true kalo username nya baru aja ke lock, dipake buat kirim email sekali aja
+func (g *LoginGuard) RegisterFailure(ctx context.Context, username string, ip string) (lockedFor time.Duration, newlyLocked bool, err error) {
+
+	pipe := g.RedisClient.TxPipeline()
+	userFails := pipe.Incr(ctx, userGuardKey("login_fail", username))
+	pipe.Expire(ctx, userGuardKey("login_fail", username), loginFailWindow)
+	ipFails := pipe.Incr(ctx, ipGuardKey("login_fail", ip))
+	pipe.Expire(ctx, ipGuardKey("login_fail", ip), loginFailWindow)
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, false, err
+	}
+
+	userLock := lockDuration(userFails.Val(), userLockThreshold)
+	ipLock := lockDuration(ipFails.Val(), ipLockThreshold)
+
+	pipe = g.RedisClient.TxPipeline()
+	if userLock > 0 {
+		pipe.Set(ctx, userGuardKey("login_lock", username), 1, userLock)
+	}
+	if ipLock > 0 {
+		pipe.Set(ctx, ipGuardKey("login_lock", ip), 1, ipLock)
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, false, err
+	}
+
+	return max(userLock, ipLock), userFails.Val() == userLockThreshold, nil
+}
+
+// ip nya sengaja ga di reset, biar 1 ip ga bisa nyoba banyak username sambil sesekali login bener
+func (g *LoginGuard) RegisterSuccess(ctx context.Context, username string) error {
+	return g.RedisClient.Del(ctx, userGuardKey("login_fail", username), userGuardKey("login_lock", username)).Err()
+}
+
+// counter 2FA dipisah dari counter password, login password yang bener ga nge-reset nya.
+// kalo digabung, orang yang udah tau password nya bisa nebak kode 2FA tanpa batas
+// cukup dengan login ulang tiap beberapa percobaan
+func (g *LoginGuard) TwoFactorLockedFor(ctx context.Context, userId uuid.UUID) (time.Duration, error) {
+
+	ttl, err := g.RedisClient.PTTL(ctx, userGuardKey("twofa_lock", userId.String())).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	return max(ttl, 0), nil
+}
+
+func (g *LoginGuard) RegisterTwoFactorFailure(ctx context.Context, userId uuid.UUID) (lockedFor time.Duration, newlyLocked bool, err error) {
+
+	failKey := userGuardKey("twofa_fail", userId.String())
+
+	pipe := g.RedisClient.TxPipeline()
+	fails := pipe.Incr(ctx, failKey)
+	pipe.Expire(ctx, failKey, loginFailWindow)
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, false, err
+	}
+
+	lock := lockDuration(fails.Val(), userLockThreshold)
+	if lock > 0 {
+		if err := g.RedisClient.Set(ctx, userGuardKey("twofa_lock", userId.String()), 1, lock).Err(); err != nil {
+			return 0, false, err
+		}
+	}
+
+	return lock, fails.Val() == userLockThreshold, nil
+}
+
+// cuma dipanggil kalo kode 2FA nya bener
+func (g *LoginGuard) RegisterTwoFactorSuccess(ctx context.Context, userId uuid.UUID) error {
+	return g.RedisClient.Del(ctx, userGuardKey("twofa_fail", userId.String()), userGuardKey("twofa_lock", userId.String())).Err()
+}
+
+func lockDuration(fails int64, threshold int64) time.Duration {
+
+	if fails < threshold {
+		return 0
+	}
+
+	d := baseLockDuration
+	for i := threshold; i < fails && d < maxLockDuration; i++ {
+		d *= 2
+	}
+
+	return min(d, maxLockDuration)
+}
@@ -0,0 +1,181 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Agmer17/golang_yapping/internal/event"
+	"github.com/Agmer17/golang_yapping/internal/model"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestLockDuration(t *testing.T) {
+
+	cases := []struct {
+		fails int64
+		want  time.Duration
+	}{
+		{userLockThreshold - 1, 0},
+		{userLockThreshold, baseLockDuration},
+		{userLockThreshold + 1, 2 * baseLockDuration},
+		{userLockThreshold + 2, 4 * baseLockDuration},
+		{userLockThreshold + 50, maxLockDuration},
+	}
+
+	for _, tc := range cases {
+		if got := lockDuration(tc.fails, userLockThreshold); got != tc.want {
+			t.Errorf("gagal %d kali : lock %s, harusnya %s", tc.fails, got, tc.want)
+		}
+	}
+}
+
+func TestLoginGuardLockoutDoublesAndExpires(t *testing.T) {
+
+	mr, rdb := newTestRedis(t)
+
+	guard := NewLoginGuard(rdb)
+	ctx := context.Background()
+
+	var lockedFor time.Duration
+	var newlyLocked bool
+	var err error
+
+	for i := 1; i <= userLockThreshold; i++ {
+		lockedFor, newlyLocked, err = guard.RegisterFailure(ctx, "Budi", "10.0.0.1")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if i < userLockThreshold && lockedFor != 0 {
+			t.Fatalf("gagal ke %d belum boleh di lock", i)
+		}
+	}
+
+	if lockedFor != baseLockDuration || !newlyLocked {
+		t.Fatalf("nyampe threshold harusnya di lock %s, dapet %s newlyLocked=%v", baseLockDuration, lockedFor, newlyLocked)
+	}
+
+	// username nya ga case sensitive
+	if locked, _ := guard.LockedFor(ctx, "budi", "10.0.0.9"); locked <= 0 {
+		t.Fatal("username yang sama beda huruf besar kecil harusnya ikut ke lock")
+	}
+
+	lockedFor, newlyLocked, _ = guard.RegisterFailure(ctx, "budi", "10.0.0.1")
+	if lockedFor != 2*baseLockDuration || newlyLocked {
+		t.Fatalf("gagal lagi harusnya lock nya 2x lipat tanpa email lagi, dapet %s newlyLocked=%v", lockedFor, newlyLocked)
+	}
+
+	mr.FastForward(2*baseLockDuration + time.Second)
+
+	if locked, _ := guard.LockedFor(ctx, "budi", "10.0.0.1"); locked != 0 {
+		t.Fatalf("lock nya harusnya udah abis, sisa %s", locked)
+	}
+
+	// counter nya masih ada selama window nya, gagal sekali lagi langsung lock lebih lama
+	if lockedFor, _, _ := guard.RegisterFailure(ctx, "budi", "10.0.0.1"); lockedFor != 4*baseLockDuration {
+		t.Fatalf("gagal setelah lock abis harusnya lanjut 2x lipat, dapet %s", lockedFor)
+	}
+
+	// ga ada percobaan gagal lagi selama window nya, counter nya ke reset
+	mr.FastForward(loginFailWindow + time.Second)
+
+	if lockedFor, _, _ := guard.RegisterFailure(ctx, "budi", "10.0.0.1"); lockedFor != 0 {
+		t.Fatalf("counter harusnya udah ke reset, dapet lock %s", lockedFor)
+	}
+}
+
+func TestLoginLockoutFlow(t *testing.T) {
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("rahasia"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user := &model.User{Id: uuid.New(), Username: "budi", Email: "budi@mail.com", Password: string(hash), IsActivate: true, Role: "USER"}
+	auth, mr := newTestAuthService(t, user)
+
+	locked := make(chan event.AccountLockedEvent, 4)
+	auth.bus.Subscribe(event.AccountLocked, func(ctx context.Context, payload interface{}) {
+		locked <- payload.(event.AccountLockedEvent)
+	})
+
+	ctx := context.Background()
+	meta := SessionMeta{Ip: "10.0.0.1"}
+
+	for i := 1; i < userLockThreshold; i++ {
+		_, svcErr := auth.LoginService("budi", "salah", meta, ctx)
+		if svcErr == nil || svcErr.Code != http.StatusUnauthorized {
+			t.Fatalf("gagal ke %d harusnya 401, dapet %v", i, svcErr)
+		}
+	}
+
+	// login yang bener nge-reset counter user nya
+	if _, svcErr := auth.LoginService("budi", "rahasia", meta, ctx); svcErr != nil {
+		t.Fatalf("password bener harusnya berhasil : %s", svcErr.Message)
+	}
+
+	for i := 1; i <= userLockThreshold; i++ {
+		_, svcErr := auth.LoginService("budi", "salah", meta, ctx)
+		if i == userLockThreshold && (svcErr == nil || svcErr.Code != http.StatusTooManyRequests) {
+			t.Fatalf("gagal ke %d harusnya di lock, dapet %v", i, svcErr)
+		}
+	}
+
+	select {
+	case ev := <-locked:
+		if ev.Email != user.Email || ev.LockedFor != baseLockDuration {
+			t.Errorf("event AccountLocked nya %+v", ev)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("user nya harusnya dikabarin pas akun nya ke lock")
+	}
+
+	// password bener pun ditolak selama masih di lock, dan error nya 429 bukan 401
+	_, svcErr := auth.LoginService("budi", "rahasia", meta, ctx)
+	if svcErr == nil || svcErr.Code != http.StatusTooManyRequests || svcErr.RetryAfter <= 0 {
+		t.Fatalf("masih di lock harusnya 429 + Retry-After, dapet %v", svcErr)
+	}
+
+	mr.FastForward(baseLockDuration + time.Second)
+
+	if _, svcErr := auth.LoginService("budi", "rahasia", meta, ctx); svcErr != nil {
+		t.Fatalf("lock nya udah abis, harusnya bisa login : %s", svcErr.Message)
+	}
+}
+
+func TestLoginIpLockoutAcrossUsernames(t *testing.T) {
+
+	auth, _ := newTestAuthService(t)
+	ctx := context.Background()
+
+	attacker := SessionMeta{Ip: "10.0.0.66"}
+
+	var svcErr = auth.loginFailed("user-0", nil, attacker, ctx)
+	for i := 1; i < ipLockThreshold; i++ {
+		svcErr = auth.loginFailed(uuid.NewString(), nil, attacker, ctx)
+	}
+
+	if svcErr == nil || svcErr.Code != http.StatusTooManyRequests {
+		t.Fatalf("ip yang nyoba %d username beda harusnya di lock, dapet %v", ipLockThreshold, svcErr)
+	}
+
+	if locked, _ := auth.guard.LockedFor(ctx, "username-baru", attacker.Ip); locked <= 0 {
+		t.Fatal("username lain dari ip yang sama harusnya ikut ke lock")
+	}
+
+	if locked, _ := auth.guard.LockedFor(ctx, "username-baru", "10.0.0.2"); locked != 0 {
+		t.Fatal("ip lain ga boleh ikut ke lock")
+	}
+
+	// login bener ga nge-reset counter ip
+	if err := auth.guard.RegisterSuccess(ctx, "user-0"); err != nil {
+		t.Fatal(err)
+	}
+
+	if locked, _ := auth.guard.LockedFor(ctx, "user-0", attacker.Ip); locked <= 0 {
+		t.Fatal("lock ip harusnya ga ke reset sama login yang berhasil")
+	}
+}
@@ -0,0 +1,296 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Agmer17/golang_yapping/internal/model"
+	"github.com/Agmer17/golang_yapping/internal/repository"
+	"github.com/Agmer17/golang_yapping/pkg"
+	"github.com/Agmer17/golang_yapping/pkg/customerrors"
+	"github.com/jackc/pgx/v5"
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// umur state di redis sekaligus umur cookie state di browser
+	OidcStateTTL = 10 * time.Minute
+
+	// username dari provider dibersihin dulu, kalo kepake ditambahin suffix random
+	oidcUsernameMaxAttempts = 5
+)
+
+var usernameCleaner = regexp.MustCompile(`[^a-z0-9_.]+`)
+
+type OidcServiceInterface interface {
+	BeginLogin(ctx context.Context, provider string) (OidcLoginStart, *customerrors.ServiceErrors)
+	CompleteLogin(ctx context.Context, provider string, state string, browserState string, code string, meta SessionMeta) (ResponseSchema, *customerrors.ServiceErrors)
+}
+
+// State nya harus disimpen di browser yang mulai login (cookie), terus dikirim balik pas callback
+type OidcLoginStart struct {
+	AuthURL string
+	State   string
+}
+
+// data yang disimpen di redis selama user bolak balik ke provider
+type oidcLoginState struct {
+	Provider     string `json:"provider"`
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"code_verifier"`
+}
+
+type OidcService struct {
+	Providers    map[string]*pkg.OidcProvider
+	IdentityRepo repository.LinkedIdentityRepoInterface
+	UserRepo     repository.UserRepositoryInterface
+	RedisClient  *redis.Client
+	auth         *AuthService
+}
+
+func NewOidcService(
+	providers []pkg.OidcProviderConfig,
+	identityRepo *repository.LinkedIdentityRepo,
+	userRepo *repository.UserRepository,
+	r *redis.Client,
+	auth *AuthService,
+) *OidcService {
+
+	registered := make(map[string]*pkg.OidcProvider, len(providers))
+	for _, cfg := range providers {
+		registered[cfg.Name] = pkg.NewOidcProvider(cfg)
+	}
+
+	return &OidcService{
+		Providers:    registered,
+		IdentityRepo: identityRepo,
+		UserRepo:     userRepo,
+		RedisClient:  r,
+		auth:         auth,
+	}
+}
+
+func oidcStateKey(state string) string {
+	return "oidc_state:" + pkg.HashToken(state)
+}
+
+// balikin url authorize provider, state + nonce + pkce verifier nya disimpen di redis
+func (svc *OidcService) BeginLogin(ctx context.Context, provider string) (OidcLoginStart, *customerrors.ServiceErrors) {
+
+	p, ok := svc.Providers[provider]
+	if !ok {
+		return OidcLoginStart{}, customerrors.New(http.StatusNotFound, "provider login tidak ditemukan")
+	}
+
+	state, err := pkg.GenerateRandomStringToken(32)
+	if err != nil {
+		return OidcLoginStart{}, customerrors.New(http.StatusInternalServerError, "Terjadi kesalahan di server : "+err.Error())
+	}
+
+	nonce, err := pkg.GenerateRandomStringToken(32)
+	if err != nil {
+		return OidcLoginStart{}, customerrors.New(http.StatusInternalServerError, "Terjadi kesalahan di server : "+err.Error())
+	}
+
+	verifier, challenge, err := pkg.GeneratePkce()
+	if err != nil {
+		return OidcLoginStart{}, customerrors.New(http.StatusInternalServerError, "Terjadi kesalahan di server : "+err.Error())
+	}
+
+	authURL, err := p.AuthCodeURL(ctx, state, nonce, challenge)
+	if err != nil {
+		return OidcLoginStart{}, customerrors.New(http.StatusBadGateway, "gagal menghubungi provider login : "+err.Error())
+	}
+
+	raw, _ := json.Marshal(oidcLoginState{
+		Provider:     provider,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+	})
+
+	if err := svc.RedisClient.Set(ctx, oidcStateKey(state), raw, OidcStateTTL).Err(); err != nil {
+		return OidcLoginStart{}, customerrors.New(http.StatusInternalServerError, "Terjadi kesalahan di server : "+err.Error())
+	}
+
+	return OidcLoginStart{AuthURL: authURL, State: state}, nil
+}
+
+// browserState state dari cookie browser yang manggil callback. kalo beda sama state nya berarti
+// callback nya bukan dari browser yang mulai login (login CSRF, user dibikin masuk ke akun orang lain)
+func (svc *OidcService) CompleteLogin(ctx context.Context, provider string, state string, browserState string, code string, meta SessionMeta) (ResponseSchema, *customerrors.ServiceErrors) {
+
+	p, ok := svc.Providers[provider]
+	if !ok {
+		return nil, customerrors.New(http.StatusNotFound, "provider login tidak ditemukan")
+	}
+
+	if browserState == "" || subtle.ConstantTimeCompare([]byte(state), []byte(browserState)) != 1 {
+		return nil, customerrors.New(http.StatusBadRequest, "login harus diselesaikan di browser yang sama, silahkan ulangi login")
+	}
+
+	// state cuma bisa dipake sekali
+	raw, err := svc.RedisClient.GetDel(ctx, oidcStateKey(state)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, customerrors.New(http.StatusBadRequest, "sesi login sudah habis atau tidak valid, silahkan ulangi login")
+	}
+
+	if err != nil {
+		return nil, customerrors.New(http.StatusInternalServerError, "Terjadi kesalahan di server : "+err.Error())
+	}
+
+	var saved oidcLoginState
+	if err := json.Unmarshal(raw, &saved); err != nil || saved.Provider != provider {
+		return nil, customerrors.New(http.StatusBadRequest, "sesi login sudah habis atau tidak valid, silahkan ulangi login")
+	}
+
+	idToken, err := p.Exchange(ctx, code, saved.CodeVerifier)
+	if err != nil {
+		return nil, customerrors.New(http.StatusBadGateway, "gagal menukar kode dari provider : "+err.Error())
+	}
+
+	identity, err := p.VerifyIdToken(ctx, idToken, saved.Nonce)
+	if err != nil {
+		return nil, customerrors.New(http.StatusUnauthorized, "id token dari provider tidak valid : "+err.Error())
+	}
+
+	user, svcErr := svc.resolveUser(ctx, provider, identity)
+	if svcErr != nil {
+		return nil, svcErr
+	}
+
+	return svc.auth.finishLogin(user, meta, ctx)
+}
+
+// urutan nya : identity yang udah ke link -> user dengan email yang sama -> bikin user baru
+func (svc *OidcService) resolveUser(ctx context.Context, provider string, identity pkg.OidcIdentity) (*model.User, *customerrors.ServiceErrors) {
+
+	linked, err := svc.IdentityRepo.FindByProviderSubject(ctx, provider, identity.Subject)
+	if err == nil {
+		user, err := svc.UserRepo.GetUserDataById(linked.UserId, ctx)
+		if err != nil {
+			return nil, customerrors.New(http.StatusInternalServerError, "Terjadi kesalahan di server : "+err.Error())
+		}
+
+		return user, nil
+	}
+
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, customerrors.New(http.StatusInternalServerError, "Terjadi kesalahan di server : "+err.Error())
+	}
+
+	// email yang belum diverifikasi provider ga boleh dipake buat nyambungin atau bikin akun
+	if identity.Email == "" || !identity.EmailVerified {
+		return nil, customerrors.New(http.StatusForbidden, "email dari provider belum terverifikasi")
+	}
+
+	newIdentity := model.LinkedIdentity{
+		Provider: provider,
+		Subject:  identity.Subject,
+		Email:    &identity.Email,
+	}
+
+	existing, err := svc.UserRepo.GetUserDataByEmail(identity.Email, ctx)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, customerrors.New(http.StatusInternalServerError, "Terjadi kesalahan di server : "+err.Error())
+	}
+
+	if existing != nil {
+		// akun yang belum aktif bisa aja didaftarin orang lain pake email ini,
+		// jadi harus diaktifin dulu lewat email sebelum bisa di link
+		if !existing.IsActivate {
+			return nil, customerrors.New(http.StatusConflict, "akun dengan email ini belum diaktifkan, silahkan aktifkan akun terlebih dahulu")
+		}
+
+		newIdentity.UserId = existing.Id
+		if err := svc.IdentityRepo.Link(ctx, newIdentity); err != nil {
+			return nil, customerrors.New(http.StatusInternalServerError, "gagal menghubungkan akun : "+err.Error())
+		}
+
+		return existing, nil
+	}
+
+	return svc.createUser(ctx, identity, newIdentity)
+}
+
+func (svc *OidcService) createUser(ctx context.Context, identity pkg.OidcIdentity, newIdentity model.LinkedIdentity) (*model.User, *customerrors.ServiceErrors) {
+
+	username, err := svc.availableUsername(ctx, identity)
+	if err != nil {
+		return nil, customerrors.New(http.StatusInternalServerError, "Terjadi kesalahan di server : "+err.Error())
+	}
+
+	// password random, kalo mau login pake password user bisa pake fitur lupa password
+	randomPw, err := pkg.GenerateRandomStringToken(32)
+	if err != nil {
+		return nil, customerrors.New(http.StatusInternalServerError, "Terjadi kesalahan di server : "+err.Error())
+	}
+
+	hashedPw, err := bcrypt.GenerateFromPassword([]byte(randomPw), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, customerrors.New(http.StatusInternalServerError, "Terjadi kesalahan di server : "+err.Error())
+	}
+
+	fullName := strings.TrimSpace(identity.Name)
+	if fullName == "" {
+		fullName = username
+	}
+
+	user, err := svc.IdentityRepo.CreateUserWithIdentity(ctx, model.User{
+		Username: username,
+		FullName: fullName,
+		Email:    identity.Email,
+		Password: string(hashedPw),
+	}, newIdentity)
+
+	if err != nil {
+		return nil, customerrors.New(http.StatusInternalServerError, "gagal membuat akun : "+err.Error())
+	}
+
+	return &user, nil
+}
+
+func (svc *OidcService) availableUsername(ctx context.Context, identity pkg.OidcIdentity) (string, error) {
+
+	base := identity.PreferredUsername
+	if base == "" {
+		base, _, _ = strings.Cut(identity.Email, "@")
+	}
+
+	base = usernameCleaner.ReplaceAllString(strings.ToLower(base), "")
+	if len(base) > 20 {
+		base = base[:20]
+	}
+
+	for len(base) < 4 {
+		base += "_"
+	}
+
+	candidate := base
+
+	for i := 0; i < oidcUsernameMaxAttempts; i++ {
+		exist, err := svc.UserRepo.ExistByNameOrUsername(candidate, "", ctx)
+		if err != nil {
+			return "", err
+		}
+
+		if !exist {
+			return candidate, nil
+		}
+
+		suffix, err := pkg.GenerateRandomStringToken(3)
+		if err != nil {
+			return "", err
+		}
+
+		candidate = base + "_" + usernameCleaner.ReplaceAllString(strings.ToLower(suffix), "")
+	}
+
+	return "", errors.New("gagal membuat username yang tersedia")
+}
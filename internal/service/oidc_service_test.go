@@ -0,0 +1,417 @@
+package service
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Agmer17/golang_yapping/internal/model"
+	"github.com/Agmer17/golang_yapping/pkg"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	mockOidcClientId = "yapping-test"
+	mockOidcKid      = "mock-key"
+)
+
+// provider OIDC bohongan : discovery, jwks, sama token endpoint yang ngecek PKCE
+type mockOidcProvider struct {
+	server *httptest.Server
+	priv   ed25519.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]mockAuthorization
+}
+
+// yang dicatet provider pas user login di halaman authorize
+type mockAuthorization struct {
+	challenge string
+	claims    jwt.MapClaims
+}
+
+func newMockOidcProvider(t *testing.T) *mockOidcProvider {
+	t.Helper()
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := &mockOidcProvider{
+		priv:  priv,
+		codes: make(map[string]mockAuthorization),
+	}
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 m.server.URL,
+			"authorization_endpoint": m.server.URL + "/authorize",
+			"token_endpoint":         m.server.URL + "/token",
+			"jwks_uri":               m.server.URL + "/jwks",
+		})
+	})
+
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(pkg.JWKSet{Keys: []pkg.JWK{{
+			Kty: "OKP",
+			Kid: mockOidcKid,
+			Use: "sig",
+			Alg: "EdDSA",
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(pub),
+		}}})
+	})
+
+	mux.HandleFunc("/token", m.handleToken)
+
+	m.server = httptest.NewServer(mux)
+	t.Cleanup(m.server.Close)
+
+	return m
+}
+
+func (m *mockOidcProvider) handleToken(w http.ResponseWriter, r *http.Request) {
+
+	r.ParseForm()
+
+	m.mu.Lock()
+	auth, ok := m.codes[r.PostForm.Get("code")]
+	delete(m.codes, r.PostForm.Get("code"))
+	m.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	verifierOk := base64.RawURLEncoding.EncodeToString(sum[:]) == auth.challenge
+
+	if !ok || !verifierOk || r.PostForm.Get("client_id") != mockOidcClientId {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, auth.claims)
+	token.Header["kid"] = mockOidcKid
+
+	signed, _ := token.SignedString(m.priv)
+
+	json.NewEncoder(w).Encode(map[string]string{"id_token": signed})
+}
+
+// pura pura user login di provider. claims id token nya bisa diubah lewat modify
+// buat bikin kasus iss / aud / nonce yang salah
+func (m *mockOidcProvider) authorize(t *testing.T, authURL string, subject string, email string, modify func(jwt.MapClaims)) (state string, code string) {
+	t.Helper()
+
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	q := u.Query()
+
+	if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		t.Fatalf("url authorize harus pake PKCE S256 : %s", authURL)
+	}
+
+	claims := jwt.MapClaims{
+		"iss":            m.server.URL,
+		"aud":            mockOidcClientId,
+		"sub":            subject,
+		"exp":            time.Now().Add(time.Minute).Unix(),
+		"iat":            time.Now().Unix(),
+		"nonce":          q.Get("nonce"),
+		"email":          email,
+		"email_verified": true,
+	}
+
+	if modify != nil {
+		modify(claims)
+	}
+
+	code = uuid.NewString()
+
+	m.mu.Lock()
+	m.codes[code] = mockAuthorization{challenge: q.Get("code_challenge"), claims: claims}
+	m.mu.Unlock()
+
+	return q.Get("state"), code
+}
+
+type fakeIdentityRepo struct {
+	users      *fakeUserRepo
+	identities []model.LinkedIdentity
+}
+
+func (r *fakeIdentityRepo) FindByProviderSubject(ctx context.Context, provider string, subject string) (model.LinkedIdentity, error) {
+	for _, li := range r.identities {
+		if li.Provider == provider && li.Subject == subject {
+			return li, nil
+		}
+	}
+	return model.LinkedIdentity{}, pgx.ErrNoRows
+}
+
+func (r *fakeIdentityRepo) Link(ctx context.Context, identity model.LinkedIdentity) error {
+	r.identities = append(r.identities, identity)
+	return nil
+}
+
+func (r *fakeIdentityRepo) CreateUserWithIdentity(ctx context.Context, user model.User, identity model.LinkedIdentity) (model.User, error) {
+	user, _ = r.users.AddUser(user, ctx)
+	user.IsActivate = true
+
+	identity.UserId = user.Id
+	r.identities = append(r.identities, identity)
+
+	return user, nil
+}
+
+func newTestOidcService(t *testing.T, users ...*model.User) (*OidcService, *mockOidcProvider, *fakeIdentityRepo) {
+	t.Helper()
+
+	pkg.JwtInit("oidc-test-secret")
+
+	_, rdb := newTestRedis(t)
+	mock := newMockOidcProvider(t)
+
+	userRepo := newFakeUserRepo(users...)
+	identityRepo := &fakeIdentityRepo{users: userRepo}
+
+	auth := &AuthService{
+		UserRepo:    userRepo,
+		RedisClient: rdb,
+		Sessions:    NewSessionRegistry(rdb),
+		twoFactor:   &TwoFactorService{Repo: &fakeTwoFactorRepo{}},
+	}
+
+	svc := &OidcService{
+		Providers: map[string]*pkg.OidcProvider{
+			"mock": pkg.NewOidcProvider(pkg.OidcProviderConfig{
+				Name:        "mock",
+				Issuer:      mock.server.URL,
+				ClientId:    mockOidcClientId,
+				RedirectURL: "http://localhost/api/auth/oidc/mock/callback",
+			}),
+		},
+		IdentityRepo: identityRepo,
+		UserRepo:     userRepo,
+		RedisClient:  rdb,
+		auth:         auth,
+	}
+
+	return svc, mock, identityRepo
+}
+
+func beginMockLogin(t *testing.T, svc *OidcService) string {
+	t.Helper()
+
+	start, svcErr := svc.BeginLogin(context.Background(), "mock")
+	if svcErr != nil {
+		t.Fatalf("BeginLogin : %s", svcErr.Message)
+	}
+
+	return start.AuthURL
+}
+
+func TestOidcLoginCreatesUser(t *testing.T) {
+
+	svc, mock, identities := newTestOidcService(t)
+
+	state, code := mock.authorize(t, beginMockLogin(t, svc), "sub-1", "Baru@Example.com", nil)
+
+	resp, svcErr := svc.CompleteLogin(context.Background(), "mock", state, state, code, SessionMeta{})
+	if svcErr != nil {
+		t.Fatalf("login harusnya berhasil : %d %s", svcErr.Code, svcErr.Message)
+	}
+
+	if resp["accessToken"] == nil || resp["refreshToken"] == nil {
+		t.Fatalf("response harusnya berisi token : %v", resp)
+	}
+
+	if len(identities.identities) != 1 || *identities.identities[0].Email != "baru@example.com" {
+		t.Fatalf("identity harusnya kesimpen sekali pake email lowercase : %+v", identities.identities)
+	}
+
+	// state cuma bisa dipake sekali
+	if _, svcErr := svc.CompleteLogin(context.Background(), "mock", state, state, code, SessionMeta{}); svcErr == nil || svcErr.Code != http.StatusBadRequest {
+		t.Fatalf("state yang udah dipake harusnya ditolak 400, dapet %v", svcErr)
+	}
+}
+
+func TestOidcStateMismatch(t *testing.T) {
+
+	svc, mock, _ := newTestOidcService(t)
+
+	_, code := mock.authorize(t, beginMockLogin(t, svc), "sub-1", "user@example.com", nil)
+
+	_, svcErr := svc.CompleteLogin(context.Background(), "mock", "state-ngarang", "state-ngarang", code, SessionMeta{})
+	if svcErr == nil || svcErr.Code != http.StatusBadRequest {
+		t.Fatalf("state yang ga dikenal harusnya ditolak 400, dapet %v", svcErr)
+	}
+}
+
+// penyerang mulai login sendiri terus ngirim url callback nya ke korban,
+// browser korban ga punya cookie state itu jadi harus ditolak
+func TestOidcCallbackFromOtherBrowser(t *testing.T) {
+
+	svc, mock, _ := newTestOidcService(t)
+
+	attackerState, code := mock.authorize(t, beginMockLogin(t, svc), "sub-penyerang", "penyerang@example.com", nil)
+
+	victim, svcErr := svc.BeginLogin(context.Background(), "mock")
+	if svcErr != nil {
+		t.Fatal(svcErr.Message)
+	}
+
+	for name, browserState := range map[string]string{"tanpa cookie": "", "cookie login lain": victim.State} {
+		_, svcErr := svc.CompleteLogin(context.Background(), "mock", attackerState, browserState, code, SessionMeta{})
+		if svcErr == nil || svcErr.Code != http.StatusBadRequest {
+			t.Fatalf("%s : callback harusnya ditolak 400, dapet %v", name, svcErr)
+		}
+	}
+}
+
+func TestOidcRejectsInvalidIdToken(t *testing.T) {
+
+	cases := map[string]func(jwt.MapClaims){
+		"nonce beda":      func(c jwt.MapClaims) { c["nonce"] = "nonce-lain" },
+		"tanpa nonce":     func(c jwt.MapClaims) { delete(c, "nonce") },
+		"iss salah":       func(c jwt.MapClaims) { c["iss"] = "https://issuer-lain.example.com" },
+		"aud salah":       func(c jwt.MapClaims) { c["aud"] = "client-lain" },
+		"udah kadaluarsa": func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Minute).Unix() },
+	}
+
+	for name, modify := range cases {
+		t.Run(name, func(t *testing.T) {
+			svc, mock, identities := newTestOidcService(t)
+
+			state, code := mock.authorize(t, beginMockLogin(t, svc), "sub-1", "user@example.com", modify)
+
+			_, svcErr := svc.CompleteLogin(context.Background(), "mock", state, state, code, SessionMeta{})
+			if svcErr == nil || svcErr.Code != http.StatusUnauthorized {
+				t.Fatalf("id token harusnya ditolak 401, dapet %v", svcErr)
+			}
+
+			if len(identities.identities) != 0 {
+				t.Fatal("identity ga boleh kesimpen")
+			}
+		})
+	}
+}
+
+func TestOidcPkceVerifier(t *testing.T) {
+
+	svc, mock, _ := newTestOidcService(t)
+
+	state, code := mock.authorize(t, beginMockLogin(t, svc), "sub-1", "user@example.com", nil)
+
+	// code nya dicegat dan dipasangin ke challenge punya orang lain, verifier yang disimpen
+	// di state ga bakal cocok jadi token endpoint nolak
+	mock.mu.Lock()
+	auth := mock.codes[code]
+	auth.challenge = base64.RawURLEncoding.EncodeToString(make([]byte, 32))
+	mock.codes[code] = auth
+	mock.mu.Unlock()
+
+	_, svcErr := svc.CompleteLogin(context.Background(), "mock", state, state, code, SessionMeta{})
+	if svcErr == nil || svcErr.Code != http.StatusBadGateway {
+		t.Fatalf("verifier yang ga cocok harusnya gagal di token endpoint, dapet %v", svcErr)
+	}
+}
+
+func TestOidcLinksVerifiedLocalAccount(t *testing.T) {
+
+	local := &model.User{
+		Id:         uuid.New(),
+		Username:   "lokal",
+		Email:      "lokal@example.com",
+		IsActivate: true,
+	}
+
+	svc, mock, identities := newTestOidcService(t, local)
+
+	state, code := mock.authorize(t, beginMockLogin(t, svc), "sub-lokal", "lokal@example.com", nil)
+
+	resp, svcErr := svc.CompleteLogin(context.Background(), "mock", state, state, code, SessionMeta{})
+	if svcErr != nil {
+		t.Fatalf("login harusnya berhasil : %d %s", svcErr.Code, svcErr.Message)
+	}
+
+	if resp["id"] != local.Id {
+		t.Fatalf("harusnya login sebagai akun lokal %s, dapet %v", local.Id, resp["id"])
+	}
+
+	if len(identities.identities) != 1 || identities.identities[0].UserId != local.Id {
+		t.Fatalf("identity harusnya ke link ke akun lokal : %+v", identities.identities)
+	}
+
+	// login berikutnya langsung lewat identity yang udah ke link
+	state, code = mock.authorize(t, beginMockLogin(t, svc), "sub-lokal", "lokal@example.com", nil)
+	if resp, svcErr := svc.CompleteLogin(context.Background(), "mock", state, state, code, SessionMeta{}); svcErr != nil || resp["id"] != local.Id {
+		t.Fatalf("login kedua harusnya ke akun yang sama, dapet %v %v", resp, svcErr)
+	}
+
+	if len(identities.identities) != 1 {
+		t.Fatal("identity ga boleh di link dua kali")
+	}
+}
+
+func TestOidcRefusesUnactivatedLocalAccount(t *testing.T) {
+
+	local := &model.User{
+		Id:       uuid.New(),
+		Username: "belumaktif",
+		Email:    "belum@example.com",
+	}
+
+	svc, mock, identities := newTestOidcService(t, local)
+
+	state, code := mock.authorize(t, beginMockLogin(t, svc), "sub-2", "belum@example.com", nil)
+
+	_, svcErr := svc.CompleteLogin(context.Background(), "mock", state, state, code, SessionMeta{})
+	if svcErr == nil || svcErr.Code != http.StatusConflict {
+		t.Fatalf("akun lokal yang belum aktif harusnya ditolak 409, dapet %v", svcErr)
+	}
+
+	if len(identities.identities) != 0 {
+		t.Fatal("identity ga boleh ke link ke akun yang belum aktif")
+	}
+}
+
+func TestOidcRefusesUnverifiedEmail(t *testing.T) {
+
+	local := &model.User{
+		Id:         uuid.New(),
+		Username:   "lokal",
+		Email:      "lokal@example.com",
+		IsActivate: true,
+	}
+
+	svc, mock, identities := newTestOidcService(t, local)
+
+	state, code := mock.authorize(t, beginMockLogin(t, svc), "sub-3", "lokal@example.com", func(c jwt.MapClaims) {
+		c["email_verified"] = false
+	})
+
+	_, svcErr := svc.CompleteLogin(context.Background(), "mock", state, state, code, SessionMeta{})
+	if svcErr == nil || svcErr.Code != http.StatusForbidden {
+		t.Fatalf("email yang belum diverifikasi provider harusnya ditolak 403, dapet %v", svcErr)
+	}
+
+	if len(identities.identities) != 0 {
+		t.Fatal("identity ga boleh ke link pake email yang belum diverifikasi")
+	}
+}
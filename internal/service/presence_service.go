@@ -0,0 +1,408 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Agmer17/golang_yapping/internal/event"
+	"github.com/Agmer17/golang_yapping/internal/repository"
+	"github.com/Agmer17/golang_yapping/internal/ws"
+	"github.com/Agmer17/golang_yapping/pkg/customerrors"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// TYPING_STOP otomatis dikirim kalo client ga ngirim TYPING_START lagi selama ini
+	typingTTL = 6 * time.Second
+
+	maxPresenceQuery = 100
+
+	presenceDbTimeout = 5 * time.Second
+)
+
+type PresenceData struct {
+	UserId   uuid.UUID  `json:"user_id"`
+	Online   bool       `json:"online"`
+	LastSeen *time.Time `json:"last_seen"`
+}
+
+type PresenceServiceInterface interface {
+	GetPresence(ctx context.Context, viewer uuid.UUID, userIds []uuid.UUID) ([]PresenceData, *customerrors.ServiceErrors)
+	SetHideLastSeen(ctx context.Context, userId uuid.UUID, hide bool) *customerrors.ServiceErrors
+}
+
+// salah satu dari To atau GroupId yang keisi
+type typingKey struct {
+	From    uuid.UUID
+	To      uuid.UUID
+	GroupId uuid.UUID
+}
+
+func (k typingKey) room() string {
+	if k.GroupId != uuid.Nil {
+		return ws.GroupRoom(k.GroupId)
+	}
+
+	return ws.UserRoom(k.To)
+}
+
+// timer TYPING_STOP otomatis di instance ini, token nya sama kayak yang ditulis ke TypingRegistry
+type typingTimer struct {
+	timer *time.Timer
+	token string
+}
+
+type PresenceService struct {
+	Repo     repository.PresenceRepositoryInterface
+	Hub      *ws.Hub
+	EventBus *event.EventBus
+	Typing   *TypingRegistry
+
+	muTyping sync.Mutex
+	typing   map[typingKey]*typingTimer
+
+	// context buat query yang jalan di luar request (update last seen, ambil partner)
+	bgCtx context.Context
+}
+
+// sekalian daftarin hook presence + action TYPING_START / TYPING_STOP ke hub
+func NewPresenceService(repo *repository.PresenceRepository, hub *ws.Hub, eventBus *event.EventBus, r *redis.Client, bgCtx context.Context) *PresenceService {
+
+	ps := &PresenceService{
+		Repo:     repo,
+		Hub:      hub,
+		EventBus: eventBus,
+		Typing:   NewTypingRegistry(r),
+		typing:   make(map[typingKey]*typingTimer),
+		bgCtx:    bgCtx,
+	}
+
+	hub.OnPresenceChange = ps.onPresenceChange
+	hub.HandleAction(ws.ActionTypingStart, ps.handleTypingStart)
+	hub.HandleAction(ws.ActionTypingStop, ps.handleTypingStop)
+
+	return ps
+}
+
+// user yang ga satu percakapan sama viewer ga ikut dibalikin, sama kayak user yang ga ada
+func (ps *PresenceService) GetPresence(ctx context.Context, viewer uuid.UUID, userIds []uuid.UUID) ([]PresenceData, *customerrors.ServiceErrors) {
+
+	if len(userIds) == 0 || len(userIds) > maxPresenceQuery {
+		return nil, customerrors.New(http.StatusBadRequest, "jumlah user harus antara 1 sampai 100")
+	}
+
+	rows, err := ps.Repo.GetPresence(ctx, viewer, userIds)
+	if err != nil {
+		return nil, customerrors.New(http.StatusInternalServerError, "Gagal mengambil data di database "+err.Error())
+	}
+
+	ids := make([]uuid.UUID, 0, len(rows))
+	for _, p := range rows {
+		ids = append(ids, p.UserId)
+	}
+
+	online := ps.Hub.OnlineUsers(ids)
+
+	result := make([]PresenceData, 0, len(rows))
+	for _, p := range rows {
+		data := PresenceData{
+			UserId: p.UserId,
+			Online: online[p.UserId],
+		}
+
+		if !data.Online && !p.HideLastSeen {
+			data.LastSeen = p.LastSeen
+		}
+
+		result = append(result, data)
+	}
+
+	return result, nil
+}
+
+func (ps *PresenceService) SetHideLastSeen(ctx context.Context, userId uuid.UUID, hide bool) *customerrors.ServiceErrors {
+
+	err := ps.Repo.SetHideLastSeen(ctx, userId, hide)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return customerrors.New(http.StatusNotFound, "user tidak ditemukan")
+	}
+
+	if err != nil {
+		return customerrors.New(http.StatusInternalServerError, "Gagal menyimpan pengaturan "+err.Error())
+	}
+
+	return nil
+}
+
+// jalan di goroutine presence hub, kerjaan ke database / redis nya dilempar ke goroutine lain
+func (ps *PresenceService) onPresenceChange(userId uuid.UUID, online bool) {
+
+	now := time.Now().UTC()
+
+	go func() {
+		if !online {
+			ps.clearTypingFrom(userId)
+		}
+
+		ctx, cancel := context.WithTimeout(ps.bgCtx, presenceDbTimeout)
+		defer cancel()
+
+		data := ws.PresenceEventData{
+			UserId: userId,
+			Online: online,
+		}
+
+		if !online {
+			if err := ps.Repo.UpdateLastSeen(ctx, userId, now); err != nil {
+				log.Printf("gagal update last seen %s : %v", userId, err)
+			}
+
+			rows, err := ps.Repo.GetPresence(ctx, userId, []uuid.UUID{userId})
+			if err == nil && len(rows) == 1 && !rows[0].HideLastSeen {
+				data.LastSeen = &now
+			}
+		}
+
+		partners, err := ps.Repo.GetChatPartnerIds(ctx, userId)
+		if err != nil {
+			log.Printf("gagal ambil partner chat %s : %v", userId, err)
+			return
+		}
+
+		payload, _ := json.Marshal(data)
+
+		for _, partner := range partners {
+			ps.EventBus.Publish(event.WsEventSendPayload, ws.WebsocketEvent{
+				Action:   ws.ActionPresence,
+				Detail:   "PRESENCE CHANGED",
+				Type:     ws.TypeSystemOk,
+				Receiver: ws.UserRoom(partner),
+				Data:     payload,
+			})
+		}
+	}()
+}
+
+func parseTypingTarget(c *ws.Client, ev ws.WebsocketEvent) (typingKey, bool) {
+
+	var req ws.TypingRequestData
+	if err := json.Unmarshal(ev.Data, &req); err != nil {
+		c.SendError("Harap kirim payload dengan benar!")
+		return typingKey{}, false
+	}
+
+	if err := binding.Validator.ValidateStruct(req); err != nil {
+		c.SendError("Harap kirim data payload dengan benar")
+		return typingKey{}, false
+	}
+
+	key := typingKey{From: c.UserId}
+
+	// akses ke grup nya udah dicek pas SUBSCRIBE, jadi ga perlu ke database lagi
+	if req.GroupId != "" {
+		key.GroupId, _ = uuid.Parse(req.GroupId)
+		if !c.InRoom(key.room()) {
+			c.SendError("harap subscribe ke room grup ini dulu")
+			return typingKey{}, false
+		}
+
+		return key, true
+	}
+
+	key.To, _ = uuid.Parse(req.To)
+	if key.To == c.UserId {
+		c.SendError("Harap kirim data payload dengan benar")
+		return typingKey{}, false
+	}
+
+	return key, true
+}
+
+// TYPING_START yang dikirim ulang selama masih ngetik cuma manjangin expiry, ga di relay lagi
+func (ps *PresenceService) handleTypingStart(c *ws.Client, ev ws.WebsocketEvent) {
+
+	key, ok := parseTypingTarget(c, ev)
+	if !ok {
+		return
+	}
+
+	ps.muTyping.Lock()
+	_, alreadyTyping := ps.typing[key]
+	ps.muTyping.Unlock()
+
+	// cuma dicek pas mulai ngetik, TYPING_START berikutnya cuma manjangin timer
+	if !alreadyTyping && !ps.canTypeTo(c, key) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ps.bgCtx, presenceDbTimeout)
+	defer cancel()
+
+	// TYPING_START sebelumnya bisa aja masuk lewat koneksi di instance lain
+	token := uuid.NewString()
+	started, err := ps.Typing.Start(ctx, key, token)
+	if err != nil {
+		log.Printf("gagal nyimpen status ngetik %s : %v", key.From, err)
+		c.SendError("Terjadi kesalahan di server")
+		return
+	}
+
+	ps.muTyping.Lock()
+	if t, ok := ps.typing[key]; ok {
+		t.timer.Stop()
+	}
+
+	ps.typing[key] = &typingTimer{
+		token: token,
+		timer: time.AfterFunc(typingTTL, func() {
+			ps.expireTyping(key, token)
+		}),
+	}
+	ps.muTyping.Unlock()
+
+	if started {
+		ps.sendTyping(ws.ActionTypingStart, key)
+	}
+}
+
+// indikator ngetik cuma boleh dikirim ke user yang pernah chat pribadi / satu grup sama pengirim nya.
+// target grup udah dicek lewat InRoom di parseTypingTarget
+func (ps *PresenceService) canTypeTo(c *ws.Client, key typingKey) bool {
+
+	if key.GroupId != uuid.Nil {
+		return true
+	}
+
+	ctx, cancel := context.WithTimeout(ps.bgCtx, presenceDbTimeout)
+	defer cancel()
+
+	shared, err := ps.Repo.SharesConversation(ctx, key.From, key.To)
+	if err != nil {
+		log.Printf("gagal cek percakapan %s -> %s : %v", key.From, key.To, err)
+		c.SendError("Terjadi kesalahan di server")
+		return false
+	}
+
+	if !shared {
+		c.SendError("kamu belum pernah chat dengan user ini")
+		return false
+	}
+
+	return true
+}
+
+func (ps *PresenceService) handleTypingStop(c *ws.Client, ev ws.WebsocketEvent) {
+
+	key, ok := parseTypingTarget(c, ev)
+	if !ok {
+		return
+	}
+
+	ps.stopTyping(key)
+}
+
+func (ps *PresenceService) stopTyping(key typingKey) {
+
+	ps.muTyping.Lock()
+	if t, ok := ps.typing[key]; ok {
+		t.timer.Stop()
+		delete(ps.typing, key)
+	}
+	ps.muTyping.Unlock()
+
+	ctx, cancel := context.WithTimeout(ps.bgCtx, presenceDbTimeout)
+	defer cancel()
+
+	stopped, err := ps.Typing.Stop(ctx, key)
+	if err != nil {
+		log.Printf("gagal hapus status ngetik %s : %v", key.From, err)
+		return
+	}
+
+	if stopped {
+		ps.sendTyping(ws.ActionTypingStop, key)
+	}
+}
+
+// timer nya cuma ngirim TYPING_STOP kalo ga ada TYPING_START yang lebih baru di instance mana pun
+func (ps *PresenceService) expireTyping(key typingKey, token string) {
+
+	ps.muTyping.Lock()
+	if t, ok := ps.typing[key]; ok && t.token == token {
+		delete(ps.typing, key)
+	}
+	ps.muTyping.Unlock()
+
+	ctx, cancel := context.WithTimeout(ps.bgCtx, presenceDbTimeout)
+	defer cancel()
+
+	expired, err := ps.Typing.Expire(ctx, key, token)
+	if err != nil {
+		log.Printf("gagal hapus status ngetik %s : %v", key.From, err)
+		return
+	}
+
+	if expired {
+		ps.sendTyping(ws.ActionTypingStop, key)
+	}
+}
+
+// user nya udah offline di semua instance, semua indikator ngetik nya dihentiin
+func (ps *PresenceService) clearTypingFrom(userId uuid.UUID) {
+
+	ps.muTyping.Lock()
+	for key, t := range ps.typing {
+		if key.From == userId {
+			t.timer.Stop()
+			delete(ps.typing, key)
+		}
+	}
+	ps.muTyping.Unlock()
+
+	ctx, cancel := context.WithTimeout(ps.bgCtx, presenceDbTimeout)
+	defer cancel()
+
+	keys, err := ps.Typing.ClearFrom(ctx, userId)
+	if err != nil {
+		log.Printf("gagal hapus status ngetik %s : %v", userId, err)
+	}
+
+	for _, key := range keys {
+		ps.sendTyping(ws.ActionTypingStop, key)
+	}
+}
+
+func (ps *PresenceService) sendTyping(action string, key typingKey) {
+
+	data := ws.TypingEventData{From: key.From}
+	if key.GroupId != uuid.Nil {
+		data.GroupId = &key.GroupId
+	}
+
+	if action == ws.ActionTypingStart {
+		data.ExpiresIn = int(typingTTL.Seconds())
+	}
+
+	payload, _ := json.Marshal(data)
+
+	detail := "USER TYPING"
+	if action == ws.ActionTypingStop {
+		detail = "USER STOPPED TYPING"
+	}
+
+	ps.EventBus.Publish(event.WsEventSendPayload, ws.WebsocketEvent{
+		Action:   action,
+		Detail:   detail,
+		Type:     ws.TypeSystemOk,
+		Receiver: key.room(),
+		Data:     payload,
+	})
+}
@@ -0,0 +1,274 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Agmer17/golang_yapping/pkg"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// refresh token yang dikirim udah pernah di rotate sebelumnya
+var ErrRefreshTokenReused = errors.New("refresh token sudah pernah digunakan")
+
+type SessionMeta struct {
+	UserAgent string
+	Ip        string
+}
+
+type sessionData struct {
+	UserId       string `redis:"user_id"`
+	RefreshToken string `redis:"refresh_token"` // hash sha256 dari refresh token
+	UserAgent    string `redis:"user_agent"`
+	Ip           string `redis:"ip"`
+	CreatedAt    string `redis:"created_at"`
+	LastUsedAt   string `redis:"last_used_at"`
+	ExpiresAt    string `redis:"expires_at"`
+}
+
+type SessionInfo struct {
+	Id         string    `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	Ip         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"`
+}
+
+// key di redis :
+//
+//	session:<sessionId>        -> hash data session
+//	user_sessions:<userId>     -> set berisi sessionId punya user
+//	refresh_consumed:<nonce>   -> sessionId dari refresh token yang udah di rotate
+//
+// satu session = satu token family, refresh token nya ganti tiap kali di refresh
+type SessionRegistry struct {
+	RedisClient *redis.Client
+}
+
+func NewSessionRegistry(r *redis.Client) *SessionRegistry {
+	return &SessionRegistry{
+		RedisClient: r,
+	}
+}
+
+func sessionKey(sessionId string) string {
+	return "session:" + sessionId
+}
+
+func userSessionsKey(userId uuid.UUID) string {
+	return "user_sessions:" + userId.String()
+}
+
+// token lama yang belum punya nonce masih pake hash token nya
+func consumedRefreshKey(claims *pkg.RefreshTokenClaims, token string) string {
+	if claims.Nonce == "" {
+		return "refresh_consumed:" + pkg.HashToken(token)
+	}
+
+	return "refresh_consumed:" + claims.Nonce
+}
+
+func NewSessionId() (string, error) {
+	return pkg.GenerateRandomStringToken(16)
+}
+
+func (s *SessionRegistry) Create(
+	ctx context.Context,
+	sessionId string,
+	userId uuid.UUID,
+	refreshToken string,
+	expiresAt time.Time,
+	meta SessionMeta,
+) error {
+
+	now := time.Now().Format(time.RFC3339)
+	ttl := time.Until(expiresAt)
+
+	data := map[string]any{
+		"user_id":       userId.String(),
+		"refresh_token": pkg.HashToken(refreshToken),
+		"user_agent":    meta.UserAgent,
+		"ip":            meta.Ip,
+		"created_at":    now,
+		"last_used_at":  now,
+		"expires_at":    expiresAt.Format(time.RFC3339),
+	}
+
+	pipe := s.RedisClient.TxPipeline()
+
+	pipe.HSet(ctx, sessionKey(sessionId), data)
+	pipe.Expire(ctx, sessionKey(sessionId), ttl)
+
+	pipe.SAdd(ctx, userSessionsKey(userId), sessionId)
+	// umur refresh token selalu sama, jadi session terbaru pasti yang paling lama expire nya
+	pipe.Expire(ctx, userSessionsKey(userId), ttl)
+
+	_, err := pipe.Exec(ctx)
+
+	return err
+}
+
+// balikin redis.Nil kalo session nya udah ga ada
+func (s *SessionRegistry) Get(ctx context.Context, sessionId string) (sessionData, error) {
+
+	var data sessionData
+
+	cmd := s.RedisClient.HGetAll(ctx, sessionKey(sessionId))
+	if err := cmd.Err(); err != nil {
+		return sessionData{}, err
+	}
+
+	if len(cmd.Val()) == 0 {
+		return sessionData{}, redis.Nil
+	}
+
+	if err := cmd.Scan(&data); err != nil {
+		return sessionData{}, err
+	}
+
+	return data, nil
+}
+
+func (s *SessionRegistry) List(ctx context.Context, userId uuid.UUID, currentSession string) ([]SessionInfo, error) {
+
+	ids, err := s.RedisClient.SMembers(ctx, userSessionsKey(userId)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := make([]SessionInfo, 0, len(ids))
+
+	for _, id := range ids {
+		data, err := s.Get(ctx, id)
+
+		// session udah expire tapi id nya masih nyangkut di set
+		if err == redis.Nil {
+			s.RedisClient.SRem(ctx, userSessionsKey(userId), id)
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		createdAt, _ := time.Parse(time.RFC3339, data.CreatedAt)
+		lastUsedAt, _ := time.Parse(time.RFC3339, data.LastUsedAt)
+		expiresAt, _ := time.Parse(time.RFC3339, data.ExpiresAt)
+
+		sessions = append(sessions, SessionInfo{
+			Id:         id,
+			UserAgent:  data.UserAgent,
+			Ip:         data.Ip,
+			CreatedAt:  createdAt,
+			LastUsedAt: lastUsedAt,
+			ExpiresAt:  expiresAt,
+			Current:    id == currentSession,
+		})
+	}
+
+	return sessions, nil
+}
+
+// balikin false kalo session nya bukan punya user ini atau udah ga ada
+func (s *SessionRegistry) Revoke(ctx context.Context, userId uuid.UUID, sessionId string) (bool, error) {
+
+	data, err := s.Get(ctx, sessionId)
+	if err == redis.Nil {
+		s.RedisClient.SRem(ctx, userSessionsKey(userId), sessionId)
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	if data.UserId != userId.String() {
+		return false, nil
+	}
+
+	pipe := s.RedisClient.TxPipeline()
+	pipe.Del(ctx, sessionKey(sessionId))
+	pipe.SRem(ctx, userSessionsKey(userId), sessionId)
+
+	_, err = pipe.Exec(ctx)
+
+	return err == nil, err
+}
+
+func (s *SessionRegistry) RevokeAll(ctx context.Context, userId uuid.UUID) error {
+
+	ids, err := s.RedisClient.SMembers(ctx, userSessionsKey(userId)).Result()
+	if err != nil {
+		return err
+	}
+
+	pipe := s.RedisClient.TxPipeline()
+
+	for _, id := range ids {
+		pipe.Del(ctx, sessionKey(id))
+	}
+	pipe.Del(ctx, userSessionsKey(userId))
+
+	_, err = pipe.Exec(ctx)
+
+	return err
+}
+
+// ganti refresh token session, token lama ditandain consumed sampe umurnya habis.
+// pake WATCH biar 2 refresh barengan pake token yang sama ga dua duanya lolos
+func (s *SessionRegistry) Rotate(
+	ctx context.Context,
+	sessionId string,
+	oldToken string,
+	oldClaims *pkg.RefreshTokenClaims,
+	newToken string,
+	newExpiresAt time.Time,
+) error {
+
+	key := sessionKey(sessionId)
+	oldHash := pkg.HashToken(oldToken)
+
+	return s.RedisClient.Watch(ctx, func(tx *redis.Tx) error {
+
+		current, err := tx.HGet(ctx, key, "refresh_token").Result()
+		if err != nil {
+			return err
+		}
+
+		if current != oldHash {
+			return ErrRefreshTokenReused
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.HSet(ctx, key, map[string]any{
+				"refresh_token": pkg.HashToken(newToken),
+				"last_used_at":  time.Now().Format(time.RFC3339),
+				"expires_at":    newExpiresAt.Format(time.RFC3339),
+			})
+			pipe.Expire(ctx, key, time.Until(newExpiresAt))
+
+			if ttl := time.Until(oldClaims.ExpiresAt.Time); ttl > 0 {
+				pipe.Set(ctx, consumedRefreshKey(oldClaims, oldToken), sessionId, ttl)
+			}
+
+			return nil
+		})
+
+		return err
+
+	}, key)
+}
+
+func (s *SessionRegistry) IsConsumed(ctx context.Context, refreshToken string, claims *pkg.RefreshTokenClaims) (bool, error) {
+
+	n, err := s.RedisClient.Exists(ctx, consumedRefreshKey(claims, refreshToken)).Result()
+	if err != nil {
+		return false, err
+	}
+
+	return n > 0, nil
+}
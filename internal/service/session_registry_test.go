@@ -0,0 +1,283 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Agmer17/golang_yapping/internal/model"
+	"github.com/Agmer17/golang_yapping/pkg"
+	"github.com/Agmer17/golang_yapping/pkg/customerrors"
+	"github.com/google/uuid"
+)
+
+type testLogin struct {
+	accessToken  string
+	refreshToken string
+	sessionId    string
+}
+
+func loginAs(t *testing.T, auth *AuthService, user *model.User, meta SessionMeta) testLogin {
+	t.Helper()
+
+	resp, svcErr := auth.issueSession(user, meta, context.Background())
+	if svcErr != nil {
+		t.Fatal(svcErr.Message)
+	}
+
+	login := testLogin{
+		accessToken:  resp["accessToken"].(string),
+		refreshToken: resp["refreshToken"].(string),
+	}
+
+	claims, err := pkg.VerifyToken(login.accessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	login.sessionId = claims.SessionId
+
+	return login
+}
+
+func accessRevoked(t *testing.T, auth *AuthService, accessToken string) bool {
+	t.Helper()
+
+	claims, err := pkg.VerifyToken(accessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	revoked, err := auth.Revocation.IsRevoked(context.Background(), claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return revoked
+}
+
+func TestSessionListAndRevoke(t *testing.T) {
+
+	user := &model.User{Id: uuid.New(), Role: "USER"}
+	other := &model.User{Id: uuid.New(), Role: "USER"}
+	auth, _ := newTestAuthService(t, user, other)
+	ctx := context.Background()
+
+	laptop := loginAs(t, auth, user, SessionMeta{UserAgent: "laptop", Ip: "10.0.0.1"})
+	phone := loginAs(t, auth, user, SessionMeta{UserAgent: "hp", Ip: "10.0.0.2"})
+	otherLogin := loginAs(t, auth, other, SessionMeta{UserAgent: "lain"})
+
+	sessions, svcErr := auth.GetSessions(user.Id, laptop.sessionId, ctx)
+	if svcErr != nil {
+		t.Fatal(svcErr.Message)
+	}
+
+	if len(sessions) != 2 {
+		t.Fatalf("jumlah sesi %d, harusnya 2", len(sessions))
+	}
+
+	for _, s := range sessions {
+		if s.Current != (s.Id == laptop.sessionId) {
+			t.Errorf("sesi %s (%s) current=%v", s.Id, s.UserAgent, s.Current)
+		}
+	}
+
+	// sesi user lain ga bisa dihapus
+	if svcErr := auth.RevokeSession(user.Id, otherLogin.sessionId, ctx); svcErr == nil || svcErr.Code != http.StatusNotFound {
+		t.Fatalf("hapus sesi user lain harusnya 404, dapet %v", svcErr)
+	}
+
+	if accessRevoked(t, auth, otherLogin.accessToken) {
+		t.Fatal("sesi user lain ga boleh ikut kehapus")
+	}
+
+	if svcErr := auth.RevokeSession(user.Id, phone.sessionId, ctx); svcErr != nil {
+		t.Fatal(svcErr.Message)
+	}
+
+	// access token dari sesi yang dihapus langsung ga berlaku, sesi lain tetep jalan
+	if !accessRevoked(t, auth, phone.accessToken) {
+		t.Error("access token sesi yang dihapus harusnya ikut dicabut")
+	}
+
+	if accessRevoked(t, auth, laptop.accessToken) {
+		t.Error("sesi lain ga boleh ikut dicabut")
+	}
+
+	if _, svcErr := auth.RefreshSession(phone.refreshToken, ctx); svcErr == nil || svcErr.Code != http.StatusUnauthorized {
+		t.Fatalf("refresh token sesi yang dihapus harusnya ditolak, dapet %v", svcErr)
+	}
+
+	if sessions, _ := auth.GetSessions(user.Id, "", ctx); len(sessions) != 1 || sessions[0].Id != laptop.sessionId {
+		t.Fatalf("sisa sesi nya %+v", sessions)
+	}
+}
+
+func TestSessionLogoutAndLogoutAll(t *testing.T) {
+
+	user := &model.User{Id: uuid.New(), Role: "USER"}
+	auth, _ := newTestAuthService(t, user)
+	ctx := context.Background()
+
+	first := loginAs(t, auth, user, SessionMeta{UserAgent: "laptop"})
+	second := loginAs(t, auth, user, SessionMeta{UserAgent: "hp"})
+	third := loginAs(t, auth, user, SessionMeta{UserAgent: "tablet"})
+
+	if svcErr := auth.Logout(first.refreshToken, first.accessToken, ctx); svcErr != nil {
+		t.Fatal(svcErr.Message)
+	}
+
+	if !accessRevoked(t, auth, first.accessToken) {
+		t.Error("access token yang logout harusnya dicabut")
+	}
+
+	// logout kedua kali pake token yang sama tetep dianggap berhasil
+	if svcErr := auth.Logout(first.refreshToken, "", ctx); svcErr != nil {
+		t.Fatalf("logout ulang harusnya ga error, dapet %s", svcErr.Message)
+	}
+
+	if accessRevoked(t, auth, second.accessToken) {
+		t.Fatal("logout satu sesi ga boleh ngaruh ke sesi lain")
+	}
+
+	if svcErr := auth.LogoutAll(user.Id, ctx); svcErr != nil {
+		t.Fatal(svcErr.Message)
+	}
+
+	for _, login := range []testLogin{second, third} {
+		if !accessRevoked(t, auth, login.accessToken) {
+			t.Error("logout-all harusnya nyabut semua access token")
+		}
+
+		if _, svcErr := auth.RefreshSession(login.refreshToken, ctx); svcErr == nil {
+			t.Error("logout-all harusnya nyabut semua refresh token")
+		}
+	}
+
+	if sessions, _ := auth.GetSessions(user.Id, "", ctx); len(sessions) != 0 {
+		t.Errorf("masih ada sesi setelah logout-all : %+v", sessions)
+	}
+}
+
+func TestSessionListPrunesExpired(t *testing.T) {
+
+	user := &model.User{Id: uuid.New(), Role: "USER"}
+	auth, mr := newTestAuthService(t, user)
+	ctx := context.Background()
+
+	// sesi yang expire duluan, id nya masih nyangkut di user_sessions
+	if err := auth.Sessions.Create(ctx, "sesi-lama", user.Id, "token-lama", time.Now().Add(time.Minute), SessionMeta{}); err != nil {
+		t.Fatal(err)
+	}
+
+	live := loginAs(t, auth, user, SessionMeta{})
+
+	mr.FastForward(2 * time.Minute)
+
+	sessions, svcErr := auth.GetSessions(user.Id, "", ctx)
+	if svcErr != nil {
+		t.Fatal(svcErr.Message)
+	}
+
+	if len(sessions) != 1 || sessions[0].Id != live.sessionId {
+		t.Fatalf("sesi yang udah expire harusnya ga ikut, dapet %+v", sessions)
+	}
+
+	if ok, _ := mr.SIsMember(userSessionsKey(user.Id), "sesi-lama"); ok {
+		t.Error("id sesi yang udah expire harusnya dihapus dari set")
+	}
+}
+
+func TestRefreshRotationAndReuseRevokesFamily(t *testing.T) {
+
+	user := &model.User{Id: uuid.New(), Role: "USER"}
+	auth, _ := newTestAuthService(t, user)
+	ctx := context.Background()
+
+	login := loginAs(t, auth, user, SessionMeta{UserAgent: "laptop"})
+	otherDevice := loginAs(t, auth, user, SessionMeta{UserAgent: "hp"})
+
+	resp, svcErr := auth.RefreshSession(login.refreshToken, ctx)
+	if svcErr != nil {
+		t.Fatal(svcErr.Message)
+	}
+
+	rotated := resp["refreshToken"].(string)
+	if rotated == login.refreshToken {
+		t.Fatal("refresh token nya harusnya diganti")
+	}
+
+	// token hasil rotasi masih satu session sama yang lama
+	claims, err := pkg.VerifyToken(resp["accessToken"].(string))
+	if err != nil || claims.SessionId != login.sessionId {
+		t.Fatalf("session id nya berubah : %v %v", claims, err)
+	}
+
+	resp, svcErr = auth.RefreshSession(rotated, ctx)
+	if svcErr != nil {
+		t.Fatalf("token hasil rotasi harusnya bisa dipake : %s", svcErr.Message)
+	}
+	latest := resp["refreshToken"].(string)
+
+	// token yang udah di rotate dipake lagi, anggap bocor dan satu family nya dimatiin
+	_, svcErr = auth.RefreshSession(login.refreshToken, ctx)
+	if svcErr == nil || svcErr.Code != http.StatusUnauthorized {
+		t.Fatalf("token lama harusnya ditolak, dapet %v", svcErr)
+	}
+
+	if _, svcErr := auth.RefreshSession(latest, ctx); svcErr == nil {
+		t.Fatal("token terbaru di family yang sama harusnya ikut dicabut")
+	}
+
+	if !accessRevoked(t, auth, login.accessToken) {
+		t.Error("access token session nya harusnya ikut dicabut")
+	}
+
+	// session di perangkat lain ga kena
+	if _, svcErr := auth.RefreshSession(otherDevice.refreshToken, ctx); svcErr != nil {
+		t.Fatalf("session lain harusnya tetep jalan : %s", svcErr.Message)
+	}
+}
+
+func TestRefreshConcurrentOnlyOneWins(t *testing.T) {
+
+	user := &model.User{Id: uuid.New(), Role: "USER"}
+	auth, _ := newTestAuthService(t, user)
+
+	login := loginAs(t, auth, user, SessionMeta{})
+
+	const attempts = 8
+
+	var wg sync.WaitGroup
+	results := make(chan *customerrors.ServiceErrors, attempts)
+
+	for range attempts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, svcErr := auth.RefreshSession(login.refreshToken, context.Background())
+			results <- svcErr
+		}()
+	}
+
+	wg.Wait()
+	close(results)
+
+	wins := 0
+	for svcErr := range results {
+		if svcErr == nil {
+			wins++
+			continue
+		}
+
+		if svcErr.Code != http.StatusUnauthorized && svcErr.Code != http.StatusConflict {
+			t.Errorf("refresh yang kalah harusnya 401 / 409, dapet %d %s", svcErr.Code, svcErr.Message)
+		}
+	}
+
+	if wins != 1 {
+		t.Fatalf("refresh barengan pake token yang sama lolos %d kali, harusnya sekali", wins)
+	}
+}
@@ -0,0 +1,108 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Agmer17/golang_yapping/internal/event"
+	"github.com/Agmer17/golang_yapping/internal/model"
+	"github.com/Agmer17/golang_yapping/pkg"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/redis/go-redis/v9"
+)
+
+// redis in-memory, ditutup otomatis pas test nya selesai
+func newTestRedis(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+
+	return mr, rdb
+}
+
+// user repo in-memory, cuma method yang dipake service yang beneran diisi
+type fakeUserRepo struct {
+	users map[uuid.UUID]*model.User
+}
+
+func newFakeUserRepo(users ...*model.User) *fakeUserRepo {
+	r := &fakeUserRepo{users: make(map[uuid.UUID]*model.User)}
+	for _, u := range users {
+		r.users[u.Id] = u
+	}
+	return r
+}
+
+func (r *fakeUserRepo) GetUserDataByUsername(username string, c context.Context) (*model.User, error) {
+	for _, u := range r.users {
+		if u.Username == username {
+			return u, nil
+		}
+	}
+	return nil, pgx.ErrNoRows
+}
+
+func (r *fakeUserRepo) GetUserDataById(id uuid.UUID, c context.Context) (*model.User, error) {
+	if u, ok := r.users[id]; ok {
+		return u, nil
+	}
+	return nil, pgx.ErrNoRows
+}
+
+func (r *fakeUserRepo) GetUserDataByEmail(email string, c context.Context) (*model.User, error) {
+	for _, u := range r.users {
+		if u.Email == email {
+			return u, nil
+		}
+	}
+	return nil, pgx.ErrNoRows
+}
+
+func (r *fakeUserRepo) AddUser(user model.User, c context.Context) (model.User, error) {
+	user.Id = uuid.New()
+	r.users[user.Id] = &user
+	return user, nil
+}
+
+func (r *fakeUserRepo) DeleteUser(id uuid.UUID, c context.Context) error {
+	delete(r.users, id)
+	return nil
+}
+
+func (r *fakeUserRepo) EditUser(e model.User, c context.Context) (model.User, error) {
+	r.users[e.Id] = &e
+	return e, nil
+}
+
+func (r *fakeUserRepo) ExistByNameOrUsername(username string, email string, c context.Context) (bool, error) {
+	for _, u := range r.users {
+		if u.Username == username || (email != "" && u.Email == email) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// AuthService lengkap di atas redis in-memory, 2FA nya ga aktif
+func newTestAuthService(t *testing.T, users ...*model.User) (*AuthService, *miniredis.Miniredis) {
+	t.Helper()
+
+	pkg.JwtInit("auth-test-secret")
+
+	mr, rdb := newTestRedis(t)
+
+	return &AuthService{
+		UserRepo:    newFakeUserRepo(users...),
+		RedisClient: rdb,
+		bus:         event.NewEventBus(nil, context.Background(), nil),
+		Sessions:    NewSessionRegistry(rdb),
+		Revocation:  NewTokenRevocation(rdb),
+		twoFactor:   &TwoFactorService{Repo: &fakeTwoFactorRepo{}},
+		guard:       NewLoginGuard(rdb),
+	}, mr
+}
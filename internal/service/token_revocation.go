@@ -0,0 +1,106 @@
+package service
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/Agmer17/golang_yapping/pkg"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// umur access token paling lama, dipake buat TTL watermark per user
+const maxAccessTokenLifetime = 15 * time.Minute
+
+type TokenRevocationInterface interface {
+	Revoke(ctx context.Context, claims *pkg.Claims) error
+	RevokeAllBefore(ctx context.Context, userId uuid.UUID, t time.Time) error
+	IsRevoked(ctx context.Context, claims *pkg.Claims) (bool, error)
+}
+
+// key di redis :
+//
+//	token_denylist:<jti>          -> access token yang dicabut satu per satu
+//	token_watermark:<userId>      -> unix milli, token yang iat_ms nya sebelum / sama dengan ini dianggap ga valid
+//
+// selain itu access token yang punya sid juga ikut mati kalo session:<sid> nya udah dihapus
+type TokenRevocation struct {
+	RedisClient *redis.Client
+}
+
+func NewTokenRevocation(r *redis.Client) *TokenRevocation {
+	return &TokenRevocation{
+		RedisClient: r,
+	}
+}
+
+func denylistKey(jti string) string {
+	return "token_denylist:" + jti
+}
+
+func watermarkKey(userId uuid.UUID) string {
+	return "token_watermark:" + userId.String()
+}
+
+func (t *TokenRevocation) Revoke(ctx context.Context, claims *pkg.Claims) error {
+
+	if claims.ID == "" || claims.ExpiresAt == nil {
+		return nil
+	}
+
+	ttl := time.Until(claims.ExpiresAt.Time)
+	if ttl <= 0 {
+		return nil
+	}
+
+	return t.RedisClient.Set(ctx, denylistKey(claims.ID), 1, ttl).Err()
+}
+
+// dipake kalo role berubah, user di ban, atau password di reset
+func (t *TokenRevocation) RevokeAllBefore(ctx context.Context, userId uuid.UUID, before time.Time) error {
+	return t.RedisClient.Set(ctx, watermarkKey(userId), before.UnixMilli(), maxAccessTokenLifetime).Err()
+}
+
+func (t *TokenRevocation) IsRevoked(ctx context.Context, claims *pkg.Claims) (bool, error) {
+
+	pipe := t.RedisClient.Pipeline()
+
+	var denied *redis.IntCmd
+	if claims.ID != "" {
+		denied = pipe.Exists(ctx, denylistKey(claims.ID))
+	}
+
+	var sessionAlive *redis.IntCmd
+	if claims.SessionId != "" {
+		sessionAlive = pipe.Exists(ctx, sessionKey(claims.SessionId))
+	}
+
+	watermark := pipe.Get(ctx, watermarkKey(claims.UserID))
+
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return false, err
+	}
+
+	if denied != nil && denied.Val() > 0 {
+		return true, nil
+	}
+
+	if sessionAlive != nil && sessionAlive.Val() == 0 {
+		return true, nil
+	}
+
+	if wm, err := watermark.Result(); err == nil {
+		before, err := strconv.ParseInt(wm, 10, 64)
+		if err != nil {
+			return false, err
+		}
+
+		// token tanpa iat_ms ga bisa dibandingin, umurnya paling lama sama kayak watermark nya jadi ikut dicabut aja
+		if claims.IssuedAtMs == 0 || claims.IssuedAtMs <= before {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Agmer17/golang_yapping/pkg"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func testAccessClaims(userId uuid.UUID, issuedAt time.Time) *pkg.Claims {
+	return &pkg.Claims{
+		UserID:     userId,
+		IssuedAtMs: issuedAt.UnixMilli(),
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			IssuedAt:  jwt.NewNumericDate(issuedAt),
+			ExpiresAt: jwt.NewNumericDate(issuedAt.Add(10 * time.Minute)),
+		},
+	}
+}
+
+func TestRevokeAllBeforeSameSecondLogin(t *testing.T) {
+
+	_, rdb := newTestRedis(t)
+	revocation := NewTokenRevocation(rdb)
+	ctx := context.Background()
+
+	userId := uuid.New()
+
+	// logout-all di tengah detik, login ulang nya masih di detik yang sama
+	logoutAt := time.Now().Truncate(time.Second).Add(400 * time.Millisecond)
+	before := testAccessClaims(userId, logoutAt.Add(-300*time.Millisecond))
+	after := testAccessClaims(userId, logoutAt.Add(100*time.Millisecond))
+
+	if err := revocation.RevokeAllBefore(ctx, userId, logoutAt); err != nil {
+		t.Fatal(err)
+	}
+
+	if revoked, err := revocation.IsRevoked(ctx, before); err != nil || !revoked {
+		t.Fatalf("token sebelum logout-all harusnya dicabut, revoked=%v err=%v", revoked, err)
+	}
+
+	if revoked, err := revocation.IsRevoked(ctx, after); err != nil || revoked {
+		t.Fatalf("login setelah logout-all di detik yang sama harusnya tetep valid, revoked=%v err=%v", revoked, err)
+	}
+
+	// token tanpa iat_ms ga bisa dibandingin, dianggap dicabut
+	legacy := testAccessClaims(userId, logoutAt.Add(time.Second))
+	legacy.IssuedAtMs = 0
+
+	if revoked, _ := revocation.IsRevoked(ctx, legacy); !revoked {
+		t.Error("token tanpa iat_ms harusnya ikut dicabut selama watermark nya masih ada")
+	}
+
+	// user lain ga kena watermark nya
+	if revoked, _ := revocation.IsRevoked(ctx, testAccessClaims(uuid.New(), logoutAt.Add(-time.Minute))); revoked {
+		t.Error("watermark user lain ga boleh ngaruh")
+	}
+}
+
+func TestRevokeSingleToken(t *testing.T) {
+
+	_, rdb := newTestRedis(t)
+	revocation := NewTokenRevocation(rdb)
+	ctx := context.Background()
+
+	userId := uuid.New()
+	revokedToken := testAccessClaims(userId, time.Now())
+	otherToken := testAccessClaims(userId, time.Now())
+
+	if err := revocation.Revoke(ctx, revokedToken); err != nil {
+		t.Fatal(err)
+	}
+
+	if revoked, _ := revocation.IsRevoked(ctx, revokedToken); !revoked {
+		t.Error("token yang di revoke harusnya dicabut")
+	}
+
+	if revoked, _ := revocation.IsRevoked(ctx, otherToken); revoked {
+		t.Error("token lain user yang sama ga boleh ikut dicabut")
+	}
+}
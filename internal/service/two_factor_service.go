@@ -0,0 +1,290 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Agmer17/golang_yapping/internal/repository"
+	"github.com/Agmer17/golang_yapping/pkg"
+	"github.com/Agmer17/golang_yapping/pkg/customerrors"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	totpIssuer        = "Yapping"
+	totpSkew          = 1
+	recoveryCodeCount = 10
+)
+
+var totpCodePattern = regexp.MustCompile(`^[0-9]{6}$`)
+
+type TwoFactorSetup struct {
+	Secret     string `json:"secret"`
+	OtpauthURI string `json:"otpauth_uri"`
+}
+
+type TwoFactorServiceInterface interface {
+	BeginEnrollment(ctx context.Context, userId uuid.UUID) (TwoFactorSetup, *customerrors.ServiceErrors)
+	ConfirmEnrollment(ctx context.Context, userId uuid.UUID, code string) ([]string, *customerrors.ServiceErrors)
+	Disable(ctx context.Context, userId uuid.UUID, code string) *customerrors.ServiceErrors
+	RegenerateRecoveryCodes(ctx context.Context, userId uuid.UUID, code string) ([]string, *customerrors.ServiceErrors)
+	IsEnabled(ctx context.Context, userId uuid.UUID) (bool, *customerrors.ServiceErrors)
+	VerifyCode(ctx context.Context, userId uuid.UUID, code string) *customerrors.ServiceErrors
+}
+
+type TwoFactorService struct {
+	Repo        repository.TwoFactorRepoInterface
+	UserRepo    repository.UserRepositoryInterface
+	RedisClient *redis.Client
+
+	// secret TOTP di db disimpen terenkripsi pake key server
+	Secrets *pkg.SecretBox
+
+	// diganti pas testing biar kode TOTP nya bisa ditebak
+	Now func() time.Time
+}
+
+func NewTwoFactorService(repo *repository.TwoFactorRepo, userRepo *repository.UserRepository, r *redis.Client, secrets *pkg.SecretBox) *TwoFactorService {
+	return &TwoFactorService{
+		Repo:        repo,
+		UserRepo:    userRepo,
+		RedisClient: r,
+		Secrets:     secrets,
+		Now:         time.Now,
+	}
+}
+
+func (svc *TwoFactorService) BeginEnrollment(ctx context.Context, userId uuid.UUID) (TwoFactorSetup, *customerrors.ServiceErrors) {
+
+	user, err := svc.UserRepo.GetUserDataById(userId, ctx)
+	if err != nil {
+		return TwoFactorSetup{}, customerrors.New(http.StatusInternalServerError, "Terjadi kesalahan di server : "+err.Error())
+	}
+
+	secret, err := pkg.GenerateTotpSecret()
+	if err != nil {
+		return TwoFactorSetup{}, customerrors.New(http.StatusInternalServerError, "Terjadi kesalahan di server : "+err.Error())
+	}
+
+	sealed, err := svc.Secrets.Seal(secret)
+	if err != nil {
+		return TwoFactorSetup{}, customerrors.New(http.StatusInternalServerError, "Terjadi kesalahan di server : "+err.Error())
+	}
+
+	err = svc.Repo.SetPendingSecret(ctx, userId, sealed)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return TwoFactorSetup{}, customerrors.New(http.StatusConflict, "2FA sudah aktif di akun kamu")
+	}
+
+	if err != nil {
+		return TwoFactorSetup{}, customerrors.New(http.StatusInternalServerError, "Terjadi kesalahan di server : "+err.Error())
+	}
+
+	return TwoFactorSetup{
+		Secret:     secret,
+		OtpauthURI: pkg.TotpAuthURI(totpIssuer, user.Username, secret),
+	}, nil
+}
+
+// recovery code mentah cuma dibalikin sekali di sini, di db cuma disimpen hash nya
+func (svc *TwoFactorService) ConfirmEnrollment(ctx context.Context, userId uuid.UUID, code string) ([]string, *customerrors.ServiceErrors) {
+
+	tf, err := svc.Repo.GetTwoFactor(ctx, userId)
+	if err != nil {
+		return nil, customerrors.New(http.StatusInternalServerError, "Terjadi kesalahan di server : "+err.Error())
+	}
+
+	if tf.Enabled {
+		return nil, customerrors.New(http.StatusConflict, "2FA sudah aktif di akun kamu")
+	}
+
+	if tf.Secret == nil {
+		return nil, customerrors.New(http.StatusBadRequest, "Mulai setup 2FA terlebih dahulu")
+	}
+
+	secret, svcErr := svc.openSecret(ctx, userId, *tf.Secret)
+	if svcErr != nil {
+		return nil, svcErr
+	}
+
+	if svcErr := svc.verifyTotp(ctx, userId, secret, code); svcErr != nil {
+		return nil, svcErr
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, customerrors.New(http.StatusInternalServerError, "Terjadi kesalahan di server : "+err.Error())
+	}
+
+	if err := svc.Repo.Enable(ctx, userId, hashes); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, customerrors.New(http.StatusConflict, "2FA sudah aktif di akun kamu")
+		}
+
+		return nil, customerrors.New(http.StatusInternalServerError, "Gagal mengaktifkan 2FA : "+err.Error())
+	}
+
+	return codes, nil
+}
+
+func (svc *TwoFactorService) Disable(ctx context.Context, userId uuid.UUID, code string) *customerrors.ServiceErrors {
+
+	if svcErr := svc.VerifyCode(ctx, userId, code); svcErr != nil {
+		return svcErr
+	}
+
+	if err := svc.Repo.Disable(ctx, userId); err != nil {
+		return customerrors.New(http.StatusInternalServerError, "Gagal menonaktifkan 2FA : "+err.Error())
+	}
+
+	return nil
+}
+
+func (svc *TwoFactorService) RegenerateRecoveryCodes(ctx context.Context, userId uuid.UUID, code string) ([]string, *customerrors.ServiceErrors) {
+
+	if svcErr := svc.VerifyCode(ctx, userId, code); svcErr != nil {
+		return nil, svcErr
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, customerrors.New(http.StatusInternalServerError, "Terjadi kesalahan di server : "+err.Error())
+	}
+
+	if err := svc.Repo.ReplaceRecoveryCodes(ctx, userId, hashes); err != nil {
+		return nil, customerrors.New(http.StatusInternalServerError, "Gagal membuat recovery code : "+err.Error())
+	}
+
+	return codes, nil
+}
+
+func (svc *TwoFactorService) IsEnabled(ctx context.Context, userId uuid.UUID) (bool, *customerrors.ServiceErrors) {
+
+	tf, err := svc.Repo.GetTwoFactor(ctx, userId)
+	if err != nil {
+		return false, customerrors.New(http.StatusInternalServerError, "Terjadi kesalahan di server : "+err.Error())
+	}
+
+	return tf.Enabled, nil
+}
+
+// code bisa kode TOTP 6 digit atau salah satu recovery code
+func (svc *TwoFactorService) VerifyCode(ctx context.Context, userId uuid.UUID, code string) *customerrors.ServiceErrors {
+
+	tf, err := svc.Repo.GetTwoFactor(ctx, userId)
+	if err != nil {
+		return customerrors.New(http.StatusInternalServerError, "Terjadi kesalahan di server : "+err.Error())
+	}
+
+	if !tf.Enabled || tf.Secret == nil {
+		return customerrors.New(http.StatusBadRequest, "2FA belum aktif di akun kamu")
+	}
+
+	code = strings.TrimSpace(code)
+
+	if totpCodePattern.MatchString(code) {
+		secret, svcErr := svc.openSecret(ctx, userId, *tf.Secret)
+		if svcErr != nil {
+			return svcErr
+		}
+
+		return svc.verifyTotp(ctx, userId, secret, code)
+	}
+
+	err = svc.Repo.UseRecoveryCode(ctx, userId, pkg.HashToken(normalizeRecoveryCode(code)))
+	if errors.Is(err, repository.ErrRecoveryCodeInvalid) {
+		return customerrors.New(http.StatusUnauthorized, "kode 2FA salah")
+	}
+
+	if err != nil {
+		return customerrors.New(http.StatusInternalServerError, "Terjadi kesalahan di server : "+err.Error())
+	}
+
+	return nil
+}
+
+// secret yang masih plaintext (disimpen sebelum ada enkripsi) langsung dienkripsi ulang pas dibaca
+func (svc *TwoFactorService) openSecret(ctx context.Context, userId uuid.UUID, stored string) (string, *customerrors.ServiceErrors) {
+
+	secret, legacy, err := svc.Secrets.Open(stored)
+	if err != nil {
+		return "", customerrors.New(http.StatusInternalServerError, "Terjadi kesalahan di server : "+err.Error())
+	}
+
+	if !legacy {
+		return secret, nil
+	}
+
+	sealed, err := svc.Secrets.Seal(secret)
+	if err == nil {
+		err = svc.Repo.ReplaceSecret(ctx, userId, stored, sealed)
+	}
+
+	// gagal nya ga ngeblok verifikasi, bakal dicoba lagi pas secret nya dibaca berikutnya
+	if err != nil {
+		log.Printf("gagal mengenkripsi ulang secret TOTP user %s : %v", userId, err)
+	}
+
+	return secret, nil
+}
+
+// satu kode TOTP cuma boleh dipake sekali selama masih di dalam window nya
+func (svc *TwoFactorService) verifyTotp(ctx context.Context, userId uuid.UUID, secret string, code string) *customerrors.ServiceErrors {
+
+	step, ok := pkg.VerifyTotp(secret, code, svc.Now(), totpSkew)
+	if !ok {
+		return customerrors.New(http.StatusUnauthorized, "kode 2FA salah")
+	}
+
+	key := "totp_used:" + userId.String() + ":" + strconv.FormatInt(step, 10)
+	window := time.Duration(2*totpSkew+1) * pkg.TotpPeriod * time.Second
+
+	fresh, err := svc.RedisClient.SetNX(ctx, key, 1, window).Result()
+	if err != nil {
+		return customerrors.New(http.StatusInternalServerError, "Terjadi kesalahan di server : "+err.Error())
+	}
+
+	if !fresh {
+		return customerrors.New(http.StatusUnauthorized, "kode 2FA sudah digunakan, tunggu kode berikutnya")
+	}
+
+	return nil
+}
+
+func generateRecoveryCodes() ([]string, []string, error) {
+
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+
+	for i := 0; i < recoveryCodeCount; i++ {
+		raw, err := pkg.GenerateTotpSecret()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		code := strings.ToLower(raw[:5] + "-" + raw[5:10])
+
+		codes = append(codes, code)
+		hashes = append(hashes, pkg.HashToken(code))
+	}
+
+	return codes, hashes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.ReplaceAll(code, " ", ""))
+
+	if len(code) == 10 && !strings.Contains(code, "-") {
+		code = code[:5] + "-" + code[5:]
+	}
+
+	return code
+}
@@ -0,0 +1,397 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Agmer17/golang_yapping/internal/event"
+	"github.com/Agmer17/golang_yapping/internal/model"
+	"github.com/Agmer17/golang_yapping/internal/repository"
+	"github.com/Agmer17/golang_yapping/pkg"
+	"github.com/google/uuid"
+)
+
+type fakeTwoFactorRepo struct {
+	tf       model.TwoFactor
+	recovery map[string]bool
+}
+
+func (r *fakeTwoFactorRepo) GetTwoFactor(ctx context.Context, userId uuid.UUID) (model.TwoFactor, error) {
+	return r.tf, nil
+}
+
+func (r *fakeTwoFactorRepo) SetPendingSecret(ctx context.Context, userId uuid.UUID, secret string) error {
+	r.tf.Secret = &secret
+	return nil
+}
+
+func (r *fakeTwoFactorRepo) Enable(ctx context.Context, userId uuid.UUID, recoveryHashes []string) error {
+	r.tf.Enabled = true
+	return r.ReplaceRecoveryCodes(ctx, userId, recoveryHashes)
+}
+
+func (r *fakeTwoFactorRepo) Disable(ctx context.Context, userId uuid.UUID) error {
+	r.tf.Enabled = false
+	r.tf.Secret = nil
+	return nil
+}
+
+func (r *fakeTwoFactorRepo) ReplaceRecoveryCodes(ctx context.Context, userId uuid.UUID, recoveryHashes []string) error {
+	r.recovery = make(map[string]bool)
+	for _, h := range recoveryHashes {
+		r.recovery[h] = true
+	}
+	return nil
+}
+
+func (r *fakeTwoFactorRepo) ReplaceSecret(ctx context.Context, userId uuid.UUID, oldSecret string, newSecret string) error {
+	if r.tf.Secret != nil && *r.tf.Secret == oldSecret {
+		r.tf.Secret = &newSecret
+	}
+	return nil
+}
+
+func (r *fakeTwoFactorRepo) UseRecoveryCode(ctx context.Context, userId uuid.UUID, codeHash string) error {
+	if !r.recovery[codeHash] {
+		return repository.ErrRecoveryCodeInvalid
+	}
+
+	delete(r.recovery, codeHash)
+	return nil
+}
+
+func newTestSecretBox(t *testing.T) *pkg.SecretBox {
+	t.Helper()
+
+	box, err := pkg.NewSecretBox(base64.StdEncoding.EncodeToString(make([]byte, 32)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return box
+}
+
+// 2FA udah aktif pake secret RFC 6238, jam nya di fix ke waktu yang dikasih
+func newTestTwoFactorService(t *testing.T, now time.Time) (*TwoFactorService, *fakeTwoFactorRepo, string) {
+	t.Helper()
+
+	_, rdb := newTestRedis(t)
+
+	box := newTestSecretBox(t)
+
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	sealed, err := box.Seal(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repo := &fakeTwoFactorRepo{
+		tf: model.TwoFactor{Secret: &sealed, Enabled: true},
+	}
+
+	svc := &TwoFactorService{
+		Repo:        repo,
+		RedisClient: rdb,
+		Secrets:     box,
+		Now:         func() time.Time { return now },
+	}
+
+	return svc, repo, secret
+}
+
+func totpAt(t *testing.T, secret string, at time.Time) string {
+	t.Helper()
+
+	code, err := pkg.TotpCodeAt(secret, pkg.TotpStep(at))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return code
+}
+
+func TestTwoFactorVerifyCodeWindow(t *testing.T) {
+
+	now := time.Unix(1111111111, 0)
+	period := pkg.TotpPeriod * time.Second
+
+	cases := []struct {
+		name string
+		at   time.Time
+		ok   bool
+	}{
+		{"step sekarang", now, true},
+		{"satu step sebelum", now.Add(-period), true},
+		{"satu step sesudah", now.Add(period), true},
+		{"dua step sebelum", now.Add(-2 * period), false},
+		{"dua step sesudah", now.Add(2 * period), false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			svc, _, secret := newTestTwoFactorService(t, now)
+
+			svcErr := svc.VerifyCode(context.Background(), uuid.New(), totpAt(t, secret, tc.at))
+			if tc.ok && svcErr != nil {
+				t.Fatalf("harusnya diterima, dapet %d %s", svcErr.Code, svcErr.Message)
+			}
+
+			if !tc.ok && (svcErr == nil || svcErr.Code != http.StatusUnauthorized) {
+				t.Fatalf("harusnya ditolak 401, dapet %v", svcErr)
+			}
+		})
+	}
+}
+
+func TestTwoFactorRejectsReplay(t *testing.T) {
+
+	now := time.Unix(1111111111, 0)
+	svc, _, secret := newTestTwoFactorService(t, now)
+	userId := uuid.New()
+	code := totpAt(t, secret, now)
+
+	if svcErr := svc.VerifyCode(context.Background(), userId, code); svcErr != nil {
+		t.Fatalf("pemakaian pertama harusnya diterima : %s", svcErr.Message)
+	}
+
+	svcErr := svc.VerifyCode(context.Background(), userId, code)
+	if svcErr == nil || svcErr.Code != http.StatusUnauthorized {
+		t.Fatalf("kode yang sama harusnya ditolak, dapet %v", svcErr)
+	}
+
+	// masih di dalam window, kode yang sama tetep ga boleh walaupun jam nya udah maju
+	svc.Now = func() time.Time { return now.Add(pkg.TotpPeriod * time.Second) }
+	if svcErr := svc.VerifyCode(context.Background(), userId, code); svcErr == nil {
+		t.Fatal("kode yang sama di step berikutnya harusnya tetep ditolak")
+	}
+
+	// user lain ga kena
+	if svcErr := svc.VerifyCode(context.Background(), uuid.New(), totpAt(t, secret, now.Add(pkg.TotpPeriod*time.Second))); svcErr != nil {
+		t.Fatalf("kode step berikutnya buat user lain harusnya diterima : %s", svcErr.Message)
+	}
+}
+
+func TestTwoFactorRecoveryCodeSingleUse(t *testing.T) {
+
+	svc, repo, _ := newTestTwoFactorService(t, time.Unix(1111111111, 0))
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo.ReplaceRecoveryCodes(context.Background(), uuid.Nil, hashes)
+
+	userId := uuid.New()
+
+	// spasi / huruf besar / tanpa strip tetep diterima
+	input := "  " + codes[0][:5] + codes[0][6:] + " "
+	if svcErr := svc.VerifyCode(context.Background(), userId, input); svcErr != nil {
+		t.Fatalf("recovery code harusnya diterima : %s", svcErr.Message)
+	}
+
+	svcErr := svc.VerifyCode(context.Background(), userId, codes[0])
+	if svcErr == nil || svcErr.Code != http.StatusUnauthorized {
+		t.Fatalf("recovery code yang udah dipake harusnya ditolak, dapet %v", svcErr)
+	}
+
+	if svcErr := svc.VerifyCode(context.Background(), userId, codes[1]); svcErr != nil {
+		t.Fatalf("recovery code lain harusnya masih bisa : %s", svcErr.Message)
+	}
+
+	if len(repo.recovery) != recoveryCodeCount-2 {
+		t.Fatalf("sisa recovery code %d, harusnya %d", len(repo.recovery), recoveryCodeCount-2)
+	}
+}
+
+// AuthService yang cuma punya bagian buat login 2FA, event AccountLocked nya dikirim ke channel
+func newTestTwoFactorAuth(t *testing.T, svc *TwoFactorService, users ...*model.User) (*AuthService, <-chan event.AccountLockedEvent) {
+	t.Helper()
+
+	locked := make(chan event.AccountLockedEvent, 4)
+
+	bus := event.NewEventBus(nil, context.Background(), nil)
+	bus.Subscribe(event.AccountLocked, func(ctx context.Context, payload interface{}) {
+		locked <- payload.(event.AccountLockedEvent)
+	})
+
+	return &AuthService{
+		UserRepo:    newFakeUserRepo(users...),
+		RedisClient: svc.RedisClient,
+		bus:         bus,
+		Sessions:    NewSessionRegistry(svc.RedisClient),
+		twoFactor:   svc,
+		guard:       NewLoginGuard(svc.RedisClient),
+	}, locked
+}
+
+func TestLoginChallengeAttemptLimit(t *testing.T) {
+
+	now := time.Unix(1111111111, 0)
+	svc, _, secret := newTestTwoFactorService(t, now)
+
+	user := &model.User{Id: uuid.New(), Username: "budi", Email: "budi@mail.com"}
+	auth, _ := newTestTwoFactorAuth(t, svc, user)
+
+	ctx := context.Background()
+
+	challenge, err := auth.createLoginChallenge(user.Id, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < loginChallengeMaxAttempts-1; i++ {
+		_, svcErr := auth.CompleteTwoFactorLogin(challenge, "000000", SessionMeta{}, ctx)
+		if svcErr == nil || svcErr.Message != "kode 2FA salah" {
+			t.Fatalf("percobaan %d : harusnya kode salah, dapet %v", i+1, svcErr)
+		}
+	}
+
+	// percobaan terakhir di challenge ini sekalian nyampe threshold lock user nya
+	_, svcErr := auth.CompleteTwoFactorLogin(challenge, "000000", SessionMeta{}, ctx)
+	if svcErr == nil || svcErr.Code != http.StatusTooManyRequests {
+		t.Fatalf("percobaan %d : harusnya udah di lock, dapet %v", loginChallengeMaxAttempts, svcErr)
+	}
+
+	// reset lock nya biar yang dicek cuma batas per challenge
+	if err := auth.guard.RegisterTwoFactorSuccess(ctx, user.Id); err != nil {
+		t.Fatal(err)
+	}
+
+	// kode yang bener pun udah ga diterima, challenge nya dihapus
+	_, svcErr = auth.CompleteTwoFactorLogin(challenge, totpAt(t, secret, now), SessionMeta{}, ctx)
+	if svcErr == nil || svcErr.Code != http.StatusUnauthorized {
+		t.Fatalf("harusnya ditolak setelah %d percobaan, dapet %v", loginChallengeMaxAttempts, svcErr)
+	}
+
+	if n, _ := auth.RedisClient.Exists(ctx, loginChallengeKey(challenge)).Result(); n != 0 {
+		t.Fatal("challenge harusnya udah dihapus")
+	}
+
+	_, svcErr = auth.CompleteTwoFactorLogin(challenge, totpAt(t, secret, now), SessionMeta{}, ctx)
+	if svcErr == nil || svcErr.Message != "Sesi login sudah habis, silahkan login ulang" {
+		t.Fatalf("challenge yang udah dihapus harusnya dianggap habis, dapet %v", svcErr)
+	}
+}
+
+func TestTwoFactorLoginLockoutAcrossChallenges(t *testing.T) {
+
+	now := time.Unix(1111111111, 0)
+	svc, _, secret := newTestTwoFactorService(t, now)
+
+	user := &model.User{Id: uuid.New(), Username: "budi", Email: "budi@mail.com"}
+	auth, locked := newTestTwoFactorAuth(t, svc, user)
+
+	ctx := context.Background()
+
+	// challenge baru tiap 2 percobaan, kayak orang yang udah tau password nya login ulang terus
+	var challenge string
+	for i := 0; i < userLockThreshold; i++ {
+		if i%2 == 0 {
+			var err error
+			if challenge, err = auth.createLoginChallenge(user.Id, ctx); err != nil {
+				t.Fatal(err)
+			}
+
+			// login password yang bener ga boleh nge-reset counter 2FA nya
+			if err := auth.guard.RegisterSuccess(ctx, user.Username); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		_, svcErr := auth.CompleteTwoFactorLogin(challenge, "000000", SessionMeta{Ip: "10.0.0.1"}, ctx)
+		if i < userLockThreshold-1 && (svcErr == nil || svcErr.Code != http.StatusUnauthorized) {
+			t.Fatalf("percobaan %d : harusnya kode salah, dapet %v", i+1, svcErr)
+		}
+
+		if i == userLockThreshold-1 && (svcErr == nil || svcErr.Code != http.StatusTooManyRequests) {
+			t.Fatalf("percobaan %d : harusnya udah di lock, dapet %v", i+1, svcErr)
+		}
+	}
+
+	select {
+	case ev := <-locked:
+		if ev.Email != user.Email || ev.Ip != "10.0.0.1" || ev.LockedFor != baseLockDuration {
+			t.Errorf("event AccountLocked nya %+v", ev)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("user nya harusnya dikabarin pas 2FA nya ke lock")
+	}
+
+	challenge, err := auth.createLoginChallenge(user.Id, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// kode yang bener pun ditolak selama masih di lock
+	_, svcErr := auth.CompleteTwoFactorLogin(challenge, totpAt(t, secret, now), SessionMeta{}, ctx)
+	if svcErr == nil || svcErr.Code != http.StatusTooManyRequests {
+		t.Fatalf("masih di lock, harusnya ditolak, dapet %v", svcErr)
+	}
+
+	// lock nya abis, kode yang bener diterima dan counter nya di reset
+	auth.RedisClient.Del(ctx, userGuardKey("twofa_lock", user.Id.String()))
+
+	resp, svcErr := auth.CompleteTwoFactorLogin(challenge, totpAt(t, secret, now), SessionMeta{}, ctx)
+	if svcErr != nil {
+		t.Fatalf("lock udah abis, harusnya berhasil, dapet %s", svcErr.Message)
+	}
+
+	if resp["accessToken"] == nil {
+		t.Fatal("harusnya dapet token")
+	}
+
+	if n, _ := auth.RedisClient.Exists(ctx, userGuardKey("twofa_fail", user.Id.String())).Result(); n != 0 {
+		t.Error("counter 2FA harusnya di reset setelah kode nya bener")
+	}
+}
+
+func TestTwoFactorSecretEncryptedAtRest(t *testing.T) {
+
+	now := time.Unix(1111111111, 0)
+	svc, repo, _ := newTestTwoFactorService(t, now)
+
+	user := &model.User{Id: uuid.New(), Username: "budi"}
+	svc.UserRepo = newFakeUserRepo(user)
+	repo.tf = model.TwoFactor{}
+
+	ctx := context.Background()
+
+	setup, svcErr := svc.BeginEnrollment(ctx, user.Id)
+	if svcErr != nil {
+		t.Fatal(svcErr.Message)
+	}
+
+	if repo.tf.Secret == nil || strings.Contains(*repo.tf.Secret, setup.Secret) {
+		t.Fatalf("secret di db harusnya terenkripsi, isi nya %v", repo.tf.Secret)
+	}
+
+	if _, svcErr := svc.ConfirmEnrollment(ctx, user.Id, totpAt(t, setup.Secret, now)); svcErr != nil {
+		t.Fatalf("secret terenkripsi harusnya tetep bisa dipake verifikasi : %s", svcErr.Message)
+	}
+}
+
+func TestTwoFactorLegacyPlaintextSecretReencrypted(t *testing.T) {
+
+	now := time.Unix(1111111111, 0)
+	svc, repo, secret := newTestTwoFactorService(t, now)
+
+	// secret yang disimpen sebelum ada enkripsi
+	legacy := secret
+	repo.tf.Secret = &legacy
+
+	if svcErr := svc.VerifyCode(context.Background(), uuid.New(), totpAt(t, secret, now)); svcErr != nil {
+		t.Fatalf("secret lama harusnya masih bisa dipake : %s", svcErr.Message)
+	}
+
+	if *repo.tf.Secret == secret {
+		t.Fatal("secret lama harusnya dienkripsi ulang pas dibaca")
+	}
+
+	if plain, isLegacy, err := svc.Secrets.Open(*repo.tf.Secret); err != nil || isLegacy || plain != secret {
+		t.Errorf("hasil enkripsi ulang nya %q legacy=%v err=%v", plain, isLegacy, err)
+	}
+}
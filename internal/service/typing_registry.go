@@ -0,0 +1,144 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/Agmer17/golang_yapping/internal/ws"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// key di redis baru ilang agak telat dari timer typingTTL nya,
+// biar timer instance yang terakhir manjangin masih sempet ngirim TYPING_STOP
+const typingGrace = 2 * time.Second
+
+// token yang ditulis tiap TYPING_START beda beda, jadi yang bisa ngehapus lewat timer
+// cuma instance yang terakhir nerima TYPING_START nya
+var typingStartScript = redis.NewScript(`
+local prev = redis.call('GET', KEYS[1])
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+redis.call('SADD', KEYS[2], ARGV[3])
+redis.call('PEXPIRE', KEYS[2], ARGV[2])
+if prev then
+	return 0
+end
+return 1
+`)
+
+var typingExpireScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) ~= ARGV[1] then
+	return 0
+end
+redis.call('DEL', KEYS[1])
+redis.call('SREM', KEYS[2], ARGV[2])
+return 1
+`)
+
+// status ngetik dibagi ke semua instance, TYPING_START sama TYPING_STOP nya bisa dateng dari koneksi
+// user yang nyangkut di instance beda. key di redis :
+//
+//	typing:<from>:<room>    -> token TYPING_START terakhir
+//	typing_rooms:<from>     -> set room yang lagi ditulisin user, dipake pas user nya offline
+type TypingRegistry struct {
+	RedisClient *redis.Client
+}
+
+func NewTypingRegistry(r *redis.Client) *TypingRegistry {
+	return &TypingRegistry{
+		RedisClient: r,
+	}
+}
+
+func typingStateKey(key typingKey) string {
+	return "typing:" + key.From.String() + ":" + key.room()
+}
+
+func typingRoomsKey(from uuid.UUID) string {
+	return "typing_rooms:" + from.String()
+}
+
+// kebalikan dari typingKey.room
+func typingKeyFromRoom(from uuid.UUID, room string) (typingKey, bool) {
+
+	kind, rawId, _ := strings.Cut(room, ":")
+	id, err := uuid.Parse(rawId)
+	if err != nil {
+		return typingKey{}, false
+	}
+
+	switch kind {
+	case ws.RoomKindUser:
+		return typingKey{From: from, To: id}, true
+	case ws.RoomKindGroup:
+		return typingKey{From: from, GroupId: id}, true
+	}
+
+	return typingKey{}, false
+}
+
+// true kalo sebelumnya user nya belum ngetik di room ini (di instance mana pun)
+func (t *TypingRegistry) Start(ctx context.Context, key typingKey, token string) (bool, error) {
+
+	started, err := typingStartScript.Run(ctx, t.RedisClient,
+		[]string{typingStateKey(key), typingRoomsKey(key.From)},
+		token, (typingTTL + typingGrace).Milliseconds(), key.room(),
+	).Int64()
+
+	return started == 1, err
+}
+
+// dipanggil timer, false kalo udah ada TYPING_START yang lebih baru atau udah di stop
+func (t *TypingRegistry) Expire(ctx context.Context, key typingKey, token string) (bool, error) {
+
+	expired, err := typingExpireScript.Run(ctx, t.RedisClient,
+		[]string{typingStateKey(key), typingRoomsKey(key.From)},
+		token, key.room(),
+	).Int64()
+
+	return expired == 1, err
+}
+
+// false kalo user nya emang lagi ga ngetik
+func (t *TypingRegistry) Stop(ctx context.Context, key typingKey) (bool, error) {
+
+	pipe := t.RedisClient.TxPipeline()
+	deleted := pipe.Del(ctx, typingStateKey(key))
+	pipe.SRem(ctx, typingRoomsKey(key.From), key.room())
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return false, err
+	}
+
+	return deleted.Val() > 0, nil
+}
+
+// ngehapus semua status ngetik user, yang dibalikin cuma yang beneran masih aktif
+func (t *TypingRegistry) ClearFrom(ctx context.Context, from uuid.UUID) ([]typingKey, error) {
+
+	rooms, err := t.RedisClient.SMembers(ctx, typingRoomsKey(from)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	cleared := make([]typingKey, 0, len(rooms))
+
+	for _, room := range rooms {
+		key, ok := typingKeyFromRoom(from, room)
+		if !ok {
+			continue
+		}
+
+		stopped, err := t.Stop(ctx, key)
+		if err != nil {
+			return cleared, err
+		}
+
+		if stopped {
+			cleared = append(cleared, key)
+		}
+	}
+
+	return cleared, nil
+}
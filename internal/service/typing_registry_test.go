@@ -0,0 +1,88 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestTypingRegistryAcrossInstances(t *testing.T) {
+
+	_, rdb := newTestRedis(t)
+	ctx := context.Background()
+
+	// dua instance pake redis yang sama
+	a := NewTypingRegistry(rdb)
+	b := NewTypingRegistry(rdb)
+
+	key := typingKey{From: uuid.New(), To: uuid.New()}
+
+	started, err := a.Start(ctx, key, "token-a")
+	if err != nil || !started {
+		t.Fatalf("start pertama harusnya baru mulai ngetik, started=%v err=%v", started, err)
+	}
+
+	// TYPING_START berikutnya masuk lewat koneksi di instance lain
+	started, err = b.Start(ctx, key, "token-b")
+	if err != nil || started {
+		t.Fatalf("start kedua cuma manjangin, started=%v err=%v", started, err)
+	}
+
+	// timer instance a udah ketinggalan, ga boleh ngirim TYPING_STOP
+	if expired, _ := a.Expire(ctx, key, "token-a"); expired {
+		t.Fatal("timer dengan token lama harusnya ga ngehapus status ngetik")
+	}
+
+	if expired, _ := b.Expire(ctx, key, "token-b"); !expired {
+		t.Fatal("timer dengan token terakhir harusnya ngehapus status ngetik")
+	}
+
+	if stopped, _ := a.Stop(ctx, key); stopped {
+		t.Error("stop setelah expired harusnya ga ngirim TYPING_STOP lagi")
+	}
+}
+
+func TestTypingRegistryClearFrom(t *testing.T) {
+
+	_, rdb := newTestRedis(t)
+	ctx := context.Background()
+
+	reg := NewTypingRegistry(rdb)
+
+	from := uuid.New()
+	direct := typingKey{From: from, To: uuid.New()}
+	group := typingKey{From: from, GroupId: uuid.New()}
+	stopped := typingKey{From: from, To: uuid.New()}
+	other := typingKey{From: uuid.New(), To: from}
+
+	for _, key := range []typingKey{direct, group, stopped, other} {
+		if _, err := reg.Start(ctx, key, uuid.NewString()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reg.Stop(ctx, stopped)
+
+	cleared, err := reg.ClearFrom(ctx, from)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(map[typingKey]bool)
+	for _, key := range cleared {
+		got[key] = true
+	}
+
+	if len(cleared) != 2 || !got[direct] || !got[group] {
+		t.Fatalf("yang dihapus %v, harusnya cuma chat pribadi sama grup yang masih aktif", cleared)
+	}
+
+	if started, _ := reg.Start(ctx, direct, uuid.NewString()); !started {
+		t.Error("abis di clear, TYPING_START harusnya mulai dari awal lagi")
+	}
+
+	if started, _ := reg.Start(ctx, other, uuid.NewString()); started {
+		t.Error("status ngetik user lain harusnya ga ikut kehapus")
+	}
+}
@@ -2,16 +2,35 @@ package service
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
 
 	"github.com/Agmer17/golang_yapping/internal/model"
 	"github.com/Agmer17/golang_yapping/internal/repository"
+	"github.com/Agmer17/golang_yapping/pkg"
+	"github.com/Agmer17/golang_yapping/pkg/customerrors"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/redis/go-redis/v9"
 )
 
+// masa berlaku token per tipe verifikasi
+var verificationTTL = map[string]time.Duration{
+	model.TypeAccountVerification:  24 * time.Hour,
+	model.TypePasswordVerification: 30 * time.Minute,
+}
+
+// jeda minimal sebelum user bisa minta token baru (tipe yang sama)
+const verificationCooldown = 60 * time.Second
+
 type VerificationServiceInterface interface {
-	SaveVerificationCode(ctx context.Context, userId uuid.UUID, tokenType string) error
-	GetVerificationCode(ctx context.Context, token string) (model.VerificationModel, error)
+	SaveVerificationCode(ctx context.Context, userId uuid.UUID, tokenType string) (string, *customerrors.ServiceErrors)
+	GetVerificationCode(ctx context.Context, token string, tokenType string) (model.VerificationModel, *customerrors.ServiceErrors)
+	ActivateAccount(ctx context.Context, token string) *customerrors.ServiceErrors
+	ResetPassword(ctx context.Context, token string, hashedPassword string) (uuid.UUID, *customerrors.ServiceErrors)
 }
 
 type VerificationService struct {
@@ -27,11 +46,124 @@ func NewVerificationService(repo *repository.VerificationRepo, redCli *redis.Cli
 	}
 }
 
-func (svc *VerificationService) SaveVerificationCode(ctx context.Context, userId uuid.UUID, tokenType string) error {
+// bikin token baru, yang disimpen di db cuma hash nya. token mentah dibalikin buat dikirim ke email
+func (svc *VerificationService) SaveVerificationCode(ctx context.Context, userId uuid.UUID, tokenType string) (string, *customerrors.ServiceErrors) {
+
+	ttl, ok := verificationTTL[tokenType]
+	if !ok {
+		return "", customerrors.New(http.StatusInternalServerError, "tipe verifikasi tidak dikenal : "+tokenType)
+	}
+
+	cooldownKey := "verification_cooldown:" + tokenType + ":" + userId.String()
+
+	allowed, err := svc.RedisCli.SetNX(ctx, cooldownKey, 1, verificationCooldown).Result()
+	if err != nil {
+		return "", customerrors.New(http.StatusInternalServerError, "Terjadi kesalahan di server : "+err.Error())
+	}
+
+	if !allowed {
+		wait, _ := svc.RedisCli.TTL(ctx, cooldownKey).Result()
+		return "", customerrors.NewTooManyRequests(
+			fmt.Sprintf("Tunggu %d detik sebelum meminta token baru", int(wait.Seconds())),
+			wait,
+		)
+	}
+
+	token, svcErr := svc.createVerificationCode(ctx, userId, tokenType, ttl)
+	if svcErr != nil {
+		// token nya ga kesimpen berarti user ga dapet apa apa, jangan sampe ketahan cooldown
+		if err := svc.RedisCli.Del(ctx, cooldownKey).Err(); err != nil {
+			log.Printf("gagal menghapus cooldown verifikasi user %s : %v", userId, err)
+		}
+
+		return "", svcErr
+	}
+
+	return token, nil
+}
+
+func (svc *VerificationService) createVerificationCode(ctx context.Context, userId uuid.UUID, tokenType string, ttl time.Duration) (string, *customerrors.ServiceErrors) {
+
+	token, err := pkg.GenerateRandomStringToken(32)
+	if err != nil {
+		return "", customerrors.New(http.StatusInternalServerError, "Terjadi kesalahan di server : "+err.Error())
+	}
+
+	err = svc.VerifRepo.ReplaceVerificationCode(ctx, model.VerificationModel{
+		UserId:    userId,
+		Token:     pkg.HashToken(token),
+		Type:      tokenType,
+		ExpiresAt: time.Now().Add(ttl),
+	})
+
+	if err != nil {
+		return "", customerrors.New(http.StatusInternalServerError, "Gagal menyimpan token verifikasi : "+err.Error())
+	}
+
+	return token, nil
+}
+
+// ngecek token masih valid atau ngga, belum nandain token sebagai used
+func (svc *VerificationService) GetVerificationCode(ctx context.Context, token string, tokenType string) (model.VerificationModel, *customerrors.ServiceErrors) {
+
+	code, err := svc.VerifRepo.FindVerificationCode(ctx, pkg.HashToken(token), tokenType)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return model.VerificationModel{}, customerrors.New(http.StatusNotFound, "token tidak valid atau tidak ditemukan")
+		}
+
+		return model.VerificationModel{}, customerrors.New(http.StatusInternalServerError, "Terjadi kesalahan di server : "+err.Error())
+	}
+
+	if code.UsedAt != nil {
+		return model.VerificationModel{}, customerrors.New(http.StatusGone, "token sudah digunakan, silahkan minta token baru")
+	}
+
+	if time.Now().After(code.ExpiresAt) {
+		return model.VerificationModel{}, customerrors.New(http.StatusGone, "token sudah kadaluarsa, silahkan minta token baru")
+	}
+
+	return code, nil
+}
+
+func (svc *VerificationService) ActivateAccount(ctx context.Context, token string) *customerrors.ServiceErrors {
+
+	code, svcErr := svc.GetVerificationCode(ctx, token, model.TypeAccountVerification)
+	if svcErr != nil {
+		return svcErr
+	}
+
+	err := svc.VerifRepo.ActivateAccount(ctx, code.Id, code.UserId)
+
+	if err != nil {
+		if errors.Is(err, repository.ErrVerificationCodeUsed) {
+			return customerrors.New(http.StatusGone, "token sudah digunakan, silahkan minta token baru")
+		}
+
+		return customerrors.New(http.StatusInternalServerError, "Gagal mengaktifkan akun : "+err.Error())
+	}
 
 	return nil
 }
-func (svc *VerificationService) GetVerificationCode(ctx context.Context, token string) (model.VerificationModel, error) {
 
-	return model.VerificationModel{}, nil
+// balikin id user yang password nya diganti, dipake buat nge revoke semua session nya
+func (svc *VerificationService) ResetPassword(ctx context.Context, token string, hashedPassword string) (uuid.UUID, *customerrors.ServiceErrors) {
+
+	code, svcErr := svc.GetVerificationCode(ctx, token, model.TypePasswordVerification)
+	if svcErr != nil {
+		return uuid.Nil, svcErr
+	}
+
+	err := svc.VerifRepo.ResetPassword(ctx, code.Id, code.UserId, hashedPassword)
+
+	if err != nil {
+		if errors.Is(err, repository.ErrVerificationCodeUsed) {
+			return uuid.Nil, customerrors.New(http.StatusGone, "token sudah digunakan, silahkan minta token baru")
+		}
+
+		return uuid.Nil, customerrors.New(http.StatusInternalServerError, "Gagal mengganti password : "+err.Error())
+	}
+
+	return code.UserId, nil
 }
@@ -0,0 +1,308 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Agmer17/golang_yapping/internal/ws"
+	"github.com/Agmer17/golang_yapping/pkg"
+	"github.com/Agmer17/golang_yapping/pkg/customerrors"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/gorilla/websocket"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// ticket cuma dipake buat sekali upgrade, jadi umurnya pendek
+	wsTicketTTL = 30 * time.Second
+
+	// sesi koneksi dicek ulang ke redis tiap segini, buat nangkep logout / revoke
+	wsRevocationCheckInterval = 30 * time.Second
+
+	// AUTH_EXPIRING dikirim segini sebelum token nya expired
+	wsAuthWarnBefore = time.Minute
+
+	wsAuthTimeout = 5 * time.Second
+)
+
+type WsTicketData struct {
+	Ticket    string `json:"ticket"`
+	ExpiresIn int    `json:"expires_in"`
+}
+
+type WsAuthServiceInterface interface {
+	IssueTicket(ctx context.Context, claims *pkg.Claims) (WsTicketData, *customerrors.ServiceErrors)
+	RedeemTicket(ctx context.Context, ticket string) (*pkg.Claims, *customerrors.ServiceErrors)
+	Authenticate(ctx context.Context, token string) (*pkg.Claims, *customerrors.ServiceErrors)
+	Watch(c *ws.Client, claims *pkg.Claims)
+}
+
+// token yang lagi dipake satu koneksi, diganti tiap client ngirim AUTH
+type wsSession struct {
+	mu     sync.Mutex
+	claims *pkg.Claims
+
+	// diisi pas token nya diganti biar timer expired nya diatur ulang
+	renewed chan struct{}
+}
+
+func (s *wsSession) current() *pkg.Claims {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.claims
+}
+
+// ws_ticket:<ticket> -> claims access token yang dipake buat minta ticket nya
+type WsAuthService struct {
+	RedisClient *redis.Client
+	Revocation  TokenRevocationInterface
+
+	muSessions sync.Mutex
+	sessions   map[*ws.Client]*wsSession
+}
+
+// sekalian daftarin action AUTH ke hub
+func NewWsAuthService(r *redis.Client, revocation TokenRevocationInterface, hub *ws.Hub) *WsAuthService {
+
+	svc := &WsAuthService{
+		RedisClient: r,
+		Revocation:  revocation,
+		sessions:    make(map[*ws.Client]*wsSession),
+	}
+
+	hub.HandleAction(ws.ActionAuth, svc.handleAuth)
+
+	return svc
+}
+
+func wsTicketKey(ticket string) string {
+	return "ws_ticket:" + ticket
+}
+
+var errWsUnauthorized = customerrors.New(http.StatusUnauthorized, "harap login sebelum mengakses ini!")
+
+func (svc *WsAuthService) IssueTicket(ctx context.Context, claims *pkg.Claims) (WsTicketData, *customerrors.ServiceErrors) {
+
+	ticket, err := pkg.GenerateRandomStringToken(32)
+	if err != nil {
+		return WsTicketData{}, customerrors.New(http.StatusInternalServerError, "Terjadi kesalahan di server : "+err.Error())
+	}
+
+	raw, _ := json.Marshal(claims)
+
+	if err := svc.RedisClient.Set(ctx, wsTicketKey(ticket), raw, wsTicketTTL).Err(); err != nil {
+		return WsTicketData{}, customerrors.New(http.StatusInternalServerError, "Terjadi kesalahan di server : "+err.Error())
+	}
+
+	return WsTicketData{
+		Ticket:    ticket,
+		ExpiresIn: int(wsTicketTTL.Seconds()),
+	}, nil
+}
+
+// ticket langsung dihapus pas dipake, jadi ga bisa dipake ulang walaupun bocor di log
+func (svc *WsAuthService) RedeemTicket(ctx context.Context, ticket string) (*pkg.Claims, *customerrors.ServiceErrors) {
+
+	raw, err := svc.RedisClient.GetDel(ctx, wsTicketKey(ticket)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, customerrors.New(http.StatusUnauthorized, "ticket tidak valid atau sudah dipakai")
+	}
+
+	if err != nil {
+		return nil, customerrors.New(http.StatusInternalServerError, "Terjadi kesalahan di server : "+err.Error())
+	}
+
+	var claims pkg.Claims
+	if err := json.Unmarshal(raw, &claims); err != nil {
+		return nil, customerrors.New(http.StatusUnauthorized, "ticket tidak valid atau sudah dipakai")
+	}
+
+	// token yang dipake buat minta ticket bisa aja udah di logout di antara nya
+	if svcErr := svc.checkClaims(ctx, &claims); svcErr != nil {
+		return nil, svcErr
+	}
+
+	return &claims, nil
+}
+
+// sama kayak AuthMiddleware tapi token nya ga harus dari header Authorization
+func (svc *WsAuthService) Authenticate(ctx context.Context, token string) (*pkg.Claims, *customerrors.ServiceErrors) {
+
+	claims, err := pkg.VerifyToken(token)
+	if err != nil || claims == nil {
+		return nil, errWsUnauthorized
+	}
+
+	if svcErr := svc.checkClaims(ctx, claims); svcErr != nil {
+		return nil, svcErr
+	}
+
+	return claims, nil
+}
+
+func (svc *WsAuthService) checkClaims(ctx context.Context, claims *pkg.Claims) *customerrors.ServiceErrors {
+
+	if claims.ExpiresAt == nil || !claims.ExpiresAt.After(time.Now()) {
+		return customerrors.New(http.StatusUnauthorized, "token sudah kadaluarsa, silahkan login ulang")
+	}
+
+	revoked, err := svc.Revocation.IsRevoked(ctx, claims)
+	if err != nil {
+		return customerrors.New(http.StatusInternalServerError, "terjadi kesalahan di server "+err.Error())
+	}
+
+	if revoked {
+		return customerrors.New(http.StatusUnauthorized, "sesi kamu sudah tidak berlaku, silahkan login ulang")
+	}
+
+	return nil
+}
+
+// koneksi nya ditutup pas token nya expired (kecuali diganti lewat AUTH) atau sesi nya dicabut
+func (svc *WsAuthService) Watch(c *ws.Client, claims *pkg.Claims) {
+
+	sess := &wsSession{
+		claims:  claims,
+		renewed: make(chan struct{}, 1),
+	}
+
+	svc.muSessions.Lock()
+	svc.sessions[c] = sess
+	svc.muSessions.Unlock()
+
+	go svc.watch(c, sess)
+}
+
+func (svc *WsAuthService) watch(c *ws.Client, sess *wsSession) {
+
+	defer func() {
+		svc.muSessions.Lock()
+		delete(svc.sessions, c)
+		svc.muSessions.Unlock()
+	}()
+
+	check := time.NewTicker(wsRevocationCheckInterval)
+	defer check.Stop()
+
+	for {
+		expiresAt := sess.current().ExpiresAt.Time
+
+		expired := time.NewTimer(time.Until(expiresAt))
+		warn := time.NewTimer(time.Until(expiresAt.Add(-wsAuthWarnBefore)))
+
+		closed := svc.waitSession(c, sess, expired, warn, check)
+
+		expired.Stop()
+		warn.Stop()
+
+		if closed {
+			return
+		}
+	}
+}
+
+// true kalo koneksi nya udah selesai, false kalo token nya diganti dan timer nya harus diatur ulang
+func (svc *WsAuthService) waitSession(c *ws.Client, sess *wsSession, expired *time.Timer, warn *time.Timer, check *time.Ticker) bool {
+
+	for {
+		select {
+		case <-c.Done():
+			return true
+
+		case <-sess.renewed:
+			return false
+
+		case <-warn.C:
+			sendAuthStatus(c, ws.ActionAuthExpiring, "TOKEN SEBENTAR LAGI KADALUARSA, KIRIM AUTH DENGAN TOKEN BARU", sess.current())
+
+		case <-expired.C:
+			c.Close(websocket.ClosePolicyViolation, "token sudah kadaluarsa")
+			return true
+
+		case <-check.C:
+			ctx, cancel := context.WithTimeout(context.Background(), wsAuthTimeout)
+			revoked, err := svc.Revocation.IsRevoked(ctx, sess.current())
+			cancel()
+
+			// redis nya lagi bermasalah jangan langsung mutusin semua koneksi, dicek lagi nanti
+			if err != nil {
+				log.Printf("gagal cek sesi websocket user %s : %v", c.UserId, err)
+				continue
+			}
+
+			if revoked {
+				c.Close(websocket.ClosePolicyViolation, "sesi sudah tidak berlaku")
+				return true
+			}
+		}
+	}
+}
+
+// token baru harus punya user yang sama sama koneksi nya
+func (svc *WsAuthService) handleAuth(c *ws.Client, ev ws.WebsocketEvent) {
+
+	var req ws.AuthData
+	if err := json.Unmarshal(ev.Data, &req); err != nil {
+		c.SendError("Harap kirim payload dengan benar!")
+		return
+	}
+
+	if err := binding.Validator.ValidateStruct(req); err != nil {
+		c.SendError("Harap kirim data payload dengan benar")
+		return
+	}
+
+	svc.muSessions.Lock()
+	sess, ok := svc.sessions[c]
+	svc.muSessions.Unlock()
+
+	if !ok {
+		c.SendError("sesi koneksi tidak ditemukan")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), wsAuthTimeout)
+	defer cancel()
+
+	claims, svcErr := svc.Authenticate(ctx, req.Token)
+	if svcErr != nil {
+		c.SendError(svcErr.Message)
+		return
+	}
+
+	if claims.UserID != c.UserId {
+		c.SendError("token bukan milik user koneksi ini")
+		return
+	}
+
+	sess.mu.Lock()
+	sess.claims = claims
+	sess.mu.Unlock()
+
+	select {
+	case sess.renewed <- struct{}{}:
+	default:
+	}
+
+	sendAuthStatus(c, ws.ActionAuth, "TOKEN KONEKSI DIPERBARUI", claims)
+}
+
+func sendAuthStatus(c *ws.Client, action string, detail string, claims *pkg.Claims) {
+
+	data, _ := json.Marshal(ws.AuthStatusData{
+		ExpiresAt: claims.ExpiresAt.Time,
+	})
+
+	c.SendEvent(ws.WebsocketEvent{
+		Action: action,
+		Detail: detail,
+		Type:   ws.TypeSystemOk,
+		Data:   data,
+	})
+}
@@ -0,0 +1,55 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Agmer17/golang_yapping/internal/ws"
+	"github.com/Agmer17/golang_yapping/pkg"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func (svc *WsAuthService) watching(c *ws.Client) bool {
+	svc.muSessions.Lock()
+	defer svc.muSessions.Unlock()
+
+	_, ok := svc.sessions[c]
+	return ok
+}
+
+func TestWsAuthWatchStopsOnDisconnect(t *testing.T) {
+
+	_, rdb := newTestRedis(t)
+	hub := ws.NewHub(ws.NewMemoryBackplane(), nil, nil)
+	svc := NewWsAuthService(rdb, NewTokenRevocation(rdb), hub)
+
+	userId := uuid.New()
+	conn := newWsTestConn()
+	c := ws.NewClient(conn, hub, userId)
+
+	go c.WritePump()
+	go c.ReadPump()
+
+	svc.Watch(c, &pkg.Claims{
+		UserID: userId,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	})
+
+	if !svc.watching(c) {
+		t.Fatal("koneksi nya harusnya lagi diawasin")
+	}
+
+	// koneksi putus dari sisi client, goroutine watch nya harus langsung selesai
+	conn.Close()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for svc.watching(c) {
+		if time.Now().After(deadline) {
+			t.Fatal("sesi websocket nya masih diawasin setelah koneksi putus")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,157 @@
+package ws
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// DeliverFunc dipanggil backplane tiap ada payload buat room yang lagi di subscribe instance ini
+type DeliverFunc func(roomId string, payload []byte)
+
+// Backplane nyebarin payload room ke semua instance app.
+// Hub cuma subscribe room yang lagi ada client nya di instance ini,
+// Subscribe dipanggil pas Room dibikin dan Unsubscribe pas Room nya dihapus
+type Backplane interface {
+	Start(deliver DeliverFunc)
+	Publish(roomId string, payload []byte) error
+	Subscribe(roomId string)
+	Unsubscribe(roomId string)
+}
+
+// buat mode single node, payload langsung dikirim balik ke hub yang sama
+type MemoryBackplane struct {
+	mu      sync.RWMutex
+	deliver DeliverFunc
+	rooms   map[string]bool
+}
+
+func NewMemoryBackplane() *MemoryBackplane {
+	return &MemoryBackplane{
+		rooms: make(map[string]bool),
+	}
+}
+
+func (b *MemoryBackplane) Start(deliver DeliverFunc) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.deliver = deliver
+}
+
+func (b *MemoryBackplane) Publish(roomId string, payload []byte) error {
+	b.mu.RLock()
+	deliver := b.deliver
+	subscribed := b.rooms[roomId]
+	b.mu.RUnlock()
+
+	if subscribed && deliver != nil {
+		deliver(roomId, payload)
+	}
+
+	return nil
+}
+
+func (b *MemoryBackplane) Subscribe(roomId string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.rooms[roomId] = true
+}
+
+func (b *MemoryBackplane) Unsubscribe(roomId string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.rooms, roomId)
+}
+
+const (
+	redisRoomChannelPrefix = "ws:room:"
+
+	redisPublishTimeout = 3 * time.Second
+)
+
+type redisSubOp struct {
+	roomId    string
+	subscribe bool
+}
+
+// satu koneksi pubsub dipake bareng semua room, channel nya ws:room:<roomId>
+type RedisBackplane struct {
+	rdb    *redis.Client
+	pubsub *redis.PubSub
+	ctx    context.Context
+
+	// subscribe / unsubscribe dijalanin berurutan di satu goroutine biar urutan room dihapus lalu dibikin lagi
+	// tetep kejaga. antrian nya ga ada batas nya, jadi Subscribe / Unsubscribe ga pernah nge-block lock hub
+	// walaupun redis nya lagi lambat
+	ops *opQueue[redisSubOp]
+}
+
+// ctx dipake sampe app mati, kalo ctx nya selesai koneksi pubsub nya ditutup
+func NewRedisBackplane(ctx context.Context, rdb *redis.Client) *RedisBackplane {
+	return &RedisBackplane{
+		rdb:    rdb,
+		pubsub: rdb.Subscribe(ctx),
+		ctx:    ctx,
+		ops:    newOpQueue[redisSubOp](),
+	}
+}
+
+func roomChannel(roomId string) string {
+	return redisRoomChannelPrefix + roomId
+}
+
+func (b *RedisBackplane) Start(deliver DeliverFunc) {
+
+	go b.ops.run(b.ctx, b.applyOp)
+
+	go func() {
+		for msg := range b.pubsub.Channel() {
+			roomId, ok := strings.CutPrefix(msg.Channel, redisRoomChannelPrefix)
+			if !ok {
+				continue
+			}
+
+			deliver(roomId, []byte(msg.Payload))
+		}
+	}()
+
+	go func() {
+		<-b.ctx.Done()
+		b.pubsub.Close()
+	}()
+}
+
+func (b *RedisBackplane) applyOp(op redisSubOp) {
+	var err error
+	if op.subscribe {
+		err = b.pubsub.Subscribe(b.ctx, roomChannel(op.roomId))
+	} else {
+		err = b.pubsub.Unsubscribe(b.ctx, roomChannel(op.roomId))
+	}
+
+	if err != nil {
+		log.Printf("gagal ubah subscription room %s : %v", op.roomId, err)
+	}
+}
+
+func (b *RedisBackplane) Publish(roomId string, payload []byte) error {
+	ctx, cancel := context.WithTimeout(b.ctx, redisPublishTimeout)
+	defer cancel()
+
+	return b.rdb.Publish(ctx, roomChannel(roomId), payload).Err()
+}
+
+func (b *RedisBackplane) Subscribe(roomId string) {
+	b.ops.push(redisSubOp{roomId: roomId, subscribe: true})
+}
+
+func (b *RedisBackplane) Unsubscribe(roomId string) {
+	b.ops.push(redisSubOp{roomId: roomId, subscribe: false})
+}
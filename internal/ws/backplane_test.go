@@ -0,0 +1,61 @@
+package ws
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestRedisBackplaneSubscribeNeverBlocks(t *testing.T) {
+
+	rdb := newTestRedis(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	// goroutine yang ngejalanin antrian nya belum jalan, Subscribe tetep harus langsung balik
+	b := NewRedisBackplane(ctx, rdb)
+
+	done := make(chan struct{})
+	go func() {
+		for i := range 1000 {
+			b.Subscribe(fmt.Sprintf("group:%d", i))
+			b.Unsubscribe(fmt.Sprintf("group:%d", i))
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(testWait):
+		t.Fatal("Subscribe / Unsubscribe nge-block pas antrian nya numpuk")
+	}
+
+	delivered := make(chan string, 1)
+	b.Start(func(roomId string, payload []byte) {
+		delivered <- roomId + " " + string(payload)
+	})
+	b.Subscribe("group:x")
+
+	// subscribe nya async, publish diulang sampe pubsub nya kebentuk
+	deadline := time.Now().Add(testWait)
+	for {
+		if err := b.Publish("group:x", []byte("halo")); err != nil {
+			t.Fatal(err)
+		}
+
+		select {
+		case got := <-delivered:
+			if got != "group:x halo" {
+				t.Fatalf("payload yang nyampe %q", got)
+			}
+			return
+		case <-time.After(20 * time.Millisecond):
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal("payload nya ga nyampe lewat redis")
+		}
+	}
+}
@@ -4,6 +4,7 @@ package ws
 import (
 	"encoding/json"
 	"log"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin/binding"
@@ -21,27 +22,70 @@ const (
 	maxMessageSize = 4 * 1024
 )
 
+// bagian dari *websocket.Conn yang dipake client, biar bisa diganti koneksi palsu
+type Conn interface {
+	ReadMessage() (int, []byte, error)
+	WriteMessage(messageType int, data []byte) error
+	WriteControl(messageType int, data []byte, deadline time.Time) error
+	SetReadLimit(limit int64)
+	SetReadDeadline(t time.Time) error
+	SetWriteDeadline(t time.Time) error
+	SetPongHandler(h func(appData string) error)
+	Close() error
+}
+
 type Client struct {
-	Conn   *websocket.Conn
-	Send   chan []byte
-	Room   *Room
+	Conn   Conn
+	Hub    *Hub
 	UserId uuid.UUID
+
+	// payload yang nunggu ditulis WritePump, ukuran + policy nya dari Hub.Queue
+	queue *sendQueue
+
+	// semua room yang lagi diikutin koneksi ini, termasuk room user:<id> nya sendiri
+	muRooms sync.Mutex
+	rooms   map[string]*Room
+
+	// ditutup pas koneksi nya harus diputus (misal kelambatan nerima payload),
+	// closeCode + closeReason nya dikirim di close frame
+	quit        chan struct{}
+	quitOnce    sync.Once
+	closeCode   int
+	closeReason string
+
+	// hasil RESUME dari ReadPump, ditulis WritePump sebelum payload live yang ditahan
+	replay chan replayBatch
+
+	// ditutup pas client ga bakal ngirim RESUME (ngirim action lain duluan)
+	gate     chan struct{}
+	gateOnce sync.Once
+
+	// ditutup pas WritePump selesai
+	done chan struct{}
 }
 
-func NewClient(conn *websocket.Conn, room *Room, userId uuid.UUID) *Client {
+func NewClient(conn Conn, hub *Hub, userId uuid.UUID) *Client {
 
 	return &Client{
 		Conn:   conn,
-		Send:   make(chan []byte),
-		Room:   room,
+		queue:  newSendQueue(hub.Queue, &hub.Metrics),
+		Hub:    hub,
 		UserId: userId,
+		rooms:  make(map[string]*Room),
+		quit:   make(chan struct{}),
+		replay: make(chan replayBatch, 1),
+		gate:   make(chan struct{}),
+		done:   make(chan struct{}),
 	}
 
 }
 
 func (c *Client) ReadPump() {
 	defer func() {
-		c.Room.Unregister <- c
+		c.leaveAll()
+
+		// WritePump (sama yang nunggu Done) langsung berhenti, ga nunggu ping berikutnya gagal
+		c.kick(websocket.CloseNormalClosure, "")
 		c.Conn.Close()
 	}()
 
@@ -63,29 +107,60 @@ func (c *Client) ReadPump() {
 		err = json.Unmarshal(message, &jsonEvent)
 
 		if err != nil {
-			c.sendError("Payload tidak didukung!")
+			c.SendError("Payload tidak didukung!")
 			continue
 		}
 
+		if jsonEvent.Action != ActionResume {
+			c.openGate()
+		}
+
 		switch jsonEvent.Action {
 
-		case ActionSubscribe:
-			var joinData JoinRoomEventData
-			if err := json.Unmarshal(jsonEvent.Data, &joinData); err != nil {
-				c.sendError("Harap kirim payload dengan benar!")
+		case ActionResume:
+			var resumeData ResumeData
+			if err := json.Unmarshal(jsonEvent.Data, &resumeData); err != nil {
+				c.openGate()
+				c.SendError("Harap kirim payload dengan benar!")
+				continue
+			}
+
+			if err := binding.Validator.ValidateStruct(resumeData); err != nil {
+				c.openGate()
+				c.SendError("Harap kirim data payload dengan benar")
 				continue
 			}
 
-			if err := binding.Validator.ValidateStruct(joinData); err != nil {
+			c.resume(resumeData.LastSeq)
 
-				c.sendError("Harap kirim data payload dengan benar")
+		case ActionSubscribe, ActionUnsubscribe:
+			var roomData JoinRoomEventData
+			if err := json.Unmarshal(jsonEvent.Data, &roomData); err != nil {
+				c.SendError("Harap kirim payload dengan benar!")
 				continue
 			}
 
-			c.Room.Broadcast <- message
+			if err := binding.Validator.ValidateStruct(roomData); err != nil {
+
+				c.SendError("Harap kirim data payload dengan benar")
+				continue
+			}
+
+			for _, roomId := range roomData.RoomIds() {
+				if jsonEvent.Action == ActionSubscribe {
+					c.subscribe(roomId)
+				} else {
+					c.unsubscribe(roomId)
+				}
+			}
 
 		default:
-			c.sendError("event not supported")
+			if handler := c.Hub.actionHandler(jsonEvent.Action); handler != nil {
+				handler(c, jsonEvent)
+				continue
+			}
+
+			c.SendError("event not supported")
 		}
 	}
 }
@@ -93,31 +168,89 @@ func (c *Client) ReadPump() {
 func (c *Client) WritePump() {
 
 	ticker := time.NewTicker(pingPeriod)
+	grace := time.NewTimer(resumeGrace)
 	defer func() {
 		ticker.Stop()
+		grace.Stop()
+		close(c.done)
 		c.Conn.Close()
+
+		// yang masih ngantri ga bakal kekirim, jangan diitung lagi di queue depth
+		c.queue.drain()
 	}()
 
+	// payload live ditahan dulu sampe RESUME selesai di replay, biar urutan seq nya ga kebalik
+	var held [][]byte
+	holding := true
+	gate := c.gate
+	graceC := grace.C
+
+	// event dengan seq segini ke bawah udah dikirim lewat replay
+	var replayedUpTo int64
+
+	release := func() bool {
+		holding = false
+		gate = nil
+		graceC = nil
+
+		for _, message := range held {
+			if !c.writeLive(message, replayedUpTo) {
+				return false
+			}
+		}
+		held = nil
+
+		return true
+	}
+
 	for {
 
 		select {
-		case message, ok := <-c.Send:
-			c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+		case <-c.quit:
+			c.Conn.WriteControl(websocket.CloseMessage, closeMessage(c.closeCode, c.closeReason), time.Now().Add(writeWait))
+			return
+
+		case <-c.queue.ready:
+			for _, message := range c.queue.drain() {
+				if holding {
+					held = append(held, message)
+					if len(held) < maxHeldPayload {
+						continue
+					}
+
+					if !release() {
+						return
+					}
+					continue
+				}
+
+				if !c.writeLive(message, replayedUpTo) {
+					return
+				}
+			}
 
-			if !ok {
-				errPayload, _ := json.Marshal(WebsocketEvent{
-					Action: "SYSTEM",
-					Detail: "KONEKSI DITUTUP KARENA INTERNET MELAMBAT!",
-					Data:   nil,
-				})
+		case batch := <-c.replay:
+			for _, message := range batch.Events {
+				if !c.write(message) {
+					return
+				}
+			}
+
+			replayedUpTo = max(replayedUpTo, batch.UpTo)
 
-				c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
-				c.Conn.WriteMessage(websocket.CloseMessage, errPayload)
+			if !release() {
 				return
 			}
 
-			c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
-			c.Conn.WriteMessage(websocket.TextMessage, message)
+		case <-gate:
+			if !release() {
+				return
+			}
+
+		case <-graceC:
+			if !release() {
+				return
+			}
 
 		case <-ticker.C:
 			c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
@@ -130,7 +263,69 @@ func (c *Client) WritePump() {
 
 }
 
-func (c *Client) sendError(msg string) {
+func (c *Client) write(message []byte) bool {
+	c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+	return c.Conn.WriteMessage(websocket.TextMessage, message) == nil
+}
+
+// event live yang seq nya udah kekirim lewat replay ga dikirim dua kali
+func (c *Client) writeLive(message []byte, replayedUpTo int64) bool {
+	if replayedUpTo > 0 {
+		if seq := payloadSeq(message); seq > 0 && seq <= replayedUpTo {
+			return true
+		}
+	}
+
+	return c.write(message)
+}
+
+// dipake ActionHandler buat bales langsung ke koneksi ini aja
+func (c *Client) SendEvent(ev WebsocketEvent) {
+	payload, _ := json.Marshal(ev)
+	c.send(payload)
+}
+
+// ga pernah nge-block, kalo antrian nya penuh diurus sesuai policy
+func (c *Client) send(payload []byte) {
+	c.enqueue(payload)
+}
+
+// false kalo client nya diputus karena antrian nya penuh
+func (c *Client) enqueue(payload []byte) bool {
+	code := c.queue.push(payload)
+	if code == 0 {
+		return true
+	}
+
+	reason := "koneksi terlalu lambat menerima pesan"
+	if code == websocket.CloseTryAgainLater {
+		reason = "antrian pesan penuh, sambung ulang lalu kirim RESUME"
+	}
+
+	c.kick(code, reason)
+	return false
+}
+
+// nutup koneksi dari luar package (misal token nya expired) pake close code + reason
+func (c *Client) Close(code int, reason string) {
+	c.kick(code, reason)
+}
+
+// ditutup pas WritePump nya udah berhenti
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// cuma alasan pertama yang dipake, kick berikutnya ga ngapa ngapain
+func (c *Client) kick(code int, reason string) {
+	c.quitOnce.Do(func() {
+		c.closeCode = code
+		c.closeReason = reason
+		close(c.quit)
+	})
+}
+
+func (c *Client) SendError(msg string) {
 
 	errEvent, _ := json.Marshal(WebsocketEvent{
 		Action: ActionSystem,
@@ -139,6 +334,6 @@ func (c *Client) sendError(msg string) {
 		Data:   nil,
 	})
 
-	c.Send <- errEvent
+	c.send(errEvent)
 
 }
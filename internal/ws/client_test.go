@@ -0,0 +1,95 @@
+package ws
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestReadPumpExitStopsWritePump(t *testing.T) {
+
+	hub, _ := newTestHub(t)
+
+	conn := newFakeConn()
+	c := NewClient(conn, hub, uuid.New())
+
+	go c.WritePump()
+
+	pumpDone := make(chan struct{})
+	go func() {
+		c.ReadPump()
+		close(pumpDone)
+	}()
+
+	// koneksi putus dari sisi client, ReadMessage nya langsung error
+	conn.Close()
+
+	select {
+	case <-pumpDone:
+	case <-time.After(testWait):
+		t.Fatal("ReadPump nya ga berhenti")
+	}
+
+	// tanpa kick WritePump baru sadar pas ping berikutnya, bisa sampe pingPeriod
+	select {
+	case <-c.Done():
+	case <-time.After(testWait):
+		t.Fatal("WritePump harusnya ikut berhenti begitu ReadPump keluar")
+	}
+}
+
+// ack SUBSCRIBED terakhir yang masuk antrian client
+func lastRoomAck(t *testing.T, c *Client) RoomAckData {
+	t.Helper()
+
+	payloads := c.queue.drain()
+	if len(payloads) == 0 {
+		t.Fatal("ack nya ga dikirim")
+	}
+
+	var ev WebsocketEvent
+	if err := json.Unmarshal(payloads[len(payloads)-1], &ev); err != nil || ev.Action != ActionSubscribed {
+		t.Fatalf("payload terakhir nya %s", payloads[len(payloads)-1])
+	}
+
+	var ack RoomAckData
+	if err := json.Unmarshal(ev.Data, &ack); err != nil {
+		t.Fatal(err)
+	}
+
+	return ack
+}
+
+func TestSubscribeRoomCap(t *testing.T) {
+
+	hub, _ := newTestHub(t)
+	hub.AuthorizeRoom(RoomKindGroup, func(userId uuid.UUID, id string) bool { return true })
+
+	c := NewClient(nil, hub, uuid.New())
+	hub.Join(UserRoom(c.UserId), c)
+
+	// room user sendiri ga ngurangin jatah, jadi masih bisa ikut persis maxRoomsPerClient room
+	for i := range maxRoomsPerClient {
+		room := GroupRoom(uuid.New())
+		c.subscribe(room)
+
+		if ack := lastRoomAck(t, c); ack.Error != "" {
+			t.Fatalf("room ke %d harusnya masih boleh, dapet %q", i+1, ack.Error)
+		}
+	}
+
+	extra := GroupRoom(uuid.New())
+	c.subscribe(extra)
+
+	if ack := lastRoomAck(t, c); ack.Error == "" || c.InRoom(extra) {
+		t.Fatalf("room ke %d harusnya ditolak", maxRoomsPerClient+1)
+	}
+
+	// room yang udah diikutin tetep dibales ok
+	c.subscribe(UserRoom(c.UserId))
+	if ack := lastRoomAck(t, c); ack.Error != "" {
+		t.Fatalf("subscribe ulang room sendiri harusnya ok, dapet %q", ack.Error)
+	}
+}
@@ -0,0 +1,123 @@
+package ws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// gap nya udah kebuang dari log (atau seq client nya ga dikenal), client harus resync lewat REST
+var ErrReplayGap = errors.New("event yang terlewat sudah tidak tersedia")
+
+type LoggedEvent struct {
+	Seq     int64
+	Payload []byte
+}
+
+// EventLog nyimpen event per room user dengan seq yang terus naik, dipake RESUME buat replay
+type EventLog interface {
+	Append(roomId string, payload []byte) (int64, error)
+
+	// semua event setelah lastSeq sampe seq terakhir (current)
+	Since(roomId string, lastSeq int64) ([]LoggedEvent, int64, error)
+}
+
+const (
+	// jumlah event maksimal yang disimpen per user, lebih dari ini client disuruh resync
+	eventLogMaxLen = 1000
+
+	// log nya ilang kalo user ga nerima event apa pun selama ini
+	eventLogTTL = 7 * 24 * time.Hour
+
+	eventLogTimeout = 3 * time.Second
+)
+
+// INCR sama XADD harus atomik biar urutan id di stream sama kayak urutan seq nya
+var appendEventScript = redis.NewScript(`
+local seq = redis.call('INCR', KEYS[1])
+redis.call('XADD', KEYS[2], 'MAXLEN', '~', ARGV[2], seq .. '-0', 'payload', ARGV[1])
+redis.call('EXPIRE', KEYS[1], ARGV[3])
+redis.call('EXPIRE', KEYS[2], ARGV[3])
+return seq
+`)
+
+// seq disimpen di ws_seq:<roomId>, event nya di stream ws_events:<roomId> dengan id <seq>-0
+type RedisEventLog struct {
+	rdb *redis.Client
+	ctx context.Context
+}
+
+func NewRedisEventLog(ctx context.Context, rdb *redis.Client) *RedisEventLog {
+	return &RedisEventLog{
+		rdb: rdb,
+		ctx: ctx,
+	}
+}
+
+func eventSeqKey(roomId string) string {
+	return "ws_seq:" + roomId
+}
+
+func eventStreamKey(roomId string) string {
+	return "ws_events:" + roomId
+}
+
+func (l *RedisEventLog) Append(roomId string, payload []byte) (int64, error) {
+	ctx, cancel := context.WithTimeout(l.ctx, eventLogTimeout)
+	defer cancel()
+
+	return appendEventScript.Run(ctx, l.rdb,
+		[]string{eventSeqKey(roomId), eventStreamKey(roomId)},
+		payload, eventLogMaxLen, int64(eventLogTTL.Seconds()),
+	).Int64()
+}
+
+// lastSeq 0 artinya client belum pernah nerima event, ga ada yang di replay
+func (l *RedisEventLog) Since(roomId string, lastSeq int64) ([]LoggedEvent, int64, error) {
+	ctx, cancel := context.WithTimeout(l.ctx, eventLogTimeout)
+	defer cancel()
+
+	current, err := l.rdb.Get(ctx, eventSeqKey(roomId)).Int64()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, 0, err
+	}
+
+	// seq nya lebih gede dari yang ada berarti log nya udah expired terus mulai dari awal lagi
+	if lastSeq > current || current-lastSeq > eventLogMaxLen {
+		return nil, current, ErrReplayGap
+	}
+
+	if lastSeq == 0 || lastSeq == current {
+		return nil, current, nil
+	}
+
+	entries, err := l.rdb.XRangeN(ctx, eventStreamKey(roomId), fmt.Sprintf("%d-0", lastSeq+1), "+", current-lastSeq).Result()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	result := make([]LoggedEvent, 0, len(entries))
+
+	for _, entry := range entries {
+		rawSeq, _, _ := strings.Cut(entry.ID, "-")
+		seq, err := strconv.ParseInt(rawSeq, 10, 64)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		payload, _ := entry.Values["payload"].(string)
+		result = append(result, LoggedEvent{Seq: seq, Payload: []byte(payload)})
+	}
+
+	// event pertama yang ketemu harus persis setelah lastSeq, kalo ga berarti udah ke trim
+	if len(result) == 0 || result[0].Seq != lastSeq+1 {
+		return nil, current, ErrReplayGap
+	}
+
+	return result, current, nil
+}
@@ -1,17 +1,115 @@
 // hub.go
 package ws
 
-import "sync"
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// dipanggil tiap ada action dari client yang ga di handle langsung di ReadPump
+type ActionHandler func(c *Client, ev WebsocketEvent)
+
+// dipanggil pas client SUBSCRIBE ke room <jenis>:<id>, true kalo user nya boleh masuk.
+// jalan di goroutine ReadPump
+type RoomAuthorizer func(userId uuid.UUID, id string) bool
 
 type Hub struct {
 	muRoom sync.Mutex
 	Rooms  map[string]*Room
+
+	// semua payload room lewat sini dulu biar nyampe ke client di instance lain juga
+	backplane Backplane
+
+	// nil berarti event ga dikasih seq dan RESUME selalu minta resync
+	events EventLog
+
+	muActions   sync.RWMutex
+	actions     map[string]ActionHandler
+	authorizers map[string]RoomAuthorizer
+
+	// jumlah koneksi yang lagi kebuka per user di instance ini, diitung dari register / unregister ke room user:<id>
+	muPresence  sync.Mutex
+	connections map[uuid.UUID]int
+
+	// status online user di semua instance, cuma dikabarin pas jumlah koneksi lokal nya 0 <-> 1
+	presence    PresenceStore
+	presenceOps *opQueue[presenceOp]
+
+	// ukuran antrian kirim + policy buat client baru, diubah sebelum server jalan
+	Queue QueueConfig
+
+	Metrics Metrics
+
+	// dipanggil pas koneksi pertama user di semua instance kebuka (online) dan pas koneksi terakhir nya ketutup (offline).
+	// jalan berurutan di satu goroutine presence jadi jangan nge-block
+	OnPresenceChange func(userId uuid.UUID, online bool)
 }
 
-func NewHub() *Hub {
-	return &Hub{
-		Rooms: make(map[string]*Room),
+type presenceOp struct {
+	userId    uuid.UUID
+	connected bool
+}
+
+// backplane / presence nil berarti single node, pake MemoryBackplane / MemoryPresence
+func NewHub(backplane Backplane, events EventLog, presence PresenceStore) *Hub {
+	if backplane == nil {
+		backplane = NewMemoryBackplane()
+	}
+
+	if presence == nil {
+		presence = NewMemoryPresence()
+	}
+
+	h := &Hub{
+		Rooms:       make(map[string]*Room),
+		backplane:   backplane,
+		events:      events,
+		actions:     make(map[string]ActionHandler),
+		authorizers: make(map[string]RoomAuthorizer),
+		connections: make(map[uuid.UUID]int),
+		presence:    presence,
+		presenceOps: newOpQueue[presenceOp](),
+		Queue: QueueConfig{
+			Size:   DefaultQueueSize,
+			Policy: PolicyDisconnect,
+		},
 	}
+
+	backplane.Start(h.deliverLocal)
+	backplane.Subscribe(evictControlRoom)
+
+	presence.Start(h.localUsers)
+	go h.presenceOps.run(context.Background(), h.applyPresence)
+
+	return h
+}
+
+const (
+	RoomKindUser  = "user"
+	RoomKindGroup = "group"
+
+	userRoomPrefix = RoomKindUser + ":"
+
+	// room internal buat nyebarin EvictUser ke semua instance, client ga bisa masuk sini
+	evictControlRoom = "hub:evict"
+)
+
+type evictCommand struct {
+	RoomId string    `json:"room_id"`
+	UserId uuid.UUID `json:"user_id"`
+}
+
+func UserRoom(userId uuid.UUID) string {
+	return userRoomPrefix + userId.String()
+}
+
+func GroupRoom(groupId uuid.UUID) string {
+	return RoomKindGroup + ":" + groupId.String()
 }
 
 func (h *Hub) GetOrCreate(roomId string) *Room {
@@ -26,6 +124,7 @@ func (h *Hub) GetOrCreate(roomId string) *Room {
 
 	room = NewRooms(h, roomId)
 	h.Rooms[roomId] = room
+	h.backplane.Subscribe(roomId)
 
 	go room.Run()
 
@@ -55,18 +154,212 @@ func (h *Hub) removeRoom(roomId string) {
 
 	if ok {
 		delete(h.Rooms, roomId)
+		h.backplane.Unsubscribe(roomId)
 		return
 
 	}
 
 }
 
+// dikirim ke backplane, yang nerusin ke room nya di instance mana pun client nya konek
 func (h *Hub) SendPayloadTo(roomId string, payload []byte) {
 
+	if err := h.backplane.Publish(roomId, payload); err != nil {
+		log.Printf("gagal publish payload ke room %s : %v", roomId, err)
+	}
+
+}
+
+// event ke room user dicatet dulu di EventLog biar dapet seq dan bisa di replay pas RESUME
+func (h *Hub) SendEvent(ev WebsocketEvent) {
+
+	if h.events != nil && strings.HasPrefix(ev.Receiver, userRoomPrefix) {
+		logged, _ := json.Marshal(ev)
+
+		seq, err := h.events.Append(ev.Receiver, logged)
+		if err != nil {
+			log.Printf("gagal nyatet event ke room %s : %v", ev.Receiver, err)
+		} else {
+			ev.Seq = seq
+		}
+	}
+
+	payload, _ := json.Marshal(ev)
+	h.SendPayloadTo(ev.Receiver, payload)
+}
+
+// dipanggil backplane, cuma nganterin ke client yang konek ke instance ini
+func (h *Hub) deliverLocal(roomId string, payload []byte) {
+
+	if roomId == evictControlRoom {
+		h.evictLocal(payload)
+		return
+	}
+
 	room := h.GetRoom(roomId)
 
 	if room != nil {
-		room.Broadcast <- payload
+		room.broadcast(payload)
+	}
+
+}
+
+// masukin client ke room, room nya dibikin dulu kalo belum ada
+func (h *Hub) Join(roomId string, c *Client) {
+	for {
+		room := h.GetOrCreate(roomId)
+
+		if room.join(c) {
+			c.addRoom(room)
+			return
+		}
+	}
+}
+
+// ngeluarin semua koneksi user dari room di semua instance, misal abis di kick dari grup
+func (h *Hub) EvictUser(roomId string, userId uuid.UUID) {
+
+	payload, _ := json.Marshal(evictCommand{RoomId: roomId, UserId: userId})
+
+	if err := h.backplane.Publish(evictControlRoom, payload); err != nil {
+		log.Printf("gagal publish evict room %s : %v", roomId, err)
 	}
+}
+
+func (h *Hub) evictLocal(payload []byte) {
 
+	var cmd evictCommand
+	if err := json.Unmarshal(payload, &cmd); err != nil {
+		return
+	}
+
+	if room := h.GetRoom(cmd.RoomId); room != nil {
+		room.evict(cmd.UserId)
+	}
+}
+
+// authorizer yang sama di register dua kali, yang terakhir yang dipake
+func (h *Hub) AuthorizeRoom(kind string, authorizer RoomAuthorizer) {
+	h.muActions.Lock()
+	defer h.muActions.Unlock()
+
+	h.authorizers[kind] = authorizer
+}
+
+// room user cuma boleh punya sendiri, jenis room yang ga ada authorizer nya ditolak
+func (h *Hub) canJoin(userId uuid.UUID, roomId string) bool {
+
+	kind, id, ok := strings.Cut(roomId, ":")
+	if !ok || id == "" {
+		return false
+	}
+
+	if kind == RoomKindUser {
+		return roomId == UserRoom(userId)
+	}
+
+	h.muActions.RLock()
+	authorizer := h.authorizers[kind]
+	h.muActions.RUnlock()
+
+	return authorizer != nil && authorizer(userId, id)
+}
+
+// action yang sama di register dua kali, yang terakhir yang dipake
+func (h *Hub) HandleAction(action string, handler ActionHandler) {
+	h.muActions.Lock()
+	defer h.muActions.Unlock()
+
+	h.actions[action] = handler
+}
+
+func (h *Hub) actionHandler(action string) ActionHandler {
+	h.muActions.RLock()
+	defer h.muActions.RUnlock()
+
+	return h.actions[action]
+}
+
+func (h *Hub) IsOnline(userId uuid.UUID) bool {
+	return h.OnlineUsers([]uuid.UUID{userId})[userId]
+}
+
+// kalo store nya lagi error, yang dipake cuma koneksi di instance ini
+func (h *Hub) OnlineUsers(userIds []uuid.UUID) map[uuid.UUID]bool {
+
+	online, err := h.presence.Online(userIds)
+	if err == nil {
+		return online
+	}
+
+	log.Printf("gagal ambil status online : %v", err)
+
+	h.muPresence.Lock()
+	defer h.muPresence.Unlock()
+
+	online = make(map[uuid.UUID]bool, len(userIds))
+	for _, id := range userIds {
+		online[id] = h.connections[id] > 0
+	}
+
+	return online
+}
+
+func (h *Hub) localUsers() []uuid.UUID {
+	h.muPresence.Lock()
+	defer h.muPresence.Unlock()
+
+	users := make([]uuid.UUID, 0, len(h.connections))
+	for id := range h.connections {
+		users = append(users, id)
+	}
+
+	return users
+}
+
+// jalan di goroutine Room.Run, urusan ke store nya dilempar ke antrian presence
+func (h *Hub) clientConnected(userId uuid.UUID) {
+	h.muPresence.Lock()
+	h.connections[userId]++
+	first := h.connections[userId] == 1
+	h.muPresence.Unlock()
+
+	if first {
+		h.presenceOps.push(presenceOp{userId: userId, connected: true})
+	}
+}
+
+func (h *Hub) clientDisconnected(userId uuid.UUID) {
+	h.muPresence.Lock()
+	h.connections[userId]--
+	last := h.connections[userId] <= 0
+	if last {
+		delete(h.connections, userId)
+	}
+	h.muPresence.Unlock()
+
+	if last {
+		h.presenceOps.push(presenceOp{userId: userId, connected: false})
+	}
+}
+
+func (h *Hub) applyPresence(op presenceOp) {
+
+	var changed bool
+	var err error
+
+	if op.connected {
+		changed, err = h.presence.Connect(op.userId)
+	} else {
+		changed, err = h.presence.Disconnect(op.userId)
+	}
+
+	if err != nil {
+		log.Printf("gagal update presence %s : %v", op.userId, err)
+		return
+	}
+
+	if changed && h.OnPresenceChange != nil {
+		h.OnPresenceChange(op.userId, op.connected)
+	}
 }
@@ -0,0 +1,189 @@
+package ws
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const testWait = 2 * time.Second
+
+// hub single node, client nya ga punya koneksi jadi payload nya dicek langsung dari antrian kirim
+func newTestHub(t *testing.T) (*Hub, *MemoryBackplane) {
+	t.Helper()
+
+	backplane := NewMemoryBackplane()
+	return NewHub(backplane, nil, nil), backplane
+}
+
+func waitPayloads(t *testing.T, c *Client) [][]byte {
+	t.Helper()
+
+	select {
+	case <-c.queue.ready:
+		return c.queue.drain()
+	case <-time.After(testWait):
+		t.Fatal("payload nya ga nyampe ke client")
+		return nil
+	}
+}
+
+func eventually(t *testing.T, msg string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(testWait)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal(msg)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func waitPresence(t *testing.T, changes <-chan bool) bool {
+	t.Helper()
+
+	select {
+	case online := <-changes:
+		return online
+	case <-time.After(testWait):
+		t.Fatal("OnPresenceChange ga kepanggil")
+		return false
+	}
+}
+
+func (b *MemoryBackplane) subscribed(roomId string) bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.rooms[roomId]
+}
+
+func TestHubSendPayloadToRoom(t *testing.T) {
+
+	hub, _ := newTestHub(t)
+
+	room := GroupRoom(uuid.New())
+	c := NewClient(nil, hub, uuid.New())
+	hub.Join(room, c)
+
+	hub.SendPayloadTo(room, []byte(`{"action":"TEST"}`))
+
+	got := waitPayloads(t, c)
+	if len(got) != 1 || string(got[0]) != `{"action":"TEST"}` {
+		t.Fatalf("payload yang nyampe %q", got)
+	}
+
+	// room yang ga ada client nya di instance ini ga di subscribe, payload nya ga nyampe ke mana mana
+	hub.SendPayloadTo(GroupRoom(uuid.New()), []byte(`{"action":"LAIN"}`))
+	hub.SendPayloadTo(room, []byte(`{"action":"TEST"}`))
+
+	if got := waitPayloads(t, c); len(got) != 1 {
+		t.Errorf("payload room lain ikut nyampe : %q", got)
+	}
+}
+
+func TestHubSubscribesWhileRoomExists(t *testing.T) {
+
+	hub, backplane := newTestHub(t)
+
+	if !backplane.subscribed(evictControlRoom) {
+		t.Fatal("room kontrol evict harusnya langsung di subscribe")
+	}
+
+	room := GroupRoom(uuid.New())
+	c := NewClient(nil, hub, uuid.New())
+	hub.Join(room, c)
+
+	if !backplane.subscribed(room) {
+		t.Fatal("room harusnya di subscribe pas dibikin")
+	}
+
+	hub.GetRoom(room).leave(c)
+
+	eventually(t, "room kosong harusnya di unsubscribe", func() bool {
+		return !backplane.subscribed(room) && hub.GetRoom(room) == nil
+	})
+
+	// join lagi bikin room baru dan subscribe ulang
+	hub.Join(room, c)
+
+	if !backplane.subscribed(room) {
+		t.Error("room yang dibikin ulang harusnya di subscribe lagi")
+	}
+}
+
+func TestHubEvictUser(t *testing.T) {
+
+	hub, _ := newTestHub(t)
+
+	room := GroupRoom(uuid.New())
+	kicked := NewClient(nil, hub, uuid.New())
+	stays := NewClient(nil, hub, uuid.New())
+	hub.Join(room, kicked)
+	hub.Join(room, stays)
+
+	hub.EvictUser(room, kicked.UserId)
+
+	got := waitPayloads(t, kicked)
+
+	var ev WebsocketEvent
+	if len(got) != 1 || json.Unmarshal(got[0], &ev) != nil || ev.Action != ActionUnsubscribed {
+		t.Fatalf("client yang di evict harusnya dapet UNSUBSCRIBED, dapet %q", got)
+	}
+
+	if kicked.InRoom(room) {
+		t.Error("room nya harusnya udah dihapus dari client")
+	}
+
+	hub.SendPayloadTo(room, []byte(`{"action":"TEST"}`))
+
+	if got := waitPayloads(t, stays); len(got) != 1 {
+		t.Fatalf("client lain harusnya tetep nerima payload room, dapet %q", got)
+	}
+
+	if got := kicked.queue.drain(); len(got) != 0 {
+		t.Errorf("client yang di evict masih nerima payload room : %q", got)
+	}
+}
+
+func TestHubPresenceTransitions(t *testing.T) {
+
+	hub, _ := newTestHub(t)
+
+	changes := make(chan bool, 4)
+	hub.OnPresenceChange = func(userId uuid.UUID, online bool) {
+		changes <- online
+	}
+
+	userId := uuid.New()
+	first := NewClient(nil, hub, userId)
+	second := NewClient(nil, hub, userId)
+
+	hub.Join(UserRoom(userId), first)
+	hub.Join(UserRoom(userId), second)
+
+	if online := waitPresence(t, changes); !online {
+		t.Fatal("koneksi pertama harusnya bikin online")
+	}
+
+	if !hub.IsOnline(userId) {
+		t.Error("user nya harusnya online")
+	}
+
+	room := hub.GetRoom(UserRoom(userId))
+	room.leave(first)
+	room.leave(second)
+
+	if online := waitPresence(t, changes); online {
+		t.Fatal("koneksi terakhir ketutup harusnya bikin offline")
+	}
+
+	select {
+	case online := <-changes:
+		t.Errorf("presence harusnya cuma berubah dua kali, dapet lagi %v", online)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,46 @@
+package ws
+
+import "sync/atomic"
+
+// counter antrian kirim semua client di instance ini
+type Metrics struct {
+	queueDepth      atomic.Int64
+	maxQueueDepth   atomic.Int64
+	enqueued        atomic.Int64
+	droppedOldest   atomic.Int64
+	coalesced       atomic.Int64
+	slowDisconnects atomic.Int64
+}
+
+type MetricsSnapshot struct {
+	// total payload yang lagi ngantri di semua client
+	QueueDepth int64 `json:"queue_depth"`
+
+	// antrian satu client paling panjang yang pernah ada
+	MaxQueueDepth int64 `json:"max_queue_depth"`
+
+	Enqueued        int64 `json:"enqueued"`
+	DroppedOldest   int64 `json:"dropped_oldest"`
+	Coalesced       int64 `json:"coalesced"`
+	SlowDisconnects int64 `json:"slow_disconnects"`
+}
+
+func (m *Metrics) observeDepth(depth int64) {
+	for {
+		current := m.maxQueueDepth.Load()
+		if depth <= current || m.maxQueueDepth.CompareAndSwap(current, depth) {
+			return
+		}
+	}
+}
+
+func (m *Metrics) Snapshot() MetricsSnapshot {
+	return MetricsSnapshot{
+		QueueDepth:      m.queueDepth.Load(),
+		MaxQueueDepth:   m.maxQueueDepth.Load(),
+		Enqueued:        m.enqueued.Load(),
+		DroppedOldest:   m.droppedOldest.Load(),
+		Coalesced:       m.coalesced.Load(),
+		SlowDisconnects: m.slowDisconnects.Load(),
+	}
+}
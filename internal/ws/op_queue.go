@@ -0,0 +1,57 @@
+package ws
+
+import (
+	"context"
+	"sync"
+)
+
+// antrian tanpa batas yang dijalanin berurutan di satu goroutine.
+// push nya ga pernah nge-block, jadi aman dipanggil dari Room.Run atau pas lagi megang lock hub
+type opQueue[T any] struct {
+	mu     sync.Mutex
+	items  []T
+	signal chan struct{}
+}
+
+func newOpQueue[T any]() *opQueue[T] {
+	return &opQueue[T]{
+		signal: make(chan struct{}, 1),
+	}
+}
+
+func (q *opQueue[T]) push(item T) {
+	q.mu.Lock()
+	q.items = append(q.items, item)
+	q.mu.Unlock()
+
+	select {
+	case q.signal <- struct{}{}:
+	default:
+	}
+}
+
+// jalan sampe ctx nya selesai, item yang masih ngantri pas itu dibuang
+func (q *opQueue[T]) run(ctx context.Context, handle func(T)) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.signal:
+		}
+
+		for {
+			q.mu.Lock()
+			items := q.items
+			q.items = nil
+			q.mu.Unlock()
+
+			if len(items) == 0 {
+				break
+			}
+
+			for _, item := range items {
+				handle(item)
+			}
+		}
+	}
+}
@@ -2,15 +2,36 @@ package ws
 
 import (
 	"encoding/json"
+	"time"
 
 	"github.com/google/uuid"
 )
 
 const (
-	ActionNotification   = "SYSTEM_NOTIFICATION"
-	ActionSystem         = "SYSTEM"
-	ActionSubscribe      = "SUBSCRIBE"
-	ActionPrivateMessage = "PRIVATE_MESSAGE"
+	ActionNotification    = "SYSTEM_NOTIFICATION"
+	ActionSystem          = "SYSTEM"
+	ActionSubscribe       = "SUBSCRIBE"
+	ActionUnsubscribe     = "UNSUBSCRIBE"
+	ActionSubscribed      = "SUBSCRIBED"
+	ActionUnsubscribed    = "UNSUBSCRIBED"
+	ActionPrivateMessage  = "PRIVATE_MESSAGE"
+	ActionReadReceipt     = "READ_RECEIPT"
+	ActionMessageEdited   = "MESSAGE_EDITED"
+	ActionMessageDeleted  = "MESSAGE_DELETED"
+	ActionReactionAdded   = "REACTION_ADDED"
+	ActionReactionRemoved = "REACTION_REMOVED"
+	ActionGroupMessage    = "GROUP_MESSAGE"
+	ActionGroupUpdated    = "GROUP_UPDATED"
+	ActionTypingStart     = "TYPING_START"
+	ActionTypingStop      = "TYPING_STOP"
+	ActionPresence        = "PRESENCE"
+	ActionSendMessage     = "SEND_MESSAGE"
+	ActionAck             = "ACK"
+	ActionResume          = "RESUME"
+	ActionResumed         = "RESUMED"
+	ActionResyncRequired  = "RESYNC_REQUIRED"
+	ActionAuth            = "AUTH"
+	ActionAuthExpiring    = "AUTH_EXPIRING"
 
 	TypeSystemError = "ERROR"
 	TypeSystemOk    = "OK"
@@ -22,6 +43,9 @@ type WebsocketEvent struct {
 	Type     string          `json:"type"`
 	Receiver string          `json:"-"`
 	Data     json.RawMessage `json:"data"`
+
+	// cuma ada di event yang dikirim ke room user, naik terus per user. dipake buat RESUME
+	Seq int64 `json:"seq,omitempty"`
 }
 
 type NotificationEventData struct {
@@ -29,8 +53,24 @@ type NotificationEventData struct {
 	Message string `json:"notification_message"`
 }
 
+// dipake SUBSCRIBE sama UNSUBSCRIBE, isi salah satu JoinTo (satu room) atau Rooms (banyak sekaligus)
 type JoinRoomEventData struct {
-	JoinTo string `json:"join_to" binding:"required"`
+	JoinTo string   `json:"join_to" binding:"required_without=Rooms"`
+	Rooms  []string `json:"rooms" binding:"required_without=JoinTo,max=50,dive,required"`
+}
+
+func (d JoinRoomEventData) RoomIds() []string {
+	if d.JoinTo == "" {
+		return d.Rooms
+	}
+
+	return append([]string{d.JoinTo}, d.Rooms...)
+}
+
+// ACK per room buat SUBSCRIBE / UNSUBSCRIBE, Error diisi kalo gagal
+type RoomAckData struct {
+	Room  string `json:"room"`
+	Error string `json:"error,omitempty"`
 }
 
 // user metadata
@@ -47,3 +87,130 @@ type PrivateMessageData struct {
 	MediaUrl []string     `json:"media_url"`
 	From     UserMetadata `json:"from"`
 }
+
+// dikirim ke pengirim pesan pas lawan chat nya udah baca sampe UpToChatId
+type ReadReceiptData struct {
+	ReaderId   uuid.UUID `json:"reader_id"`
+	PartnerId  uuid.UUID `json:"partner_id"`
+	UpToChatId uuid.UUID `json:"up_to_chat_id"`
+	ReadAt     time.Time `json:"read_at"`
+}
+
+type MessageEditedData struct {
+	ChatId     uuid.UUID  `json:"chat_id"`
+	SenderId   uuid.UUID  `json:"sender_id"`
+	ReceiverId uuid.UUID  `json:"receiver_id"`
+	ChatText   *string    `json:"chat_text"`
+	EditedAt   *time.Time `json:"edited_at"`
+}
+
+// Mode isinya "me" atau "everyone"
+type MessageDeletedData struct {
+	ChatId    uuid.UUID `json:"chat_id"`
+	DeletedBy uuid.UUID `json:"deleted_by"`
+	Mode      string    `json:"mode"`
+}
+
+// Count itu jumlah emoji tsb di pesan ini setelah reaksi ditambah / dihapus
+type ReactionEventData struct {
+	ChatId uuid.UUID `json:"chat_id"`
+	UserId uuid.UUID `json:"user_id"`
+	Emoji  string    `json:"emoji"`
+	Count  int       `json:"count"`
+}
+
+type GroupMessageData struct {
+	ConversationId uuid.UUID    `json:"conversation_id"`
+	ChatId         uuid.UUID    `json:"chat_id"`
+	ReplyTo        *uuid.UUID   `json:"reply_to"`
+	Message        *string      `json:"text_message"`
+	PostId         *uuid.UUID   `json:"post_id"`
+	MediaUrl       []string     `json:"media_url"`
+	From           UserMetadata `json:"from"`
+	CreatedAt      time.Time    `json:"created_at"`
+}
+
+// Change isinya salah satu dari GroupChange*, Members isinya user yang kena perubahan
+type GroupUpdatedData struct {
+	ConversationId uuid.UUID   `json:"conversation_id"`
+	Change         string      `json:"change"`
+	ActorId        uuid.UUID   `json:"actor_id"`
+	Members        []uuid.UUID `json:"members"`
+	Role           string      `json:"role,omitempty"`
+	Name           string      `json:"name,omitempty"`
+	Avatar         *string     `json:"avatar,omitempty"`
+}
+
+const (
+	GroupChangeCreated      = "CREATED"
+	GroupChangeInfo         = "INFO_UPDATED"
+	GroupChangeMemberAdded  = "MEMBER_ADDED"
+	GroupChangeMemberKicked = "MEMBER_KICKED"
+	GroupChangeMemberLeft   = "MEMBER_LEFT"
+	GroupChangeRole         = "ROLE_CHANGED"
+	GroupChangeDisbanded    = "DISBANDED"
+)
+
+// dikirim client pas TYPING_START / TYPING_STOP, To itu lawan chat nya.
+// buat grup isi GroupId, event nya dikirim ke room group:<id> jadi harus SUBSCRIBE dulu
+type TypingRequestData struct {
+	To      string `json:"to" binding:"required_without=GroupId,omitempty,uuid"`
+	GroupId string `json:"group_id" binding:"required_without=To,omitempty,uuid"`
+}
+
+// ExpiresIn detik, kalo client ga ngirim TYPING_START lagi sebelum itu server ngirim TYPING_STOP sendiri
+type TypingEventData struct {
+	From      uuid.UUID  `json:"from"`
+	GroupId   *uuid.UUID `json:"group_id,omitempty"`
+	ExpiresIn int        `json:"expires_in,omitempty"`
+}
+
+// LastSeen nil kalo user nya lagi online atau nyembunyiin last seen
+type PresenceEventData struct {
+	UserId   uuid.UUID  `json:"user_id"`
+	Online   bool       `json:"online"`
+	LastSeen *time.Time `json:"last_seen"`
+}
+
+// ClientMsgId dibikin client (misal uuid), dipake buat nyocokin ACK sama ngehindarin pesan dobel pas retry
+type SendMessageData struct {
+	ClientMsgId string  `json:"client_msg_id" binding:"required,max=64"`
+	ReceiverId  string  `json:"receiver_id" binding:"required,uuid"`
+	ReplyTo     *string `json:"reply_to" binding:"omitempty,uuid"`
+	ChatText    *string `json:"chat_text"`
+	PostId      *string `json:"posts_id" binding:"omitempty,uuid"`
+}
+
+// Duplicate true kalo ClientMsgId nya udah pernah diterima, ChatId nya id pesan yang dulu
+type AckData struct {
+	ClientMsgId string     `json:"client_msg_id"`
+	ChatId      *uuid.UUID `json:"chat_id"`
+	CreatedAt   *time.Time `json:"created_at"`
+	Duplicate   bool       `json:"duplicate"`
+	Error       string     `json:"error,omitempty"`
+}
+
+// LastSeq itu seq terakhir yang udah diterima client secara berurutan, 0 kalo belum pernah nerima
+type ResumeData struct {
+	LastSeq int64 `json:"last_seq" binding:"min=0"`
+}
+
+type ResumedData struct {
+	Replayed int   `json:"replayed"`
+	LastSeq  int64 `json:"last_seq"`
+}
+
+// client harus ambil ulang data nya lewat REST terus lanjut dari LastSeq
+type ResyncRequiredData struct {
+	LastSeq int64 `json:"last_seq"`
+}
+
+// access token baru buat manjangin umur koneksi, dikirim sebelum token lama nya expired
+type AuthData struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// dikirim pas AUTH berhasil, sama pas token koneksi nya sebentar lagi expired (AUTH_EXPIRING)
+type AuthStatusData struct {
+	ExpiresAt time.Time `json:"expires_at"`
+}
@@ -0,0 +1,227 @@
+package ws
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// PresenceStore ngitung user yang online di semua instance app.
+// Hub cuma manggil Connect pas koneksi pertama user di instance ini kebuka
+// dan Disconnect pas koneksi terakhir nya di instance ini ketutup
+type PresenceStore interface {
+	// local dipanggil berkala buat ngambil user yang lagi konek ke instance ini
+	Start(local func() []uuid.UUID)
+
+	// true kalo sebelumnya user nya offline di semua instance
+	Connect(userId uuid.UUID) (bool, error)
+
+	// true kalo sekarang user nya udah offline di semua instance
+	Disconnect(userId uuid.UUID) (bool, error)
+
+	Online(userIds []uuid.UUID) (map[uuid.UUID]bool, error)
+}
+
+// buat mode single node, yang online di instance ini = yang online di semua instance
+type MemoryPresence struct {
+	mu     sync.RWMutex
+	online map[uuid.UUID]bool
+}
+
+func NewMemoryPresence() *MemoryPresence {
+	return &MemoryPresence{
+		online: make(map[uuid.UUID]bool),
+	}
+}
+
+func (p *MemoryPresence) Start(local func() []uuid.UUID) {}
+
+func (p *MemoryPresence) Connect(userId uuid.UUID) (bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.online[userId] = true
+
+	return true, nil
+}
+
+func (p *MemoryPresence) Disconnect(userId uuid.UUID) (bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	delete(p.online, userId)
+
+	return true, nil
+}
+
+func (p *MemoryPresence) Online(userIds []uuid.UUID) (map[uuid.UUID]bool, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	result := make(map[uuid.UUID]bool, len(userIds))
+	for _, id := range userIds {
+		result[id] = p.online[id]
+	}
+
+	return result, nil
+}
+
+const (
+	// instance yang ga heartbeat selama ini dianggap mati, koneksi nya ga diitung lagi
+	presenceTTL = 60 * time.Second
+
+	presenceHeartbeat = 20 * time.Second
+
+	presenceTimeout = 3 * time.Second
+)
+
+// instance yang udah lewat deadline nya dibuang dulu sebelum diitung,
+// instance ini sendiri ga ikut diitung biar sisa dari Disconnect yang gagal ga bikin online nya ke skip
+var presenceConnectScript = redis.NewScript(`
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', ARGV[2])
+local before = redis.call('ZCARD', KEYS[1])
+if redis.call('ZSCORE', KEYS[1], ARGV[1]) then
+	before = before - 1
+end
+redis.call('ZADD', KEYS[1], ARGV[3], ARGV[1])
+redis.call('PEXPIRE', KEYS[1], ARGV[4])
+return before
+`)
+
+var presenceDisconnectScript = redis.NewScript(`
+redis.call('ZREM', KEYS[1], ARGV[1])
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', ARGV[2])
+return redis.call('ZCARD', KEYS[1])
+`)
+
+// tiap user punya sorted set ws_presence:<userId>, member nya id instance yang lagi megang koneksi user itu
+// dan score nya deadline heartbeat (unix ms). instance yang crash ilang sendiri dari hitungan setelah presenceTTL,
+// tapi event offline nya ga dikirim sampe ada instance lain yang Disconnect user itu
+type RedisPresence struct {
+	rdb        *redis.Client
+	ctx        context.Context
+	instanceId string
+}
+
+// ctx dipake sampe app mati, heartbeat nya berhenti kalo ctx nya selesai
+func NewRedisPresence(ctx context.Context, rdb *redis.Client) *RedisPresence {
+	return &RedisPresence{
+		rdb:        rdb,
+		ctx:        ctx,
+		instanceId: uuid.NewString(),
+	}
+}
+
+func presenceKey(userId uuid.UUID) string {
+	return "ws_presence:" + userId.String()
+}
+
+func presenceDeadline(now time.Time) int64 {
+	return now.Add(presenceTTL).UnixMilli()
+}
+
+func (p *RedisPresence) Start(local func() []uuid.UUID) {
+
+	go func() {
+		ticker := time.NewTicker(presenceHeartbeat)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-p.ctx.Done():
+				return
+			case <-ticker.C:
+				if err := p.heartbeat(local()); err != nil {
+					log.Printf("gagal heartbeat presence : %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// cuma manjangin deadline (XX), user yang barusan Disconnect ga ketambah lagi
+func (p *RedisPresence) heartbeat(userIds []uuid.UUID) error {
+	if len(userIds) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(p.ctx, presenceTimeout)
+	defer cancel()
+
+	deadline := float64(presenceDeadline(time.Now()))
+
+	pipe := p.rdb.Pipeline()
+	for _, id := range userIds {
+		pipe.ZAddXX(ctx, presenceKey(id), redis.Z{Score: deadline, Member: p.instanceId})
+		pipe.PExpire(ctx, presenceKey(id), presenceTTL)
+	}
+
+	_, err := pipe.Exec(ctx)
+
+	return err
+}
+
+func (p *RedisPresence) Connect(userId uuid.UUID) (bool, error) {
+	ctx, cancel := context.WithTimeout(p.ctx, presenceTimeout)
+	defer cancel()
+
+	now := time.Now()
+
+	before, err := presenceConnectScript.Run(ctx, p.rdb,
+		[]string{presenceKey(userId)},
+		p.instanceId, now.UnixMilli(), presenceDeadline(now), presenceTTL.Milliseconds(),
+	).Int64()
+	if err != nil {
+		return false, err
+	}
+
+	return before == 0, nil
+}
+
+func (p *RedisPresence) Disconnect(userId uuid.UUID) (bool, error) {
+	ctx, cancel := context.WithTimeout(p.ctx, presenceTimeout)
+	defer cancel()
+
+	remaining, err := presenceDisconnectScript.Run(ctx, p.rdb,
+		[]string{presenceKey(userId)},
+		p.instanceId, time.Now().UnixMilli(),
+	).Int64()
+	if err != nil {
+		return false, err
+	}
+
+	return remaining == 0, nil
+}
+
+func (p *RedisPresence) Online(userIds []uuid.UUID) (map[uuid.UUID]bool, error) {
+	result := make(map[uuid.UUID]bool, len(userIds))
+	if len(userIds) == 0 {
+		return result, nil
+	}
+
+	ctx, cancel := context.WithTimeout(p.ctx, presenceTimeout)
+	defer cancel()
+
+	now := strconv.FormatInt(time.Now().UnixMilli(), 10)
+
+	pipe := p.rdb.Pipeline()
+	counts := make([]*redis.IntCmd, len(userIds))
+	for i, id := range userIds {
+		counts[i] = pipe.ZCount(ctx, presenceKey(id), "("+now, "+inf")
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	for i, id := range userIds {
+		result[id] = counts[i].Val() > 0
+	}
+
+	return result, nil
+}
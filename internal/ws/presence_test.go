@@ -0,0 +1,95 @@
+package ws
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestRedis(t *testing.T) *redis.Client {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+
+	return rdb
+}
+
+func TestRedisPresenceAcrossInstances(t *testing.T) {
+
+	rdb := newTestRedis(t)
+	ctx := context.Background()
+
+	a := NewRedisPresence(ctx, rdb)
+	b := NewRedisPresence(ctx, rdb)
+
+	user := uuid.New()
+
+	if first, err := a.Connect(user); err != nil || !first {
+		t.Fatalf("koneksi pertama di cluster harusnya online, first=%v err=%v", first, err)
+	}
+
+	if first, _ := b.Connect(user); first {
+		t.Fatal("koneksi di instance kedua harusnya ga ngirim online lagi")
+	}
+
+	if last, _ := a.Disconnect(user); last {
+		t.Fatal("masih ada koneksi di instance b, harusnya belum offline")
+	}
+
+	if online, _ := a.Online([]uuid.UUID{user}); !online[user] {
+		t.Fatal("user masih konek ke instance b, harusnya online")
+	}
+
+	if last, _ := b.Disconnect(user); !last {
+		t.Fatal("koneksi terakhir di cluster ketutup, harusnya offline")
+	}
+
+	if online, _ := b.Online([]uuid.UUID{user}); online[user] {
+		t.Error("ga ada koneksi lagi, harusnya offline")
+	}
+}
+
+func TestRedisPresenceDeadInstance(t *testing.T) {
+
+	rdb := newTestRedis(t)
+	ctx := context.Background()
+
+	p := NewRedisPresence(ctx, rdb)
+	user := uuid.New()
+
+	// instance lain yang udah lewat deadline heartbeat nya
+	stale := float64(time.Now().Add(-time.Second).UnixMilli())
+	rdb.ZAdd(ctx, presenceKey(user), redis.Z{Score: stale, Member: "instance-mati"})
+
+	if online, _ := p.Online([]uuid.UUID{user}); online[user] {
+		t.Fatal("instance yang udah mati harusnya ga diitung online")
+	}
+
+	if first, _ := p.Connect(user); !first {
+		t.Fatal("koneksi dari instance mati ga diitung, harusnya ini koneksi pertama")
+	}
+
+	if err := p.heartbeat([]uuid.UUID{user}); err != nil {
+		t.Fatal(err)
+	}
+
+	if last, _ := p.Disconnect(user); !last {
+		t.Error("sisa instance mati harusnya ga nahan user tetep online")
+	}
+
+	// heartbeat setelah Disconnect ga boleh bikin user nya online lagi
+	if err := p.heartbeat([]uuid.UUID{user}); err != nil {
+		t.Fatal(err)
+	}
+
+	if online, _ := p.Online([]uuid.UUID{user}); online[user] {
+		t.Error("heartbeat ga boleh nambahin user yang udah disconnect")
+	}
+}
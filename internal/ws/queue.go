@@ -0,0 +1,191 @@
+package ws
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+// apa yang dilakuin kalo antrian kirim client udah penuh
+type SlowConsumerPolicy string
+
+const (
+	// payload paling lama dibuang, client bisa tau ada yang kelewat dari seq yang bolong terus RESUME
+	PolicyDropOldest SlowConsumerPolicy = "drop_oldest"
+
+	// event yang sifatnya status (typing, presence) ditimpa sama yang paling baru,
+	// kalo tetep penuh koneksi nya diputus pake 1013 biar client sambung ulang
+	PolicyCoalesce SlowConsumerPolicy = "coalesce"
+
+	// langsung diputus pake 1008
+	PolicyDisconnect SlowConsumerPolicy = "disconnect"
+)
+
+const (
+	DefaultQueueSize = 64
+
+	// batas reason close frame dari RFC 6455
+	maxCloseReasonLength = 123
+)
+
+type QueueConfig struct {
+	Size   int
+	Policy SlowConsumerPolicy
+}
+
+func ParseSlowConsumerPolicy(raw string) (SlowConsumerPolicy, error) {
+	switch p := SlowConsumerPolicy(raw); p {
+	case PolicyDropOldest, PolicyCoalesce, PolicyDisconnect:
+		return p, nil
+	}
+
+	return "", fmt.Errorf("policy %q tidak dikenal", raw)
+}
+
+type queuedPayload struct {
+	payload []byte
+
+	// kosong berarti ga bisa ditimpa
+	key string
+}
+
+// antrian kirim per client. yang masukin Room.Run / ReadPump, yang ngambil WritePump
+type sendQueue struct {
+	mu     sync.Mutex
+	items  []queuedPayload
+	size   int
+	policy SlowConsumerPolicy
+
+	// diisi tiap ada payload baru, buffer 1 jadi sinyal yang numpuk digabung
+	ready chan struct{}
+
+	metrics *Metrics
+}
+
+func newSendQueue(cfg QueueConfig, metrics *Metrics) *sendQueue {
+	if cfg.Size <= 0 {
+		cfg.Size = DefaultQueueSize
+	}
+
+	if cfg.Policy == "" {
+		cfg.Policy = PolicyDisconnect
+	}
+
+	return &sendQueue{
+		items:   make([]queuedPayload, 0, cfg.Size),
+		size:    cfg.Size,
+		policy:  cfg.Policy,
+		ready:   make(chan struct{}, 1),
+		metrics: metrics,
+	}
+}
+
+// close code 0 berarti payload nya masuk (atau sengaja dibuang sesuai policy),
+// selain itu client nya harus diputus pake code itu
+func (q *sendQueue) push(payload []byte) int {
+
+	item := queuedPayload{payload: payload}
+	if q.policy == PolicyCoalesce {
+		item.key = coalesceKey(payload)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if item.key != "" {
+		for i := range q.items {
+			if q.items[i].key == item.key {
+				q.items[i] = item
+				q.metrics.coalesced.Add(1)
+				return 0
+			}
+		}
+	}
+
+	if len(q.items) >= q.size {
+		switch q.policy {
+		case PolicyDropOldest:
+			q.items = append(q.items[:0], q.items[1:]...)
+			q.metrics.droppedOldest.Add(1)
+			q.metrics.queueDepth.Add(-1)
+
+		case PolicyCoalesce:
+			q.metrics.slowDisconnects.Add(1)
+			return websocket.CloseTryAgainLater
+
+		default:
+			q.metrics.slowDisconnects.Add(1)
+			return websocket.ClosePolicyViolation
+		}
+	}
+
+	q.items = append(q.items, item)
+	q.metrics.enqueued.Add(1)
+	q.metrics.queueDepth.Add(1)
+	q.metrics.observeDepth(int64(len(q.items)))
+
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+
+	return 0
+}
+
+// ngambil semua payload yang lagi ngantri sesuai urutan masuk
+func (q *sendQueue) drain() [][]byte {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	result := make([][]byte, len(q.items))
+	for i, item := range q.items {
+		result[i] = item.payload
+	}
+
+	q.metrics.queueDepth.Add(-int64(len(q.items)))
+	q.items = q.items[:0]
+
+	return result
+}
+
+// cuma event status yang boleh ditimpa, pesan / ACK harus nyampe semua
+func coalesceKey(payload []byte) string {
+
+	var ev struct {
+		Action string `json:"action"`
+		Data   struct {
+			From    uuid.UUID  `json:"from"`
+			UserId  uuid.UUID  `json:"user_id"`
+			GroupId *uuid.UUID `json:"group_id"`
+		} `json:"data"`
+	}
+
+	if err := json.Unmarshal(payload, &ev); err != nil {
+		return ""
+	}
+
+	switch ev.Action {
+	case ActionTypingStart, ActionTypingStop:
+		key := "typing:" + ev.Data.From.String()
+		if ev.Data.GroupId != nil {
+			key += ":" + ev.Data.GroupId.String()
+		}
+		return key
+
+	case ActionPresence:
+		return "presence:" + ev.Data.UserId.String()
+	}
+
+	return ""
+}
+
+func closeMessage(code int, reason string) []byte {
+	if len(reason) > maxCloseReasonLength {
+		reason = reason[:maxCloseReasonLength]
+	}
+
+	return websocket.FormatCloseMessage(code, reason)
+}
@@ -0,0 +1,248 @@
+package ws
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+// koneksi palsu, yang ditulis WritePump dicatet biar bisa dicek
+type fakeConn struct {
+	mu        sync.Mutex
+	written   [][]byte
+	closeCode int
+
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newFakeConn() *fakeConn {
+	return &fakeConn{closed: make(chan struct{})}
+}
+
+func (f *fakeConn) ReadMessage() (int, []byte, error) {
+	<-f.closed
+	return 0, nil, errors.New("koneksi ditutup")
+}
+
+func (f *fakeConn) WriteMessage(messageType int, data []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if messageType == websocket.TextMessage {
+		f.written = append(f.written, data)
+	}
+
+	return nil
+}
+
+func (f *fakeConn) WriteControl(messageType int, data []byte, deadline time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if messageType == websocket.CloseMessage && len(data) >= 2 {
+		f.closeCode = int(binary.BigEndian.Uint16(data))
+	}
+
+	return nil
+}
+
+func (f *fakeConn) SetReadLimit(limit int64)                    {}
+func (f *fakeConn) SetReadDeadline(t time.Time) error           { return nil }
+func (f *fakeConn) SetWriteDeadline(t time.Time) error          { return nil }
+func (f *fakeConn) SetPongHandler(h func(appData string) error) {}
+
+func (f *fakeConn) Close() error {
+	f.closeOnce.Do(func() { close(f.closed) })
+	return nil
+}
+
+func (f *fakeConn) messages() [][]byte {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([][]byte(nil), f.written...)
+}
+
+// nunggu WritePump nya selesai, balikin close code yang dikirim
+func (f *fakeConn) waitClosed(t *testing.T) int {
+	t.Helper()
+
+	select {
+	case <-f.closed:
+	case <-time.After(testWait):
+		t.Fatal("koneksi nya ga ditutup")
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.closeCode
+}
+
+func newQueueTestClient(t *testing.T, cfg QueueConfig) (*Client, *fakeConn) {
+	t.Helper()
+
+	hub, _ := newTestHub(t)
+	hub.Queue = cfg
+
+	conn := newFakeConn()
+	return NewClient(conn, hub, uuid.New()), conn
+}
+
+func queued(c *Client) []string {
+	c.queue.mu.Lock()
+	defer c.queue.mu.Unlock()
+
+	result := make([]string, len(c.queue.items))
+	for i, item := range c.queue.items {
+		result[i] = string(item.payload)
+	}
+
+	return result
+}
+
+func presencePayload(userId uuid.UUID, online bool) []byte {
+	data, _ := json.Marshal(PresenceEventData{UserId: userId, Online: online})
+	payload, _ := json.Marshal(WebsocketEvent{Action: ActionPresence, Data: data})
+	return payload
+}
+
+func typingPayload(action string, from uuid.UUID, groupId *uuid.UUID) []byte {
+	data, _ := json.Marshal(TypingEventData{From: from, GroupId: groupId})
+	payload, _ := json.Marshal(WebsocketEvent{Action: action, Data: data})
+	return payload
+}
+
+func TestQueueDropOldest(t *testing.T) {
+
+	c, conn := newQueueTestClient(t, QueueConfig{Size: 2, Policy: PolicyDropOldest})
+
+	for _, payload := range []string{`{"n":1}`, `{"n":2}`, `{"n":3}`} {
+		if !c.enqueue([]byte(payload)) {
+			t.Fatalf("drop_oldest ga boleh mutusin koneksi, payload %s", payload)
+		}
+	}
+
+	go c.WritePump()
+	c.openGate()
+
+	eventually(t, "payload yang ngantri ga ditulis", func() bool {
+		return len(conn.messages()) == 2
+	})
+
+	got := conn.messages()
+	if string(got[0]) != `{"n":2}` || string(got[1]) != `{"n":3}` {
+		t.Errorf("yang kekirim %q, harusnya payload paling lama yang dibuang", got)
+	}
+
+	c.Close(websocket.CloseNormalClosure, "")
+	conn.waitClosed(t)
+
+	snap := c.Hub.Metrics.Snapshot()
+	want := MetricsSnapshot{Enqueued: 3, DroppedOldest: 1, MaxQueueDepth: 2}
+	if snap != want {
+		t.Errorf("metrics %+v, harusnya %+v", snap, want)
+	}
+}
+
+func TestQueueCoalesce(t *testing.T) {
+
+	c, conn := newQueueTestClient(t, QueueConfig{Size: 3, Policy: PolicyCoalesce})
+
+	user := uuid.New()
+	groupId := uuid.New()
+
+	c.enqueue(presencePayload(user, true))
+	c.enqueue(typingPayload(ActionTypingStart, user, nil))
+	c.enqueue(typingPayload(ActionTypingStart, user, &groupId))
+
+	// status yang lebih baru nimpa yang lama di posisi yang sama, antrian nya ga nambah
+	offline := presencePayload(user, false)
+	stopped := typingPayload(ActionTypingStop, user, nil)
+	stoppedGroup := typingPayload(ActionTypingStop, user, &groupId)
+
+	for _, payload := range [][]byte{offline, stopped, stoppedGroup} {
+		if !c.enqueue(payload) {
+			t.Fatal("event status yang bisa ditimpa ga boleh mutusin koneksi")
+		}
+	}
+
+	want := []string{string(offline), string(stopped), string(stoppedGroup)}
+	if got := queued(c); len(got) != 3 || got[0] != want[0] || got[1] != want[1] || got[2] != want[2] {
+		t.Fatalf("isi antrian %q, harusnya %q", got, want)
+	}
+
+	// pesan biasa ga bisa ditimpa, antrian nya penuh jadi diputus pake 1013
+	if c.enqueue([]byte(`{"action":"NEW_MESSAGE"}`)) {
+		t.Fatal("antrian penuh harusnya mutusin koneksi")
+	}
+
+	go c.WritePump()
+
+	if code := conn.waitClosed(t); code != websocket.CloseTryAgainLater {
+		t.Errorf("close code %d, harusnya %d", code, websocket.CloseTryAgainLater)
+	}
+
+	snap := c.Hub.Metrics.Snapshot()
+	wantMetrics := MetricsSnapshot{Enqueued: 3, Coalesced: 3, SlowDisconnects: 1, MaxQueueDepth: 3}
+	if snap != wantMetrics {
+		t.Errorf("metrics %+v, harusnya %+v", snap, wantMetrics)
+	}
+}
+
+func TestQueueDisconnect(t *testing.T) {
+
+	c, conn := newQueueTestClient(t, QueueConfig{Size: 1, Policy: PolicyDisconnect})
+
+	if !c.enqueue([]byte(`{"n":1}`)) {
+		t.Fatal("antrian belum penuh, payload nya harusnya masuk")
+	}
+
+	// event status juga ga ditimpa di policy ini
+	if c.enqueue(presencePayload(uuid.New(), true)) {
+		t.Fatal("antrian penuh harusnya mutusin koneksi")
+	}
+
+	go c.WritePump()
+
+	if code := conn.waitClosed(t); code != websocket.ClosePolicyViolation {
+		t.Errorf("close code %d, harusnya %d", code, websocket.ClosePolicyViolation)
+	}
+
+	snap := c.Hub.Metrics.Snapshot()
+	want := MetricsSnapshot{Enqueued: 1, SlowDisconnects: 1, MaxQueueDepth: 1}
+	if snap != want {
+		t.Errorf("metrics %+v, harusnya %+v", snap, want)
+	}
+}
+
+func TestCoalesceKey(t *testing.T) {
+
+	user := uuid.New()
+	groupId := uuid.New()
+
+	cases := []struct {
+		name    string
+		payload []byte
+		want    string
+	}{
+		{"presence", presencePayload(user, true), "presence:" + user.String()},
+		{"typing pribadi", typingPayload(ActionTypingStart, user, nil), "typing:" + user.String()},
+		{"typing grup", typingPayload(ActionTypingStop, user, &groupId), "typing:" + user.String() + ":" + groupId.String()},
+		{"pesan", []byte(`{"action":"NEW_MESSAGE"}`), ""},
+		{"bukan json", []byte(`halo`), ""},
+	}
+
+	for _, tc := range cases {
+		if got := coalesceKey(tc.payload); got != tc.want {
+			t.Errorf("%s : key %q, harusnya %q", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package ws
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+)
+
+const (
+	// RESUME harus dikirim sebagai pesan pertama, kalo ga dateng dalam waktu segini payload live langsung dikirim
+	resumeGrace = 2 * time.Second
+
+	// payload live yang ditahan selama nunggu RESUME, lebih dari ini langsung dikirim aja
+	maxHeldPayload = 256
+)
+
+type replayBatch struct {
+	Events [][]byte
+	UpTo   int64
+}
+
+func (c *Client) openGate() {
+	c.gateOnce.Do(func() {
+		close(c.gate)
+	})
+}
+
+// ngambil event yang kelewat dari EventLog terus dititipin ke WritePump.
+// jalan di goroutine ReadPump
+func (c *Client) resume(lastSeq int64) {
+
+	var batch replayBatch
+
+	events := c.Hub.events
+	if events == nil {
+		batch.Events = append(batch.Events, resyncPayload(0))
+		c.sendReplay(batch)
+		return
+	}
+
+	missed, current, err := events.Since(UserRoom(c.UserId), lastSeq)
+
+	switch {
+	case errors.Is(err, ErrReplayGap):
+		batch.Events = append(batch.Events, resyncPayload(current))
+		batch.UpTo = current
+
+	case err != nil:
+		log.Printf("gagal ambil event log user %s : %v", c.UserId, err)
+		errPayload, _ := json.Marshal(WebsocketEvent{
+			Action: ActionSystem,
+			Detail: "gagal mengambil event yang terlewat, coba lagi",
+			Type:   TypeSystemError,
+		})
+		batch.Events = append(batch.Events, errPayload)
+
+	default:
+		for _, ev := range missed {
+			batch.Events = append(batch.Events, withSeq(ev.Payload, ev.Seq))
+		}
+
+		data, _ := json.Marshal(ResumedData{
+			Replayed: len(missed),
+			LastSeq:  current,
+		})
+
+		done, _ := json.Marshal(WebsocketEvent{
+			Action: ActionResumed,
+			Detail: "EVENT TERLEWAT SUDAH DIKIRIM",
+			Type:   TypeSystemOk,
+			Data:   data,
+		})
+
+		batch.Events = append(batch.Events, done)
+		batch.UpTo = current
+	}
+
+	c.sendReplay(batch)
+}
+
+func (c *Client) sendReplay(batch replayBatch) {
+	select {
+	case c.replay <- batch:
+	case <-c.done:
+	}
+}
+
+func resyncPayload(current int64) []byte {
+	data, _ := json.Marshal(ResyncRequiredData{LastSeq: current})
+
+	payload, _ := json.Marshal(WebsocketEvent{
+		Action: ActionResyncRequired,
+		Detail: "EVENT YANG TERLEWAT SUDAH TIDAK TERSEDIA, HARAP AMBIL ULANG DATA",
+		Type:   TypeSystemOk,
+		Data:   data,
+	})
+
+	return payload
+}
+
+// payload di log disimpen tanpa seq, seq nya ditempel lagi pas di replay
+func withSeq(payload []byte, seq int64) []byte {
+	var ev WebsocketEvent
+	if err := json.Unmarshal(payload, &ev); err != nil {
+		return payload
+	}
+
+	ev.Seq = seq
+	result, _ := json.Marshal(ev)
+
+	return result
+}
+
+func payloadSeq(payload []byte) int64 {
+	var ev struct {
+		Seq int64 `json:"seq"`
+	}
+
+	if err := json.Unmarshal(payload, &ev); err != nil {
+		return 0
+	}
+
+	return ev.Seq
+}
@@ -1,6 +1,8 @@
 // room.go
 package ws
 
+import "github.com/google/uuid"
+
 type Room struct {
 	Id        string
 	Clients   map[*Client]bool
@@ -9,7 +11,14 @@ type Room struct {
 	Register   chan *Client
 	Unregister chan *Client
 
+	// semua koneksi user ini dikeluarin dari room, dipake pas akses nya dicabut
+	Evict chan uuid.UUID
+
 	Hub *Hub
+
+	// ditutup pas Run selesai. channel di atas ga pernah ditutup, yang ngirim harus
+	// select sama done biar ga nge-block selamanya ke room yang udah mati
+	done chan struct{}
 }
 
 func NewRooms(hub *Hub, id string) *Room {
@@ -19,17 +28,18 @@ func NewRooms(hub *Hub, id string) *Room {
 		Broadcast:  make(chan []byte, 10),
 		Register:   make(chan *Client),
 		Unregister: make(chan *Client),
+		Evict:      make(chan uuid.UUID),
 		Hub:        hub,
+		done:       make(chan struct{}),
 	}
 }
 
 func (r *Room) Run() {
 
 	defer func() {
-		close(r.Broadcast)
-		close(r.Register)
-		close(r.Unregister)
+		// dihapus dari hub dulu biar payload dari backplane ga dianterin lagi ke room ini
 		r.Hub.removeRoom(r.Id)
+		close(r.done)
 
 	}()
 	for {
@@ -37,25 +47,83 @@ func (r *Room) Run() {
 		case nc := <-r.Register:
 			r.Clients[nc] = true
 
+			if r.isOwnerRoom(nc) {
+				r.Hub.clientConnected(nc.UserId)
+			}
+
 		case uc := <-r.Unregister:
 			if _, ok := r.Clients[uc]; ok {
-				delete(r.Clients, uc)
-				close(uc.Send)
+				r.removeClient(uc)
+			}
+
+			if len(r.Clients) == 0 {
+				return
+			}
+
+		case userId := <-r.Evict:
+			for client := range r.Clients {
+				if client.UserId == userId {
+					r.removeClient(client)
+					client.evicted(r.Id)
+				}
 			}
 
 			if len(r.Clients) == 0 {
 				return
 			}
+
 		case pl := <-r.Broadcast:
 			for client := range r.Clients {
-				select {
-				case client.Send <- pl:
-				default:
-					close(client.Send)
-					delete(r.Clients, client)
+				// client yang kelambatan diputus koneksi nya, nanti keluar dari room lain lewat ReadPump
+				if !client.enqueue(pl) {
+					r.removeClient(client)
 				}
 			}
 		}
 
 	}
 }
+
+// false kalo room nya udah keburu mati, client harus masuk ke room baru dari hub
+func (r *Room) join(c *Client) bool {
+	select {
+	case r.Register <- c:
+		return true
+	case <-r.done:
+		return false
+	}
+}
+
+func (r *Room) leave(c *Client) {
+	select {
+	case r.Unregister <- c:
+	case <-r.done:
+	}
+}
+
+func (r *Room) evict(userId uuid.UUID) {
+	select {
+	case r.Evict <- userId:
+	case <-r.done:
+	}
+}
+
+func (r *Room) broadcast(payload []byte) {
+	select {
+	case r.Broadcast <- payload:
+	case <-r.done:
+	}
+}
+
+// presence cuma diitung dari room user:<id> punya client itu sendiri
+func (r *Room) isOwnerRoom(c *Client) bool {
+	return r.Id == UserRoom(c.UserId)
+}
+
+func (r *Room) removeClient(c *Client) {
+	delete(r.Clients, c)
+
+	if r.isOwnerRoom(c) {
+		r.Hub.clientDisconnected(c.UserId)
+	}
+}
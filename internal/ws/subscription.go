@@ -0,0 +1,128 @@
+package ws
+
+import "encoding/json"
+
+// room user sendiri ga dihitung
+const maxRoomsPerClient = 100
+
+func (c *Client) addRoom(room *Room) {
+	c.muRooms.Lock()
+	defer c.muRooms.Unlock()
+
+	c.rooms[room.Id] = room
+}
+
+// true kalo koneksi ini lagi ikut room itu
+func (c *Client) InRoom(roomId string) bool {
+	c.muRooms.Lock()
+	defer c.muRooms.Unlock()
+
+	_, ok := c.rooms[roomId]
+	return ok
+}
+
+// jangan pegang muRooms sambil ngirim ke room, Room.Run juga manggil evicted
+func (c *Client) subscribe(roomId string) {
+
+	c.muRooms.Lock()
+	_, joined := c.rooms[roomId]
+	count := len(c.rooms)
+	if _, ok := c.rooms[UserRoom(c.UserId)]; ok {
+		count--
+	}
+	c.muRooms.Unlock()
+
+	if joined {
+		c.sendRoomAck(ActionSubscribed, roomId, "")
+		return
+	}
+
+	if count >= maxRoomsPerClient {
+		c.sendRoomAck(ActionSubscribed, roomId, "jumlah room sudah maksimal")
+		return
+	}
+
+	if !c.Hub.canJoin(c.UserId, roomId) {
+		c.sendRoomAck(ActionSubscribed, roomId, "kamu tidak punya akses ke room ini")
+		return
+	}
+
+	c.Hub.Join(roomId, c)
+	c.sendRoomAck(ActionSubscribed, roomId, "")
+}
+
+func (c *Client) unsubscribe(roomId string) {
+
+	if roomId == UserRoom(c.UserId) {
+		c.sendRoomAck(ActionUnsubscribed, roomId, "room pribadi tidak bisa ditinggalkan")
+		return
+	}
+
+	c.muRooms.Lock()
+	room, joined := c.rooms[roomId]
+	delete(c.rooms, roomId)
+	c.muRooms.Unlock()
+
+	if joined {
+		room.leave(c)
+	}
+
+	c.sendRoomAck(ActionUnsubscribed, roomId, "")
+}
+
+// dipanggil pas koneksi nya ketutup
+func (c *Client) leaveAll() {
+
+	c.muRooms.Lock()
+	rooms := c.rooms
+	c.rooms = make(map[string]*Room)
+	c.muRooms.Unlock()
+
+	for _, room := range rooms {
+		room.leave(c)
+	}
+}
+
+// dipanggil dari goroutine Room.Run abis client nya dikeluarin lewat Hub.EvictUser
+func (c *Client) evicted(roomId string) {
+
+	c.muRooms.Lock()
+	delete(c.rooms, roomId)
+	c.muRooms.Unlock()
+
+	data, _ := json.Marshal(RoomAckData{
+		Room:  roomId,
+		Error: "akses kamu ke room ini sudah dicabut",
+	})
+
+	payload, _ := json.Marshal(WebsocketEvent{
+		Action: ActionUnsubscribed,
+		Detail: "DIKELUARKAN DARI ROOM",
+		Type:   TypeSystemOk,
+		Data:   data,
+	})
+
+	c.enqueue(payload)
+}
+
+func (c *Client) sendRoomAck(action string, roomId string, errMsg string) {
+
+	data, _ := json.Marshal(RoomAckData{
+		Room:  roomId,
+		Error: errMsg,
+	})
+
+	ev := WebsocketEvent{
+		Action: action,
+		Detail: "OK",
+		Type:   TypeSystemOk,
+		Data:   data,
+	}
+
+	if errMsg != "" {
+		ev.Detail = errMsg
+		ev.Type = TypeSystemError
+	}
+
+	c.SendEvent(ev)
+}
@@ -0,0 +1,15 @@
+-- token verifikasi akun & reset password
+-- token disimpan dalam bentuk hash sha256, token mentah cuma dikirim lewat email
+
+CREATE TABLE IF NOT EXISTS verification_codes (
+    id          UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id     UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token       TEXT NOT NULL UNIQUE,
+    type        VARCHAR(32) NOT NULL,
+    used_at     TIMESTAMPTZ,
+    expires_at  TIMESTAMPTZ NOT NULL,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_verification_codes_user_type
+    ON verification_codes (user_id, type);
@@ -0,0 +1,16 @@
+-- 2FA pake TOTP (RFC 6238)
+-- totp_secret di isi pas user mulai enrollment, totp_enabled baru true setelah user konfirmasi kode pertama
+
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS totp_secret  TEXT,
+    ADD COLUMN IF NOT EXISTS totp_enabled BOOLEAN NOT NULL DEFAULT false;
+
+-- recovery code disimpan dalam bentuk hash sha256, cuma bisa dipake sekali
+CREATE TABLE IF NOT EXISTS user_recovery_codes (
+    id          UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id     UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash   TEXT NOT NULL,
+    used_at     TIMESTAMPTZ,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (user_id, code_hash)
+);
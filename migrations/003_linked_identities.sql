@@ -0,0 +1,14 @@
+-- akun dari provider OIDC (google, dll) yang ke link ke user
+-- satu user bisa punya banyak identity, tapi satu (provider, subject) cuma boleh ke satu user
+
+CREATE TABLE IF NOT EXISTS linked_identities (
+    id          UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id     UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    provider    TEXT NOT NULL,
+    subject     TEXT NOT NULL,
+    email       TEXT,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (provider, subject)
+);
+
+CREATE INDEX IF NOT EXISTS linked_identities_user_id_idx ON linked_identities (user_id);
@@ -0,0 +1,8 @@
+-- index buat keyset pagination chat, urutan kolom nya harus sama kayak filter + ORDER BY
+-- di ChatRepository.GetChatBeetween : least/greatest(sender, receiver), created_at, id
+
+CREATE INDEX IF NOT EXISTS private_messages_conversation_idx
+    ON private_messages (least(sender_id, receiver_id), greatest(sender_id, receiver_id), created_at, id);
+
+CREATE INDEX IF NOT EXISTS private_messages_attachment_chat_id_idx
+    ON private_messages_attachment (chat_id);
@@ -0,0 +1,8 @@
+-- waktu pesan dibaca, dipake buat centang biru di client
+ALTER TABLE private_messages
+    ADD COLUMN IF NOT EXISTS read_at TIMESTAMPTZ;
+
+-- MarkConversationAsRead cuma nyentuh pesan yang belum dibaca
+CREATE INDEX IF NOT EXISTS private_messages_unread_idx
+    ON private_messages (receiver_id, sender_id, created_at)
+    WHERE is_read = false;
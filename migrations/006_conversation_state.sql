@@ -0,0 +1,18 @@
+-- jumlah pesan belum dibaca per percakapan, dari sisi user_id.
+-- di update di query yang sama waktu pesan dikirim, dibaca dan dihapus (lihat ChatRepository)
+
+CREATE TABLE IF NOT EXISTS conversation_state (
+    user_id       UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    partner_id    UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    unread_count  INTEGER NOT NULL DEFAULT 0 CHECK (unread_count >= 0),
+    updated_at    TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (user_id, partner_id)
+);
+
+-- isi dari data yang udah ada
+INSERT INTO conversation_state (user_id, partner_id, unread_count)
+SELECT receiver_id, sender_id, count(*)
+FROM private_messages
+WHERE is_read = false
+GROUP BY receiver_id, sender_id
+ON CONFLICT (user_id, partner_id) DO UPDATE SET unread_count = EXCLUDED.unread_count;
@@ -0,0 +1,15 @@
+-- edit pesan : chat_text di private_messages selalu isi yang terbaru,
+-- isi sebelumnya disimpan di private_message_edits (append only)
+
+ALTER TABLE private_messages
+    ADD COLUMN IF NOT EXISTS edited_at TIMESTAMPTZ;
+
+CREATE TABLE IF NOT EXISTS private_message_edits (
+    id             UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    chat_id        UUID NOT NULL REFERENCES private_messages(id) ON DELETE CASCADE,
+    previous_text  TEXT,
+    edited_at      TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS private_message_edits_chat_id_idx
+    ON private_message_edits (chat_id, edited_at);
@@ -0,0 +1,15 @@
+-- hapus untuk semua orang : row nya tetep ada sebagai tombstone (deleted_at di isi, isi pesan dikosongin)
+ALTER TABLE private_messages
+    ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+
+-- hapus untuk saya : pesan cuma disembunyiin buat user itu.
+-- kalo dua dua nya udah nyembunyiin, row pesan + attachment nya dihapus beneran
+CREATE TABLE IF NOT EXISTS private_message_hidden (
+    chat_id    UUID NOT NULL REFERENCES private_messages(id) ON DELETE CASCADE,
+    user_id    UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    hidden_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (chat_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS private_message_hidden_user_id_idx
+    ON private_message_hidden (user_id, chat_id);
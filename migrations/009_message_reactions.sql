@@ -0,0 +1,12 @@
+-- reaksi emoji di pesan, satu user cuma bisa kasih emoji yang sama sekali per pesan
+CREATE TABLE IF NOT EXISTS message_reactions (
+    chat_id     UUID NOT NULL REFERENCES private_messages(id) ON DELETE CASCADE,
+    user_id     UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    emoji       TEXT NOT NULL,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (chat_id, user_id, emoji)
+);
+
+-- dipake buat ngitung reaksi per pesan satu halaman sekaligus
+CREATE INDEX IF NOT EXISTS message_reactions_chat_id_idx
+    ON message_reactions (chat_id, emoji);
@@ -0,0 +1,48 @@
+-- chat grup. private_messages tetep khusus 1:1, pesan grup disimpan terpisah di group_messages
+
+CREATE TABLE IF NOT EXISTS conversations (
+    id          UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name        TEXT NOT NULL,
+    avatar      TEXT,
+    created_by  UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- satu grup selalu punya tepat satu owner (dijaga di ConversationRepository)
+CREATE TABLE IF NOT EXISTS conversation_members (
+    conversation_id  UUID NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+    user_id          UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role             TEXT NOT NULL DEFAULT 'member' CHECK (role IN ('owner', 'admin', 'member')),
+    joined_at        TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (conversation_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS conversation_members_user_id_idx
+    ON conversation_members (user_id);
+
+CREATE TABLE IF NOT EXISTS group_messages (
+    id               UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    conversation_id  UUID NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+    sender_id        UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    reply_to         UUID REFERENCES group_messages(id) ON DELETE SET NULL,
+    chat_text        TEXT,
+    post_id          UUID,
+    created_at       TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- keyset pagination per grup, sama kayak private_messages_conversation_idx
+CREATE INDEX IF NOT EXISTS group_messages_conversation_idx
+    ON group_messages (conversation_id, created_at, id);
+
+CREATE TABLE IF NOT EXISTS group_messages_attachment (
+    id          UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    message_id  UUID NOT NULL REFERENCES group_messages(id) ON DELETE CASCADE,
+    file_name   TEXT NOT NULL,
+    media_type  TEXT NOT NULL,
+    size        BIGINT NOT NULL,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS group_messages_attachment_message_id_idx
+    ON group_messages_attachment (message_id);
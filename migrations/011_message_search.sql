@@ -0,0 +1,8 @@
+-- full text search isi pesan. pake config 'simple' biar ga ada stemming bahasa tertentu,
+-- chat isinya campur bahasa indonesia, inggris sama singkatan
+ALTER TABLE private_messages
+    ADD COLUMN IF NOT EXISTS chat_text_tsv tsvector
+    GENERATED ALWAYS AS (to_tsvector('simple', coalesce(chat_text, ''))) STORED;
+
+CREATE INDEX IF NOT EXISTS private_messages_chat_text_tsv_idx
+    ON private_messages USING GIN (chat_text_tsv);
@@ -0,0 +1,4 @@
+-- last seen di update pas koneksi websocket terakhir user ketutup (lihat PresenceService)
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS last_seen_at TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS hide_last_seen BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1,7 @@
+-- pesan grup ikut dicari di /chat/search, config nya sama kayak private_messages (011)
+ALTER TABLE group_messages
+    ADD COLUMN IF NOT EXISTS chat_text_tsv tsvector
+    GENERATED ALWAYS AS (to_tsvector('simple', coalesce(chat_text, ''))) STORED;
+
+CREATE INDEX IF NOT EXISTS group_messages_chat_text_tsv_idx
+    ON group_messages USING GIN (chat_text_tsv);
@@ -0,0 +1,8 @@
+-- client_msg_id dari SEND_MESSAGE websocket disimpan di pesan nya, retry dengan id yang sama
+-- ditolak sama unique index nya di transaksi yang sama waktu insert (lihat ChatRepository.Save)
+ALTER TABLE private_messages
+    ADD COLUMN IF NOT EXISTS client_msg_id TEXT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS private_messages_sender_client_msg_id_idx
+    ON private_messages (sender_id, client_msg_id)
+    WHERE client_msg_id IS NOT NULL;
@@ -1,8 +1,13 @@
 package customerrors
 
+import "time"
+
 type ServiceErrors struct {
 	Code    int
 	Message string
+
+	// di isi kalo Code nya 429, dipake handler buat header Retry-After
+	RetryAfter time.Duration
 }
 
 func (e *ServiceErrors) Error() string {
@@ -15,3 +20,11 @@ func New(code int, message string) *ServiceErrors {
 		Message: message,
 	}
 }
+
+func NewTooManyRequests(message string, retryAfter time.Duration) *ServiceErrors {
+	return &ServiceErrors{
+		Code:       429,
+		Message:    message,
+		RetryAfter: retryAfter,
+	}
+}
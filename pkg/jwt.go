@@ -10,61 +10,100 @@ import (
 
 var jwtSecret []byte
 
+// aud access token sama refresh token dibedain, biar yang satu ga bisa dipake sebagai yang lain
+// (keduanya ditanda tangan pake key yang sama)
+const (
+	accessTokenAudience  = "yapping-access"
+	refreshTokenAudience = "yapping-refresh"
+)
+
 type Claims struct {
-	UserID uuid.UUID `json:"user_id"`
-	Role   string    `json:"role"` // role nya harus "USER, MODERATOR"
+	UserID    uuid.UUID `json:"user_id"`
+	Role      string    `json:"role"` // role nya harus "USER, MODERATOR"
+	SessionId string    `json:"sid,omitempty"`
+
+	// iat standar cuma sampe detik, ini dipake buat dibandingin sama watermark revoke per user
+	IssuedAtMs int64 `json:"iat_ms,omitempty"`
 	jwt.RegisteredClaims
 }
 
 type RefreshTokenClaims struct {
 	UserId uuid.UUID `json:"uuid"`
+
+	// random per token, jti nya udah dipake buat id session. tanpa ini refresh di detik yang
+	// sama bakal ngasilin token yang persis sama kayak sebelumnya
+	Nonce string `json:"nonce,omitempty"`
 	jwt.RegisteredClaims
 }
 
+// mode lama, sign + verifikasi pake satu secret HS256. buat RS256 / EdDSA pake JwtInitKeys
 func JwtInit(secret string) {
 	jwtSecret = []byte(secret)
 	if len(jwtSecret) == 0 {
 		panic("JWT_SECRET not set")
 	}
+
+	hmacKey := &jwtKey{
+		Method:  jwt.SigningMethodHS256,
+		Private: jwtSecret,
+		Public:  jwtSecret,
+	}
+
+	muKeys.Lock()
+	defer muKeys.Unlock()
+
+	activeKey = hmacKey
+	verifyKeys = map[string]*jwtKey{"": hmacKey}
 }
 
-func GenerateToken(userID uuid.UUID, role string, limit int) (string, error) {
-	expirationTime := time.Now().Add(time.Duration(limit) * time.Minute)
+func GenerateToken(userID uuid.UUID, role string, sessionId string, limit int) (string, error) {
+	now := time.Now()
+	expirationTime := now.Add(time.Duration(limit) * time.Minute)
 
 	claims := &Claims{
-		UserID: userID,
-		Role:   role,
+		UserID:     userID,
+		Role:       role,
+		SessionId:  sessionId,
+		IssuedAtMs: now.UnixMilli(),
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			IssuedAt:  jwt.NewNumericDate(now),
 			Issuer:    "agmer-yapping",
+			Audience:  jwt.ClaimStrings{accessTokenAudience},
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-
-	tokenString, err := token.SignedString(jwtSecret)
+	tokenString, err := signClaims(claims)
 	if err != nil {
 		return "", err
 	}
 
 	return tokenString, nil
 }
-func GenerateTokenNoRole(userID uuid.UUID, limit int) (string, error) {
+
+// jti refresh token = id session nya di redis
+func GenerateTokenNoRole(userID uuid.UUID, sessionId string, limit int) (string, error) {
 	expirationTime := time.Now().Add(time.Duration(limit) * time.Minute)
 
+	nonce, err := GenerateRandomStringToken(16)
+	if err != nil {
+		return "", err
+	}
+
 	claims := &RefreshTokenClaims{
 		UserId: userID,
+		Nonce:  nonce,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        sessionId,
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			Issuer:    "agmer-yapping",
+			Audience:  jwt.ClaimStrings{refreshTokenAudience},
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-
-	tokenString, err := token.SignedString(jwtSecret)
+	tokenString, err := signClaims(claims)
 	if err != nil {
 		return "", err
 	}
@@ -75,12 +114,7 @@ func GenerateTokenNoRole(userID uuid.UUID, limit int) (string, error) {
 func VerifyToken(tokenString string) (*Claims, error) {
 	claims := &Claims{}
 
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return jwtSecret, nil
-	})
+	token, err := jwt.ParseWithClaims(tokenString, claims, verificationKey, jwt.WithAudience(accessTokenAudience))
 
 	if err != nil {
 		return nil, err
@@ -96,12 +130,7 @@ func VerifyToken(tokenString string) (*Claims, error) {
 func VerifyRefreshToken(tokenString string) (*RefreshTokenClaims, error) {
 	claims := &RefreshTokenClaims{}
 
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return jwtSecret, nil
-	})
+	token, err := jwt.ParseWithClaims(tokenString, claims, verificationKey, jwt.WithAudience(refreshTokenAudience))
 
 	if err != nil {
 		return nil, err
@@ -0,0 +1,225 @@
+package pkg
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// satu key buat tanda tangan / verifikasi jwt.
+// Private nil berarti key nya cuma dipake buat verifikasi (key lama yang lagi di rotate)
+type jwtKey struct {
+	Kid     string
+	Method  jwt.SigningMethod
+	Private any
+	Public  any
+}
+
+var (
+	muKeys     sync.RWMutex
+	activeKey  *jwtKey
+	verifyKeys = map[string]*jwtKey{}
+)
+
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+
+	// Ed25519 / EC
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// baca semua file *.pem di dir, nama file (tanpa .pem) jadi kid nya.
+// file private key (RSA / Ed25519) bisa buat sign + verifikasi, file public key cuma buat verifikasi.
+// buat rotasi : taruh key baru, ganti activeKid, terus biarin public key lama tetep ada
+// sampe semua token yang ditanda tangan pake key lama expire
+func JwtInitKeys(dir string, activeKid string) error {
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	keys := map[string]*jwtKey{}
+	var signingKids []string
+
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".pem") {
+			continue
+		}
+
+		kid := strings.TrimSuffix(e.Name(), ".pem")
+
+		raw, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return err
+		}
+
+		key, err := parsePemKey(kid, raw)
+		if err != nil {
+			return fmt.Errorf("gagal baca key %s : %w", e.Name(), err)
+		}
+
+		keys[kid] = key
+		if key.Private != nil {
+			signingKids = append(signingKids, kid)
+		}
+	}
+
+	if activeKid == "" {
+		if len(signingKids) != 1 {
+			return errors.New("JWT_ACTIVE_KID harus di isi kalo jumlah private key bukan 1")
+		}
+		activeKid = signingKids[0]
+	}
+
+	active, ok := keys[activeKid]
+	if !ok || active.Private == nil {
+		return fmt.Errorf("private key buat kid %s tidak ditemukan", activeKid)
+	}
+
+	muKeys.Lock()
+	defer muKeys.Unlock()
+
+	activeKey = active
+	verifyKeys = keys
+
+	return nil
+}
+
+func parsePemKey(kid string, raw []byte) (*jwtKey, error) {
+
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return nil, errors.New("format pem tidak valid")
+	}
+
+	var parsed any
+	var err error
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("tipe pem %s tidak didukung", block.Type)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		return &jwtKey{Kid: kid, Method: jwt.SigningMethodRS256, Private: k, Public: &k.PublicKey}, nil
+	case *rsa.PublicKey:
+		return &jwtKey{Kid: kid, Method: jwt.SigningMethodRS256, Public: k}, nil
+	case ed25519.PrivateKey:
+		return &jwtKey{Kid: kid, Method: jwt.SigningMethodEdDSA, Private: k, Public: k.Public()}, nil
+	case ed25519.PublicKey:
+		return &jwtKey{Kid: kid, Method: jwt.SigningMethodEdDSA, Public: k}, nil
+	default:
+		return nil, fmt.Errorf("tipe key %T tidak didukung", parsed)
+	}
+}
+
+func signClaims(claims jwt.Claims) (string, error) {
+
+	muKeys.RLock()
+	key := activeKey
+	muKeys.RUnlock()
+
+	if key == nil {
+		return "", errors.New("jwt belum di inisialisasi")
+	}
+
+	token := jwt.NewWithClaims(key.Method, claims)
+	if key.Kid != "" {
+		token.Header["kid"] = key.Kid
+	}
+
+	return token.SignedString(key.Private)
+}
+
+// pilih key verifikasi berdasarkan header kid, algoritma nya juga harus sama
+func verificationKey(token *jwt.Token) (interface{}, error) {
+
+	kid, _ := token.Header["kid"].(string)
+
+	muKeys.RLock()
+	key, ok := verifyKeys[kid]
+	muKeys.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown key id: %q", kid)
+	}
+
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+
+	return key.Public, nil
+}
+
+// public key yang dipake buat verifikasi, key HMAC ga pernah ikut di publish
+func PublicJWKS() JWKSet {
+
+	muKeys.RLock()
+	defer muKeys.RUnlock()
+
+	set := JWKSet{Keys: make([]JWK, 0, len(verifyKeys))}
+
+	for _, key := range verifyKeys {
+		switch pub := key.Public.(type) {
+		case *rsa.PublicKey:
+			set.Keys = append(set.Keys, JWK{
+				Kty: "RSA",
+				Kid: key.Kid,
+				Use: "sig",
+				Alg: key.Method.Alg(),
+				N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			set.Keys = append(set.Keys, JWK{
+				Kty: "OKP",
+				Kid: key.Kid,
+				Use: "sig",
+				Alg: key.Method.Alg(),
+				Crv: "Ed25519",
+				X:   base64.RawURLEncoding.EncodeToString(pub),
+			})
+		}
+	}
+
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].Kid < set.Keys[j].Kid })
+
+	return set
+}
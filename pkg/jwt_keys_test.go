@@ -0,0 +1,353 @@
+package pkg
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+type testJwtKeys struct {
+	dir string
+
+	rsaKey *rsa.PrivateKey
+	edKey  ed25519.PrivateKey
+}
+
+func writePem(t *testing.T, dir string, name string, blockType string, der []byte) {
+	t.Helper()
+
+	raw := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, name), raw, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// rsa-old.pem (PKCS1, private), ed-new.pem (PKCS8, private), rsa-pub.pem (public aja) + file yang bukan .pem
+func newTestJwtKeys(t *testing.T) testJwtKeys {
+	t.Helper()
+
+	dir := t.TempDir()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	edDer, err := x509.MarshalPKCS8PrivateKey(edKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pubDer, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writePem(t, dir, "rsa-old.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey))
+	writePem(t, dir, "ed-new.pem", "PRIVATE KEY", edDer)
+	writePem(t, dir, "rsa-pub.pem", "PUBLIC KEY", pubDer)
+
+	if err := os.WriteFile(filepath.Join(dir, "README.txt"), []byte("bukan key"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return testJwtKeys{dir: dir, rsaKey: rsaKey, edKey: edKey}
+}
+
+func tokenHeader(t *testing.T, token string) (kid string, alg string) {
+	t.Helper()
+
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, &Claims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kid, _ = parsed.Header["kid"].(string)
+	return kid, parsed.Method.Alg()
+}
+
+func TestJwtInitKeysActiveKid(t *testing.T) {
+
+	keys := newTestJwtKeys(t)
+
+	// dua private key, active kid nya harus dipilih
+	if err := JwtInitKeys(keys.dir, ""); err == nil {
+		t.Fatal("lebih dari satu private key tanpa JWT_ACTIVE_KID harusnya error")
+	}
+
+	if err := JwtInitKeys(keys.dir, "rsa-pub"); err == nil {
+		t.Fatal("kid yang cuma public key ga bisa dipake sign")
+	}
+
+	if err := JwtInitKeys(keys.dir, "ga-ada"); err == nil {
+		t.Fatal("kid yang ga ada harusnya error")
+	}
+
+	if err := JwtInitKeys(keys.dir, "ed-new"); err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := GenerateToken(uuid.New(), "USER", "sid", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if kid, alg := tokenHeader(t, token); kid != "ed-new" || alg != "EdDSA" {
+		t.Fatalf("token ditanda tangan pake kid %q alg %q", kid, alg)
+	}
+
+	if _, err := VerifyToken(token); err != nil {
+		t.Fatalf("token dari active key harusnya valid : %v", err)
+	}
+
+	// satu private key aja, langsung jadi active key
+	dir := t.TempDir()
+	writePem(t, dir, "only.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(keys.rsaKey))
+
+	if err := JwtInitKeys(dir, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	token, err = GenerateToken(uuid.New(), "USER", "sid", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if kid, alg := tokenHeader(t, token); kid != "only" || alg != "RS256" {
+		t.Fatalf("token ditanda tangan pake kid %q alg %q", kid, alg)
+	}
+}
+
+func TestJwtInitKeysRejectsBadPem(t *testing.T) {
+
+	cases := map[string][]byte{
+		"bukan pem":           []byte("halo"),
+		"tipe ga didukung":    pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte{1, 2, 3}}),
+		"isi nya rusak":       pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: []byte{1, 2, 3}}),
+		"public key rusak":    pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: []byte{1, 2, 3}}),
+		"pkcs1 private rusak": pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: []byte{1, 2, 3}}),
+	}
+
+	for name, raw := range cases {
+		dir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dir, "k1.pem"), raw, 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := JwtInitKeys(dir, "k1"); err == nil {
+			t.Errorf("%s : harusnya error", name)
+		}
+	}
+}
+
+func TestJwtRotationKeepsOldKeyForVerification(t *testing.T) {
+
+	keys := newTestJwtKeys(t)
+
+	if err := JwtInitKeys(keys.dir, "rsa-old"); err != nil {
+		t.Fatal(err)
+	}
+
+	oldToken, err := GenerateToken(uuid.New(), "USER", "sid", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// rotasi ke key baru, key lama cuma tinggal buat verifikasi
+	if err := JwtInitKeys(keys.dir, "ed-new"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := VerifyToken(oldToken); err != nil {
+		t.Fatalf("token dari key lama harusnya masih valid : %v", err)
+	}
+
+	// key lama nya udah dicabut dari dir
+	if err := os.Remove(filepath.Join(keys.dir, "rsa-old.pem")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(keys.dir, "rsa-pub.pem")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := JwtInitKeys(keys.dir, "ed-new"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := VerifyToken(oldToken); err == nil {
+		t.Fatal("token dari key yang udah dicabut harusnya ditolak")
+	}
+}
+
+func TestJwtRejectsUnknownKidAndAlgMismatch(t *testing.T) {
+
+	keys := newTestJwtKeys(t)
+
+	if err := JwtInitKeys(keys.dir, "ed-new"); err != nil {
+		t.Fatal(err)
+	}
+
+	claims := &Claims{
+		UserID: uuid.New(),
+		RegisteredClaims: jwt.RegisteredClaims{
+			Audience: jwt.ClaimStrings{accessTokenAudience},
+		},
+	}
+
+	// kid ga dikenal, walaupun tanda tangan nya dari key yang valid
+	unknown := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	unknown.Header["kid"] = "ga-ada"
+	signed, err := unknown.SignedString(keys.edKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := VerifyToken(signed); err == nil || !strings.Contains(err.Error(), "unknown key id") {
+		t.Fatalf("kid yang ga dikenal harusnya ditolak, dapet %v", err)
+	}
+
+	// alg confusion : HS256 pake public key rsa sebagai secret
+	pubPem := pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(&keys.rsaKey.PublicKey)})
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	forged.Header["kid"] = "rsa-pub"
+	signed, err = forged.SignedString(pubPem)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := VerifyToken(signed); err == nil || !strings.Contains(err.Error(), "unexpected signing method") {
+		t.Fatalf("alg yang beda sama key nya harusnya ditolak, dapet %v", err)
+	}
+
+	// kid nya bener tapi ditanda tangan key lain
+	wrongKey := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	wrongKey.Header["kid"] = "rsa-pub"
+	otherRsa, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, err = wrongKey.SignedString(otherRsa)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := VerifyToken(signed); err == nil {
+		t.Fatal("tanda tangan dari key lain harusnya ditolak")
+	}
+}
+
+func TestJwtTokenTypesNotInterchangeable(t *testing.T) {
+
+	keys := newTestJwtKeys(t)
+
+	if err := JwtInitKeys(keys.dir, "ed-new"); err != nil {
+		t.Fatal(err)
+	}
+
+	access, err := GenerateToken(uuid.New(), "USER", "sid", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	refresh, err := GenerateTokenNoRole(uuid.New(), "sid", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := VerifyToken(access); err != nil {
+		t.Fatalf("access token harusnya valid : %v", err)
+	}
+
+	if _, err := VerifyRefreshToken(refresh); err != nil {
+		t.Fatalf("refresh token harusnya valid : %v", err)
+	}
+
+	if _, err := VerifyToken(refresh); err == nil {
+		t.Error("refresh token ga boleh diterima sebagai access token")
+	}
+
+	if _, err := VerifyRefreshToken(access); err == nil {
+		t.Error("access token ga boleh diterima sebagai refresh token")
+	}
+
+	// sama juga di mode HS256
+	JwtInit("rahasia")
+
+	access, _ = GenerateToken(uuid.New(), "USER", "sid", 10)
+	refresh, _ = GenerateTokenNoRole(uuid.New(), "sid", 10)
+
+	if _, err := VerifyToken(refresh); err == nil {
+		t.Error("HS256 : refresh token ga boleh diterima sebagai access token")
+	}
+
+	if _, err := VerifyRefreshToken(access); err == nil {
+		t.Error("HS256 : access token ga boleh diterima sebagai refresh token")
+	}
+}
+
+func TestPublicJWKS(t *testing.T) {
+
+	keys := newTestJwtKeys(t)
+
+	if err := JwtInitKeys(keys.dir, "ed-new"); err != nil {
+		t.Fatal(err)
+	}
+
+	set := PublicJWKS()
+
+	if len(set.Keys) != 3 {
+		t.Fatalf("jumlah key %d, harusnya 3", len(set.Keys))
+	}
+
+	// urut berdasarkan kid
+	for i, kid := range []string{"ed-new", "rsa-old", "rsa-pub"} {
+		if set.Keys[i].Kid != kid {
+			t.Fatalf("key ke %d kid nya %q, harusnya %q", i, set.Keys[i].Kid, kid)
+		}
+	}
+
+	ed := set.Keys[0]
+	if ed.Kty != "OKP" || ed.Crv != "Ed25519" || ed.Alg != "EdDSA" || ed.Use != "sig" {
+		t.Errorf("jwk ed25519 nya %+v", ed)
+	}
+
+	if x, _ := base64.RawURLEncoding.DecodeString(ed.X); !ed25519.PublicKey(x).Equal(keys.edKey.Public()) {
+		t.Error("x di jwk ed25519 ga sama kayak public key nya")
+	}
+
+	for _, jwk := range set.Keys[1:] {
+		if jwk.Kty != "RSA" || jwk.Alg != "RS256" || jwk.Use != "sig" {
+			t.Errorf("jwk rsa nya %+v", jwk)
+		}
+
+		n, _ := base64.RawURLEncoding.DecodeString(jwk.N)
+		e, _ := base64.RawURLEncoding.DecodeString(jwk.E)
+
+		if new(big.Int).SetBytes(n).Cmp(keys.rsaKey.N) != 0 || int(new(big.Int).SetBytes(e).Int64()) != keys.rsaKey.E {
+			t.Errorf("n / e di jwk %s ga sama kayak public key nya", jwk.Kid)
+		}
+	}
+
+	// key HMAC ga pernah di publish
+	JwtInit("rahasia")
+
+	if set := PublicJWKS(); len(set.Keys) != 0 {
+		t.Errorf("mode HS256 ga boleh publish key apa apa, dapet %+v", set.Keys)
+	}
+}
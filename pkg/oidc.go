@@ -0,0 +1,462 @@
+package pkg
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/sync/singleflight"
+)
+
+// jwks provider di fetch ulang paling cepet segini kalo ketemu kid yang belum dikenal
+const oidcJwksRefreshInterval = time.Minute
+
+type OidcProviderConfig struct {
+	Name         string
+	Issuer       string
+	ClientId     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JwksURI               string `json:"jwks_uri"`
+}
+
+// data user yang udah diverifikasi dari id token
+type OidcIdentity struct {
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	Name              string
+	PreferredUsername string
+}
+
+type oidcIdTokenClaims struct {
+	jwt.RegisteredClaims
+	Nonce             string `json:"nonce"`
+	Email             string `json:"email"`
+	EmailVerified     any    `json:"email_verified"`
+	Name              string `json:"name"`
+	PreferredUsername string `json:"preferred_username"`
+}
+
+// discovery sama jwks nya di ambil pas pertama kali dipake,
+// jadi app tetep bisa jalan walaupun provider nya lagi down pas startup
+type OidcProvider struct {
+	Config     OidcProviderConfig
+	HttpClient *http.Client
+
+	// mu cuma dipegang buat baca / ganti cache, fetch ke provider nya jalan di luar lock
+	// biar provider yang lambat ga nahan login lain yang key nya udah ke cache
+	mu          sync.Mutex
+	discovery   *oidcDiscovery
+	keys        map[string]any
+	keysFetched time.Time
+
+	// request barengan yang butuh fetch cuma nge-fetch sekali
+	fetches singleflight.Group
+}
+
+func NewOidcProvider(cfg OidcProviderConfig) *OidcProvider {
+
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "email", "profile"}
+	}
+
+	return &OidcProvider{
+		Config:     cfg,
+		HttpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// verifier dikirim pas tuker code, challenge (S256) dikirim di url authorize
+func GeneratePkce() (verifier string, challenge string, err error) {
+
+	verifier, err = GenerateRandomStringToken(32)
+	if err != nil {
+		return "", "", err
+	}
+
+	sum := sha256.Sum256([]byte(verifier))
+
+	return verifier, base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+func (p *OidcProvider) AuthCodeURL(ctx context.Context, state string, nonce string, codeChallenge string) (string, error) {
+
+	d, err := p.getDiscovery(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("client_id", p.Config.ClientId)
+	q.Set("redirect_uri", p.Config.RedirectURL)
+	q.Set("scope", strings.Join(p.Config.Scopes, " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", codeChallenge)
+	q.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(d.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+
+	return d.AuthorizationEndpoint + sep + q.Encode(), nil
+}
+
+// tuker authorization code jadi id token, access token provider nya ga dipake
+func (p *OidcProvider) Exchange(ctx context.Context, code string, codeVerifier string) (string, error) {
+
+	d, err := p.getDiscovery(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.Config.RedirectURL)
+	form.Set("client_id", p.Config.ClientId)
+	form.Set("code_verifier", codeVerifier)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	if p.Config.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.Config.ClientId), url.QueryEscape(p.Config.ClientSecret))
+	}
+
+	var body struct {
+		IdToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+
+	status, err := p.doJSON(req, &body)
+	if err != nil {
+		return "", err
+	}
+
+	if status != http.StatusOK || body.Error != "" {
+		return "", fmt.Errorf("token endpoint error (%d) : %s %s", status, body.Error, body.ErrorDescription)
+	}
+
+	if body.IdToken == "" {
+		return "", errors.New("provider tidak mengembalikan id_token")
+	}
+
+	return body.IdToken, nil
+}
+
+func (p *OidcProvider) VerifyIdToken(ctx context.Context, rawIdToken string, nonce string) (OidcIdentity, error) {
+
+	d, err := p.getDiscovery(ctx)
+	if err != nil {
+		return OidcIdentity{}, err
+	}
+
+	var claims oidcIdTokenClaims
+
+	_, err = jwt.ParseWithClaims(
+		rawIdToken,
+		&claims,
+		func(t *jwt.Token) (interface{}, error) {
+			kid, _ := t.Header["kid"].(string)
+			return p.publicKey(ctx, kid)
+		},
+		jwt.WithIssuer(d.Issuer),
+		jwt.WithAudience(p.Config.ClientId),
+		jwt.WithExpirationRequired(),
+		jwt.WithValidMethods([]string{"RS256", "ES256", "EdDSA"}),
+	)
+
+	if err != nil {
+		return OidcIdentity{}, err
+	}
+
+	if claims.Nonce == "" || claims.Nonce != nonce {
+		return OidcIdentity{}, errors.New("nonce id token tidak cocok")
+	}
+
+	if claims.Subject == "" {
+		return OidcIdentity{}, errors.New("id token tidak punya sub")
+	}
+
+	// beberapa provider ngirim email_verified dalam bentuk string
+	verified := false
+	switch v := claims.EmailVerified.(type) {
+	case bool:
+		verified = v
+	case string:
+		verified = v == "true"
+	}
+
+	return OidcIdentity{
+		Subject:           claims.Subject,
+		Email:             strings.ToLower(claims.Email),
+		EmailVerified:     verified,
+		Name:              claims.Name,
+		PreferredUsername: claims.PreferredUsername,
+	}, nil
+}
+
+func (p *OidcProvider) getDiscovery(ctx context.Context) (*oidcDiscovery, error) {
+
+	p.mu.Lock()
+	d := p.discovery
+	p.mu.Unlock()
+
+	if d != nil {
+		return d, nil
+	}
+
+	// fetch nya dipake bareng, jadi ga ikut batal kalo request yang mulai duluan dibatalin.
+	// lama nya tetep dibatesin timeout HttpClient
+	v, err, _ := p.fetches.Do("discovery", func() (any, error) {
+		return p.fetchDiscovery(context.WithoutCancel(ctx))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.discovery == nil {
+		p.discovery = v.(*oidcDiscovery)
+	}
+
+	return p.discovery, nil
+}
+
+func (p *OidcProvider) fetchDiscovery(ctx context.Context) (*oidcDiscovery, error) {
+
+	wellKnown := strings.TrimSuffix(p.Config.Issuer, "/") + "/.well-known/openid-configuration"
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, wellKnown, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var d oidcDiscovery
+
+	status, err := p.doJSON(req, &d)
+	if err != nil {
+		return nil, err
+	}
+
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("gagal ambil openid-configuration %s : status %d", p.Config.Name, status)
+	}
+
+	if d.Issuer != p.Config.Issuer {
+		return nil, fmt.Errorf("issuer %s tidak sama dengan konfigurasi %s", d.Issuer, p.Config.Issuer)
+	}
+
+	if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JwksURI == "" {
+		return nil, fmt.Errorf("openid-configuration %s tidak lengkap", p.Config.Name)
+	}
+
+	return &d, nil
+}
+
+// discovery nya harus udah ke ambil sebelum manggil ini
+func (p *OidcProvider) publicKey(ctx context.Context, kid string) (any, error) {
+
+	p.mu.Lock()
+	key, ok := p.keys[kid]
+	recent := time.Since(p.keysFetched) < oidcJwksRefreshInterval
+	jwksURI := p.discovery.JwksURI
+	p.mu.Unlock()
+
+	if ok {
+		return key, nil
+	}
+
+	if recent {
+		return nil, fmt.Errorf("unknown key id: %q", kid)
+	}
+
+	_, err, _ := p.fetches.Do("jwks", func() (any, error) {
+
+		// bisa aja barusan udah di fetch sama request lain
+		p.mu.Lock()
+		recent := time.Since(p.keysFetched) < oidcJwksRefreshInterval
+		p.mu.Unlock()
+
+		if recent {
+			return nil, nil
+		}
+
+		keys, err := p.fetchJwks(context.WithoutCancel(ctx), jwksURI)
+		if err != nil {
+			return nil, err
+		}
+
+		p.mu.Lock()
+		p.keys = keys
+		p.keysFetched = time.Now()
+		p.mu.Unlock()
+
+		return nil, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	key, ok = p.keys[kid]
+	p.mu.Unlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown key id: %q", kid)
+	}
+
+	return key, nil
+}
+
+func (p *OidcProvider) fetchJwks(ctx context.Context, jwksURI string) (map[string]any, error) {
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, jwksURI, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var set JWKSet
+
+	status, err := p.doJSON(req, &set)
+	if err != nil {
+		return nil, err
+	}
+
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("gagal ambil jwks %s : status %d", p.Config.Name, status)
+	}
+
+	keys := make(map[string]any, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		pub, err := parseJWK(k)
+		if err != nil {
+			// key yang formatnya ga didukung di skip aja
+			continue
+		}
+
+		keys[k.Kid] = pub
+	}
+
+	return keys, nil
+}
+
+func (p *OidcProvider) doJSON(req *http.Request, out any) (int, error) {
+
+	resp, err := p.HttpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return resp.StatusCode, err
+	}
+
+	if err := json.Unmarshal(raw, out); err != nil && resp.StatusCode == http.StatusOK {
+		return resp.StatusCode, err
+	}
+
+	return resp.StatusCode, nil
+}
+
+func parseJWK(k JWK) (any, error) {
+
+	decode := base64.RawURLEncoding.DecodeString
+
+	switch k.Kty {
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, err
+		}
+
+		e, err := decode(k.E)
+		if err != nil {
+			return nil, err
+		}
+
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("curve %s tidak didukung", k.Crv)
+		}
+
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, err
+		}
+
+		return &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}, nil
+
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("curve %s tidak didukung", k.Crv)
+		}
+
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("panjang key Ed25519 tidak valid")
+		}
+
+		return ed25519.PublicKey(x), nil
+	}
+
+	return nil, fmt.Errorf("kty %s tidak didukung", k.Kty)
+}
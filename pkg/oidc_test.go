@@ -0,0 +1,173 @@
+package pkg
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// provider palsu, jwks nya bisa ditahan buat niru provider yang lambat
+type slowOidcServer struct {
+	server *httptest.Server
+	pub    ed25519.PublicKey
+
+	jwksHits atomic.Int64
+
+	// kalo ga nil, request jwks nunggu sampe channel nya ditutup
+	mu      sync.Mutex
+	hold    chan struct{}
+	waiting chan struct{}
+}
+
+func newSlowOidcServer(t *testing.T) *slowOidcServer {
+	t.Helper()
+
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &slowOidcServer{pub: pub}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(oidcDiscovery{
+			Issuer:                s.server.URL,
+			AuthorizationEndpoint: s.server.URL + "/authorize",
+			TokenEndpoint:         s.server.URL + "/token",
+			JwksURI:               s.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		s.jwksHits.Add(1)
+
+		s.mu.Lock()
+		hold, waiting := s.hold, s.waiting
+		s.mu.Unlock()
+
+		if hold != nil {
+			close(waiting)
+			<-hold
+		}
+
+		json.NewEncoder(w).Encode(JWKSet{Keys: []JWK{{
+			Kty: "OKP",
+			Crv: "Ed25519",
+			Kid: "k1",
+			X:   base64.RawURLEncoding.EncodeToString(s.pub),
+		}}})
+	})
+
+	s.server = httptest.NewServer(mux)
+	t.Cleanup(s.server.Close)
+
+	return s
+}
+
+func (s *slowOidcServer) holdJwks() (waiting <-chan struct{}, release func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	hold := make(chan struct{})
+	s.hold = hold
+	s.waiting = make(chan struct{})
+
+	return s.waiting, func() {
+		s.mu.Lock()
+		s.hold = nil
+		s.mu.Unlock()
+		close(hold)
+	}
+}
+
+func newTestOidcProvider(t *testing.T, s *slowOidcServer) *OidcProvider {
+	t.Helper()
+
+	p := NewOidcProvider(OidcProviderConfig{Name: "slow", Issuer: s.server.URL, ClientId: "client"})
+
+	if _, err := p.getDiscovery(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	return p
+}
+
+func TestOidcSlowJwksDoesNotBlockCachedKeys(t *testing.T) {
+
+	s := newSlowOidcServer(t)
+	p := newTestOidcProvider(t, s)
+
+	if _, err := p.publicKey(context.Background(), "k1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// jwks boleh di fetch ulang, terus fetch nya ketahan di provider
+	p.mu.Lock()
+	p.keysFetched = time.Time{}
+	p.mu.Unlock()
+
+	waiting, release := s.holdJwks()
+	defer release()
+
+	go p.publicKey(context.Background(), "kid-baru")
+	<-waiting
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := p.publicKey(context.Background(), "k1")
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("key yang udah ke cache ketahan sama fetch jwks yang lambat")
+	}
+}
+
+func TestOidcConcurrentJwksFetchOnce(t *testing.T) {
+
+	s := newSlowOidcServer(t)
+	p := newTestOidcProvider(t, s)
+
+	waiting, release := s.holdJwks()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := p.publicKey(context.Background(), "k1")
+			errs <- err
+		}()
+	}
+
+	<-waiting
+	time.Sleep(20 * time.Millisecond)
+	release()
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if hits := s.jwksHits.Load(); hits != 1 {
+		t.Errorf("jwks di fetch %d kali, harusnya sekali", hits)
+	}
+}
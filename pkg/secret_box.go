@@ -0,0 +1,85 @@
+package pkg
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"strings"
+)
+
+// prefix nya dipake buat bedain data yang udah di enkripsi sama data lama yang masih plaintext
+const secretBoxPrefix = "v1:"
+
+var ErrSecretBoxCorrupt = errors.New("data terenkripsi tidak valid")
+
+// enkripsi AES-256-GCM buat data yang harus bisa dibaca lagi (misal secret TOTP),
+// key nya dari server dan ga pernah disimpen di db
+type SecretBox struct {
+	aead cipher.AEAD
+}
+
+// key nya base64 dari 32 byte random (openssl rand -base64 32)
+func NewSecretBox(encodedKey string) (*SecretBox, error) {
+
+	if encodedKey == "" {
+		return nil, errors.New("key enkripsi belum di isi")
+	}
+
+	key, err := base64.StdEncoding.DecodeString(encodedKey)
+	if err != nil {
+		return nil, errors.New("key enkripsi harus base64 : " + err.Error())
+	}
+
+	if len(key) != 32 {
+		return nil, errors.New("key enkripsi harus 32 byte")
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SecretBox{aead: aead}, nil
+}
+
+func (b *SecretBox) Seal(plain string) (string, error) {
+
+	nonce := make([]byte, b.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := b.aead.Seal(nonce, nonce, []byte(plain), nil)
+
+	return secretBoxPrefix + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// legacy true kalo data nya masih plaintext (disimpen sebelum ada enkripsi), pemanggil sebaiknya nyimpen ulang hasil Seal nya
+func (b *SecretBox) Open(stored string) (plain string, legacy bool, err error) {
+
+	encoded, ok := strings.CutPrefix(stored, secretBoxPrefix)
+	if !ok {
+		return stored, true, nil
+	}
+
+	sealed, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < b.aead.NonceSize() {
+		return "", false, ErrSecretBoxCorrupt
+	}
+
+	nonce, ciphertext := sealed[:b.aead.NonceSize()], sealed[b.aead.NonceSize():]
+
+	out, err := b.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", false, ErrSecretBoxCorrupt
+	}
+
+	return string(out), false, nil
+}
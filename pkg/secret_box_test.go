@@ -0,0 +1,88 @@
+package pkg
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func newTestSecretBox(t *testing.T, seed byte) *SecretBox {
+	t.Helper()
+
+	key := make([]byte, 32)
+	for i := range key {
+		key[i] = seed
+	}
+
+	box, err := NewSecretBox(base64.StdEncoding.EncodeToString(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return box
+}
+
+func TestSecretBoxRoundTrip(t *testing.T) {
+
+	box := newTestSecretBox(t, 1)
+
+	sealed, err := box.Seal(rfc6238Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(sealed, rfc6238Secret) {
+		t.Fatal("secret nya masih keliatan di hasil enkripsi")
+	}
+
+	plain, legacy, err := box.Open(sealed)
+	if err != nil || legacy || plain != rfc6238Secret {
+		t.Fatalf("hasil Open %q legacy=%v err=%v", plain, legacy, err)
+	}
+
+	// nonce nya random, secret yang sama ga boleh ngasilin ciphertext yang sama
+	if again, _ := box.Seal(rfc6238Secret); again == sealed {
+		t.Error("Seal dua kali ngasilin hasil yang sama")
+	}
+}
+
+func TestSecretBoxLegacyPlaintext(t *testing.T) {
+
+	box := newTestSecretBox(t, 1)
+
+	plain, legacy, err := box.Open(rfc6238Secret)
+	if err != nil || !legacy || plain != rfc6238Secret {
+		t.Fatalf("data lama harusnya dibalikin apa adanya, dapet %q legacy=%v err=%v", plain, legacy, err)
+	}
+}
+
+func TestSecretBoxRejectsWrongKeyAndTampering(t *testing.T) {
+
+	sealed, err := newTestSecretBox(t, 1).Seal(rfc6238Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := newTestSecretBox(t, 2).Open(sealed); !errors.Is(err, ErrSecretBoxCorrupt) {
+		t.Errorf("key lain harusnya gagal, dapet %v", err)
+	}
+
+	tampered := sealed[:len(sealed)-2] + "AA"
+	if tampered == sealed {
+		tampered = sealed[:len(sealed)-2] + "BB"
+	}
+
+	if _, _, err := newTestSecretBox(t, 1).Open(tampered); !errors.Is(err, ErrSecretBoxCorrupt) {
+		t.Errorf("data yang diubah harusnya gagal, dapet %v", err)
+	}
+}
+
+func TestNewSecretBoxKeyValidation(t *testing.T) {
+
+	for _, key := range []string{"", "bukan base64!!", base64.StdEncoding.EncodeToString([]byte("pendek"))} {
+		if _, err := NewSecretBox(key); err == nil {
+			t.Errorf("key %q harusnya ditolak", key)
+		}
+	}
+}
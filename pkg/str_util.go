@@ -2,7 +2,9 @@ package pkg
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 
 	"github.com/google/uuid"
 )
@@ -35,3 +37,9 @@ func GenerateRandomStringToken(n int) (string, error) {
 
 	return base64.RawURLEncoding.EncodeToString(b), nil
 }
+
+// token mentah cuma dikirim ke user, yang disimpan di db cuma hash nya
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
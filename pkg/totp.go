@@ -0,0 +1,95 @@
+package pkg
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TOTP RFC 6238 : HMAC-SHA1, 6 digit, periode 30 detik.
+// semua fungsi nerima waktu dari luar biar bisa di test pake jam yang di fix
+const (
+	TotpPeriod = 30
+	TotpDigits = 6
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+func GenerateTotpSecret() (string, error) {
+	b := make([]byte, 20)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return totpEncoding.EncodeToString(b), nil
+}
+
+func TotpStep(t time.Time) int64 {
+	return t.Unix() / TotpPeriod
+}
+
+func TotpCodeAt(secret string, step int64) (string, error) {
+
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	bin := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	return fmt.Sprintf("%0*d", TotpDigits, bin%1000000), nil
+}
+
+// skew = jumlah step sebelum / sesudah yang masih diterima (jam hp user suka ga pas).
+// balikin step yang cocok biar pemanggil bisa nolak kode yang sama dipake 2 kali
+func VerifyTotp(secret string, code string, t time.Time, skew int64) (int64, bool) {
+
+	if len(code) != TotpDigits {
+		return 0, false
+	}
+
+	current := TotpStep(t)
+
+	for i := -skew; i <= skew; i++ {
+		expected, err := TotpCodeAt(secret, current+i)
+		if err != nil {
+			return 0, false
+		}
+
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return current + i, true
+		}
+	}
+
+	return 0, false
+}
+
+func TotpAuthURI(issuer string, account string, secret string) string {
+
+	label := url.PathEscape(issuer + ":" + account)
+
+	q := url.Values{}
+	q.Set("secret", secret)
+	q.Set("issuer", issuer)
+	q.Set("algorithm", "SHA1")
+	q.Set("digits", fmt.Sprint(TotpDigits))
+	q.Set("period", fmt.Sprint(TotpPeriod))
+
+	return "otpauth://totp/" + label + "?" + q.Encode()
+}
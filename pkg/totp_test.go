@@ -0,0 +1,63 @@
+package pkg
+
+import (
+	"testing"
+	"time"
+)
+
+// secret SHA1 dari RFC 6238 appendix B ("12345678901234567890")
+var rfc6238Secret = totpEncoding.EncodeToString([]byte("12345678901234567890"))
+
+// kode di RFC nya 8 digit, yang dipake di sini 6 digit terakhir nya
+var rfc6238Vectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "287082"},
+	{1111111109, "081804"},
+	{1111111111, "050471"},
+	{1234567890, "005924"},
+	{2000000000, "279037"},
+	{20000000000, "353130"},
+}
+
+func TestTotpCodeAtRfc6238(t *testing.T) {
+
+	for _, v := range rfc6238Vectors {
+		got, err := TotpCodeAt(rfc6238Secret, TotpStep(time.Unix(v.unix, 0)))
+		if err != nil {
+			t.Fatalf("t=%d : %v", v.unix, err)
+		}
+
+		if got != v.code {
+			t.Errorf("t=%d : kode %s, harusnya %s", v.unix, got, v.code)
+		}
+	}
+}
+
+func TestVerifyTotpSkew(t *testing.T) {
+
+	now := time.Unix(1111111111, 0)
+	current := TotpStep(now)
+
+	for _, offset := range []int64{-1, 0, 1} {
+		code, _ := TotpCodeAt(rfc6238Secret, current+offset)
+
+		step, ok := VerifyTotp(rfc6238Secret, code, now, 1)
+		if !ok || step != current+offset {
+			t.Errorf("offset %d : ok=%v step=%d, harusnya diterima di step %d", offset, ok, step, current+offset)
+		}
+	}
+
+	for _, offset := range []int64{-2, 2} {
+		code, _ := TotpCodeAt(rfc6238Secret, current+offset)
+
+		if _, ok := VerifyTotp(rfc6238Secret, code, now, 1); ok {
+			t.Errorf("offset %d : harusnya ditolak", offset)
+		}
+	}
+
+	if _, ok := VerifyTotp(rfc6238Secret, "12345", now, 1); ok {
+		t.Error("kode yang panjang nya salah harusnya ditolak")
+	}
+}